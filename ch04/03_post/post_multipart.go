@@ -1,6 +1,8 @@
 // post_multipart.go - マルチパートフォームデータを使用したHTTP POSTリクエストの例
 // multipart/form-dataフォーマットでテキストフィールドとファイルを一緒に送信します
 // このフォーマットはWebフォームでファイルアップロードを行う際に使用されます
+// ボディ全体をbytes.Bufferに作るため小さなファイル向けです。大きなファイルはボディを少しずつ組み立てて送る
+// internal/httpclientのMultipart（ch04/10_httpcliの-F）を使います
 package main
 
 import (
@@ -2,6 +2,7 @@
 // multipart/form-dataフォーマットでテキストフィールドとファイルを一緒に送信します
 // このファイルでは、textproto.MIMEHeaderを使用してContent-TypeやContent-Dispositionを
 // 明示的に設定する方法を示しています
+// ch04/10_httpcliでは-F 'photo=@file;type=image/jpeg'のように;type=でパートのContent-Typeを指定できます
 package main
 
 import (
@@ -1,20 +1,24 @@
 // cookie_client.go - Cookieを自動的に処理するHTTPクライアントの例
 // HTTPリクエスト間でCookieを保持し、自動的に送信する方法を示します
 // サーバーが最初のレスポンスでCookieを設定すると、次のリクエストで自動的に送信されます
+// CookieはNetscape形式のファイル（cookies.txt）に保存されるため、実行し直しても訪問回数が続きから増えます
 package main
 
 import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/cookiejar"
 	"net/http/httputil"
 	"net/url"
+
+	"real-world-http-learn/internal/httpclient"
 )
 
 func main() {
 	// Cookieを保存するためのCookieJarを作成
-	jar, err := cookiejar.New(nil)
+	// net/http/cookiejarはメモリ上にしか保持しないため、ファイルに保存できるhttpclient.Jarを使う
+	// （ファイルがなければ空のJarになる。.jsonの名前にするとJSON形式で保存される）
+	jar, err := httpclient.OpenJar("cookies.txt")
 	if err != nil {
 		panic(err)
 	}
@@ -70,4 +74,9 @@ func main() {
 		}
 		fmt.Println(string(respDump))
 	}
+
+	// 受け取ったCookieをファイルに書き戻す（次回の実行で読み込まれる）
+	if err := jar.Save(); err != nil {
+		panic(err)
+	}
 }
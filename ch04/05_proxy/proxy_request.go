@@ -1,6 +1,9 @@
 // proxy_request.go - プロキシを使用したHTTP GETリクエストの例
 // プロキシサーバーを経由してHTTPリクエストを送信する方法を示します
 // プロキシは、クライアントとサーバーの間に位置し、リクエストを中継する役割を果たします
+// server.go を -proxy 付きで起動すると、リクエストを実際に転送先へ中継します（なければ内容を表示するだけ）
+// ここではプロキシを 1 つに決め打ちしています。宛先ごとに PAC や NO_PROXY で選ぶ場合は
+// httpclient.ProxyConfig（httpcli の --pac / --noproxy）を Transport.Proxy に使います
 package main
 
 import (
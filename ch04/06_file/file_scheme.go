@@ -1,48 +1,85 @@
-// file_scheme.go - ローカルファイルにアクセスするHTTPクライアントの例
-// file://スキームを使用してローカルファイルシステム上のファイルを読み込む方法を示します
-// 通常のHTTPクライアントを使用して、ネットワーク経由ではなくファイルシステムから直接ファイルを取得できます
+// file_scheme.go - HTTP 以外のスキーム（file・data・embed）にアクセスするHTTPクライアントの例
+// Transport.RegisterProtocol でスキームごとの RoundTripper を登録すると、
+// 通常のHTTPクライアントのコードのまま、ネットワークではなくファイルや URL そのものから中身を取得できます。
+// httpclient.Protocols は Range・If-Modified-Since などにも HTTP のサーバーと同じステータスとヘッダで応答するため、
+// 同じクライアントのコードをテスト用のフィクスチャにも実際のサーバーにも使えます
 package main
 
 import (
+	"embed"
 	"log"
 	"net/http"
 	"net/http/httputil"
+
+	"real-world-http-learn/internal/httpclient"
 )
 
+// fixtures はバイナリに埋め込んだファイルで、embed:///fixtures/... で取得します
+//
+//go:embed fixtures
+var fixtures embed.FS
+
 func main() {
 	// カスタムトランスポートを作成
 	transport := &http.Transport{}
 
-	// "file"プロトコルハンドラを登録
-	// http.Dir(".")は現在のディレクトリをルートとするファイルシステムを指定
-	// http.NewFileTransportはファイルシステムからファイルを提供するトランスポートを作成
-	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir(".")))
+	// スキームごとのプロトコルハンドラを登録
+	// file は現在のディレクトリをルートとするファイルシステム（http.NewFileTransport(http.Dir(".")) の代わり）、
+	// data は URL に埋め込まれたデータ（RFC 2397）、embed は embed.FS のファイルを返します
+	httpclient.Protocols{
+		"file":  httpclient.NewFileTransport("."),
+		"data":  httpclient.DataTransport{},
+		"embed": &httpclient.FSTransport{FS: fixtures},
+	}.Install(transport)
 
 	// カスタムトランスポートを使用するHTTPクライアントを作成
-	// このクライアントは"file://"スキームを使用したURLを処理できるようになります
 	client := http.Client{
 		Transport: transport,
 	}
 
-	// ローカルファイルにHTTP GETリクエストを送信
 	// "file://./main.go"は現在のディレクトリ内のmain.goファイルを指定
+	// Range ヘッダを付けると、サーバーと同じく 206 Partial Content で先頭の 64 バイトだけが返ります
+	req, err := http.NewRequest("GET", "file://./main.go", nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Range", "bytes=0-63")
+	dump(client.Do(req))
+
+	// 前回の Last-Modified を If-Modified-Since に付けると 304 Not Modified が返ります
 	resp, err := client.Get("file://./main.go")
 	if err != nil {
-		// ファイルアクセスに失敗した場合はパニック
 		panic(err)
 	}
+	resp.Body.Close()
+	req, err = http.NewRequest("GET", "file://./main.go", nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("If-Modified-Since", resp.Header.Get("Last-Modified"))
+	dump(client.Do(req))
+
+	// data: の URL はメディアタイプと base64 でエンコードした中身をそのまま返します
+	dump(client.Get("data:text/plain;charset=utf-8;base64,44GT44KT44Gr44Gh44Gv"))
 
-	// 注意: 本来はrespがnilでないことを確認し、defer resp.Body.Close()を呼び出すべき
-	// 接続リソースをリークさせないために、レスポンスボディは必ず閉じる必要があります
+	// embed.FS には更新時刻がないため、内容のハッシュが ETag になります
+	dump(client.Get("embed:///fixtures/hello.json"))
 
-	// レスポンス全体（ヘッダーとボディ）をダンプ
-	// ボディにはファイルの内容が含まれます
-	dump, err := httputil.DumpResponse(resp, true)
+	// 存在しないファイルは 404 Not Found になります
+	dump(client.Get("file://./not-found.txt"))
+}
+
+// dump はレスポンス全体（ヘッダーとボディ）をダンプします
+func dump(resp *http.Response, err error) {
+	if err != nil {
+		// ファイルアクセスに失敗した場合はパニック
+		panic(err)
+	}
+	defer resp.Body.Close()
+	d, err := httputil.DumpResponse(resp, true)
 	if err != nil {
 		// レスポンスのダンプに失敗した場合はパニック
 		panic(err)
 	}
-
-	// ダンプしたレスポンスを文字列として出力
-	log.Println(string(dump))
+	log.Println(string(d))
 }
@@ -1,11 +1,18 @@
 // idn_convert.go - 国際化ドメイン名（IDN）の変換例
 // IDNAを使用して非ASCII文字（日本語など）をASCII文字に変換する方法を示します
 // 国際化ドメイン名は、Punycode形式でエンコードされ、"xn--"プレフィックスで始まります
+//
+// idnurl パッケージは URL 全体のホストを UTS #46 で変換し、表示用に Unicode へ戻します。
+// ラベルごとに用字の混在や紛らわしい文字（ホモグラフ攻撃）を調べ、問題のあるラベルを理由付きで返します
 package main
 
 import (
+	"errors"
 	"fmt"
+
 	"golang.org/x/net/idna"
+
+	"real-world-http-learn/internal/idnurl"
 )
 
 func main() {
@@ -22,6 +29,64 @@ func main() {
 	}
 
 	// 元の文字列と変換後のASCII文字列を表示
-	// 出力例: "爆竜戦隊アバレンジャー -> xn--n8jvkxa8fv5evkbn1rh87atj9b"
+	// 出力例: "爆竜戦隊アバレンジャー -> xn--cck1bxdudyb2b0dy530d933akqsct3e"
 	fmt.Printf("%s -> %s\n", src, ascii)
+
+	// ユーザーが入力した URL をそのまま正規化する
+	// 全角英数字は半角・小文字に、「。」はドットになり、パスとクエリの日本語はパーセントエンコードされます
+	fmt.Println("\n--- URL の正規化（Lookup） ---")
+	for _, raw := range []string{
+		"https://日本語。ＪＰ/パス?q=検索",
+		"ＥＸＡＭＰＬＥ．ｃｏｍ/ドキュメント",
+		"http://例え.テスト:8080/",
+	} {
+		res, err := idnurl.Parse(raw, idnurl.Lookup)
+		if err != nil {
+			fmt.Printf("%s\n  エラー: %v\n", raw, err)
+			continue
+		}
+		fmt.Printf("%s\n  -> %s\n  表示: %s\n", raw, res, res.Display())
+	}
+
+	// プロファイルの違い: Registration は登録できるラベルかを厳しく調べ、
+	// 全角のドットや大文字などの対応付け（マッピング）をしません
+	fmt.Println("\n--- プロファイルの違い ---")
+	for _, profile := range []idnurl.Profile{idnurl.Lookup, idnurl.Registration, idnurl.Display} {
+		res, err := idnurl.Parse("http://bücher。example/", profile)
+		if err != nil {
+			fmt.Printf("%-12s エラー: %v\n", profile, err)
+			continue
+		}
+		fmt.Printf("%-12s %s（表示: %s）\n", profile, res, res.Display())
+	}
+
+	// ホモグラフ攻撃の検出: 見た目は同じでも別のドメインになるラベルはエラーになります
+	fmt.Println("\n--- 紛らわしいドメイン名の検出 ---")
+	for _, raw := range []string{
+		"https://www.аpple.com/", // 先頭の "а" はキリル文字
+		"https://аррӏе.com/",     // すべてキリル文字で "apple" に見える
+		"https://エ場.jp/",         // 先頭はカタカナの「エ」で、漢字の「工」に見える
+		"https://工場.jp/",         // 正しい漢字だけのラベルは問題ない
+	} {
+		res, err := idnurl.Parse(raw, idnurl.Lookup)
+		var idnErr *idnurl.Error
+		switch {
+		case errors.As(err, &idnErr):
+			for _, label := range idnErr.Labels {
+				fmt.Printf("%s\n  %v\n", raw, label)
+			}
+		case err != nil:
+			fmt.Printf("%s\n  エラー: %v\n", raw, err)
+		default:
+			fmt.Printf("%s\n  -> %s\n", raw, res)
+		}
+	}
+
+	// Display プロファイルはエラーにせず、紛らわしいラベルだけを Punycode のまま表示します
+	// （ブラウザのアドレスバーと同じ考え方）
+	fmt.Println("\n--- 表示用の変換 ---")
+	for _, raw := range []string{"https://xn--r8jz45g.xn--zckzah/", "https://www.xn--pple-43d.com/"} {
+		res, _ := idnurl.Parse(raw, idnurl.Display)
+		fmt.Printf("%s\n  表示: %s\n", raw, res.Display())
+	}
 }
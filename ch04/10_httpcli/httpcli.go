@@ -0,0 +1,415 @@
+// httpcli.go - ch04 の各サンプルをまとめた curl 風の HTTP クライアント
+// メソッド・ヘッダ・フォーム・multipart・Cookie・プロキシ・file / data スキームをフラグで切り替えられます
+// 処理の本体は internal/httpclient にあり、このファイルはフラグの解釈と出力だけを担当します
+//
+//	go run ch04/10_httpcli/httpcli.go -v http://localhost:18888
+//	go run ch04/10_httpcli/httpcli.go -F name="Stevie Wonder" -F thumbnail=@ch04/03_post/hello_world_small.jpg
+//	go run ch04/10_httpcli/httpcli.go -c cookies.txt http://localhost:18888/cookie  # 実行のたびに訪問回数が増える
+//	go run ch04/10_httpcli/httpcli.go --trace text -o /dev/null https://example.com  # curl -w のような時間の内訳
+//	go run ch04/10_httpcli/httpcli.go -v --anyauth -u alice:secret http://localhost:18888/auth/  # 401 のチャレンジに Digest で応じる
+//	go run ch04/10_httpcli/httpcli.go -v --cache-dir /tmp/httpcache http://localhost:18062/file -o /dev/null  # 2 回目はキャッシュから返す
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"real-world-http-learn/internal/httpauth"
+	"real-world-http-learn/internal/httpclient"
+	"real-world-http-learn/internal/idnurl"
+)
+
+// defaultURL は URL を省略したときの送信先（server.go）です。
+const defaultURL = "http://localhost:18888"
+
+// listFlag は繰り返し指定できるフラグです。
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+func main() {
+	log.SetFlags(0)
+	var (
+		headers, data, binary, urlencode, forms listFlag
+
+		method, cookie, cookieJar, cacheDir, traceFormat, proxy, noProxy, pacFile, user, bearer, agent, referer, output, fileRoot, filenameEncoding string
+
+		getFlag, head, location, locationTrusted, sameOrigin, post301, post302, post303, include, verbose, insecure, progress, compressed, digest, anyAuth bool
+
+		maxRedirs, retries  int
+		maxTime, retryDelay time.Duration
+	)
+	// curl と同じく 1 文字のフラグと長い名前の両方を受け付ける
+	str := func(p *string, value, usage string, names ...string) {
+		for _, n := range names {
+			flag.StringVar(p, n, value, usage)
+		}
+	}
+	boolean := func(p *bool, usage string, names ...string) {
+		for _, n := range names {
+			flag.BoolVar(p, n, false, usage)
+		}
+	}
+	list := func(p *listFlag, usage string, names ...string) {
+		for _, n := range names {
+			flag.Var(p, n, usage)
+		}
+	}
+	str(&method, "", "メソッド（省略時は GET、ボディがあれば POST）", "X", "request")
+	list(&headers, "ヘッダ（\"Name: value\"。繰り返し指定可）", "H", "header")
+	list(&data, "application/x-www-form-urlencoded のデータ（\"@file\" でファイルから。繰り返し指定可）", "d", "data")
+	list(&binary, "データをそのまま送る（\"@file\" の改行も取り除かない）", "data-binary")
+	list(&urlencode, "値をパーセントエンコードして送る（\"name=value\"・\"name@file\"）", "data-urlencode")
+	list(&forms, "multipart/form-data のフィールド（\"name=value\"・\"name=@file;type=mime\"）", "F", "form")
+	str(&filenameEncoding, "utf8", "-F のファイル名の書き方（utf8 / percent）", "filename-encoding")
+	boolean(&progress, "-F の送信の進み具合を標準エラー出力に表示する", "progress")
+	boolean(&getFlag, "-d のデータをクエリパラメータとして GET で送る", "G", "get")
+	boolean(&head, "HEAD メソッドでヘッダだけを取得する", "I", "head")
+	boolean(&location, "リダイレクトを追う", "L", "location")
+	boolean(&locationTrusted, "-L で別のオリジンへ移っても Authorization を送る", "location-trusted")
+	flag.IntVar(&maxRedirs, "max-redirs", 10, "-L で追うリダイレクトの上限")
+	boolean(&sameOrigin, "-L で別のオリジンへのリダイレクトをエラーにする", "same-origin")
+	boolean(&post301, "301 でもメソッドとボディを変えずに追う", "post301")
+	boolean(&post302, "302 でもメソッドとボディを変えずに追う", "post302")
+	boolean(&post303, "303 でもメソッドとボディを変えずに追う", "post303")
+	str(&cookie, "", "送る Cookie（\"name=value; name2=value2\"）または読み込む Cookie ファイル", "b", "cookie")
+	str(&cookieJar, "", "Cookie を読み書きするファイル（.json なら JSON、それ以外は Netscape 形式）", "c", "cookie-jar")
+	str(&cacheDir, "", "レスポンスを保存して使い回すディレクトリ（Cache-Control・ETag に従う。実行をまたいで残る）", "cache-dir")
+	str(&proxy, "", "プロキシの URL（例: http://localhost:18888）", "x", "proxy")
+	str(&noProxy, "", "プロキシを使わないホスト（NO_PROXY 形式。例: localhost,.internal,10.0.0.0/8）", "noproxy")
+	str(&pacFile, "", "プロキシ自動設定（PAC）ファイルのパスか URL", "pac")
+	str(&user, "", "Basic 認証のユーザーとパスワード（\"user:password\"）", "u", "user")
+	boolean(&digest, "-u のユーザーで、401 の Digest 認証のチャレンジに応じる", "digest")
+	boolean(&anyAuth, "-u のユーザーで、401 のチャレンジのうち最も安全な方式（Digest・Basic）に応じる", "anyauth")
+	str(&bearer, "", "Authorization: Bearer で送るアクセストークン", "oauth2-bearer")
+	str(&agent, "", "User-Agent", "A", "user-agent")
+	str(&referer, "", "Referer", "e", "referer")
+	str(&output, "", "ボディの書き出し先ファイル（省略時は標準出力）", "o", "output")
+	str(&fileRoot, ".", "file:// で読むファイルのルートディレクトリ", "file-root")
+	boolean(&compressed, "Accept-Encoding（zstd・br・gzip・deflate）を送り、圧縮されたボディを展開する（-v で圧縮率を表示）", "compressed")
+	boolean(&include, "レスポンスヘッダも出力する", "i", "include")
+	boolean(&verbose, "送受信するヘッダを標準エラー出力にダンプする", "v", "verbose")
+	boolean(&insecure, "サーバー証明書を検証しない", "k", "insecure")
+	str(&traceFormat, "", "往復ごとの DNS・接続・TLS・最初のバイトまでの時間を標準エラー出力に書く（text / json）", "trace")
+	flag.IntVar(&retries, "retry", 0, "接続エラーや 429・502・503・504 を再試行する回数（冪等なメソッドと Idempotency-Key 付きの POST だけ）")
+	flag.DurationVar(&retryDelay, "retry-delay", 0, "最初の再試行までの待ち時間の上限（1 回ごとに倍にする。省略時は 200ms）")
+	flag.DurationVar(&maxTime, "m", 0, "リクエスト全体のタイムアウト（例: 10s）")
+	flag.DurationVar(&maxTime, "max-time", 0, "リクエスト全体のタイムアウト（例: 10s）")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: httpcli [flags] [URL]（URL の省略時は %s）\n", defaultURL)
+		flag.PrintDefaults()
+	}
+
+	target := parseArgs()
+	if target == "" || strings.HasPrefix(target, "/") {
+		// パスだけなら server.go へ送る
+		target = defaultURL + target
+	}
+	// HTTP の URL のホストは UTS #46 で正規化する（全角文字や「。」を含む日本語のドメインを入力どおりに使え、
+	// キリル文字で英字を装ったような紛らわしいホストはラベルごとの理由を付けてエラーにする）
+	if lower := strings.ToLower(target); strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+		!strings.Contains(lower, "://") && !strings.HasPrefix(lower, "data:") {
+		res, err := idnurl.Parse(target, idnurl.Lookup)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if verbose && res.Host != strings.ToLower(res.DisplayHost) {
+			fmt.Fprintf(os.Stderr, "* IDN: %s → %s\n", res.Display(), res)
+		}
+		target = res.String()
+	}
+
+	// クライアントの準備
+	var err error
+	opts := httpclient.Options{
+		Proxy:           proxy,
+		NoProxy:         noProxy,
+		PAC:             pacFile,
+		Timeout:         maxTime,
+		FollowRedirects: location || locationTrusted,
+		Redirect: httpclient.RedirectPolicy{
+			MaxHops:         maxRedirs,
+			SameOrigin:      sameOrigin,
+			KeepCredentials: locationTrusted,
+		},
+		Retry:    httpclient.RetryPolicy{MaxRetries: retries, BaseDelay: retryDelay},
+		Insecure: insecure,
+		FileRoot: fileRoot,
+	}
+	// curl と同じく、307・308 のほかに --post30x で指定したステータスでもメソッドを変えない
+	if post301 || post302 || post303 {
+		opts.Redirect.KeepMethod = []int{http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
+		for code, keep := range map[int]bool{http.StatusMovedPermanently: post301, http.StatusFound: post302, http.StatusSeeOther: post303} {
+			if keep {
+				opts.Redirect.KeepMethod = append(opts.Redirect.KeepMethod, code)
+			}
+		}
+	}
+	if verbose {
+		opts.Verbose = os.Stderr
+	}
+	// -c は読み書きする Cookie ファイル、-b は "name=value" なら送る Cookie、それ以外は読み込むだけのファイル
+	var jar *httpclient.Jar
+	if cookieJar != "" {
+		if jar, err = httpclient.OpenJar(cookieJar); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cookie != "" && !strings.Contains(cookie, "=") {
+		if jar == nil {
+			jar = httpclient.NewJar()
+		}
+		if err := jar.Load(cookie); err != nil {
+			log.Fatal(err)
+		}
+		cookie = ""
+	}
+	if jar != nil {
+		opts.Jar = jar
+	}
+	if traceFormat != "" {
+		opts.Tracer = &httpclient.Tracer{}
+		if opts.Tracer.OnTrace, err = httpclient.TraceWriter(os.Stderr, traceFormat); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// -u だけなら curl と同じく最初から Basic で送り、--digest・--anyauth・--oauth2-bearer では 401 のチャレンジに応じる
+	if digest || anyAuth || bearer != "" {
+		auth := &httpclient.Auth{}
+		if digest || anyAuth {
+			auth.Username, auth.Password, _ = strings.Cut(user, ":")
+			user = ""
+		}
+		if digest {
+			auth.Schemes = []string{httpauth.Digest}
+		}
+		if bearer != "" {
+			auth.Token = func(context.Context) (string, error) { return bearer, nil }
+		}
+		if !locationTrusted {
+			// リダイレクトで別のオリジンへ移ったら資格情報を送らない
+			origin := target
+			if !strings.Contains(origin, "://") {
+				origin = "http://" + origin
+			}
+			if u, err := url.Parse(origin); err == nil {
+				auth.Origin = u.Scheme + "://" + u.Host
+			}
+		}
+		opts.Auth = auth
+	}
+	if compressed {
+		opts.Decoder = &httpclient.Decoder{}
+	}
+	if cacheDir != "" {
+		if opts.Cache, err = httpclient.NewDiskCacheStore(cacheDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	client, err := httpclient.New(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// リクエストの組み立て
+	u, err := url.Parse(target)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if u.Scheme == "" {
+		u, err = url.Parse("http://" + target)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	body := &httpclient.Body{Length: 0}
+	hasData := len(data)+len(binary)+len(urlencode) > 0
+	switch {
+	case hasData && len(forms) > 0:
+		log.Fatal("-d 系のフラグと -F は同時に指定できません")
+	case hasData:
+		encoded, err := httpclient.Data(data, binary, urlencode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if getFlag {
+			if u.RawQuery != "" {
+				encoded = u.RawQuery + "&" + encoded
+			}
+			u.RawQuery = encoded
+		} else {
+			body = &httpclient.Body{Reader: strings.NewReader(encoded), ContentType: "application/x-www-form-urlencoded", Length: int64(len(encoded))}
+		}
+	case len(forms) > 0:
+		fields := make([]httpclient.FormField, 0, len(forms))
+		for _, arg := range forms {
+			f, err := httpclient.ParseFormField(arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fields = append(fields, f)
+		}
+		mopts := httpclient.MultipartOptions{FilenameEncoding: filenameEncoding}
+		if progress {
+			mopts.Progress = newProgress(os.Stderr)
+		}
+		if body, err = httpclient.Multipart(fields, mopts); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	switch {
+	case method != "":
+	case head:
+		method = http.MethodHead
+	case body.Reader != nil:
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, u.String(), body.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if body.Reader != nil {
+		req.ContentLength = body.Length
+		// strings.Reader などのボディは http.NewRequest が GetBody を設定済み（307・308 で送り直すのに使う）
+		if body.GetBody != nil {
+			req.GetBody = body.GetBody
+		}
+		req.Header.Set("Content-Type", body.ContentType)
+	}
+	if agent != "" {
+		req.Header.Set("User-Agent", agent)
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	if user != "" {
+		name, password, _ := strings.Cut(user, ":")
+		req.SetBasicAuth(name, password)
+	}
+	if cookie != "" {
+		req.Header.Add("Cookie", cookie)
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			log.Fatalf("ヘッダ %q は \"Name: value\" の形式で指定してください", h)
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			// curl と同じく "Name:" は既定のヘッダを消す指定とする
+			// （User-Agent は空の値にしないと net/http が既定値を付ける）
+			req.Header.Del(name)
+			if http.CanonicalHeaderKey(name) == "User-Agent" {
+				req.Header.Set(name, "")
+			}
+			continue
+		}
+		req.Header.Add(name, value)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	// 送信と出力
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if include || head {
+		writeHeader(out, resp)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		log.Fatal(err)
+	}
+	if cookieJar != "" {
+		if err := jar.Save(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// parseArgs はフラグを解釈して URL を返します。
+// curl と同じく URL の後ろに書いたフラグも受け付けます。
+func parseArgs() string {
+	var target string
+	args := os.Args[1:]
+	for {
+		if err := flag.CommandLine.Parse(args); err != nil {
+			os.Exit(2)
+		}
+		rest := flag.Args()
+		if len(rest) == 0 {
+			return target
+		}
+		if target != "" {
+			log.Fatalf("URL は 1 つだけ指定してください: %q, %q", target, rest[0])
+		}
+		target, args = rest[0], rest[1:]
+	}
+}
+
+// writeHeader はステータス行とヘッダを HTTP の書式で書きます（-i / -I）。
+func writeHeader(w io.Writer, resp *http.Response) {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(bw)
+	bw.WriteString("\r\n")
+	bw.Flush()
+}
+
+// newProgress は送信済みのバイト数を 1 行で上書き表示する関数を返します（--progress）。
+func newProgress(w io.Writer) func(sent, total int64) {
+	var last time.Time
+	return func(sent, total int64) {
+		done := sent == total
+		if !done && time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		if total < 0 {
+			fmt.Fprintf(w, "\r送信 %s", byteSize(sent))
+		} else {
+			fmt.Fprintf(w, "\r送信 %s / %s（%d%%）", byteSize(sent), byteSize(total), sent*100/max(total, 1))
+		}
+		if done {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,5 +1,7 @@
 // ch06/02_resume_range/server_resume_range.go
 // 1つのサーバーに Range/If-Range/複数範囲/Accept-Ranges: none/gzip を集約したデモ実装。
+// 強い ETag と Last-Modified を返し、If-None-Match/If-Modified-Since には 304 で応えるので、
+// クライアントのキャッシュ（internal/httpclient の Cache）の再検証も試せます（?cc= で Cache-Control を指定）。
 // ブラウザだけで確認できる UI も同梱します。
 package main
 
@@ -138,6 +140,7 @@ func uiIndex(w http.ResponseWriter, r *http.Request) {
   <li><code>GET /file_gzip</code> … Content-Encoding: gzip（圧縮後バイトに対する Range）</li>
   <li><code>GET /file_none</code> … Accept-Ranges: none（Range 無視）</li>
   <li><code>GET /flip_etag</code> … ETag/Last-Modified を変更して If-Range 不一致を発生させる</li>
+  <li><code>?cc=max-age=60</code> … 上の 3 つに Cache-Control を付ける（If-None-Match/If-Modified-Since には 304 を返す）</li>
 </ul>
 `)
 }
@@ -150,6 +153,9 @@ func handleFile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Accept-Ranges", "bytes")
 	w.Header().Set("ETag", etag)
 	w.Header().Set("Last-Modified", lm.UTC().Format(http.TimeFormat))
+	if notModified(w, r, etag, lm) {
+		return
+	}
 
 	if r.Method == http.MethodHead {
 		w.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
@@ -221,6 +227,9 @@ func handleFileGzip(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Accept-Ranges", "bytes")
 	w.Header().Set("ETag", etag)
 	w.Header().Set("Last-Modified", lm.UTC().Format(http.TimeFormat))
+	if notModified(w, r, etag, lm) {
+		return
+	}
 
 	gzTotal := int64(len(gzipBytes))
 	if r.Method == http.MethodHead {
@@ -282,12 +291,45 @@ func handleFileNone(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Accept-Ranges", "none")
 	w.Header().Set("ETag", contentETag)
 	w.Header().Set("Last-Modified", lastMod.UTC().Format(http.TimeFormat))
+	if notModified(w, r, contentETag, lastMod) {
+		return
+	}
 	w.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(content)
 }
 
 // ------------- ユーティリティ -------------
+// notModified は ?cc= の Cache-Control を付け、条件付きリクエストが現行バージョンと一致すれば 304 を返します。
+// If-None-Match があれば ETag を弱い比較で照合し、なければ If-Modified-Since を秒単位で比べます（RFC 9110 13.2.2）。
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lm time.Time) bool {
+	if cc := r.URL.Query().Get("cc"); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	match := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				match = true
+			}
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		match = !lm.Truncate(time.Second).After(ims)
+	}
+	if !match {
+		return false
+	}
+	// 304 にはボディを表すヘッダを付けない
+	w.Header().Del("Content-Type")
+	w.Header().Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
 func strongETag(b []byte) string {
 	sum := sha256.Sum256(b)
 	return "\"" + hex.EncodeToString(sum[:]) + "\""
@@ -8,6 +8,9 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,7 +27,7 @@ func main() {
 	mux.HandleFunc("/json", handleJSON)                  // GET: JSON を返す（HttpOnly Cookie 付与）
 	mux.HandleFunc("/echo", handleEcho)                  // 任意メソッド: 送られた内容/ヘッダ/クッキーを JSON で反射
 	mux.HandleFunc("/upload", handleUpload)              // POST: multipart/form-data を受信して要約を返す
-	mux.HandleFunc("/redirect", handleRedirect)          // GET: 302 → /json
+	mux.HandleFunc("/redirect", handleRedirect)          // GET: 302 → /json（?status=307&to=/echo&n=3 で変更可）
 	mux.HandleFunc("/headers", handleHeaders)            // GET: リクエストヘッダを JSON で返す
 	mux.HandleFunc("/poll", handlePoll)                  // GET: 簡易ポーリング（現在時刻）
 	mux.HandleFunc("/set_cookie", handleSetCookie)       // GET: 非 HttpOnly Cookie 設定（document.cookie 実験用）
@@ -142,8 +145,37 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleRedirect は /json へ 302 でリダイレクトします。クエリで次の値を変えられます（クライアントのリダイレクトの追い方の確認用）。
+//   - status: 301・302・303・307・308 のいずれか
+//   - to: リダイレクト先（パスか、localhost の別ポートの絶対 URL。オープンリダイレクトにならないようそれ以外は 400）
+//   - n: リダイレクトを繰り返す回数（/redirect?n=2 → /redirect?n=1 → to）
 func handleRedirect(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/json", http.StatusFound) // 302
+	q := r.URL.Query()
+	status := http.StatusFound // 302
+	if s := q.Get("status"); s != "" {
+		code, err := strconv.Atoi(s)
+		if err != nil || !slices.Contains([]int{301, 302, 303, 307, 308}, code) {
+			http.Error(w, "status must be 301, 302, 303, 307 or 308", http.StatusBadRequest)
+			return
+		}
+		status = code
+	}
+	to := "/json"
+	if t := q.Get("to"); t != "" {
+		u, err := url.Parse(t)
+		local := err == nil && (u.Host == "" && strings.HasPrefix(t, "/") && !strings.HasPrefix(t, "//") && !strings.HasPrefix(t, "/\\") ||
+			(u.Scheme == "http" || u.Scheme == "https") && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1"))
+		if !local {
+			http.Error(w, "to must be a path or a localhost URL", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if n, _ := strconv.Atoi(q.Get("n")); n > 1 {
+		q.Set("n", strconv.Itoa(n-1))
+		to = "/redirect?" + q.Encode()
+	}
+	http.Redirect(w, r, to, status)
 }
 
 func handleHeaders(w http.ResponseWriter, r *http.Request) {
@@ -2,14 +2,14 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/http/httptrace"
 	"os"
 	"time"
+
+	"real-world-http-learn/internal/httpclient"
 )
 
 // このサンプルは、Keep-Alive（接続再利用）を観察するための最小限の HTTP/1.1 クライアントです。
@@ -18,6 +18,9 @@ import (
 // - 同じサーバーに複数のリクエストを送る際、既存の TCP 接続を再利用してハンドシェイクのコストを省けます。
 // - Go の http.Transport は既定で永続接続を有効にします。レスポンスボディを最後まで読み取り Close された接続のみが、再利用のためにプールへ戻されます。
 // - このサンプルは httptrace の GotConn を用いて、Reused / WasIdle / IdleTime などのフィールドを観察します。
+// - GotConn を含む各フックは internal/httpclient の Tracer がまとめて記録し、DNS・TCP 接続・最初のバイトまでの時間も表示します。
+// - 再利用した接続では DNS と TCP 接続の段階がなくなる（time_namelookup・time_connect が 0 になる）ことを確認できます。
+// - 多数のリクエストでの差は cmd/loadgen の -keepalive=false と比べると、新しい接続の数とレイテンシの分布で確認できます。
 //
 // 再利用の前提条件:
 // - resp.Body を EOF まで読み、その後に Close すること（このコードでは io.ReadAll と defer Close を使用）。
@@ -47,22 +50,14 @@ func main() {
 		// DisableKeepAlives: false, // 既定は false（Keep-Alive 有効）
 	}
 
-	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	// Tracer で Transport を包むと、リクエストごとに httptrace のフックが設定される
+	tracer := &httpclient.Tracer{}
+	client := &http.Client{Transport: tracer.Transport(transport), Timeout: 10 * time.Second}
 
 	// 接続再利用を観察するために複数回の GET を送信
 	for i := 1; i <= 5; i++ {
 		func(i int) {
-			// httptrace を使って接続取得時の情報を取得する
-			var gotConnInfo httptrace.GotConnInfo
-			trace := &httptrace.ClientTrace{
-				GotConn: func(info httptrace.GotConnInfo) {
-					gotConnInfo = info
-				},
-			}
-
-			// このリクエスト用のトレースを含む context を作成
-			ctx := httptrace.WithClientTrace(context.Background(), trace)
-			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			req, err := http.NewRequest(http.MethodGet, url, nil)
 			if err != nil {
 				log.Fatalf("failed to create request: %v", err)
 			}
@@ -87,8 +82,12 @@ func main() {
 				snippet = snippet[:80] + "..."
 			}
 
-			fmt.Printf("[%d] status=%s reused=%t was_idle=%t idle_time=%s\n", i, resp.Status, gotConnInfo.Reused, gotConnInfo.WasIdle, gotConnInfo.IdleTime)
+			// ボディを最後まで読んだ時点で、この往復の記録が Traces に加わる
+			traces := tracer.Traces()
+			trace := traces[len(traces)-1]
+			fmt.Printf("[%d] status=%s reused=%t was_idle=%t idle_time=%s\n", i, resp.Status, trace.Reused, trace.WasIdle, trace.IdleTime)
 			fmt.Printf("[%d] body: %s\n", i, snippet)
+			fmt.Printf("[%d] %s\n", i, trace)
 		}(i)
 
 		// アイドル期間を作るため、次のリクエスト前に少し待機
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"flag"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -16,7 +17,11 @@ import (
 // - tls.Config.ClientSessionCache を有効化
 // - DisableKeepAlives=true で毎回新規 TCP/TLS ハンドシェイクを実行
 // - 同一サーバーに複数回接続し、2 回目以降で resp.TLS.DidResume==true を観測
+// - --trace text で、再開した回の TLS ハンドシェイク（time_appconnect までの差）が短くなることを確認
 func main() {
+	traceFormat := flag.String("trace", "", "通信の時間の内訳を標準エラー出力に書く（text / json）")
+	flag.Parse()
+
 	// 自前 CA を読み込む（実行時の作業ディレクトリは ch07/02_tls を想定）
 	caPEM, err := os.ReadFile("ca/certs/ca.crt")
 	if err != nil {
@@ -36,9 +41,12 @@ func main() {
 	}
 
 	// 毎回新規接続を張る（各リクエストで新規ハンドシェイクを発生させる）
-	tr := &http.Transport{
+	tr, err := tlsutil.TraceTransport(&http.Transport{
 		TLSClientConfig:   tlsConf,
 		DisableKeepAlives: true,
+	}, *traceFormat)
+	if err != nil {
+		log.Fatal(err)
 	}
 	client := &http.Client{Transport: tr}
 
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"flag"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -15,7 +16,11 @@ import (
 //   - ch07/02_tls/ca/certs/ca.crt を RootCAs に読み込み、サーバー証明書の検証を有効にします。
 //   - SNI/ホスト名検証については、tls.Config.ServerName に "localhost" を明示します
 //     （http.Client は通常 URL のホスト名を自動設定しますが、学習用に明示）。
+//   - --trace text（または json）で DNS・TCP 接続・TLS ハンドシェイク・最初のバイトまでの時間を表示します。
 func main() {
+	traceFormat := flag.String("trace", "", "通信の時間の内訳を標準エラー出力に書く（text / json）")
+	flag.Parse()
+
 	// CA 証明書を読み込む（実行ディレクトリは ch07/02_tls を想定）
 	cert, err := os.ReadFile("ca/certs/ca.crt")
 	if err != nil {
@@ -35,11 +40,13 @@ func main() {
 	// クライアントでは使用しません。
 
 	// クライアントを作成（Transport に TLS 設定を適用）
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+	transport, err := tlsutil.TraceTransport(&http.Transport{
+		TLSClientConfig: tlsConfig,
+	}, *traceFormat)
+	if err != nil {
+		panic(err)
 	}
+	client := &http.Client{Transport: transport}
 
 	// 通信を行う
 	resp, err := client.Get("https://localhost:18443")
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"flag"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -15,8 +16,12 @@ import (
 // - 自身のクライアント証明書/秘密鍵を提示（client/certs/client.crt と client/private/client.key）
 // - サーバー検証のため、CA 証明書（ca/certs/ca.crt）を RootCAs に追加
 // - ホスト名検証のため ServerName に "localhost" を設定
+// - --trace text（または json）で、クライアント証明書を送る分も含めた TLS ハンドシェイクの時間を表示
 // 実行は ch07/02_tls をカレントディレクトリにして行う前提です。
 func main() {
+	traceFormat := flag.String("trace", "", "通信の時間の内訳を標準エラー出力に書く（text / json）")
+	flag.Parse()
+
 	// 1) クライアント証明書/秘密鍵を読み込む（無暗号鍵を想定）
 	cert, err := tls.LoadX509KeyPair("client/certs/client.crt", "client/private/client.key")
 	if err != nil {
@@ -40,11 +45,13 @@ func main() {
 		ServerName:   "localhost",             // SNI/ホスト名検証
 	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConf,
-		},
+	transport, err := tlsutil.TraceTransport(&http.Transport{
+		TLSClientConfig: tlsConf,
+	}, *traceFormat)
+	if err != nil {
+		panic(err)
 	}
+	client := &http.Client{Transport: transport}
 
 	// 4) 通信を行う
 	resp, err := client.Get("https://localhost:18443")
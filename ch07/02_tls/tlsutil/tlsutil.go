@@ -4,6 +4,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+
+	"real-world-http-learn/internal/httpclient"
 )
 
 // VersionName は TLS バージョンの定数値を人が読める文字列に変換します。
@@ -61,3 +65,18 @@ func LogClientState(state *tls.ConnectionState) {
 		log.Printf("[TLS][client] server cert subject=%s", state.PeerCertificates[0].Subject.String())
 	}
 }
+
+// TraceTransport は --trace の指定（"text" / "json"）に従い、往復ごとの DNS・TCP 接続・TLS ハンドシェイク・
+// 最初のバイトまでの時間を標準エラー出力に書くよう rt を包みます。format が空なら rt をそのまま返します。
+// セッション再開（DidResume）の有無で TLS ハンドシェイクの時間がどう変わるかを比べられます。
+func TraceTransport(rt http.RoundTripper, format string) (http.RoundTripper, error) {
+	if format == "" {
+		return rt, nil
+	}
+	tracer := &httpclient.Tracer{}
+	var err error
+	if tracer.OnTrace, err = httpclient.TraceWriter(os.Stderr, format); err != nil {
+		return nil, err
+	}
+	return tracer.Transport(rt), nil
+}
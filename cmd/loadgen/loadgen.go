@@ -0,0 +1,123 @@
+// cmd/loadgen はリポジトリのサーバーに一定のレートでリクエストを送り、レイテンシの分布を HDR ヒストグラムで表示する負荷試験のツールです。
+//
+// -mode closed（既定）は -c 個の worker がレスポンスを待ってから次を送り、-mode open は -rate で決めた予定時刻ごとに
+// 応答を待たずに送ります。-http 2 で HTTP/2（http:// なら h2c）、-keepalive=false でリクエストごとに新しい接続を使います。
+// Ctrl+C で止めても、それまでの結果を表示します。
+//
+//	go run server.go
+//	go run cmd/loadgen/loadgen.go -c 10 -d 10s http://localhost:18888/
+//	go run cmd/loadgen/loadgen.go -mode open -rate 500 -c 50 -d 30s -json http://localhost:18888/
+//	go run cmd/loadgen/loadgen.go -keepalive=false -c 10 -n 2000 http://localhost:18888/  # ch07/01_keep-alive との比較
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"real-world-http-learn/internal/loadgen"
+)
+
+// headerFlag は繰り返し指定できる -H です。
+type headerFlag []string
+
+func (h *headerFlag) String() string     { return strings.Join(*h, ", ") }
+func (h *headerFlag) Set(s string) error { *h = append(*h, s); return nil }
+
+func main() {
+	log.SetFlags(0)
+	var headers headerFlag
+	mode := flag.String("mode", "closed", "送り方（closed: レスポンスを待ってから次を送る / open: 予定時刻ごとに待たずに送る）")
+	rate := flag.Float64("rate", 0, "全体で 1 秒あたりに送るリクエストの目標数（open では必須。closed で 0 なら上限なし）")
+	concurrency := flag.Int("c", 1, "同時に送るリクエストの上限（worker の数）")
+	duration := flag.Duration("d", 10*time.Second, "送り続ける時間（0 なら -n の数だけ送る）")
+	requests := flag.Int64("n", 0, "送るリクエストの数の上限（0 なら -d の時間だけ送る）")
+	httpVersion := flag.String("http", "1.1", "HTTP のバージョン（1.1 / 2。http:// の 2 は h2c）")
+	keepAlive := flag.Bool("keepalive", true, "接続を使い回す（false ならリクエストごとに新しい接続を作る）")
+	method := flag.String("X", "GET", "メソッド")
+	flag.Var(&headers, "H", "ヘッダ（\"Name: value\"。繰り返し指定可）")
+	body := flag.String("body", "", "送るボディ（\"@file\" でファイルから）")
+	timeout := flag.Duration("timeout", 30*time.Second, "1 リクエストあたりのタイムアウト")
+	insecure := flag.Bool("k", false, "サーバー証明書を検証しない")
+	jsonOut := flag.Bool("json", false, "結果の要約を JSON で出力する")
+	hgrm := flag.String("hgrm", "", "レイテンシの分布を HdrHistogram の .hgrm 形式（ms）で書き出すファイル")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: loadgen [flags] URL")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := loadgen.Options{
+		Method:            *method,
+		URL:               flag.Arg(0),
+		Header:            http.Header{},
+		Mode:              *mode,
+		Rate:              *rate,
+		Concurrency:       *concurrency,
+		Duration:          *duration,
+		Requests:          *requests,
+		HTTP:              *httpVersion,
+		DisableKeepAlives: !*keepAlive,
+		Insecure:          *insecure,
+		Timeout:           *timeout,
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			log.Fatalf("ヘッダ %q は \"Name: value\" の形式で指定してください", h)
+		}
+		opts.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if *body != "" {
+		opts.Body = []byte(*body)
+		if file, ok := strings.CutPrefix(*body, "@"); ok {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Body = data
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := loadgen.Run(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *hgrm != "" {
+		f, err := os.Create(*hgrm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := result.Latency.WritePercentiles(f, 5, 1000); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := result.WriteText(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
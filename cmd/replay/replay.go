@@ -0,0 +1,174 @@
+// cmd/replay は server.go が記録したリクエストを別のサーバーへ送り直し、レスポンスを比較するツールです。
+//
+// 送り先を 1 つ（-a）だけ指定すると記録時のレスポンスと A の、2 つ（-a と -b）指定すると A と B のレスポンスを比べます。
+// ステータス・ヘッダ（-ignore-header で除外）・ボディ（JSON なら値ごと、それ以外は行単位の差分）を比較し、
+// 違いがあれば終了コード 1 で終了するため、CI で新しい実装を参照実装と突き合わせるのに使えます。
+//
+//	go run server.go -capture captures.jsonl
+//	go run cmd/replay/replay.go -from captures.jsonl -a http://localhost:18888 -b http://localhost:8080
+//	go run cmd/replay/replay.go -from http://localhost:18888/_captures -a http://localhost:8080 -path /cookie
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"real-world-http-learn/internal/capture"
+	"real-world-http-learn/internal/replay"
+)
+
+// report は -json 指定時に 1 件ごとに出力する結果です。
+type report struct {
+	ID          int64               `json:"id"`
+	Method      string              `json:"method"`
+	Target      string              `json:"target"`
+	Status      [2]int              `json:"status"` // 比べた 2 つのステータス（-b がなければ記録時と A）
+	Differences []replay.Difference `json:"differences"`
+}
+
+func main() {
+	from := flag.String("from", "", "記録の読み込み元（JSONL ファイルまたは /_captures の URL）")
+	targetA := flag.String("a", "", "送り先 A のベース URL（例: http://localhost:18888）")
+	targetB := flag.String("b", "", "送り先 B のベース URL（省略時は記録時のレスポンスと比べる）")
+	method := flag.String("method", "", "このメソッドの記録だけを送る")
+	pathPrefix := flag.String("path", "", "このパスで始まる記録だけを送る")
+	idList := flag.String("id", "", "送る記録の ID（カンマ区切り）")
+	ignoreHeaders := flag.String("ignore-header", strings.Join(replay.DefaultIgnoreHeaders, ","), "比較しないヘッダ（カンマ区切り）")
+	ignoreJSON := flag.String("ignore-json", "", "比較しない JSON の位置（カンマ区切り。例: $.id,$.items[*].updatedAt）")
+	bodyMode := flag.String("body", "auto", "ボディの比較方法（auto / json / text / none）")
+	timeout := flag.Duration("timeout", 30*time.Second, "1 リクエストあたりのタイムアウト")
+	jsonOut := flag.Bool("json", false, "結果を JSON Lines で出力する")
+	flag.Parse()
+
+	if *from == "" || *targetA == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	baseA, err := parseBase(*targetA)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var baseB *url.URL
+	if *targetB != "" {
+		if baseB, err = parseBase(*targetB); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ids := map[int64]bool{}
+	for _, s := range splitList(*idList) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid id %q", s)
+		}
+		ids[id] = true
+	}
+
+	records, err := replay.Load(*from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	records = replay.Select(records, *method, *pathPrefix, ids)
+	if len(records) == 0 {
+		log.Fatal("送る記録がありません")
+	}
+
+	opts := replay.Options{
+		IgnoreHeaders:   splitList(*ignoreHeaders),
+		IgnoreJSONPaths: splitList(*ignoreJSON),
+		Body:            *bodyMode,
+	}
+	if baseB == nil {
+		// 記録時のヘッダは net/http が Content-Length を付ける前に控えたものなので比べない
+		opts.IgnoreHeaders = append(opts.IgnoreHeaders, "Content-Length")
+	}
+	client := replay.NewClient(*timeout)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+
+	differing := 0
+	for _, rec := range records {
+		a, b, ok := run(client, rec, baseA, baseB)
+		if !ok {
+			log.Printf("#%d %s %s: 記録にレスポンスがないため比較できません", rec.ID, rec.Method, rec.Target)
+			continue
+		}
+		diffs := replay.Compare(a, b, opts)
+		if len(diffs) > 0 {
+			differing++
+		}
+		if *jsonOut {
+			if diffs == nil {
+				diffs = []replay.Difference{}
+			}
+			_ = enc.Encode(report{ID: rec.ID, Method: rec.Method, Target: rec.Target, Status: [2]int{a.Status, b.Status}, Differences: diffs})
+			continue
+		}
+		printResult(rec, a, b, diffs)
+	}
+
+	if !*jsonOut {
+		fmt.Printf("\n%d 件中 %d 件に違いがありました\n", len(records), differing)
+	}
+	if differing > 0 {
+		os.Exit(1)
+	}
+}
+
+// run は記録を送り、比較する 2 つの結果を返します。
+// -b がなければ記録時のレスポンスを 1 つ目、-a の結果を 2 つ目にします。
+func run(client *http.Client, rec capture.Record, baseA, baseB *url.URL) (first, second replay.Result, ok bool) {
+	a := replay.Do(client, rec, baseA)
+	if baseB == nil {
+		recorded, ok := replay.Recorded(rec)
+		return recorded, a, ok
+	}
+	return a, replay.Do(client, rec, baseB), true
+}
+
+func printResult(rec capture.Record, first, second replay.Result, diffs []replay.Difference) {
+	status := func(r replay.Result) string {
+		if r.Err != nil {
+			return "ERR"
+		}
+		return strconv.Itoa(r.Status)
+	}
+	verdict := "一致"
+	if len(diffs) > 0 {
+		verdict = fmt.Sprintf("%d 件の違い", len(diffs))
+	}
+	fmt.Printf("#%d %s %s  %s → %s  %s\n", rec.ID, rec.Method, rec.Target, status(first), status(second), verdict)
+	for _, d := range diffs {
+		for _, line := range strings.Split(strings.TrimRight(d.String(), "\n"), "\n") {
+			fmt.Println("    " + line)
+		}
+	}
+}
+
+func parseBase(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid target URL %q", s)
+	}
+	return u, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -2,6 +2,11 @@ module real-world-http-learn
 
 go 1.24
 
-require golang.org/x/net v0.42.0
+require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/net v0.42.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require golang.org/x/text v0.27.0 // indirect
@@ -0,0 +1,268 @@
+// パッケージ capture は、ルートの server.go が受信したリクエストを構造化レコードとして記録します。
+// httputil.DumpRequest のテキストをコンソールで目視する代わりに、メソッド・ターゲット・ヘッダ行・
+// デコード済みボディ・TLS 状態・処理時間などを JSON で保存し、テストから検証できるようにします。
+//
+// レコードは追記専用の JSONL ファイルに 1 行 1 件で書き出され、同じ内容を /_captures で参照できます。
+package capture
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"real-world-http-learn/ch07/02_tls/tlsutil"
+	"real-world-http-learn/internal/contentcoding"
+	"real-world-http-learn/internal/wirecap"
+)
+
+// DefaultMaxBody は 1 レコードに保存するボディの上限バイト数です（超過分は切り詰めます）。
+const DefaultMaxBody = 1 << 20
+
+// Record は 1 リクエスト分の受信内容を表します。
+// JSON のフィールド名は /_captures と JSONL ファイルで共通です。
+type Record struct {
+	ID         int64     `json:"id"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs float64   `json:"durationMs"`
+	RemoteAddr string    `json:"remoteAddr"`
+
+	Method string `json:"method"`
+	Target string `json:"target"` // リクエストライン上のターゲット（r.RequestURI）
+	Proto  string `json:"proto"`
+	Host   string `json:"host"`
+
+	// HeaderLines は "Name: value" 形式のヘッダ行です。
+	// ワイヤ上のリクエストを記録している（Wire がある）ときは、受信した順・受信した綴りのままです（HeaderLinesRaw が true）。
+	// そうでなければ net/http がヘッダを map で保持するため、先頭に Host を置き、残りは正規化した名前の順に並べます。
+	HeaderLines    []string `json:"headerLines"`
+	HeaderLinesRaw bool     `json:"headerLinesRaw,omitempty"`
+
+	// Body はデコード済みのボディの先頭 MaxBody バイトです。UTF-8 として妥当でなければ base64 にして BodyEncoding に記録します。
+	// BodySize はデコード後の大きさですが、MaxBody を超えた（BodyTruncated）場合は、
+	// ハンドラが読んだ分までを含めた受信バイト数（デコード前）です。
+	Body            string `json:"body,omitempty"`
+	BodyEncoding    string `json:"bodyEncoding,omitempty"`
+	BodySize        int64  `json:"bodySize"`
+	BodyTruncated   bool   `json:"bodyTruncated,omitempty"`
+	ContentEncoding string `json:"contentEncoding,omitempty"` // デコード前の Content-Encoding
+	DecodeError     string `json:"decodeError,omitempty"`
+
+	TLS      *TLSInfo      `json:"tls,omitempty"`
+	Response *ResponseInfo `json:"response,omitempty"`
+	Timings  *Timings      `json:"timings,omitempty"`
+	// Wire はワイヤ上のリクエストそのもの（server.go の -wire 指定時のみ）です。
+	Wire *wirecap.Message `json:"wire,omitempty"`
+}
+
+// Timings はサーバー側から見た処理時間の内訳です（ミリ秒）。
+// HAR の timings（send / wait / receive）に対応させて使います。
+type Timings struct {
+	BodyReadMs  float64 `json:"bodyReadMs"`  // 記録するリクエストボディ（先頭 MaxBody バイトまで）の受信にかかった時間
+	FirstByteMs float64 `json:"firstByteMs"` // ボディ受信完了からレスポンスの書き始めまで
+	ResponseMs  float64 `json:"responseMs"`  // レスポンスの書き始めから完了まで
+}
+
+// TLSInfo は r.TLS から取り出した交渉結果です。
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	ALPN        string `json:"alpn,omitempty"`
+	ServerName  string `json:"serverName,omitempty"`
+	Resumed     bool   `json:"resumed"`
+	PeerCerts   int    `json:"peerCerts"`
+}
+
+// ResponseInfo はハンドラが返したレスポンスの要約です。
+// Body は MaxBody までの内容で、Content-Encoding が付いていれば符号化されたままです。
+type ResponseInfo struct {
+	Status        int      `json:"status"`
+	HeaderLines   []string `json:"headerLines"` // 正規化した名前の順
+	Size          int64    `json:"size"`
+	Body          string   `json:"body,omitempty"`
+	BodyEncoding  string   `json:"bodyEncoding,omitempty"`
+	BodyTruncated bool     `json:"bodyTruncated,omitempty"`
+}
+
+// BodyBytes は Body を BodyEncoding に従ってバイト列へ戻します。
+func (rec *Record) BodyBytes() ([]byte, error) {
+	return decodeStored(rec.Body, rec.BodyEncoding)
+}
+
+// BodyBytes はレスポンスの Body を BodyEncoding に従ってバイト列へ戻します。
+func (info *ResponseInfo) BodyBytes() ([]byte, error) {
+	return decodeStored(info.Body, info.BodyEncoding)
+}
+
+// Header は HeaderLines を http.Header に戻します（Host 行は含めません）。
+func (rec *Record) Header() http.Header {
+	return parseHeaderLines(rec.HeaderLines, true)
+}
+
+// Header は HeaderLines を http.Header に戻します。
+func (info *ResponseInfo) Header() http.Header {
+	return parseHeaderLines(info.HeaderLines, false)
+}
+
+func parseHeaderLines(lines []string, skipHost bool) http.Header {
+	h := http.Header{}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if skipHost && strings.EqualFold(name, "Host") {
+			continue
+		}
+		h.Add(name, strings.TrimSpace(value))
+	}
+	return h
+}
+
+func decodeStored(body, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// storeBody は保存用にボディを文字列化します（UTF-8 でなければ base64）。
+func storeBody(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// newRecord はハンドラ実行前のリクエストからレコードを組み立てます。
+// ボディは記録に使う先頭 maxBody+1 バイトだけを読み、読んだ分を前に戻した r.Body に差し替えるため、
+// 後続のハンドラは元のボディを最後まで読めます（大きなアップロードをメモリに溜め込みません）。
+// 戻り値の関数はハンドラの実行後に呼び、切り詰めた場合の BodySize を受信したバイト数で確定させます。
+func newRecord(r *http.Request, maxBody int64) (*Record, func()) {
+	rec := &Record{
+		StartedAt:   time.Now(),
+		RemoteAddr:  r.RemoteAddr,
+		Method:      r.Method,
+		Target:      r.RequestURI,
+		Proto:       r.Proto,
+		Host:        r.Host,
+		HeaderLines: headerLines(r.Host, r.Header),
+		TLS:         tlsInfo(r.TLS),
+	}
+	if m, ok := wirecap.FromContext(r.Context()); ok {
+		rec.Wire = m
+		rec.HeaderLines, rec.HeaderLinesRaw = m.UnfoldedHeaderLines(), true
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return rec, func() {}
+	}
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		rec.DecodeError = err.Error()
+	}
+	body := &countingBody{Reader: io.MultiReader(bytes.NewReader(raw), r.Body), Closer: r.Body}
+	r.Body = body
+	truncated := int64(len(raw)) > maxBody
+	if truncated {
+		raw = raw[:maxBody]
+	}
+
+	decoded := raw
+	if ce := r.Header.Get("Content-Encoding"); ce != "" {
+		rec.ContentEncoding = ce
+		d, err := decodeBody(ce, raw, maxBody+1)
+		if err != nil && !(truncated && errors.Is(err, io.ErrUnexpectedEOF)) {
+			rec.DecodeError = err.Error()
+		} else {
+			decoded = d
+		}
+	}
+	if int64(len(decoded)) > maxBody {
+		decoded = decoded[:maxBody]
+		truncated = true
+	}
+	rec.BodySize = int64(len(decoded))
+	rec.BodyTruncated = truncated
+	rec.Body, rec.BodyEncoding = storeBody(decoded)
+	return rec, func() {
+		if truncated {
+			rec.BodySize = body.n
+		}
+	}
+}
+
+// countingBody はハンドラへ渡すボディで、読まれたバイト数を数えます。
+type countingBody struct {
+	io.Reader
+	io.Closer
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// headerLines は Host を先頭にし、残りを正規化した名前の順に並べたヘッダ行の一覧を作ります。
+func headerLines(host string, h http.Header) []string {
+	lines := []string{}
+	if host != "" {
+		lines = append(lines, "Host: "+host)
+	}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	return lines
+}
+
+func tlsInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:     tlsutil.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+		Resumed:     state.DidResume,
+		PeerCerts:   len(state.PeerCertificates),
+	}
+}
+
+// decodeBody は Content-Encoding（カンマ区切りで複数指定可）を逆順に外します。
+// 展開後の大きさは limit バイトまでに抑えます（小さな圧縮データが巨大に膨らむ「圧縮爆弾」への対策）。
+// raw が途中で切れている場合は、展開できたところまでと io.ErrUnexpectedEOF を返します。
+func decodeBody(contentEncoding string, raw []byte, limit int64) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	var rd io.Reader = bytes.NewReader(raw)
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == contentcoding.Identity {
+			continue
+		}
+		dec, err := contentcoding.NewReader(coding, rd)
+		if err != nil {
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+		defer dec.Close()
+		rd = dec
+	}
+	return io.ReadAll(io.LimitReader(rd, limit))
+}
@@ -0,0 +1,116 @@
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"real-world-http-learn/internal/wirecap"
+)
+
+// TestMiddlewareBody は MaxBody を超えるボディを先頭だけ記録しつつハンドラには全体を渡すことと、
+// 圧縮されたボディの展開を MaxBody で打ち切ることを確認します。
+func TestMiddlewareBody(t *testing.T) {
+	rc, err := NewRecorder("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.MaxBody = 1024
+	srv := httptest.NewServer(rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%x", sha256.Sum256(body))
+	})))
+	defer srv.Close()
+
+	post := func(body []byte, contentEncoding string) (Record, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/upload", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", contentEncoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		records := rc.Records()
+		return records[len(records)-1], string(digest)
+	}
+	sum := func(b []byte) string { return fmt.Sprintf("%x", sha256.Sum256(b)) }
+	gzipped := func(b []byte) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(b)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	large := []byte(strings.Repeat("0123456789abcdef", 64*100))
+	rec, digest := post(large, "")
+	if digest != sum(large) {
+		t.Error("handler did not receive the whole body")
+	}
+	if !rec.BodyTruncated || len(rec.Body) != 1024 || rec.BodySize != int64(len(large)) || rec.Body != string(large[:1024]) {
+		t.Errorf("large: truncated=%v body=%d size=%d", rec.BodyTruncated, len(rec.Body), rec.BodySize)
+	}
+
+	small := gzipped([]byte("name=value"))
+	if rec, digest := post(small, "gzip"); rec.Body != "name=value" || rec.BodyTruncated || rec.BodySize != 10 || digest != sum(small) {
+		t.Errorf("gzip: %+v", rec)
+	}
+
+	// 16 MiB のゼロを圧縮したもの（約 16 KiB）。展開しても MaxBody までしか作らない
+	bomb := gzipped(make([]byte, 16<<20))
+	rec, digest = post(bomb, "gzip")
+	if digest != sum(bomb) {
+		t.Error("handler did not receive the compressed body as-is")
+	}
+	if !rec.BodyTruncated || len(rec.Body) != 1024 || rec.DecodeError != "" || rec.BodySize != int64(len(bomb)) {
+		t.Errorf("gzip bomb: truncated=%v body=%d size=%d err=%q", rec.BodyTruncated, len(rec.Body), rec.BodySize, rec.DecodeError)
+	}
+}
+
+// TestHeaderLines はワイヤ上のリクエストを記録しているときは受信した順・綴りのヘッダ行を、
+// そうでなければ Host を先頭に正規化した名前の順のヘッダ行を記録することを確認します。
+func TestHeaderLines(t *testing.T) {
+	rc, _ := NewRecorder("")
+	srv := httptest.NewUnstartedServer(wirecap.Middleware(rc.Middleware(http.NotFoundHandler())))
+	srv.Listener = wirecap.Wrap(srv.Listener, wirecap.DefaultMaxBytes)
+	srv.Config.ConnContext = wirecap.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET /raw HTTP/1.1\r\nx-b: 2\r\nHost: example.com\r\nX-A: 1\r\n  folded\r\nConnection: close\r\n\r\n")
+	io.ReadAll(conn)
+	conn.Close()
+
+	rec := rc.Records()[0]
+	want := []string{"x-b: 2", "Host: example.com", "X-A: 1 folded", "Connection: close"}
+	if !rec.HeaderLinesRaw || !slices.Equal(rec.HeaderLines, want) {
+		t.Errorf("raw: %v %q", rec.HeaderLinesRaw, rec.HeaderLines)
+	}
+	if h := rec.Header(); h.Get("X-A") != "1 folded" || h.Get("X-B") != "2" || h.Get("Host") != "" {
+		t.Errorf("Header() = %v", h)
+	}
+
+	rc2, _ := NewRecorder("")
+	rec2 := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-B", "2")
+	req.Header.Set("A", "1")
+	rc2.Middleware(http.NotFoundHandler()).ServeHTTP(rec2, req)
+	if got := rc2.Records()[0]; got.HeaderLinesRaw || !slices.Equal(got.HeaderLines, []string{"Host: example.com", "A: 1", "X-B: 2"}) {
+		t.Errorf("sorted: %v %q", got.HeaderLinesRaw, got.HeaderLines)
+	}
+}
@@ -0,0 +1,370 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxRecords はメモリ上に保持するレコード数の既定値です。
+// JSONL ファイルには上限なく追記されます。
+const DefaultMaxRecords = 1000
+
+// Recorder はレコードを JSONL ファイルへ追記し、直近分をメモリに保持します。
+type Recorder struct {
+	// MaxBody は 1 レコードに保存するボディの上限です（0 なら DefaultMaxBody）。
+	MaxBody int64
+	// MaxRecords はメモリ上に保持するレコード数の上限です（0 なら DefaultMaxRecords）。
+	MaxRecords int
+
+	mu      sync.Mutex
+	file    *os.File
+	enc     *json.Encoder
+	nextID  int64
+	records []*Record
+	subs    map[chan Record]struct{}
+}
+
+// NewRecorder は path の JSONL ファイルを追記モードで開いた Recorder を返します。
+// 既存ファイルがあれば最後の ID から採番を続けます。path が空ならメモリ上だけに保持します。
+func NewRecorder(path string) (*Recorder, error) {
+	rec := &Recorder{}
+	if path == "" {
+		return rec, nil
+	}
+	lastID, err := scanLastID(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	rec.file = f
+	rec.enc = json.NewEncoder(f)
+	rec.enc.SetEscapeHTML(false)
+	rec.nextID = lastID
+	return rec, nil
+}
+
+// scanLastID は既存の JSONL ファイルから最大の ID を探します。
+func scanLastID(path string) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var last int64
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*DefaultMaxBody)
+	for sc.Scan() {
+		var head struct {
+			ID int64 `json:"id"`
+		}
+		if json.Unmarshal(sc.Bytes(), &head) == nil && head.ID > last {
+			last = head.ID
+		}
+	}
+	return last, sc.Err()
+}
+
+// Close は JSONL ファイルを閉じます。
+func (rc *Recorder) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.file == nil {
+		return nil
+	}
+	err := rc.file.Close()
+	rc.file, rc.enc = nil, nil
+	return err
+}
+
+// add は採番してメモリとファイルの両方に記録します。
+func (rc *Recorder) add(rec *Record) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.nextID++
+	rec.ID = rc.nextID
+
+	max := rc.MaxRecords
+	if max <= 0 {
+		max = DefaultMaxRecords
+	}
+	rc.records = append(rc.records, rec)
+	if over := len(rc.records) - max; over > 0 {
+		rc.records = append([]*Record(nil), rc.records[over:]...)
+	}
+	for ch := range rc.subs {
+		select {
+		case ch <- *rec:
+		default:
+			// 受け取りが追いつかない購読者の分は捨てる（記録や応答を止めない）
+		}
+	}
+	if rc.enc == nil {
+		return nil
+	}
+	return rc.enc.Encode(rec)
+}
+
+// Subscribe は以後に記録されたレコードを受け取るチャネルを返します。
+// buffer を超えて溜まった分は捨てられます。使い終わったら cancel を呼んでください。
+func (rc *Recorder) Subscribe(buffer int) (records <-chan Record, cancel func()) {
+	ch := make(chan Record, buffer)
+	rc.mu.Lock()
+	if rc.subs == nil {
+		rc.subs = map[chan Record]struct{}{}
+	}
+	rc.subs[ch] = struct{}{}
+	rc.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			rc.mu.Lock()
+			delete(rc.subs, ch)
+			rc.mu.Unlock()
+		})
+	}
+}
+
+// Records はメモリ上のレコードを古い順に返します（コピー）。
+func (rc *Recorder) Records() []Record {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	out := make([]Record, len(rc.records))
+	for i, rec := range rc.records {
+		out[i] = *rec
+	}
+	return out
+}
+
+// Get は ID に一致するレコードを返します。
+func (rc *Recorder) Get(id int64) (Record, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, rec := range rc.records {
+		if rec.ID == id {
+			return *rec, true
+		}
+	}
+	return Record{}, false
+}
+
+// Reset はメモリ上のレコードを破棄します（JSONL ファイルは追記専用のため変更しません）。
+func (rc *Recorder) Reset() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.records = nil
+}
+
+// Middleware は next の前後でリクエストとレスポンスを記録するハンドラを返します。
+// "/_" で始まる管理用パス（/_captures など）は記録しません。
+func (rc *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/_") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		maxBody := rc.MaxBody
+		if maxBody <= 0 {
+			maxBody = DefaultMaxBody
+		}
+		rec, finish := newRecord(r, maxBody)
+		bodyRead := time.Now()
+		rw := &responseRecorder{ResponseWriter: w, maxBody: maxBody}
+		defer func() {
+			finish()
+			end := time.Now()
+			if rw.firstByte.IsZero() {
+				rw.firstByte = end
+			}
+			rec.DurationMs = msSince(rec.StartedAt, end)
+			rec.Timings = &Timings{
+				BodyReadMs:  msSince(rec.StartedAt, bodyRead),
+				FirstByteMs: msSince(bodyRead, rw.firstByte),
+				ResponseMs:  msSince(rw.firstByte, end),
+			}
+			rec.Response = rw.info()
+			if err := rc.add(rec); err != nil {
+				// 記録に失敗してもクライアントへの応答には影響させない
+				log.Printf("capture: write record: %v", err)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func msSince(from, to time.Time) float64 {
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+// Handler は /_captures のハンドラを返します。
+//
+//	GET    /_captures?method=POST&path=/cookie&after=10&limit=5  → JSON 配列
+//	GET    /_captures?format=jsonl                               → JSONL
+//	GET    /_captures?id=3                                        → 1 件
+//	DELETE /_captures                                             → メモリ上の記録を破棄
+func (rc *Recorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			rc.Reset()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, "GET or DELETE only", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		if idStr := q.Get("id"); idStr != "" {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid id", http.StatusBadRequest)
+				return
+			}
+			rec, ok := rc.Get(id)
+			if !ok {
+				http.Error(w, "record not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, rec)
+			return
+		}
+
+		records, err := filter(rc.Records(), q.Get("method"), q.Get("path"), q.Get("after"), q.Get("limit"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Get("format") == "jsonl" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+			for _, rec := range records {
+				_ = enc.Encode(rec)
+			}
+			return
+		}
+		writeJSON(w, records)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+// filter はクエリ条件でレコードを絞り込みます。limit は末尾（新しい側）から数えます。
+func filter(records []Record, method, pathPrefix, after, limit string) ([]Record, error) {
+	var afterID int64
+	if after != "" {
+		v, err := strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid after")
+		}
+		afterID = v
+	}
+	out := make([]Record, 0, len(records))
+	for _, rec := range records {
+		if method != "" && !strings.EqualFold(rec.Method, method) {
+			continue
+		}
+		if pathPrefix != "" && !strings.HasPrefix(rec.Target, pathPrefix) {
+			continue
+		}
+		if rec.ID <= afterID {
+			continue
+		}
+		out = append(out, rec)
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid limit")
+		}
+		if len(out) > n {
+			out = out[len(out)-n:]
+		}
+	}
+	return out, nil
+}
+
+// responseRecorder はステータス・ヘッダ・ボディ（先頭 maxBody バイト）を控える ResponseWriter です。
+// Unwrap を実装しているので http.NewResponseController 経由の Flush/Hijack も透過します。
+type responseRecorder struct {
+	http.ResponseWriter
+	maxBody   int64
+	status    int
+	size      int64
+	header    http.Header
+	body      bytes.Buffer
+	firstByte time.Time
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+		w.header = w.ResponseWriter.Header().Clone()
+		w.firstByte = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		// net/http が書き込み時に行う Content-Type の推測をここで先に行い、記録に残す
+		h := w.ResponseWriter.Header()
+		if _, ok := h["Content-Type"]; !ok && h.Get("Content-Encoding") == "" {
+			h.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	if room := w.maxBody - int64(w.body.Len()); room > 0 {
+		w.body.Write(p[:min(int64(n), room)])
+	}
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush は既存コードの w.(http.Flusher) 型アサーション向けに用意しています。
+func (w *responseRecorder) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseRecorder) info() *ResponseInfo {
+	status, header := w.status, w.header
+	if status == 0 {
+		// 何も書かれなかった場合、net/http は 200 を返す
+		status, header = http.StatusOK, w.ResponseWriter.Header()
+	}
+	info := &ResponseInfo{
+		Status:        status,
+		HeaderLines:   headerLines("", header),
+		Size:          w.size,
+		BodyTruncated: w.size > int64(w.body.Len()),
+	}
+	info.Body, info.BodyEncoding = storeBody(w.body.Bytes())
+	return info
+}
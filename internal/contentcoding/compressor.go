@@ -0,0 +1,287 @@
+package contentcoding
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMinSize は Compressor.MinSize を指定しないときの、圧縮する最小のバイト数です。
+// これより小さい応答は、圧縮してもヘッダやフレームの分で得にならないことが多いためそのまま送ります。
+const DefaultMinSize = 1024
+
+// Rule は Content-Type ごとの圧縮の設定です。Compressor は先頭から順に Type と照合し、最初に一致した Rule を使います。
+type Rule struct {
+	// Type は "text/html" のようなメディアタイプか、"text/*"・"application/*+json" のようなパターン（path.Match の書式）です。
+	Type string
+	// Encodings はこのタイプで使うコーディング（優先する順）です。空ならこのタイプは圧縮しません。
+	Encodings []string
+	// MinSize はこのタイプを圧縮する最小のバイト数です（0 なら Compressor.MinSize）。
+	MinSize int
+}
+
+// DefaultRules はテキスト系のタイプをすべてのコーディングで圧縮し、画像・動画・アーカイブなど
+// すでに圧縮されている形式（一致しないタイプ）は圧縮しない設定です。
+var DefaultRules = []Rule{
+	{Type: "text/*", Encodings: Supported},
+	{Type: "application/json", Encodings: Supported},
+	{Type: "application/*+json", Encodings: Supported},
+	{Type: "application/javascript", Encodings: Supported},
+	{Type: "application/xml", Encodings: Supported},
+	{Type: "application/*+xml", Encodings: Supported},
+	{Type: "application/wasm", Encodings: Supported},
+	{Type: "image/svg+xml", Encodings: Supported},
+}
+
+// Compressor は応答のボディを Accept-Encoding に応じて圧縮するミドルウェアの設定です。ゼロ値は DefaultRules と DefaultMinSize で動きます。
+type Compressor struct {
+	// MinSize は圧縮する最小のバイト数です（0 なら DefaultMinSize）。Content-Length がなければ、ここまでボディを溜めてから決めます。
+	MinSize int
+	// Rules は Content-Type ごとの設定です（nil なら DefaultRules）。
+	Rules []Rule
+}
+
+// Middleware は next の応答を、Accept-Encoding と Content-Type の Rule から選んだコーディングで圧縮します。
+//
+// 次の応答は圧縮しません: HEAD への応答、1xx・204・206・304、すでに Content-Encoding があるもの、
+// Cache-Control: no-transform、一致する Rule がない Content-Type、MinSize より小さいボディ。
+// 圧縮したときは Content-Length を外し、ETag を弱いものにし（バイト列が変わるため）、
+// 圧縮後のバイト列と合わない Range を受け付けないよう Accept-Ranges を外します。
+// 圧縮するかどうかが Accept-Encoding で変わるタイプには Vary: Accept-Encoding を付けます。
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, c: c, accept: r.Header.Get("Accept-Encoding")}
+		defer cw.finish()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func (c *Compressor) minSize(rule Rule) int {
+	switch {
+	case rule.MinSize > 0:
+		return rule.MinSize
+	case c.MinSize > 0:
+		return c.MinSize
+	}
+	return DefaultMinSize
+}
+
+// rule は Content-Type に一致する Rule を返します。
+func (c *Compressor) rule(contentType string) (Rule, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Rule{}, false
+	}
+	rules := c.Rules
+	if rules == nil {
+		rules = DefaultRules
+	}
+	for _, rule := range rules {
+		if ok, _ := path.Match(strings.ToLower(rule.Type), mediaType); ok {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// encoderPools はコーディングごとに Encoder を使い回します（zstd や br の Encoder は作るのに大きなメモリを使うため）。
+var encoderPools sync.Map // coding → *sync.Pool
+
+func getEncoder(coding string, w io.Writer) (Encoder, error) {
+	if pool, ok := encoderPools.Load(coding); ok {
+		if enc, ok := pool.(*sync.Pool).Get().(Encoder); ok {
+			enc.Reset(w)
+			return enc, nil
+		}
+	}
+	return NewWriter(coding, w)
+}
+
+func putEncoder(coding string, enc Encoder) {
+	pool, _ := encoderPools.LoadOrStore(coding, &sync.Pool{})
+	pool.(*sync.Pool).Put(enc)
+}
+
+// compressWriter は圧縮するかどうかを決めるまでステータスとボディを溜め、決めたあとはそのまま（または Encoder を通して）書きます。
+type compressWriter struct {
+	http.ResponseWriter
+	c      *Compressor
+	accept string
+
+	status  int  // next が WriteHeader で指定したステータス（0 ならまだ）
+	decided bool // 圧縮するかどうかを決め、ステータスを書いた
+	buf     []byte
+	// minSize は Content-Type から決めた、圧縮を決めるのに必要なボディの大きさ（-1 なら圧縮しないことが決まっている）
+	minSize int
+
+	coding string
+	enc    Encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if code >= 100 && code < 200 {
+		// 103 Early Hints などの途中経過はそのまま送る
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	h := cw.Header()
+	switch {
+	case code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent,
+		h.Get("Content-Encoding") != "",
+		hasToken(h.Values("Cache-Control"), "no-transform"):
+		cw.decide(false)
+		return
+	}
+	if h.Get("Content-Type") == "" {
+		// Content-Type を最初のボディから推測するため、書かれるまで待つ
+		return
+	}
+	cw.checkType()
+	if cw.minSize < 0 {
+		cw.decide(false)
+		return
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		cw.decide(n >= int64(cw.minSize))
+	}
+}
+
+// checkType は Content-Type に一致する Rule から、使えるコーディングと minSize を決めます。
+func (cw *compressWriter) checkType() {
+	h := cw.Header()
+	rule, ok := cw.c.rule(h.Get("Content-Type"))
+	if !ok || len(rule.Encodings) == 0 {
+		cw.minSize = -1
+		return
+	}
+	// 圧縮するかどうかは Accept-Encoding で変わるので、実際に圧縮しない場合も共有キャッシュに知らせる
+	if !hasToken(h.Values("Vary"), "Accept-Encoding") && !hasToken(h.Values("Vary"), "*") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	cw.coding = Negotiate(cw.accept, rule.Encodings)
+	if cw.coding == "" {
+		cw.minSize = -1
+		return
+	}
+	cw.minSize = cw.c.minSize(rule)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	cw.buf = append(cw.buf, p...)
+	if cw.Header().Get("Content-Type") == "" {
+		cw.Header().Set("Content-Type", http.DetectContentType(cw.buf))
+		cw.checkType()
+	}
+	switch {
+	case cw.minSize < 0:
+		cw.decide(false)
+	case len(cw.buf) >= cw.minSize:
+		cw.decide(true)
+	}
+	return len(p), nil
+}
+
+// decide は圧縮するかどうかを決めてステータスを書き、溜めていたボディを送ります。
+func (cw *compressWriter) decide(compress bool) {
+	if cw.decided {
+		return
+	}
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	h := cw.Header()
+	if compress && cw.coding != "" {
+		enc, err := getEncoder(cw.coding, cw.ResponseWriter)
+		if err == nil {
+			cw.enc = enc
+			h.Set("Content-Encoding", cw.coding)
+			h.Del("Content-Length")
+			h.Del("Accept-Ranges")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) > 0 {
+		buf := cw.buf
+		cw.buf = nil
+		if cw.enc != nil {
+			cw.enc.Write(buf)
+		} else {
+			cw.ResponseWriter.Write(buf)
+		}
+	}
+}
+
+// Flush は圧縮するかどうかが決まっていなければ、そこまでの分で決めてから（ストリーミングの応答は大きさがわからないため、
+// 圧縮できるタイプなら圧縮します）、Encoder と下の ResponseWriter を Flush します。
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.WriteHeader(http.StatusOK)
+		}
+		cw.decide(cw.minSize >= 0)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap は http.ResponseController が下の ResponseWriter を使えるようにします。
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// finish は next が返ったあとに呼び、溜めたままのボディを送って Encoder を閉じます。
+func (cw *compressWriter) finish() {
+	if !cw.decided && (cw.status != 0 || len(cw.buf) > 0) {
+		// ボディ全体が MinSize に届かなかった
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		putEncoder(cw.coding, cw.enc)
+		cw.enc = nil
+	}
+}
+
+// hasToken はカンマ区切りのヘッダの値に token が含まれるかを返します（大文字小文字は区別しません）。
+func hasToken(values []string, token string) bool {
+	for _, v := range values {
+		if slices.ContainsFunc(strings.Split(v, ","), func(t string) bool {
+			name, _, _ := strings.Cut(t, "=")
+			return strings.EqualFold(strings.TrimSpace(name), token)
+		}) {
+			return true
+		}
+	}
+	return false
+}
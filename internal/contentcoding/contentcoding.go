@@ -0,0 +1,209 @@
+// パッケージ contentcoding は、HTTP の Content-Encoding（gzip・deflate・br・zstd）の圧縮と展開、
+// Accept-Encoding の q 値によるコーディングの選択（RFC 9110 §12.5.3）をまとめたものです。
+// server.go の -compress（Compressor.Middleware）と、ch04/10_httpcli の --compressed（httpclient.Decoder）から使います。
+//
+// br は github.com/andybalholm/brotli、zstd は github.com/klauspost/compress/zstd の Go だけで書かれた実装を使うので、
+// cgo なしでビルドできます。
+package contentcoding
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// コンテンツコーディングの名前（IANA の HTTP Content Coding Registry の登録名）です。
+const (
+	Gzip     = "gzip"
+	Deflate  = "deflate" // zlib 形式（RFC 1950）。生の deflate（RFC 1951）ではない
+	Brotli   = "br"
+	Zstd     = "zstd"
+	Identity = "identity" // コーディングなし
+)
+
+// Supported は扱えるコーディングを、サーバーが優先する順（q 値が同じなら前のものを選ぶ）に並べたものです。
+var Supported = []string{Zstd, Brotli, Gzip, Deflate}
+
+// ErrUnsupported は扱えないコーディングを指定したときのエラーです。
+var ErrUnsupported = errors.New("contentcoding: unsupported content coding")
+
+// zstdWindow は zstd のウィンドウの上限です。RFC 9659 は HTTP の zstd のウィンドウを 8MB までに制限しています。
+const zstdWindow = 8 << 20
+
+// Encoder は圧縮する Writer です。Reset で別の出力先に使い回せます。
+type Encoder interface {
+	io.WriteCloser
+	// Flush はそこまでに書いた分を、相手が展開できる形で出力先に書き出します（ストリーミングの応答用）。
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Canonical は coding を小文字にし、別名（x-gzip）を登録名にします。
+func Canonical(coding string) string {
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	if coding == "x-gzip" {
+		return Gzip
+	}
+	return coding
+}
+
+// NewWriter は coding で圧縮して w に書く Encoder を返します。
+// 圧縮レベルは動的な応答向けに速さを優先した値（gzip・deflate は 6、br は 5、zstd は 3 相当）です。
+func NewWriter(coding string, w io.Writer) (Encoder, error) {
+	switch Canonical(coding) {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Deflate:
+		return zlib.NewWriter(w), nil
+	case Brotli:
+		return brotli.NewWriterLevel(w, 5), nil
+	case Zstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(zstdWindow))
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupported, coding)
+}
+
+// NewReader は coding で圧縮された r を展開する Reader を返します。
+// gzip と deflate のヘッダは最初の Read で読むので、NewReader 自体は r を読みません。
+// deflate は本来の zlib 形式に加え、ヘッダのない生の deflate を送るサーバーにも対応します。
+func NewReader(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch Canonical(coding) {
+	case Gzip:
+		return &lazyReader{open: func() (io.ReadCloser, error) { return gzip.NewReader(r) }}, nil
+	case Deflate:
+		return &lazyReader{open: func() (io.ReadCloser, error) { return newDeflateReader(r) }}, nil
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case Zstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdWindow))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupported, coding)
+}
+
+// newDeflateReader は先頭の 2 バイトが zlib のヘッダ（CM=8 で、16 ビットの値が 31 の倍数）なら zlib として、
+// そうでなければ生の deflate として展開します。
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil && len(head) < 2 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// lazyReader は最初の Read で open を呼ぶ Reader です。
+type lazyReader struct {
+	open func() (io.ReadCloser, error)
+	rc   io.ReadCloser
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.rc == nil && l.err == nil {
+		l.rc, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.rc.Read(p)
+}
+
+func (l *lazyReader) Close() error {
+	if l.rc == nil {
+		return nil
+	}
+	return l.rc.Close()
+}
+
+// Preference は Accept-Encoding の 1 項目です。
+type Preference struct {
+	Coding string  // 小文字の登録名。"*" はほかに挙げていないすべてのコーディング
+	Q      float64 // 0〜1。0 は「受け付けない」
+}
+
+// ParseAcceptEncoding は Accept-Encoding の値を項目ごとに分けます。q 値の書式が不正な項目は無視します。
+func ParseAcceptEncoding(v string) []Preference {
+	var prefs []Preference
+	for item := range strings.SplitSeq(v, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = Canonical(coding)
+		if coding == "" {
+			continue
+		}
+		p := Preference{Coding: coding, Q: 1}
+		valid := true
+		for param := range strings.SplitSeq(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			p.Q = q
+		}
+		if valid {
+			prefs = append(prefs, p)
+		}
+	}
+	return prefs
+}
+
+// Negotiate は Accept-Encoding の値 accept と、サーバーが使えるコーディング offers（優先する順）から、
+// 応答に使うコーディングを選びます。"" はコーディングなし（identity）で送ることを表します。
+//
+// q 値の最も大きいコーディングを選び、同じ q 値なら offers の順で決めます。q=0 や挙げていないコーディングは使いません
+// （"*" を挙げていればその q 値を使います）。identity のほうが q 値が大きければ圧縮しません。
+// Accept-Encoding がない・空のとき、また identity;q=0 でも使えるコーディングがないときは、
+// RFC 9110 §12.5.3 の推奨どおりコーディングなしで送ります。
+func Negotiate(accept string, offers []string) string {
+	prefs := ParseAcceptEncoding(accept)
+	if len(prefs) == 0 {
+		return ""
+	}
+	qOf := func(coding string) (float64, bool) {
+		star, hasStar := 0.0, false
+		for _, p := range prefs {
+			if p.Coding == coding {
+				return p.Q, true
+			}
+			if p.Coding == "*" {
+				star, hasStar = p.Q, true
+			}
+		}
+		return star, hasStar
+	}
+	identityQ, _ := qOf(Identity)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		offer = Canonical(offer)
+		if q, ok := qOf(offer); ok && q > 0 && q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	if best == "" || bestQ < identityQ {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,165 @@
+package contentcoding
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestNegotiate は q 値・"*"・identity の扱いと、同じ q 値のときのサーバーの優先順を確認します。
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", Gzip},
+		{"x-gzip", Gzip},
+		{"gzip, br", Brotli},
+		{"gzip, br, zstd", Zstd},
+		{"gzip;q=1.0, br;q=0.8", Gzip},
+		{"GZIP;Q=0.5, deflate;q=0.4", Gzip},
+		{"br;q=0", ""},
+		{"*", Zstd},
+		{"*;q=0.5, zstd;q=0", Brotli},
+		{"gzip;q=0.5, identity", ""},
+		{"gzip, identity;q=0", Gzip},
+		{"identity;q=0", ""}, // 使えるコーディングがなければコーディングなしで送る
+		{"compress, gzip;q=abc", ""},
+		{"sdch, deflate", Deflate},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, Supported); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// TestRoundTrip はそれぞれのコーディングで圧縮したものを展開でき、deflate は生の deflate も展開できることを確認します。
+func TestRoundTrip(t *testing.T) {
+	want := strings.Repeat("Real World HTTP ", 1000)
+	for _, coding := range append(Supported, "x-gzip") {
+		var buf bytes.Buffer
+		enc, err := NewWriter(coding, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(enc, want)
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= len(want)/10 {
+			t.Errorf("%s: %d bytes, not compressed", coding, buf.Len())
+		}
+		dec, err := NewReader(coding, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(dec)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: %d bytes, %v", coding, len(got), err)
+		}
+	}
+
+	var raw bytes.Buffer
+	fw, _ := flate.NewWriter(&raw, flate.DefaultCompression)
+	io.WriteString(fw, want)
+	fw.Close()
+	dec, _ := NewReader(Deflate, &raw)
+	if got, err := io.ReadAll(dec); err != nil || string(got) != want {
+		t.Errorf("raw deflate: %d bytes, %v", len(got), err)
+	}
+
+	if _, err := NewWriter("compress", io.Discard); err == nil {
+		t.Error("unsupported coding was accepted")
+	}
+}
+
+// TestCompressor は Content-Type の Rule・最小サイズ・Content-Length・ETag・Vary・除外する応答の扱いを確認します。
+func TestCompressor(t *testing.T) {
+	large := strings.Repeat("<p>hello</p>\n", 200)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		io.WriteString(w, large) // Content-Type は推測させる
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "small")
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Content-Length", "2000")
+		w.Write(bytes.Repeat([]byte(" "), 2000))
+	})
+	mux.HandleFunc("/png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(bytes.Repeat([]byte{0}, 2000))
+	})
+	mux.HandleFunc("/no-transform", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "public, no-transform")
+		io.WriteString(w, large)
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: 2\n\n")
+	})
+	srv := httptest.NewServer((&Compressor{}).Middleware(mux))
+	defer srv.Close()
+
+	get := func(path, accept string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		if coding := resp.Header.Get("Content-Encoding"); coding != "" {
+			dec, err := NewReader(coding, resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = dec
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return resp, string(data)
+	}
+
+	resp, body := get("/html", "gzip, br;q=0.9")
+	h := resp.Header
+	if h.Get("Content-Encoding") != Gzip || body != large || h.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("/html: %v, %d bytes", h, len(body))
+	}
+	if h.Get("ETag") != `W/"v1"` || h.Get("Accept-Ranges") != "" || h.Get("Vary") != "Accept-Encoding" || resp.ContentLength == int64(len(large)) {
+		t.Errorf("/html headers: %v (length %d)", h, resp.ContentLength)
+	}
+	if resp, body := get("/html", "identity"); resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Vary") != "Accept-Encoding" || body != large {
+		t.Errorf("/html identity: %v", resp.Header)
+	}
+	if resp, body := get("/json", "zstd"); resp.Header.Get("Content-Encoding") != Zstd || len(body) != 2000 {
+		t.Errorf("/json: %v", resp.Header)
+	}
+
+	for _, path := range []string{"/small", "/png", "/no-transform"} {
+		if resp, _ := get(path, "gzip"); resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s was compressed: %v", path, resp.Header)
+		}
+	}
+	if resp, body := get("/stream", "br"); resp.Header.Get("Content-Encoding") != Brotli || body != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("/stream: %v %q", resp.Header, body)
+	}
+}
@@ -0,0 +1,275 @@
+// パッケージ cookiecodec は、Cookie の値を HMAC で署名（必要なら AES-GCM で暗号化）する再利用可能なコーデックです。
+// 平文の Cookie はクライアントが自由に書き換えられるため、サーバーが発行した値であることを
+// 署名で確認し、発行時刻から有効期限（max-age）を検証します。
+//
+// 値の形式（すべて Cookie 値に使える文字だけで構成されます）:
+//
+//	<mode>.<keyID>.<発行時刻(UNIX 秒)>.<payload(base64url)>.<HMAC-SHA256(base64url)>
+//
+// mode は "s1"（署名のみ）または "e1"（AES-256-GCM で暗号化した上で署名）です。
+// HMAC は Cookie 名も含めて計算するため、別の Cookie へ値を付け替えても検証に失敗します。
+// 鍵は複数登録でき、先頭の鍵で発行し、登録済みのすべての鍵で検証します（鍵のローテーション）。
+package cookiecodec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinSecretLen は鍵の秘密値に求める最小バイト数です。
+const MinSecretLen = 32
+
+const (
+	modeSigned    = "s1"
+	modeEncrypted = "e1"
+)
+
+// 検証失敗の種類です。Decode が返すエラーは errors.Is でこれらと比較できます。
+var (
+	// ErrMalformed は値の形式が壊れている（区切りの数や base64 が不正など）ことを表します。
+	ErrMalformed = errors.New("cookiecodec: malformed value")
+	// ErrTampered は署名が一致しない・未知の鍵で署名されている・復号できないことを表します。
+	ErrTampered = errors.New("cookiecodec: tampered value")
+	// ErrExpired は署名は正しいが MaxAge を過ぎていることを表します。
+	ErrExpired = errors.New("cookiecodec: expired value")
+)
+
+// DecodeError は Decode の失敗理由です。Kind に上記のいずれかのエラーを持ちます。
+type DecodeError struct {
+	Name   string // Cookie 名
+	Kind   error  // ErrMalformed / ErrTampered / ErrExpired
+	Detail string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v: cookie %q: %s", e.Kind, e.Name, e.Detail)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Kind }
+
+// Key は署名・暗号化に使う鍵です。ID は Cookie 値に埋め込まれ、検証時の鍵選択に使います。
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// derivedKey は秘密値から用途別に派生させた鍵です。
+type derivedKey struct {
+	id   string
+	mac  []byte
+	aead cipher.AEAD
+}
+
+// Codec は Cookie 値の符号化と検証を行います。並行して使っても安全です。
+type Codec struct {
+	// MaxAge が正なら、発行から MaxAge を過ぎた値を ErrExpired にします。
+	MaxAge time.Duration
+	// Encrypt が true なら値を AES-GCM で暗号化します。false の場合も値は改ざんできませんが、中身は読めます。
+	// true のときは署名のみの値を受け付けません（暗号化なしへのダウングレード防止）。
+	Encrypt bool
+
+	keys []derivedKey
+	now  func() time.Time
+}
+
+// New は keys を使う Codec を返します。keys[0] が発行用で、残りは検証のみに使う旧鍵です。
+func New(keys ...Key) (*Codec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("cookiecodec: at least one key is required")
+	}
+	c := &Codec{now: time.Now}
+	seen := map[string]bool{}
+	for _, k := range keys {
+		if !validKeyID(k.ID) || seen[k.ID] {
+			return nil, fmt.Errorf("cookiecodec: invalid or duplicate key id %q", k.ID)
+		}
+		if len(k.Secret) < MinSecretLen {
+			return nil, fmt.Errorf("cookiecodec: key %q: secret must be at least %d bytes", k.ID, MinSecretLen)
+		}
+		seen[k.ID] = true
+		block, err := aes.NewCipher(derive(k.Secret, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, derivedKey{id: k.ID, mac: derive(k.Secret, "sign"), aead: aead})
+	}
+	return c, nil
+}
+
+// validKeyID は鍵 ID が Cookie 値にそのまま埋め込める文字（英数字・'-'・'_'）だけか確認します。
+func validKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseKeys は "id1:secret1,id2:secret2" 形式の文字列を鍵の一覧にします（環境変数での指定用）。
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("cookiecodec: key %q must be id:secret", item)
+		}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// RandomKey は乱数の秘密値を持つ鍵を作ります（再起動すると以前の Cookie は検証できなくなります）。
+func RandomKey(id string) (Key, error) {
+	secret := make([]byte, MinSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: id, Secret: secret}, nil
+}
+
+// derive は HMAC-SHA256(secret, purpose) で用途別の 32 バイト鍵を作ります。
+func derive(secret []byte, purpose string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("cookiecodec:" + purpose))
+	return m.Sum(nil)
+}
+
+var b64 = base64.RawURLEncoding
+
+// Encode は Cookie 名 name の値 value を符号化します。
+func (c *Codec) Encode(name, value string) (string, error) {
+	k := c.keys[0]
+	ts := strconv.FormatInt(c.now().Unix(), 10)
+	mode := modeSigned
+	payload := []byte(value)
+	if c.Encrypt {
+		mode = modeEncrypted
+		nonce := make([]byte, k.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = k.aead.Seal(nonce, nonce, payload, []byte(additionalData(name, mode, k.id, ts)))
+	}
+	head := mode + "." + k.id + "." + ts + "." + b64.EncodeToString(payload)
+	return head + "." + b64.EncodeToString(sign(k.mac, name, head)), nil
+}
+
+// Decode は Encode した値を検証して元の値を返します。失敗時は *DecodeError を返します。
+func (c *Codec) Decode(name, encoded string) (string, error) {
+	fail := func(kind error, format string, args ...any) (string, error) {
+		return "", &DecodeError{Name: name, Kind: kind, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 5 {
+		return fail(ErrMalformed, "expected 5 fields, got %d", len(parts))
+	}
+	mode, kid, ts := parts[0], parts[1], parts[2]
+	if mode != modeSigned && mode != modeEncrypted {
+		return fail(ErrMalformed, "unknown mode %q", mode)
+	}
+	issued, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fail(ErrMalformed, "invalid timestamp")
+	}
+	payload, err := b64.DecodeString(parts[3])
+	if err != nil {
+		return fail(ErrMalformed, "invalid payload encoding")
+	}
+	mac, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return fail(ErrMalformed, "invalid signature encoding")
+	}
+
+	var k *derivedKey
+	for i := range c.keys {
+		if c.keys[i].id == kid {
+			k = &c.keys[i]
+			break
+		}
+	}
+	if k == nil {
+		return fail(ErrTampered, "unknown key id %q", kid)
+	}
+	head := strings.Join(parts[:4], ".")
+	if !hmac.Equal(mac, sign(k.mac, name, head)) {
+		return fail(ErrTampered, "signature mismatch")
+	}
+	if c.Encrypt && mode != modeEncrypted {
+		return fail(ErrTampered, "unencrypted value is not accepted")
+	}
+	if c.MaxAge > 0 {
+		if age := c.now().Sub(time.Unix(issued, 0)); age > c.MaxAge {
+			return fail(ErrExpired, "issued %s ago (max-age %s)", age.Truncate(time.Second), c.MaxAge)
+		}
+	}
+
+	if mode == modeSigned {
+		return string(payload), nil
+	}
+	ns := k.aead.NonceSize()
+	if len(payload) < ns {
+		return fail(ErrMalformed, "ciphertext too short")
+	}
+	plain, err := k.aead.Open(nil, payload[:ns], payload[ns:], []byte(additionalData(name, mode, kid, ts)))
+	if err != nil {
+		return fail(ErrTampered, "decryption failed")
+	}
+	return string(plain), nil
+}
+
+func sign(key []byte, name, head string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(name))
+	m.Write([]byte{0})
+	m.Write([]byte(head))
+	return m.Sum(nil)
+}
+
+func additionalData(name, mode, kid, ts string) string {
+	return name + "\x00" + mode + "." + kid + "." + ts
+}
+
+// SetCookie は cookie.Value を符号化して Set-Cookie を送ります。cookie 自体は書き換えません。
+func (c *Codec) SetCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	encoded, err := c.Encode(cookie.Name, cookie.Value)
+	if err != nil {
+		return err
+	}
+	out := *cookie
+	out.Value = encoded
+	http.SetCookie(w, &out)
+	return nil
+}
+
+// ReadCookie はリクエストから name の Cookie を読み出して検証します。
+// Cookie がなければ http.ErrNoCookie、検証に失敗すれば *DecodeError を返します。
+func (c *Codec) ReadCookie(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return c.Decode(name, cookie.Value)
+}
@@ -0,0 +1,106 @@
+package cookiecodec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustCodec(t *testing.T, keys ...Key) *Codec {
+	t.Helper()
+	c, err := New(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var (
+	key1 = Key{ID: "k1", Secret: []byte(strings.Repeat("a", MinSecretLen))}
+	key2 = Key{ID: "k2", Secret: []byte(strings.Repeat("b", MinSecretLen))}
+)
+
+// TestRoundTrip は署名のみ・暗号化ありの両方で値が元に戻ることを確認します。
+func TestRoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		c := mustCodec(t, key1)
+		c.Encrypt = encrypt
+		encoded, err := c.Encode("VISIT", "42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encrypt && strings.Contains(encoded, "NDI") { // "42" の base64url
+			t.Errorf("encrypted value leaks plaintext: %s", encoded)
+		}
+		got, err := c.Decode("VISIT", encoded)
+		if err != nil || got != "42" {
+			t.Errorf("encrypt=%v: Decode = %q, %v", encrypt, got, err)
+		}
+	}
+}
+
+// TestErrors は改ざん・形式不正・期限切れがそれぞれのエラーとして区別できることを確認します。
+func TestErrors(t *testing.T) {
+	c := mustCodec(t, key1)
+	encoded, _ := c.Encode("VISIT", "1")
+	parts := strings.Split(encoded, ".")
+
+	forged := strings.Join(append(parts[:3:3], b64.EncodeToString([]byte("999")), parts[4]), ".")
+	tests := []struct {
+		name    string
+		cookie  string
+		encoded string
+		want    error
+	}{
+		{"forged payload", "VISIT", forged, ErrTampered},
+		{"other cookie name", "OTHER", encoded, ErrTampered},
+		{"plain text", "VISIT", "1", ErrMalformed},
+		{"broken base64", "VISIT", strings.Join(append(parts[:3:3], "!!", parts[4]), "."), ErrMalformed},
+	}
+	for _, tt := range tests {
+		_, err := c.Decode(tt.cookie, tt.encoded)
+		var de *DecodeError
+		if !errors.Is(err, tt.want) || !errors.As(err, &de) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	c.MaxAge = time.Hour
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := c.Decode("VISIT", encoded); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired: err = %v", err)
+	}
+}
+
+// TestKeyRotation は旧鍵で発行した値を新鍵の Codec でも検証でき、
+// 旧鍵を外すと検証できなくなることを確認します。
+func TestKeyRotation(t *testing.T) {
+	old := mustCodec(t, key1)
+	encoded, _ := old.Encode("VISIT", "7")
+
+	rotated := mustCodec(t, key2, key1)
+	if got, err := rotated.Decode("VISIT", encoded); err != nil || got != "7" {
+		t.Fatalf("rotated Decode = %q, %v", got, err)
+	}
+	reissued, _ := rotated.Encode("VISIT", "8")
+	if !strings.HasPrefix(reissued, modeSigned+".k2.") {
+		t.Errorf("new values must be signed with the first key: %s", reissued)
+	}
+
+	retired := mustCodec(t, key2)
+	if _, err := retired.Decode("VISIT", encoded); !errors.Is(err, ErrTampered) {
+		t.Errorf("retired key: err = %v", err)
+	}
+}
+
+// TestDowngrade は暗号化を要求する Codec が署名のみの値を受け付けないことを確認します。
+func TestDowngrade(t *testing.T) {
+	signedOnly := mustCodec(t, key1)
+	encoded, _ := signedOnly.Encode("VISIT", "1")
+	strict := mustCodec(t, key1)
+	strict.Encrypt = true
+	if _, err := strict.Decode("VISIT", encoded); !errors.Is(err, ErrTampered) {
+		t.Errorf("err = %v, want ErrTampered", err)
+	}
+}
@@ -0,0 +1,254 @@
+// パッケージ cookielab は、RFC 6265bis の Cookie 属性を自由に組み合わせて発行し、
+// クライアント（ブラウザや ch04 の Cookie Jar）が送り返してきた Cookie を検査するための実験用ハンドラです。
+//
+// /cookie/set は Domain・Path・Secure・HttpOnly・SameSite・Partitioned（CHIPS）・Max-Age・Expires と
+// __Host- / __Secure- 接頭辞を指定して Set-Cookie を返します。仕様に違反する組み合わせもあえてそのまま送り、
+// 違反内容をレスポンスで知らせるので、Jar が正しく拒否するかを確かめられます。
+// /cookie/inspect は届いた Cookie を発行時の属性と照らし合わせ、本来送られるべきでない Cookie を指摘します。
+package cookielab
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Spec は発行する Cookie 1 つの属性です。
+type Spec struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Domain      string `json:"domain,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Secure      bool   `json:"secure,omitempty"`
+	HttpOnly    bool   `json:"httpOnly,omitempty"`
+	SameSite    string `json:"sameSite,omitempty"` // Strict / Lax / None（空なら属性を付けない）
+	Partitioned bool   `json:"partitioned,omitempty"`
+	// MaxAge は秒数です。nil なら属性を付けず、0 以下は削除を意味します。
+	MaxAge *int `json:"maxAge,omitempty"`
+	// Expires は HTTP 日付（RFC 1123）の文字列で、そのまま送信します。
+	Expires string `json:"expires,omitempty"`
+	// Prefix に "host" / "secure" を指定すると Name の先頭に __Host- / __Secure- を付けます。
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Violation は仕様違反または注意点です。
+type Violation struct {
+	Cookie   string `json:"cookie"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // "error"（準拠した Jar は拒否・送信しない）か "warning"
+	Message  string `json:"message"`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// maxAgeLimit は RFC 6265bis が Max-Age / Expires に設ける上限（400 日）です。
+const maxAgeLimit = 400 * 24 * time.Hour
+
+// FullName は接頭辞を反映した Cookie 名を返します。
+func (s Spec) FullName() string {
+	switch strings.ToLower(s.Prefix) {
+	case "host":
+		return "__Host-" + s.Name
+	case "secure":
+		return "__Secure-" + s.Name
+	}
+	return s.Name
+}
+
+// Line は Set-Cookie ヘッダの値を組み立てます。
+// http.SetCookie は不正な属性を黙って落とすため、違反する組み合わせも送れるよう自前で組み立てます。
+func (s Spec) Line() string {
+	var b strings.Builder
+	b.WriteString(s.FullName())
+	b.WriteByte('=')
+	b.WriteString(s.Value)
+	if s.Domain != "" {
+		b.WriteString("; Domain=" + s.Domain)
+	}
+	if s.Path != "" {
+		b.WriteString("; Path=" + s.Path)
+	}
+	if s.MaxAge != nil {
+		b.WriteString("; Max-Age=" + strconv.Itoa(*s.MaxAge))
+	}
+	if s.Expires != "" {
+		b.WriteString("; Expires=" + s.Expires)
+	}
+	if s.Secure {
+		b.WriteString("; Secure")
+	}
+	if s.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if s.SameSite != "" {
+		b.WriteString("; SameSite=" + s.SameSite)
+	}
+	if s.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// Validate は host（リクエストの Host）・secure（HTTPS で受けたか）の文脈で、
+// Jar がこの Set-Cookie を受け入れるかどうかを RFC 6265bis の規則で確認します。
+func (s Spec) Validate(host string, secure bool) []Violation {
+	name := s.FullName()
+	var out []Violation
+	add := func(severity, rule, format string, args ...any) {
+		out = append(out, Violation{Cookie: name, Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Name == "" && s.Prefix == "" {
+		add(severityError, "name", "Cookie 名が空です")
+	}
+	if i := strings.IndexFunc(name, invalidNameRune); i >= 0 {
+		add(severityError, "name", "Cookie 名に使えない文字 %q が含まれています", name[i])
+	}
+	if i := strings.IndexFunc(s.Value, invalidValueRune); i >= 0 {
+		add(severityError, "value", "Cookie 値に使えない文字 %q が含まれています", s.Value[i])
+	}
+
+	if strings.HasPrefix(name, "__Secure-") && !s.Secure {
+		add(severityError, "prefix", "__Secure- 接頭辞の Cookie には Secure が必要です")
+	}
+	if strings.HasPrefix(name, "__Host-") {
+		if !s.Secure {
+			add(severityError, "prefix", "__Host- 接頭辞の Cookie には Secure が必要です")
+		}
+		if s.Domain != "" {
+			add(severityError, "prefix", "__Host- 接頭辞の Cookie に Domain は指定できません")
+		}
+		if s.Path != "/" {
+			add(severityError, "prefix", "__Host- 接頭辞の Cookie は Path=/ でなければなりません")
+		}
+	}
+	if s.Secure && !secure {
+		if isLoopback(host) {
+			add(severityWarning, "secure", "HTTP で Secure Cookie を発行しています（localhost は多くのブラウザで安全なオリジン扱いです）")
+		} else {
+			add(severityError, "secure", "安全でない（HTTP の）オリジンからは Secure Cookie を設定できません")
+		}
+	}
+
+	switch strings.ToLower(s.SameSite) {
+	case "":
+		add(severityWarning, "samesite", "SameSite がないため、多くのブラウザは Lax として扱います")
+	case "strict", "lax":
+	case "none":
+		if !s.Secure {
+			add(severityError, "samesite", "SameSite=None には Secure が必要です")
+		}
+	default:
+		add(severityWarning, "samesite", "不明な SameSite 値 %q は無視されます", s.SameSite)
+	}
+
+	if s.Partitioned {
+		if !s.Secure {
+			add(severityError, "partitioned", "Partitioned（CHIPS）には Secure が必要です")
+		}
+		if !strings.HasPrefix(name, "__Host-") {
+			add(severityWarning, "partitioned", "Partitioned には __Host- 接頭辞の併用が推奨されます")
+		}
+	}
+
+	if s.Domain != "" {
+		domain := strings.ToLower(strings.TrimPrefix(s.Domain, "."))
+		if !domainMatch(hostOnly(host), domain) {
+			add(severityError, "domain", "Domain=%s はリクエストのホスト %s を含まないため拒否されます", s.Domain, hostOnly(host))
+		} else if isPublicSuffix(domain) {
+			add(severityError, "domain", "Domain=%s はパブリックサフィックスのため拒否されます", s.Domain)
+		}
+	}
+	if s.Path != "" && !strings.HasPrefix(s.Path, "/") {
+		add(severityWarning, "path", "Path が / で始まらないため、既定のパスとして扱われます")
+	}
+
+	// time.Duration に直すと大きな Max-Age で桁あふれするため、秒のまま比べる
+	if s.MaxAge != nil && *s.MaxAge > int(maxAgeLimit/time.Second) {
+		add(severityWarning, "max-age", "Max-Age は 400 日に切り詰められます")
+	}
+	if s.Expires != "" {
+		t, err := time.Parse(time.RFC1123, s.Expires)
+		switch {
+		case err != nil:
+			add(severityError, "expires", "Expires の日付を解釈できません: %v", err)
+		case time.Until(t) > maxAgeLimit:
+			add(severityWarning, "expires", "Expires は 400 日後に切り詰められます")
+		}
+	}
+	return out
+}
+
+// Expiry は now に受け取った Cookie がいつ失効するかを返します（セッション Cookie なら ok=false）。
+// Max-Age が Expires より優先されます。Jar と同じく 400 日より先は 400 日後に切り詰め、
+// 0 以下の Max-Age は now（すぐに失効）とします。
+func (s Spec) Expiry(now time.Time) (t time.Time, ok bool) {
+	limit := now.Add(maxAgeLimit)
+	if s.MaxAge != nil {
+		switch {
+		case *s.MaxAge <= 0:
+			return now, true
+		case *s.MaxAge > int(maxAgeLimit/time.Second):
+			return limit, true
+		}
+		return now.Add(time.Duration(*s.MaxAge) * time.Second), true
+	}
+	if s.Expires != "" {
+		if t, err := time.Parse(time.RFC1123, s.Expires); err == nil {
+			if t.After(limit) {
+				return limit, true
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// invalidNameRune は cookie-name（RFC 7230 の token）に使えない文字かどうかです。
+func invalidNameRune(r rune) bool {
+	return r <= ' ' || r >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, r)
+}
+
+// invalidValueRune は cookie-octet に使えない文字かどうかです。
+func invalidValueRune(r rune) bool {
+	return r <= ' ' || r >= 0x7f || r == '"' || r == ',' || r == ';' || r == '\\'
+}
+
+// hostOnly は Host ヘッダからポートを除いて小文字にします。
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// domainMatch は RFC 6265 5.1.3 の domain-match です。
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+func isLoopback(host string) bool {
+	h := hostOnly(host)
+	if h == "localhost" || strings.HasSuffix(h, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(h)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isPublicSuffix は domain が "com" や "github.io" のようなパブリックサフィックスかどうかです。
+// 一覧にない単一ラベル（localhost など）は既定規則に一致するだけなので対象外にします。
+func isPublicSuffix(domain string) bool {
+	ps, icann := publicsuffix.PublicSuffix(domain)
+	return ps == domain && (icann || strings.Contains(ps, "."))
+}
@@ -0,0 +1,92 @@
+package cookielab
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestValidate は Domain・SameSite・Secure・接頭辞・Max-Age の規則ごとに、違反の規則名と重大度を確認します。
+func TestValidate(t *testing.T) {
+	maxAge := func(n int) *int { return &n }
+	tests := []struct {
+		name   string
+		spec   Spec
+		host   string
+		secure bool
+		want   []string // "重大度:規則名" の並び
+	}{
+		{"plain", Spec{Name: "a", SameSite: "Lax"}, "example.com", false, nil},
+		{"no SameSite", Spec{Name: "a"}, "example.com", false, []string{"warning:samesite"}},
+		{"empty name", Spec{SameSite: "Lax"}, "example.com", false, []string{"error:name"}},
+		{"invalid value", Spec{Name: "a", Value: "x;y", SameSite: "Lax"}, "example.com", false, []string{"error:value"}},
+
+		{"parent Domain", Spec{Name: "a", Domain: ".example.com", SameSite: "Lax"}, "www.example.com:8080", false, nil},
+		{"other Domain", Spec{Name: "a", Domain: "other.example", SameSite: "Lax"}, "example.com", false, []string{"error:domain"}},
+		{"public suffix", Spec{Name: "a", Domain: "com", SameSite: "Lax"}, "example.com", false, []string{"error:domain"}},
+		{"private public suffix", Spec{Name: "a", Domain: "github.io", SameSite: "Lax"}, "user.github.io", false, []string{"error:domain"}},
+		{"Domain on an IP host", Spec{Name: "a", Domain: "0.2.1", SameSite: "Lax"}, "192.0.2.1", false, []string{"error:domain"}},
+
+		{"SameSite=None without Secure", Spec{Name: "a", SameSite: "None"}, "example.com", true, []string{"error:samesite"}},
+		{"SameSite=None with Secure", Spec{Name: "a", SameSite: "none", Secure: true}, "example.com", true, nil},
+		{"unknown SameSite", Spec{Name: "a", SameSite: "Loose"}, "example.com", false, []string{"warning:samesite"}},
+
+		{"Secure over HTTP", Spec{Name: "a", SameSite: "Lax", Secure: true}, "example.com", false, []string{"error:secure"}},
+		{"Secure over HTTP on localhost", Spec{Name: "a", SameSite: "Lax", Secure: true}, "localhost:18888", false, []string{"warning:secure"}},
+		{"Secure over HTTPS", Spec{Name: "a", SameSite: "Lax", Secure: true}, "example.com", true, nil},
+
+		{"__Secure- without Secure", Spec{Name: "a", Prefix: "secure", SameSite: "Lax"}, "example.com", true, []string{"error:prefix"}},
+		{"__Secure-", Spec{Name: "a", Prefix: "secure", SameSite: "Lax", Secure: true}, "example.com", true, nil},
+		{"__Host- with Domain and Path", Spec{Name: "a", Prefix: "host", SameSite: "Lax", Secure: true, Domain: "example.com", Path: "/app"}, "example.com", true,
+			[]string{"error:prefix", "error:prefix"}},
+		{"__Host- without Secure", Spec{Name: "a", Prefix: "host", SameSite: "Lax", Path: "/"}, "example.com", true, []string{"error:prefix"}},
+		{"__Host-", Spec{Name: "a", Prefix: "host", SameSite: "Lax", Secure: true, Path: "/"}, "example.com", true, nil},
+		{"Partitioned without Secure", Spec{Name: "a", SameSite: "None", Partitioned: true}, "example.com", true,
+			[]string{"error:samesite", "error:partitioned", "warning:partitioned"}},
+
+		{"Max-Age of 400 days", Spec{Name: "a", SameSite: "Lax", MaxAge: maxAge(400 * 24 * 60 * 60)}, "example.com", false, nil},
+		{"Max-Age over 400 days", Spec{Name: "a", SameSite: "Lax", MaxAge: maxAge(400*24*60*60 + 1)}, "example.com", false, []string{"warning:max-age"}},
+		{"huge Max-Age", Spec{Name: "a", SameSite: "Lax", MaxAge: maxAge(math.MaxInt)}, "example.com", false, []string{"warning:max-age"}},
+		{"negative Max-Age", Spec{Name: "a", SameSite: "Lax", MaxAge: maxAge(math.MinInt)}, "example.com", false, nil},
+		{"invalid Expires", Spec{Name: "a", SameSite: "Lax", Expires: "tomorrow"}, "example.com", false, []string{"error:expires"}},
+		{"far Expires", Spec{Name: "a", SameSite: "Lax", Expires: "Fri, 31 Dec 9999 23:59:59 GMT"}, "example.com", false, []string{"warning:expires"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range tt.spec.Validate(tt.host, tt.secure) {
+			got = append(got, v.Severity+":"+v.Rule)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestExpiry は Max-Age と Expires から失効時刻を求め、400 日より先を切り詰めることを確認します。
+func TestExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := now.Add(maxAgeLimit)
+	maxAge := func(n int) *int { return &n }
+	tests := []struct {
+		name string
+		spec Spec
+		want time.Time // ゼロ値ならセッション Cookie
+	}{
+		{"session", Spec{}, time.Time{}},
+		{"Max-Age", Spec{MaxAge: maxAge(60)}, now.Add(time.Minute)},
+		{"Max-Age of 0", Spec{MaxAge: maxAge(0)}, now},
+		{"negative Max-Age", Spec{MaxAge: maxAge(math.MinInt)}, now},
+		{"huge Max-Age", Spec{MaxAge: maxAge(math.MaxInt)}, limit},
+		{"Max-Age before Expires", Spec{MaxAge: maxAge(60), Expires: "Sat, 03 Jan 2026 00:00:00 GMT"}, now.Add(time.Minute)},
+		{"Expires", Spec{Expires: "Sat, 03 Jan 2026 00:00:00 GMT"}, now.Add(48 * time.Hour)},
+		{"far Expires", Spec{Expires: "Fri, 31 Dec 9999 23:59:59 GMT"}, limit},
+		{"invalid Expires", Spec{Expires: "tomorrow"}, time.Time{}},
+	}
+	for _, tt := range tests {
+		got, ok := tt.spec.Expiry(now)
+		if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("%s: %v %v, want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
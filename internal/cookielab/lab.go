@@ -0,0 +1,417 @@
+package cookielab
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// issued は発行した Cookie の記録です。/cookie/inspect で届いた Cookie と照合します。
+type issued struct {
+	Spec     Spec       `json:"spec"`
+	Host     string     `json:"host"` // 発行したリクエストのホスト（Domain なしの host-only Cookie の照合に使う）
+	Path     string     `json:"path"` // 実際に適用されるパス（Path がなければ既定のパス）
+	IssuedAt time.Time  `json:"issuedAt"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	// Rejected は発行時点で準拠した Jar なら拒否するはずだった（Validate がエラーを返した）ことを表します。
+	Rejected bool `json:"rejected,omitempty"`
+}
+
+const (
+	// MaxIssued は覚えておく発行記録の上限です。超えたら発行の古いものから忘れます。
+	MaxIssued = 1000
+	// expiredGrace は期限の切れた記録を残しておく時間です。期限切れの Cookie が送られてきたことを
+	// 検出できるよう、期限が切れてもすぐには忘れません。
+	expiredGrace = time.Hour
+)
+
+// Lab は発行した Cookie を覚えておき、送り返された Cookie を検査します。
+// 記録はプロセス内で共有されるため、複数のクライアントで同時に試すと互いの記録が混ざります。
+type Lab struct {
+	mu     sync.Mutex
+	issued map[string]issued // 名前・Domain・Path の組 → 記録（Jar の置き換え規則と同じキー）
+	now    func() time.Time
+}
+
+// New は空の Lab を返します。
+func New() *Lab {
+	return &Lab{issued: map[string]issued{}, now: time.Now}
+}
+
+func issuedKey(name, domain, path string) string {
+	return name + "\x00" + domain + "\x00" + path
+}
+
+// SetHandler は /cookie/set のハンドラを返します。
+//
+//	GET  /cookie/set?name=id&value=1&path=/&secure=1&samesite=None&partitioned=1&max-age=60&prefix=host
+//	POST /cookie/set  （Spec の JSON、またはその配列で複数の Cookie を一度に発行）
+//
+// 指定どおりの Set-Cookie を送り、その文脈で Jar が拒否するはずの違反を JSON で返します。
+func (l *Lab) SetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var specs []Spec
+		switch r.Method {
+		case http.MethodGet:
+			spec, err := specFromQuery(r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			specs = []Spec{spec}
+		case http.MethodPost:
+			var err error
+			if specs, err = readSpecs(r.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+
+		secure := isSecure(r)
+		lines := []string{}
+		violations := []Violation{}
+		for _, spec := range specs {
+			line := spec.Line()
+			w.Header().Add("Set-Cookie", line)
+			lines = append(lines, line)
+			problems := spec.Validate(r.Host, secure)
+			violations = append(violations, problems...)
+			l.record(spec, r, hasError(problems))
+		}
+		writeJSON(w, map[string]any{
+			"setCookie":  lines,
+			"violations": violations,
+		})
+	})
+}
+
+// record は発行した Cookie を記録します。Max-Age が 0 以下なら削除として扱います。
+func (l *Lab) record(spec Spec, r *http.Request, rejected bool) {
+	now := l.now()
+	rec := issued{
+		Spec:     spec,
+		Host:     hostOnly(r.Host),
+		Path:     spec.Path,
+		IssuedAt: now,
+		Rejected: rejected,
+	}
+	if !strings.HasPrefix(rec.Path, "/") {
+		rec.Path = defaultPath(r.URL.Path)
+	}
+	domain := strings.ToLower(strings.TrimPrefix(spec.Domain, "."))
+	key := issuedKey(spec.FullName(), domain, rec.Path)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := spec.Expiry(now); ok {
+		if !t.After(now) {
+			delete(l.issued, key)
+			return
+		}
+		rec.Expires = &t
+	}
+	l.issued[key] = rec
+	l.prune(now)
+}
+
+// prune は期限が切れて expiredGrace を過ぎた記録を捨て、MaxIssued を超えた分を発行の古い順に捨てます（l.mu を保持して呼ぶこと）。
+func (l *Lab) prune(now time.Time) {
+	for key, rec := range l.issued {
+		if rec.Expires != nil && now.Sub(*rec.Expires) > expiredGrace {
+			delete(l.issued, key)
+		}
+	}
+	for len(l.issued) > MaxIssued {
+		var oldest string
+		for key, rec := range l.issued {
+			if oldest == "" || rec.IssuedAt.Before(l.issued[oldest].IssuedAt) {
+				oldest = key
+			}
+		}
+		delete(l.issued, oldest)
+	}
+}
+
+// InspectHandler は /cookie/inspect のハンドラを返します。
+// 届いた Cookie を一覧にし、発行時の属性から見て送られるべきでなかったもの（パス・ドメイン不一致、
+// 期限切れ、HTTP での Secure Cookie、クロスサイトでの SameSite=Strict/Lax など）を violations に、
+// 送られるべきなのに届かなかったものを missing に入れて返します。
+// /cookie/inspect/ 以下のどのパスでも同じ検査を行うので、Path 属性の確認にも使えます。
+func (l *Lab) InspectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := l.now()
+		secure := isSecure(r)
+		site := requestSite(r)
+
+		l.mu.Lock()
+		all := make([]issued, 0, len(l.issued))
+		for _, rec := range l.issued {
+			all = append(all, rec)
+		}
+		l.mu.Unlock()
+		sort.Slice(all, func(i, j int) bool { return all[i].IssuedAt.Before(all[j].IssuedAt) })
+
+		type received struct {
+			Name   string  `json:"name"`
+			Value  string  `json:"value"`
+			Issued *issued `json:"issued,omitempty"` // この Lab が発行したものなら発行時の記録
+		}
+		cookies := []received{}
+		violations := []Violation{}
+		seen := map[string]int{}
+		for _, c := range r.Cookies() {
+			seen[c.Name]++
+			if seen[c.Name] == 2 {
+				violations = append(violations, Violation{Cookie: c.Name, Rule: "duplicate", Severity: severityWarning,
+					Message: "同じ名前の Cookie が複数届きました（Path や Domain の違う Cookie が重なっています）"})
+			}
+			rc := received{Name: c.Name, Value: c.Value}
+			if (strings.HasPrefix(c.Name, "__Secure-") || strings.HasPrefix(c.Name, "__Host-")) && !secure {
+				violations = append(violations, insecureViolation(c.Name, r.Host))
+			}
+
+			// 同じ名前の記録のうち、送られてよいもの（なければ値が一致するもの）を対応付ける
+			var best *issued
+			var bestProblems []Violation
+			for i := range all {
+				rec := &all[i]
+				if rec.Spec.FullName() != c.Name {
+					continue
+				}
+				problems := l.check(rec, r, secure, site, now)
+				if best == nil || len(problems) < len(bestProblems) ||
+					len(problems) == len(bestProblems) && rec.Spec.Value == c.Value {
+					best, bestProblems = rec, problems
+				}
+			}
+			if best != nil {
+				rc.Issued = best
+				violations = append(violations, bestProblems...)
+				if best.Rejected {
+					violations = append(violations, Violation{Cookie: c.Name, Rule: "rejected", Severity: severityError,
+						Message: "発行時に拒否されるべきだった Cookie が保存され、送られてきました"})
+				}
+			}
+			cookies = append(cookies, rc)
+		}
+
+		missing := []string{}
+		for i := range all {
+			rec := &all[i]
+			if rec.Rejected || seen[rec.Spec.FullName()] > 0 || len(l.check(rec, r, secure, site, now)) > 0 {
+				continue
+			}
+			missing = append(missing, rec.Spec.FullName())
+		}
+
+		writeJSON(w, map[string]any{
+			"secure":       secure,
+			"site":         site,
+			"cookieHeader": append([]string{}, r.Header.Values("Cookie")...),
+			"cookies":      cookies,
+			"violations":   violations,
+			"missing":      missing,
+		})
+	})
+}
+
+// check は rec の Cookie をこのリクエストに送ってよいかを確認し、だめな理由を返します。
+func (l *Lab) check(rec *issued, r *http.Request, secure bool, site string, now time.Time) []Violation {
+	name := rec.Spec.FullName()
+	var out []Violation
+	add := func(rule, message string) {
+		out = append(out, Violation{Cookie: name, Rule: rule, Severity: severityError, Message: message})
+	}
+
+	if rec.Expires != nil && !rec.Expires.After(now) {
+		add("expires", "有効期限の切れた Cookie が送られました")
+	}
+	host := hostOnly(r.Host)
+	if rec.Spec.Domain == "" {
+		if host != rec.Host {
+			add("domain", "host-only Cookie（"+rec.Host+" で発行）が別のホスト "+host+" に送られました")
+		}
+	} else if !domainMatch(host, strings.ToLower(strings.TrimPrefix(rec.Spec.Domain, "."))) {
+		add("domain", "Domain="+rec.Spec.Domain+" の Cookie がホスト "+host+" に送られました")
+	}
+	if !pathMatch(r.URL.Path, rec.Path) {
+		add("path", "Path="+rec.Path+" の Cookie がパス "+r.URL.Path+" に送られました")
+	}
+	if rec.Spec.Secure && !secure && !isLoopback(r.Host) {
+		add("secure", "Secure Cookie が HTTP で送られました")
+	}
+	if site == "cross-site" {
+		switch strings.ToLower(rec.Spec.SameSite) {
+		case "strict":
+			add("samesite", "SameSite=Strict の Cookie がクロスサイトのリクエストで送られました")
+		case "lax", "":
+			if !laxAllowed(r) {
+				add("samesite", "SameSite=Lax の Cookie がトップレベルの安全なナビゲーション以外のクロスサイトリクエストで送られました")
+			}
+		}
+	}
+	return out
+}
+
+func hasError(vs []Violation) bool {
+	for _, v := range vs {
+		if v.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+func insecureViolation(name, host string) Violation {
+	v := Violation{Cookie: name, Rule: "prefix", Severity: severityError, Message: "接頭辞付きの Cookie が HTTP で送られました"}
+	if isLoopback(host) {
+		v.Severity = severityWarning
+	}
+	return v
+}
+
+// laxAllowed は SameSite=Lax の Cookie をクロスサイトで送ってよいリクエスト
+// （GET/HEAD のトップレベルナビゲーション）かどうかです。Sec-Fetch-Mode がなければメソッドだけで判断します。
+func laxAllowed(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	mode := r.Header.Get("Sec-Fetch-Mode")
+	return mode == "" || mode == "navigate"
+}
+
+// requestSite はリクエストがどのサイトから来たかを返します（same-origin / same-site / cross-site / none）。
+// ブラウザが送る Sec-Fetch-Site を優先し、なければ Origin（次に Referer）と Host を比べます。どれもなければ空です。
+func requestSite(r *http.Request) string {
+	if s := r.Header.Get("Sec-Fetch-Site"); s != "" {
+		return s
+	}
+	from := r.Header.Get("Origin")
+	if from == "" || from == "null" {
+		from = r.Header.Get("Referer")
+	}
+	if from == "" {
+		return ""
+	}
+	u, err := url.Parse(from)
+	if err != nil || u.Host == "" {
+		return "cross-site"
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return "same-origin"
+	}
+	if registrable(hostOnly(u.Host)) == registrable(hostOnly(r.Host)) {
+		return "same-site"
+	}
+	return "cross-site"
+}
+
+// registrable は登録可能ドメイン（eTLD+1）を返します。求められなければホストをそのまま返します。
+func registrable(host string) string {
+	if d, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return d
+	}
+	return host
+}
+
+// isSecure は HTTPS で受けたリクエストかどうかです（TLS 終端プロキシの X-Forwarded-Proto も見ます）。
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// defaultPath は RFC 6265 5.1.4 の既定のパスです。
+func defaultPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// pathMatch は RFC 6265 5.1.4 の path-match です。
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == "" {
+		reqPath = "/"
+	}
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+// specFromQuery はクエリパラメータから Spec を作ります。
+func specFromQuery(q url.Values) (Spec, error) {
+	s := Spec{
+		Name:        q.Get("name"),
+		Value:       q.Get("value"),
+		Domain:      q.Get("domain"),
+		Path:        q.Get("path"),
+		Secure:      flag(q, "secure"),
+		HttpOnly:    flag(q, "httponly"),
+		SameSite:    q.Get("samesite"),
+		Partitioned: flag(q, "partitioned"),
+		Expires:     q.Get("expires"),
+		Prefix:      q.Get("prefix"),
+	}
+	if v := q.Get("max-age"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Spec{}, err
+		}
+		s.MaxAge = &n
+	}
+	return s, nil
+}
+
+// flag は ?secure や ?secure=1 のような真偽値のパラメータを読みます。
+func flag(q url.Values, key string) bool {
+	if !q.Has(key) {
+		return false
+	}
+	switch strings.ToLower(q.Get(key)) {
+	case "", "1", "true", "on", "yes":
+		return true
+	}
+	return false
+}
+
+// readSpecs は Spec 1 つ、または Spec の配列の JSON を読みます。
+func readSpecs(body io.Reader) ([]Spec, error) {
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var specs []Spec
+		err := json.Unmarshal(data, &specs)
+		return specs, err
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	return []Spec{spec}, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
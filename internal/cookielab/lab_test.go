@@ -0,0 +1,45 @@
+package cookielab
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRecordPrune は発行記録が MaxIssued を超えると古いものから忘れ、期限切れの記録は猶予を過ぎてから忘れることを確認します。
+func TestRecordPrune(t *testing.T) {
+	l := New()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	r := httptest.NewRequest("GET", "http://localhost/cookie/set", nil)
+
+	maxAge := 60
+	l.record(Spec{Name: "short", MaxAge: &maxAge}, r, false)
+	for i := range MaxIssued + 10 {
+		now = now.Add(time.Millisecond)
+		l.record(Spec{Name: fmt.Sprintf("c%d", i)}, r, false)
+	}
+	if len(l.issued) != MaxIssued {
+		t.Fatalf("%d records, want %d", len(l.issued), MaxIssued)
+	}
+	for _, name := range []string{"short", "c0", "c9"} {
+		if _, ok := l.issued[issuedKey(name, "", "/cookie")]; ok {
+			t.Errorf("%s was kept", name)
+		}
+	}
+
+	l = New()
+	l.now = func() time.Time { return now }
+	l.record(Spec{Name: "short", MaxAge: &maxAge}, r, false)
+	now = now.Add(time.Minute + expiredGrace/2)
+	l.record(Spec{Name: "other"}, r, false)
+	if _, ok := l.issued[issuedKey("short", "", "/cookie")]; !ok {
+		t.Error("an expired record was forgotten within the grace period")
+	}
+	now = now.Add(expiredGrace)
+	l.record(Spec{Name: "other"}, r, false)
+	if _, ok := l.issued[issuedKey("short", "", "/cookie")]; ok || len(l.issued) != 1 {
+		t.Errorf("records after the grace period: %v", l.issued)
+	}
+}
@@ -0,0 +1,97 @@
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"unicode/utf8"
+
+	"real-world-http-learn/internal/capture"
+)
+
+// Write は records を HAR 1.2 として w へ書き出します。
+// エントリを 1 件ずつエンコードするため、件数が多くても全体をメモリに組み立てません。
+func Write(w io.Writer, records []capture.Record) error {
+	head, err := json.Marshal(struct {
+		Version string  `json:"version"`
+		Creator Creator `json:"creator"`
+	}{Version, DefaultCreator})
+	if err != nil {
+		return err
+	}
+	// {"log":{"version":...,"creator":...,"entries":[ ... ]}}
+	if _, err := io.WriteString(w, `{"log":`+string(head[:len(head)-1])+`,"entries":[`); err != nil {
+		return err
+	}
+	flusher, _ := w.(http.Flusher)
+	for i, rec := range records {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(FromRecord(rec)); err != nil {
+			return err
+		}
+		if _, err := w.Write(bytes.TrimRight(buf.Bytes(), "\n")); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	_, err = io.WriteString(w, "]}}\n")
+	return err
+}
+
+// Handler は /_har のハンドラを返します。
+// recorder が保持している現在のセッションを HAR としてストリーミングします。
+// ?download=1 を付けると Content-Disposition: attachment を付与します。
+func Handler(recorder *capture.Recorder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.URL.Query().Get("download") != "" {
+			w.Header().Set("Content-Disposition", `attachment; filename="session.har"`)
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		// ヘッダ送信後のエラーはクライアントへ返せないため無視する
+		_ = Write(w, recorder.Records())
+	})
+}
+
+// multipartParams は multipart/form-data のボディを postData.params に展開します。
+// ファイルパートは fileName と contentType のみを持ち、値がテキストなら value にも入れます。
+func multipartParams(body []byte, boundary string) []Param {
+	params := []Param{}
+	if boundary == "" {
+		return params
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil { // io.EOF を含む
+			return params
+		}
+		data, _ := io.ReadAll(part)
+		p := Param{
+			Name:        part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+		}
+		if p.FileName == "" || utf8.Valid(data) {
+			p.Value = string(data)
+		}
+		params = append(params, p)
+	}
+}
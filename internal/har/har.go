@@ -0,0 +1,313 @@
+// パッケージ har は、capture で記録したリクエスト/レスポンスを HAR 1.2 形式へ変換します。
+// HAR（HTTP Archive）はブラウザの開発者ツールが読み書きできる JSON 形式で、
+// ch04 のクライアントが送った内容とブラウザが送った内容を同じツールで見比べるために使います。
+//
+// 仕様: http://www.softwareishard.com/blog/har-12-spec/
+package har
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"real-world-http-learn/internal/capture"
+)
+
+// Version は出力する HAR のバージョンです。
+const Version = "1.2"
+
+// HAR はファイル全体（ルートオブジェクト）です。
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log は HAR の log オブジェクトです。
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator は HAR を生成したアプリケーションです。
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// DefaultCreator は server.go が出力する HAR の creator です。
+var DefaultCreator = Creator{Name: "real-world-http-learn", Version: "1.0"}
+
+// Entry は 1 回のリクエスト/レスポンスの組です。
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+}
+
+// Request は HAR の request オブジェクトです。
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+// Response は HAR の response オブジェクトです。
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+// NameValue はヘッダ・クエリ文字列・フォームパラメータで共通の組です。
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie は HAR の cookie オブジェクトです。
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// PostData はリクエストボディです。フォーム形式なら Params にも展開します。
+type PostData struct {
+	MimeType string  `json:"mimeType"`
+	Params   []Param `json:"params"`
+	Text     string  `json:"text"`
+}
+
+// Param は postData.params の要素です。
+type Param struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// Content はレスポンスボディです。バイナリは Encoding = "base64" になります。
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Timings はサーバー側で計測できた時間の内訳です（計測できない項目は -1）。
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// FromRecord は capture.Record を HAR の Entry に変換します。
+func FromRecord(rec capture.Record) Entry {
+	reqHeader := rec.Header()
+	entry := Entry{
+		StartedDateTime: rec.StartedAt.Format(time.RFC3339Nano),
+		Time:            rec.DurationMs,
+		Request: Request{
+			Method:      rec.Method,
+			URL:         requestURL(rec),
+			HTTPVersion: rec.Proto,
+			Cookies:     requestCookies(reqHeader),
+			Headers:     nameValues(rec.HeaderLines),
+			QueryString: queryString(rec.Target),
+			PostData:    postData(rec, reqHeader),
+			HeadersSize: -1,
+			BodySize:    rec.BodySize,
+		},
+		Timings: Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+		Comment: "captured by server.go (id=" + strconv.FormatInt(rec.ID, 10) + ")",
+	}
+	if rec.Timings != nil {
+		entry.Timings.Send = rec.Timings.BodyReadMs
+		entry.Timings.Wait = rec.Timings.FirstByteMs
+		entry.Timings.Receive = rec.Timings.ResponseMs
+	} else {
+		entry.Timings.Wait = rec.DurationMs
+	}
+	if rec.Response != nil {
+		entry.Response = response(rec)
+	}
+	return entry
+}
+
+// requestURL はリクエストターゲットと Host から絶対 URL を組み立てます。
+func requestURL(rec capture.Record) string {
+	if u, err := url.Parse(rec.Target); err == nil && u.IsAbs() {
+		return u.String() // プロキシ宛ての absolute-form
+	}
+	scheme := "http"
+	if rec.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + rec.Host + rec.Target
+}
+
+func nameValues(lines []string) []NameValue {
+	out := []NameValue{}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		out = append(out, NameValue{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	return out
+}
+
+func queryString(target string) []NameValue {
+	u, err := url.Parse(target)
+	if err != nil {
+		return []NameValue{}
+	}
+	return formPairs(u.RawQuery)
+}
+
+// formPairs は name=value を & でつないだもの（クエリや application/x-www-form-urlencoded のボディ）を分解します。
+// url.Values は順序を持たないため、& で区切って送信順を保ちます。
+func formPairs(raw string) []NameValue {
+	out := []NameValue{}
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		out = append(out, NameValue{Name: unescape(name), Value: unescape(value)})
+	}
+	return out
+}
+
+// unescape は % エスケープと + を戻します。正しくないエスケープを含むなら元のまま返します。
+func unescape(s string) string {
+	if v, err := url.QueryUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// requestCookies は Cookie ヘッダを cookieHandler と同じく http.Request.Cookies の規則で解釈します。
+func requestCookies(h http.Header) []Cookie {
+	out := []Cookie{}
+	r := &http.Request{Header: h}
+	for _, c := range r.Cookies() {
+		out = append(out, Cookie{Name: c.Name, Value: c.Value})
+	}
+	return out
+}
+
+// responseCookies は Set-Cookie ヘッダを属性付きで解釈します。
+func responseCookies(h http.Header) []Cookie {
+	out := []Cookie{}
+	for _, line := range h.Values("Set-Cookie") {
+		c, err := http.ParseSetCookie(line)
+		if err != nil {
+			continue
+		}
+		hc := Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		out = append(out, hc)
+	}
+	return out
+}
+
+// postData はリクエストボディを MIME タイプ付きで返します。
+// application/x-www-form-urlencoded と multipart/form-data は params にも展開します。
+func postData(rec capture.Record, h http.Header) *PostData {
+	if rec.BodySize == 0 && rec.Body == "" {
+		return nil
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	pd := &PostData{MimeType: ct, Params: []Param{}, Text: rec.Body}
+	body, err := rec.BodyBytes()
+	if err != nil {
+		return pd
+	}
+	mediaType, params, _ := mime.ParseMediaType(ct)
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		// ボディは URL ではないので url.Parse を通さない（# などで後ろが落ちる）
+		for _, nv := range formPairs(string(body)) {
+			pd.Params = append(pd.Params, Param{Name: nv.Name, Value: nv.Value})
+		}
+	case "multipart/form-data":
+		pd.Params = multipartParams(body, params["boundary"])
+		if rec.BodyEncoding == "base64" {
+			// バイナリを含む multipart はテキストとして表示できないため params のみとする
+			pd.Text = ""
+		}
+	}
+	return pd
+}
+
+func response(rec capture.Record) Response {
+	info := rec.Response
+	h := info.Header()
+	mimeType := h.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	resp := Response{
+		Status:      info.Status,
+		StatusText:  http.StatusText(info.Status),
+		HTTPVersion: rec.Proto,
+		Cookies:     responseCookies(h),
+		Headers:     nameValues(info.HeaderLines),
+		Content: Content{
+			Size:     info.Size,
+			MimeType: mimeType,
+			Text:     info.Body,
+			Encoding: info.BodyEncoding,
+		},
+		RedirectURL: h.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    info.Size,
+	}
+	if info.BodyTruncated {
+		resp.Content.Comment = "body truncated"
+	}
+	return resp
+}
@@ -0,0 +1,26 @@
+package har
+
+import (
+	"testing"
+
+	"real-world-http-learn/internal/capture"
+)
+
+// TestPostDataForm は URL に使えない文字（# など）を含むフォームのボディも、送った順に params へ展開することを確認します。
+func TestPostDataForm(t *testing.T) {
+	rec := capture.Record{
+		HeaderLines: []string{"Content-Type: application/x-www-form-urlencoded"},
+		Body:        "q=a#b&tag=c++&z=%zz&empty=&q=2",
+		BodySize:    30,
+	}
+	pd := postData(rec, rec.Header())
+	want := []Param{{Name: "q", Value: "a#b"}, {Name: "tag", Value: "c  "}, {Name: "z", Value: "%zz"}, {Name: "empty"}, {Name: "q", Value: "2"}}
+	if pd == nil || len(pd.Params) != len(want) {
+		t.Fatalf("postData = %+v", pd)
+	}
+	for i, p := range pd.Params {
+		if p != want[i] {
+			t.Errorf("params[%d] = %+v, want %+v", i, p, want[i])
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// パッケージ hdrhist は、HdrHistogram と同じ方式のレイテンシのヒストグラムです。cmd/loadgen から使います。
+//
+// 値を 2 のべき乗ごとのバケットに分け、各バケットを同じ数の区間に分けて数えるので、
+// 1µs から 1 分のような広い範囲でも、指定した有効桁数（例: 3 桁なら誤差 0.1% 以内）を保ったまま
+// 一定のメモリで記録できます。パーセンタイル（p50・p99・p99.9 など）は記録した値の分布から求めます。
+package hdrhist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// ErrOutOfRange は記録できる範囲（New の lowest から highest）の外の値を記録しようとしたときのエラーです。
+var ErrOutOfRange = errors.New("hdrhist: value out of range")
+
+// Histogram は整数の値（cmd/loadgen ではマイクロ秒）の分布です。ゼロ値は使えないので New で作ります。
+// 複数の goroutine から同時に使う場合は呼び出し側で排他するか、goroutine ごとに作って Merge します。
+type Histogram struct {
+	lowest, highest int64
+	sigfigs         int
+
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketCount              int64
+	subBucketHalfCount          int64
+	subBucketMask               int64
+
+	counts     []int64
+	total      int64
+	min, max   int64
+	sum, sumSq float64
+}
+
+// New は lowest 以上 highest 以下の値を、有効数字 sigfigs 桁（1〜5）の精度で記録する Histogram を返します。
+func New(lowest, highest int64, sigfigs int) (*Histogram, error) {
+	if lowest < 1 || highest < 2*lowest || sigfigs < 1 || sigfigs > 5 {
+		return nil, fmt.Errorf("hdrhist: invalid range [%d, %d] or significant figures %d", lowest, highest, sigfigs)
+	}
+	h := &Histogram{lowest: lowest, highest: highest, sigfigs: sigfigs, min: math.MaxInt64}
+
+	// 有効桁数を保つには、1 つのバケットを 2×10^sigfigs 以上の区間に分ける必要がある
+	largestSingleUnit := 2 * int64(math.Pow10(sigfigs))
+	subBucketCountMagnitude := uint(bits.Len64(uint64(largestSingleUnit - 1)))
+	h.subBucketHalfCountMagnitude = max(subBucketCountMagnitude, 1) - 1
+	h.unitMagnitude = uint(bits.Len64(uint64(lowest)) - 1)
+	h.subBucketCount = 1 << (h.subBucketHalfCountMagnitude + 1)
+	h.subBucketHalfCount = h.subBucketCount / 2
+	h.subBucketMask = (h.subBucketCount - 1) << h.unitMagnitude
+
+	// highest まで届くバケットの数
+	buckets := 1
+	for smallestUntrackable := h.subBucketCount << h.unitMagnitude; smallestUntrackable <= highest; smallestUntrackable <<= 1 {
+		buckets++
+		if smallestUntrackable > math.MaxInt64/2 {
+			break
+		}
+	}
+	h.counts = make([]int64, (buckets+1)*int(h.subBucketHalfCount))
+	return h, nil
+}
+
+// Record は v を 1 回記録します。
+func (h *Histogram) Record(v int64) error {
+	return h.RecordN(v, 1)
+}
+
+// RecordN は v を n 回記録します。
+func (h *Histogram) RecordN(v, n int64) error {
+	if v < 0 || v > h.highest {
+		return fmt.Errorf("%w: %d (max %d)", ErrOutOfRange, v, h.highest)
+	}
+	i := h.countsIndex(v)
+	if i >= len(h.counts) {
+		return fmt.Errorf("%w: %d", ErrOutOfRange, v)
+	}
+	h.counts[i] += n
+	h.total += n
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+	f := float64(v)
+	h.sum += f * float64(n)
+	h.sumSq += f * f * float64(n)
+	return nil
+}
+
+// RecordCorrected は v を記録し、v が expectedInterval（本来の送信間隔）より長ければ、
+// その間に送れなかったはずのリクエストの分（v-interval、v-2×interval、…）も記録します。
+//
+// 前のレスポンスを待ってから次を送るクローズドループの負荷試験では、サーバーが止まっている間の
+// リクエストが送られないため、遅いレスポンスの割合が実際より小さく見えます（Coordinated Omission）。
+// その分を補正するための記録方法です。
+func (h *Histogram) RecordCorrected(v, expectedInterval int64) error {
+	if err := h.Record(v); err != nil {
+		return err
+	}
+	if expectedInterval <= 0 {
+		return nil
+	}
+	for missing := v - expectedInterval; missing >= expectedInterval; missing -= expectedInterval {
+		if err := h.Record(missing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge は other の記録を h に足します。other は h と同じ範囲と有効桁数で作ったものでなければなりません。
+func (h *Histogram) Merge(other *Histogram) error {
+	if other.lowest != h.lowest || other.highest != h.highest || other.sigfigs != h.sigfigs {
+		return errors.New("hdrhist: merging histograms with different ranges")
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.min = min(h.min, other.min)
+	h.max = max(h.max, other.max)
+	h.sum += other.sum
+	h.sumSq += other.sumSq
+	return nil
+}
+
+// Count は記録した値の数です。
+func (h *Histogram) Count() int64 { return h.total }
+
+// Min は記録した最小の値です（記録がなければ 0）。
+func (h *Histogram) Min() int64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.lowestEquivalent(h.min)
+}
+
+// Max は記録した最大の値です（同じ区間に入る値の上限で表します）。
+func (h *Histogram) Max() int64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.highestEquivalent(h.max)
+}
+
+// Mean は平均値です。
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// StdDev は標準偏差です。
+func (h *Histogram) StdDev() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	mean := h.Mean()
+	return math.Sqrt(max(h.sumSq/float64(h.total)-mean*mean, 0))
+}
+
+// ValueAtPercentile は記録した値の p パーセント（0〜100）がそれ以下になる値です。
+func (h *Histogram) ValueAtPercentile(p float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	p = min(max(p, 0), 100)
+	target := max(int64(math.Ceil(p/100*float64(h.total))), 1)
+	var seen int64
+	for i, c := range h.counts {
+		if seen += c; seen >= target {
+			return h.highestEquivalent(h.valueFromIndex(i))
+		}
+	}
+	return h.Max()
+}
+
+// Bracket はパーセンタイルの分布の 1 行です。
+type Bracket struct {
+	Percentile float64 // 0〜100
+	Value      int64
+	Count      int64 // Value 以下の値の数
+}
+
+// Distribution は HdrHistogram の出力と同じく、残り（100-p）が半分になるごとに ticksPerHalf 行ずつ、
+// 0% から 100% までのパーセンタイルを並べます（p99.9 や p99.99 のような裾の部分ほど細かく見られます）。
+func (h *Histogram) Distribution(ticksPerHalf int) []Bracket {
+	if h.total == 0 {
+		return nil
+	}
+	ticksPerHalf = max(ticksPerHalf, 1)
+	var out []Bracket
+	var seen int64
+	p := 0.0
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		if seen += c; seen == h.total {
+			break // 最後の値は 100% の行で出す
+		}
+		value := h.highestEquivalent(h.valueFromIndex(i))
+		reached := 100 * float64(seen) / float64(h.total)
+		for p <= reached {
+			out = append(out, Bracket{Percentile: p, Value: value, Count: seen})
+			// 残り (100-p) を 2 のべき乗ごとに区切り、それぞれを ticksPerHalf 等分する
+			halves := math.Floor(math.Log2(100/(100-p))) + 1
+			p += 100 / (math.Pow(2, halves) * float64(ticksPerHalf))
+		}
+	}
+	return append(out, Bracket{Percentile: 100, Value: h.Max(), Count: h.total})
+}
+
+// WritePercentiles は HdrHistogram の .hgrm 形式（Value・Percentile・TotalCount・1/(1-Percentile) の表と、
+// 平均・最大などの要約）で分布を書きます。値は scale で割って出力します（マイクロ秒を ms にするなら 1000）。
+// 出力は HdrHistogram の Plotter でグラフにできます。
+func (h *Histogram) WritePercentiles(w io.Writer, ticksPerHalf int, scale float64) error {
+	if _, err := fmt.Fprintf(w, "%12s %14s %10s %14s\n\n", "Value", "Percentile", "TotalCount", "1/(1-Percentile)"); err != nil {
+		return err
+	}
+	for _, b := range h.Distribution(ticksPerHalf) {
+		q := b.Percentile / 100
+		if q == 1 {
+			fmt.Fprintf(w, "%12.3f %2.12f %10d\n", float64(b.Value)/scale, q, b.Count)
+			continue
+		}
+		fmt.Fprintf(w, "%12.3f %2.12f %10d %14.2f\n", float64(b.Value)/scale, q, b.Count, 1/(1-q))
+	}
+	buckets := len(h.counts)/int(h.subBucketHalfCount) - 1
+	_, err := fmt.Fprintf(w, "#[Mean    = %12.3f, StdDeviation   = %12.3f]\n#[Max     = %12.3f, Total count    = %12d]\n#[Buckets = %12d, SubBuckets     = %12d]\n",
+		h.Mean()/scale, h.StdDev()/scale, float64(h.Max())/scale, h.total, buckets, h.subBucketCount)
+	return err
+}
+
+// ---- 値と counts の添字の対応（HdrHistogram と同じ計算） ----
+
+func (h *Histogram) bucketIndex(v int64) int {
+	pow2Ceiling := bits.Len64(uint64(v | h.subBucketMask))
+	return pow2Ceiling - int(h.unitMagnitude) - int(h.subBucketHalfCountMagnitude+1)
+}
+
+func (h *Histogram) subBucketIndex(v int64, bucket int) int64 {
+	return v >> (uint(bucket) + h.unitMagnitude)
+}
+
+func (h *Histogram) countsIndex(v int64) int {
+	bucket := h.bucketIndex(v)
+	sub := h.subBucketIndex(v, bucket)
+	return (bucket+1)<<h.subBucketHalfCountMagnitude + int(sub-h.subBucketHalfCount)
+}
+
+func (h *Histogram) valueFromIndex(i int) int64 {
+	bucket := i>>h.subBucketHalfCountMagnitude - 1
+	sub := int64(i)&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucket < 0 {
+		sub -= h.subBucketHalfCount
+		bucket = 0
+	}
+	return sub << (uint(bucket) + h.unitMagnitude)
+}
+
+// equivalentRange は v と同じ区間に入る（区別できない）値の幅です。
+func (h *Histogram) equivalentRange(v int64) int64 {
+	bucket := h.bucketIndex(v)
+	if h.subBucketIndex(v, bucket) >= h.subBucketCount {
+		bucket++
+	}
+	return 1 << (h.unitMagnitude + uint(bucket))
+}
+
+func (h *Histogram) lowestEquivalent(v int64) int64 {
+	bucket := h.bucketIndex(v)
+	return h.subBucketIndex(v, bucket) << (uint(bucket) + h.unitMagnitude)
+}
+
+func (h *Histogram) highestEquivalent(v int64) int64 {
+	return h.lowestEquivalent(v) + h.equivalentRange(v) - 1
+}
@@ -0,0 +1,103 @@
+package hdrhist
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestHistogram は有効桁数の精度で求めたパーセンタイル・最小・最大・平均と、範囲外の値を確認します。
+func TestHistogram(t *testing.T) {
+	h, err := New(1, 3_600_000_000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1〜10000 を 1 回ずつと、100000000 を 1 回
+	for v := int64(1); v <= 10000; v++ {
+		if err := h.Record(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Record(100_000_000)
+
+	within := func(got, want int64) bool {
+		// 有効数字 3 桁なので誤差は 0.1% 以内
+		d := got - want
+		return d >= -want/1000-1 && d <= want/1000+1
+	}
+	tests := []struct {
+		p    float64
+		want int64
+	}{
+		{0, 1},
+		{50, 5001},
+		{90, 9001},
+		{99, 9901},
+		{99.99, 10000},
+		{100, 100_000_000},
+	}
+	for _, tt := range tests {
+		if got := h.ValueAtPercentile(tt.p); !within(got, tt.want) {
+			t.Errorf("p%v = %d, want ≈ %d", tt.p, got, tt.want)
+		}
+	}
+	if h.Count() != 10001 || h.Min() != 1 || !within(h.Max(), 100_000_000) {
+		t.Errorf("count %d, min %d, max %d", h.Count(), h.Min(), h.Max())
+	}
+	if mean := h.Mean(); mean < 14999 || mean > 15001 {
+		t.Errorf("mean %v", mean)
+	}
+	if err := h.Record(3_600_000_001); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("out of range: %v", err)
+	}
+
+	// 分布は 0% から 100% まで増えていき、.hgrm 形式で書ける
+	dist := h.Distribution(5)
+	for i := 1; i < len(dist); i++ {
+		if dist[i].Percentile <= dist[i-1].Percentile || dist[i].Value < dist[i-1].Value {
+			t.Fatalf("distribution not increasing at %d: %+v %+v", i, dist[i-1], dist[i])
+		}
+	}
+	if last := dist[len(dist)-1]; last.Percentile != 100 || last.Count != 10001 {
+		t.Errorf("last bracket %+v", last)
+	}
+	var buf bytes.Buffer
+	if err := h.WritePercentiles(&buf, 5, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "1/(1-Percentile)") || !strings.Contains(out, "Total count    =        10001") {
+		t.Errorf("hgrm:\n%s", out)
+	}
+}
+
+// TestRecordCorrected は Coordinated Omission の補正で、送れなかった分の値が足されることを確認します。
+func TestRecordCorrected(t *testing.T) {
+	raw, _ := New(1, 1_000_000, 3)
+	corrected, _ := New(1, 1_000_000, 3)
+	// 10ms ごとに送るはずが、1 回だけ 1 秒止まった
+	for range 99 {
+		raw.Record(1000)
+		corrected.RecordCorrected(1000, 10_000)
+	}
+	raw.Record(1_000_000)
+	corrected.RecordCorrected(1_000_000, 10_000)
+
+	if raw.Count() != 100 || corrected.Count() != 199 {
+		t.Fatalf("count raw %d, corrected %d", raw.Count(), corrected.Count())
+	}
+	// 補正しないと p90 は 1ms のままだが、補正すると止まっていた間のリクエストが遅い側に入る
+	if raw.ValueAtPercentile(90) > 1001 || corrected.ValueAtPercentile(90) < 500_000 {
+		t.Errorf("p90 raw %d, corrected %d", raw.ValueAtPercentile(90), corrected.ValueAtPercentile(90))
+	}
+
+	other, _ := New(1, 1_000_000, 3)
+	other.Record(5)
+	if err := raw.Merge(other); err != nil || raw.Count() != 101 || raw.Min() != 5 {
+		t.Errorf("merge: %v count %d min %d", err, raw.Count(), raw.Min())
+	}
+	different, _ := New(1, 1000, 3)
+	if err := raw.Merge(different); err == nil {
+		t.Error("merged histograms with different ranges")
+	}
+}
@@ -0,0 +1,442 @@
+package httpauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 既定の有効期間です。
+const (
+	DefaultNonceTTL = 5 * time.Minute
+	DefaultTokenTTL = time.Hour
+)
+
+// maxAuthIntBody は qop=auth-int でハッシュを確かめるために読むボディの上限です。
+const maxAuthIntBody = 10 << 20
+
+// Identity は認証できたユーザーです。
+type Identity struct {
+	User   string
+	Scheme string // Basic・Digest・Bearer
+}
+
+type identityKey struct{}
+
+// FromContext は Middleware が認証したユーザーを返します。
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Authenticator は Basic・Digest・Bearer のいずれかで認証できないリクエストに、
+// 使える方式を WWW-Authenticate に並べた 401 を返すミドルウェアです。New で作ります。
+//
+// Digest の nonce は時刻と HMAC から作るので保存しませんが、nonce ごとに最後に受け付けた nc を覚えておき、
+// 同じ nc の再利用（リプレイ）を拒否します。有効期間を過ぎた nonce に正しい response が届いたら stale=true を付けて、
+// パスワードを聞き直さずに新しい nonce で送り直せることをクライアントに伝えます。
+type Authenticator struct {
+	// Realm は保護空間の名前で、Digest の A1 にも使います。
+	Realm string
+	// Users はユーザー名とパスワードです（Basic・Digest で使います）。
+	Users map[string]string
+	// Schemes は 401 で提示する方式を WWW-Authenticate に並べる順です（nil なら Digest・Basic・Bearer）。
+	Schemes []string
+	// Algorithms は提示する Digest のアルゴリズムです（nil なら SHA-256・MD5）。
+	Algorithms []string
+	// Qop は提示する Digest の qop です（nil なら auth・auth-int）。
+	Qop []string
+	// NonceTTL は Digest の nonce の、TokenTTL は TokenHandler が発行する Bearer トークンの有効期間です。
+	NonceTTL, TokenTTL time.Duration
+	// Logf を設定すると、認証の失敗の理由を受け取れます（nil なら log.Printf）。
+	Logf func(format string, args ...any)
+
+	key    []byte
+	opaque string
+	now    func() time.Time
+
+	mu          sync.Mutex
+	nonceCounts map[string]uint32 // nonce → 最後に受け付けた nc
+	tokens      map[string]issuedToken
+}
+
+type issuedToken struct {
+	user    string
+	expires time.Time
+}
+
+// New は realm と users で認証する Authenticator を返します。nonce の HMAC の鍵は起動ごとに作ります。
+func New(realm string, users map[string]string) *Authenticator {
+	a := &Authenticator{
+		Realm:       realm,
+		Users:       users,
+		key:         make([]byte, 32),
+		now:         time.Now,
+		nonceCounts: map[string]uint32{},
+		tokens:      map[string]issuedToken{},
+	}
+	rand.Read(a.key)
+	opaque := make([]byte, 16)
+	rand.Read(opaque)
+	a.opaque = hex.EncodeToString(opaque)
+	return a
+}
+
+func (a *Authenticator) schemes() []string {
+	if a.Schemes == nil {
+		return []string{Digest, Basic, Bearer}
+	}
+	return a.Schemes
+}
+
+func (a *Authenticator) algorithms() []string {
+	if a.Algorithms == nil {
+		return []string{"SHA-256", "MD5"}
+	}
+	return a.Algorithms
+}
+
+func (a *Authenticator) qops() []string {
+	if a.Qop == nil {
+		return []string{"auth", "auth-int"}
+	}
+	return a.Qop
+}
+
+func (a *Authenticator) nonceTTL() time.Duration {
+	if a.NonceTTL <= 0 {
+		return DefaultNonceTTL
+	}
+	return a.NonceTTL
+}
+
+func (a *Authenticator) tokenTTL() time.Duration {
+	if a.TokenTTL <= 0 {
+		return DefaultTokenTTL
+	}
+	return a.TokenTTL
+}
+
+func (a *Authenticator) logf(format string, args ...any) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (a *Authenticator) offers(scheme string) bool {
+	return slices.ContainsFunc(a.schemes(), func(s string) bool { return strings.EqualFold(s, scheme) })
+}
+
+// failure は認証できなかった理由と、401 のチャレンジに付ける情報です。
+type failure struct {
+	err         error
+	stale       bool   // Digest の nonce の期限切れ（response は正しい）
+	bearerError string // RFC 6750 §3.1 の error
+}
+
+var errNoCredentials = errors.New("no credentials")
+
+// Middleware は認証できたリクエストだけを、FromContext でユーザーを取り出せるようにして next に渡します。
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, fail := a.authenticate(w, r)
+		if fail != nil {
+			if fail.err != errNoCredentials {
+				a.logf("httpauth: %s %s: %v", r.Method, r.URL.Path, fail.err)
+			}
+			a.challenge(w, fail)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// challenge は提示する方式ごとのチャレンジを付けた 401 を返します。
+func (a *Authenticator) challenge(w http.ResponseWriter, fail *failure) {
+	h := w.Header()
+	for _, scheme := range a.schemes() {
+		switch {
+		case strings.EqualFold(scheme, Digest):
+			for _, alg := range a.algorithms() {
+				c := Challenge{Scheme: Digest, Params: map[string]string{
+					"realm":     a.Realm,
+					"qop":       strings.Join(a.qops(), ", "),
+					"algorithm": alg,
+					"nonce":     a.newNonce(),
+					"opaque":    a.opaque,
+					"userhash":  "true",
+					"charset":   "UTF-8",
+				}}
+				if fail.stale {
+					c.Params["stale"] = "true"
+				}
+				h.Add("WWW-Authenticate", c.String())
+			}
+		case strings.EqualFold(scheme, Basic):
+			h.Add("WWW-Authenticate", Challenge{Scheme: Basic, Params: map[string]string{"realm": a.Realm, "charset": "UTF-8"}}.String())
+		case strings.EqualFold(scheme, Bearer):
+			c := Challenge{Scheme: Bearer, Params: map[string]string{"realm": a.Realm}}
+			if fail.bearerError != "" {
+				c.Params["error"] = fail.bearerError
+				c.Params["error_description"] = fail.err.Error()
+			}
+			h.Add("WWW-Authenticate", c.String())
+		}
+	}
+	http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+}
+
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request) (Identity, *failure) {
+	v := r.Header.Get("Authorization")
+	if v == "" {
+		return Identity{}, &failure{err: errNoCredentials}
+	}
+	c, ok := ParseAuthorization(v)
+	if !ok {
+		return Identity{}, &failure{err: errors.New("malformed Authorization header")}
+	}
+	if !a.offers(c.Scheme) {
+		return Identity{}, &failure{err: fmt.Errorf("scheme %q is not offered", c.Scheme)}
+	}
+	switch {
+	case c.Is(Basic):
+		return a.basic(c)
+	case c.Is(Bearer):
+		return a.bearer(c)
+	case c.Is(Digest):
+		return a.digest(w, r, c)
+	}
+	return Identity{}, &failure{err: fmt.Errorf("unsupported scheme %q", c.Scheme)}
+}
+
+func (a *Authenticator) basic(c Challenge) (Identity, *failure) {
+	decoded, err := base64.StdEncoding.DecodeString(c.Token68)
+	if err != nil {
+		return Identity{}, &failure{err: fmt.Errorf("basic: %w", err)}
+	}
+	user, password, _ := strings.Cut(string(decoded), ":")
+	if !a.checkPassword(user, password) {
+		return Identity{}, &failure{err: fmt.Errorf("basic: wrong password for %q", user)}
+	}
+	return Identity{User: user, Scheme: Basic}, nil
+}
+
+// checkPassword はユーザーの有無で応答時間が変わらないよう、存在しない場合も比較します。
+func (a *Authenticator) checkPassword(user, password string) bool {
+	want, known := a.Users[user]
+	return subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1 && known
+}
+
+func (a *Authenticator) bearer(c Challenge) (Identity, *failure) {
+	a.mu.Lock()
+	t, ok := a.tokens[c.Token68]
+	a.mu.Unlock()
+	switch {
+	case !ok:
+		return Identity{}, &failure{err: errors.New("unknown access token"), bearerError: "invalid_token"}
+	case !a.now().Before(t.expires):
+		return Identity{}, &failure{err: errors.New("the access token expired"), bearerError: "invalid_token"}
+	}
+	return Identity{User: t.user, Scheme: Bearer}, nil
+}
+
+func (a *Authenticator) digest(w http.ResponseWriter, r *http.Request, c Challenge) (Identity, *failure) {
+	fail := func(format string, args ...any) (Identity, *failure) {
+		return Identity{}, &failure{err: fmt.Errorf("digest: "+format, args...)}
+	}
+	alg := c.Param("algorithm")
+	if alg == "" {
+		alg = "MD5"
+	}
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	switch {
+	case c.Param("realm") != a.Realm:
+		return fail("realm %q", c.Param("realm"))
+	case !slices.ContainsFunc(a.algorithms(), func(s string) bool { return strings.EqualFold(s, alg) }):
+		return fail("algorithm %q is not offered", alg)
+	case !slices.Contains(a.qops(), c.Param("qop")):
+		return fail("qop %q is not offered", c.Param("qop"))
+	case c.Param("uri") != uri:
+		return fail("uri %q does not match the request target %q", c.Param("uri"), uri)
+	case c.Param("opaque") != a.opaque:
+		return fail("opaque does not match")
+	}
+	nc, err := strconv.ParseUint(c.Param("nc"), 16, 32)
+	if err != nil || len(c.Param("nc")) != 8 {
+		return fail("nc %q", c.Param("nc"))
+	}
+	issued, valid := a.checkNonce(c.Param("nonce"))
+	if !valid {
+		return fail("nonce was not issued by this server")
+	}
+
+	user := c.Param("username")
+	switch {
+	case c.Param("userhash") == "true":
+		found := false
+		for name := range a.Users {
+			if UserHash(alg, name, a.Realm) == user {
+				user, found = name, true
+				break
+			}
+		}
+		if !found {
+			return fail("unknown userhash")
+		}
+	case c.Param("username*") != "":
+		// RFC 8187 の ext-value（UTF-8''%E3%81%82 のような形式）
+		encoded, ok := strings.CutPrefix(c.Param("username*"), "UTF-8''")
+		if !ok {
+			return fail("username* must be UTF-8")
+		}
+		if user, err = url.PathUnescape(encoded); err != nil {
+			return fail("username*: %v", err)
+		}
+	}
+	password, known := a.Users[user]
+
+	params := DigestParams{
+		Algorithm: alg,
+		Username:  user,
+		Realm:     a.Realm,
+		Password:  password,
+		Method:    r.Method,
+		URI:       uri,
+		Nonce:     c.Param("nonce"),
+		CNonce:    c.Param("cnonce"),
+		NC:        c.Param("nc"),
+		Qop:       c.Param("qop"),
+	}
+	if params.Qop == "auth-int" {
+		// ボディのハッシュを確かめたあと、next からも読めるよう読み込んだ内容に差し替える
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAuthIntBody))
+		if err != nil {
+			return fail("reading body for auth-int: %v", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		params.Body = body
+	}
+	want, err := params.Response()
+	if err != nil {
+		return fail("%v", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(want), []byte(c.Param("response"))) != 1 || !known {
+		return fail("wrong response for %q", user)
+	}
+	if a.now().Sub(issued) > a.nonceTTL() {
+		return Identity{}, &failure{err: errors.New("digest: nonce expired"), stale: true}
+	}
+	if !a.useNonce(params.Nonce, uint32(nc)) {
+		return fail("nonce count %s was already used", params.NC)
+	}
+	if a.now().Sub(issued) > a.nonceTTL()/2 {
+		// 期限が近い nonce には、次に使う nonce を知らせる（RFC 7616 §3.5）
+		w.Header().Set("Authentication-Info", "nextnonce="+quote(a.newNonce()))
+	}
+	return Identity{User: user, Scheme: Digest}, nil
+}
+
+// newNonce は発行した時刻と、その HMAC からなる nonce を作ります。
+func (a *Authenticator) newNonce() string {
+	var b [8 + 16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(a.now().UnixNano()))
+	copy(b[8:], a.mac(b[:8]))
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+func (a *Authenticator) mac(ts []byte) []byte {
+	m := hmac.New(sha256.New, a.key)
+	m.Write(ts)
+	m.Write([]byte(a.Realm))
+	return m.Sum(nil)[:16]
+}
+
+// checkNonce は nonce がこのサーバーの発行したものかを確かめ、発行した時刻を返します。
+func (a *Authenticator) checkNonce(nonce string) (time.Time, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != 8+16 || !hmac.Equal(b[8:], a.mac(b[:8])) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[:8]))), true
+}
+
+// useNonce は nonce の nc が前回より大きければ記録して true を返します。期限の切れた nonce の記録は捨てます。
+func (a *Authenticator) useNonce(nonce string, nc uint32) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if nc <= a.nonceCounts[nonce] {
+		return false
+	}
+	a.nonceCounts[nonce] = nc
+	for n := range a.nonceCounts {
+		if issued, _ := a.checkNonce(n); a.now().Sub(issued) > a.nonceTTL() {
+			delete(a.nonceCounts, n)
+		}
+	}
+	return true
+}
+
+// IssueToken は user の Bearer トークンを発行し、期限とともに返します。
+func (a *Authenticator) IssueToken(user string) (string, time.Time) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	expires := a.now().Add(a.tokenTTL())
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for t, issued := range a.tokens {
+		if !a.now().Before(issued.expires) {
+			delete(a.tokens, t)
+		}
+	}
+	a.tokens[token] = issuedToken{user: user, expires: expires}
+	return token, expires
+}
+
+// TokenHandler は Middleware で認証したユーザーに、POST で Bearer トークンを発行するハンドラです（Middleware で包んで使います）。
+// レスポンスは OAuth 2.0 のトークンレスポンス（RFC 6749 §5.1）と同じ形の JSON です。
+func (a *Authenticator) TokenHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := FromContext(r.Context())
+		if !ok {
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		token, expires := a.IssueToken(id.User)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": token,
+			"token_type":   Bearer,
+			"expires_in":   int(expires.Sub(a.now()).Seconds()),
+		})
+	})
+}
@@ -0,0 +1,318 @@
+// パッケージ httpauth は、HTTP 認証（RFC 9110 §11）の WWW-Authenticate・Authorization の解釈と、
+// Digest 認証（RFC 7616）の計算、Basic・Digest・Bearer（RFC 6750）の 401 を返すサーバー側のミドルウェア（Authenticator）です。
+// server.go の -auth-user と、ch04/10_httpcli の --digest・--anyauth・--oauth2-bearer（httpclient.Auth）から使います。
+package httpauth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+)
+
+// 認証方式の名前です。比較は大文字小文字を区別しません（strings.EqualFold）。
+const (
+	Basic  = "Basic"
+	Digest = "Digest"
+	Bearer = "Bearer"
+)
+
+// Challenge は WWW-Authenticate の 1 つのチャレンジ、または Authorization の資格情報です。
+// "Basic dXNlcjpwYXNz" のような token68 の形式なら Token68 に、"realm=..., nonce=..." の形式なら Params に入ります。
+type Challenge struct {
+	Scheme  string
+	Token68 string
+	// Params のキーは小文字です。
+	Params map[string]string
+}
+
+// Param はパラメータ name（大文字小文字を区別しない）の値です。
+func (c Challenge) Param(name string) string {
+	return c.Params[strings.ToLower(name)]
+}
+
+// Is は方式が scheme かどうかです。
+func (c Challenge) Is(scheme string) bool {
+	return strings.EqualFold(c.Scheme, scheme)
+}
+
+// String はヘッダの値の形式にします。パラメータは order の順に並べ、残りは名前の順にします。
+// 値は algorithm・nc・stale・userhash・username* と Authorization の qop 以外を引用符で囲みます（RFC 7616 の書き方）。
+func (c Challenge) String() string {
+	if c.Token68 != "" {
+		return c.Scheme + " " + c.Token68
+	}
+	order := []string{"username", "username*", "realm", "uri", "algorithm", "nonce", "nc", "cnonce", "qop", "response", "opaque", "stale", "userhash", "charset", "error", "error_description"}
+	names := make([]string, 0, len(c.Params))
+	for name := range c.Params {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		ia, ib := slices.Index(order, a), slices.Index(order, b)
+		switch {
+		case ia < 0 && ib < 0:
+			return strings.Compare(a, b)
+		case ia < 0:
+			return 1
+		case ib < 0:
+			return -1
+		}
+		return ia - ib
+	})
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		v := c.Params[name]
+		switch name {
+		case "algorithm", "nc", "stale", "userhash", "username*":
+			parts = append(parts, name+"="+v)
+		default:
+			if name == "qop" && !strings.Contains(v, ",") && c.Params["response"] != "" {
+				// Authorization の qop は token（RFC 7616 §3.4）
+				parts = append(parts, name+"="+v)
+				continue
+			}
+			parts = append(parts, name+"="+quote(v))
+		}
+	}
+	if len(parts) == 0 {
+		return c.Scheme
+	}
+	return c.Scheme + " " + strings.Join(parts, ", ")
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// ParseChallenges は WWW-Authenticate（複数行でも、1 行に複数のチャレンジがあってもよい）を解釈します。
+// 書式の誤りがあれば、そこまでに読めたチャレンジを返します。
+func ParseChallenges(values []string) []Challenge {
+	var out []Challenge
+	for _, v := range values {
+		p := &parser{s: v}
+		for {
+			p.skip(" \t,")
+			if p.eof() {
+				break
+			}
+			c, ok := p.challenge()
+			if !ok {
+				break
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ParseAuthorization は Authorization の値を解釈します。
+func ParseAuthorization(v string) (Challenge, bool) {
+	p := &parser{s: v}
+	p.skip(" \t")
+	c, ok := p.challenge()
+	if !ok {
+		return Challenge{}, false
+	}
+	p.skip(" \t")
+	return c, p.eof()
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.s) }
+
+func (p *parser) skip(chars string) {
+	for !p.eof() && strings.IndexByte(chars, p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// token は RFC 9110 の tchar の並びを読みます。
+func (p *parser) token() string {
+	start := p.pos
+	for !p.eof() && isTchar(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func isToken68(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~+/", c) >= 0
+}
+
+func isTchar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// challenge は auth-scheme [ 1*SP ( token68 / #auth-param ) ] を読みます。
+// auth-param の途中で「名前の後に = がない」ものが来たら、次のチャレンジの始まりとしてそこで止めます。
+func (p *parser) challenge() (Challenge, bool) {
+	c := Challenge{Scheme: p.token(), Params: map[string]string{}}
+	if c.Scheme == "" {
+		return c, false
+	}
+	if p.eof() || p.s[p.pos] != ' ' && p.s[p.pos] != '\t' {
+		return c, true
+	}
+	p.skip(" \t")
+	// token68（英数字と -._~+/ の並びと末尾の =）の後は、終わりかカンマ
+	start := p.pos
+	for !p.eof() && isToken68(p.s[p.pos]) {
+		p.pos++
+	}
+	if p.pos > start {
+		for !p.eof() && p.s[p.pos] == '=' {
+			p.pos++
+		}
+		token68 := p.s[start:p.pos]
+		p.skip(" \t")
+		if p.eof() || p.s[p.pos] == ',' {
+			c.Token68 = token68
+			return c, true
+		}
+	}
+	p.pos = start
+	for {
+		p.skip(" \t")
+		start = p.pos
+		name := strings.ToLower(p.token())
+		if name == "" {
+			return c, len(c.Params) > 0
+		}
+		p.skip(" \t")
+		if p.eof() || p.s[p.pos] != '=' {
+			// 次のチャレンジの方式名
+			p.pos = start
+			return c, true
+		}
+		p.pos++
+		p.skip(" \t")
+		var value string
+		if !p.eof() && p.s[p.pos] == '"' {
+			v, ok := p.quoted()
+			if !ok {
+				return c, false
+			}
+			value = v
+		} else {
+			value = p.token()
+		}
+		c.Params[name] = value
+		p.skip(" \t")
+		if p.eof() {
+			return c, true
+		}
+		if p.s[p.pos] != ',' {
+			return c, false
+		}
+		// カンマの後が同じチャレンジの次のパラメータか、次のチャレンジかは、次の名前の後ろに = があるかで決まる
+		p.pos++
+		p.skip(" \t,")
+	}
+}
+
+// quoted は quoted-string を読み、\ によるエスケープを外した値を返します。
+func (p *parser) quoted() (string, bool) {
+	var b strings.Builder
+	for p.pos++; !p.eof(); p.pos++ {
+		switch c := p.s[p.pos]; c {
+		case '\\':
+			if p.pos++; p.eof() {
+				return "", false
+			}
+			b.WriteByte(p.s[p.pos])
+		case '"':
+			p.pos++
+			return b.String(), true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// DigestAlgorithms は扱える Digest のアルゴリズムを強い順に並べたものです（"-sess" 付きも扱えます）。
+var DigestAlgorithms = []string{"SHA-512-256", "SHA-256", "MD5"}
+
+// digestHash は algorithm（"-sess" を除いた部分）のハッシュ関数を返します。省略時は RFC 7616 の既定の MD5 です。
+func digestHash(algorithm string) (func() hash.Hash, bool) {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New, true
+	case "SHA-256":
+		return sha256.New, true
+	case "SHA-512-256":
+		return sha512.New512_256, true
+	}
+	return nil, false
+}
+
+// SupportedAlgorithm は algorithm を扱えるかどうかです。
+func SupportedAlgorithm(algorithm string) bool {
+	_, ok := digestHash(algorithm)
+	return ok
+}
+
+// DigestParams は Digest の response を計算するのに使う値です。
+type DigestParams struct {
+	Algorithm string // MD5・SHA-256・SHA-512-256（"-sess" 付きも可）
+	Username  string // userhash の場合も元のユーザー名
+	Realm     string
+	Password  string
+	Method    string
+	URI       string // リクエストターゲット（Authorization の uri と同じもの）
+	Nonce     string
+	CNonce    string
+	NC        string // 8 桁の 16 進数
+	Qop       string // "auth"・"auth-int"
+	// Body は qop=auth-int のときのリクエストのボディです。
+	Body []byte
+}
+
+func hexHash(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Response は RFC 7616 §3.4.1 の response の値を計算します。
+//
+//	A1 = username:realm:password（-sess なら H(username:realm:password):nonce:cnonce）
+//	A2 = method:uri（auth-int なら method:uri:H(body)）
+//	response = H(H(A1):nonce:nc:cnonce:qop:H(A2))
+func (d DigestParams) Response() (string, error) {
+	newHash, ok := digestHash(d.Algorithm)
+	if !ok {
+		return "", fmt.Errorf("httpauth: unsupported digest algorithm %q", d.Algorithm)
+	}
+	h := func(s string) string { return hexHash(newHash, s) }
+	ha1 := h(d.Username + ":" + d.Realm + ":" + d.Password)
+	if strings.HasSuffix(strings.ToUpper(d.Algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + d.Nonce + ":" + d.CNonce)
+	}
+	a2 := d.Method + ":" + d.URI
+	switch d.Qop {
+	case "auth":
+	case "auth-int":
+		a2 += ":" + hexHash(newHash, string(d.Body))
+	default:
+		return "", fmt.Errorf("httpauth: unsupported qop %q", d.Qop)
+	}
+	return h(ha1 + ":" + d.Nonce + ":" + d.NC + ":" + d.CNonce + ":" + d.Qop + ":" + h(a2)), nil
+}
+
+// UserHash は userhash=true のときに username の代わりに送る H(username:realm) です。
+func UserHash(algorithm, username, realm string) string {
+	newHash, ok := digestHash(algorithm)
+	if !ok {
+		return ""
+	}
+	return hexHash(newHash, username+":"+realm)
+}
@@ -0,0 +1,172 @@
+package httpauth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseChallenges は 1 行に並んだ複数のチャレンジ・token68・引用符のエスケープの解釈と、String との往復を確認します。
+func TestParseChallenges(t *testing.T) {
+	got := ParseChallenges([]string{
+		`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"`,
+		`Bearer, Negotiate YIIB+g==`,
+	})
+	if len(got) != 5 {
+		t.Fatalf("got %d challenges: %+v", len(got), got)
+	}
+	if !got[0].Is("newauth") || got[0].Param("title") != `Login to "apps"` || got[0].Param("TYPE") != "1" {
+		t.Errorf("Newauth: %+v", got[0])
+	}
+	if !got[1].Is(Basic) || got[1].Param("realm") != "simple" {
+		t.Errorf("Basic: %+v", got[1])
+	}
+	if !got[2].Is(Digest) || got[2].Param("qop") != "auth, auth-int" || got[2].Param("algorithm") != "SHA-256" {
+		t.Errorf("Digest: %+v", got[2])
+	}
+	if !got[3].Is(Bearer) || len(got[3].Params) != 0 || got[4].Token68 != "YIIB+g==" {
+		t.Errorf("Bearer, Negotiate: %+v %+v", got[3], got[4])
+	}
+	if again := ParseChallenges([]string{got[2].String()}); len(again) != 1 || again[0].Param("nonce") != got[2].Param("nonce") {
+		t.Errorf("round trip of %q: %+v", got[2], again)
+	}
+
+	if c, ok := ParseAuthorization("Basic dXNlcjpwYXNz"); !ok || c.Token68 != "dXNlcjpwYXNz" {
+		t.Errorf("Basic credentials: %+v %v", c, ok)
+	}
+	if _, ok := ParseAuthorization(`Digest username="a`); ok {
+		t.Error("unterminated quoted-string was accepted")
+	}
+}
+
+// TestDigestResponse は RFC 7616 §3.9.1 の例の response と、-sess・auth-int・userhash の計算を確認します。
+func TestDigestResponse(t *testing.T) {
+	params := DigestParams{
+		Username: "Mufasa",
+		Realm:    "http-auth@example.org",
+		Password: "Circle of Life",
+		Method:   http.MethodGet,
+		URI:      "/dir/index.html",
+		Nonce:    "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		CNonce:   "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+		NC:       "00000001",
+		Qop:      "auth",
+	}
+	for alg, want := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		params.Algorithm = alg
+		if got, err := params.Response(); err != nil || got != want {
+			t.Errorf("%s: %s, %v", alg, got, err)
+		}
+	}
+
+	params.Algorithm = "SHA-256"
+	plain, _ := params.Response()
+	for _, p := range []DigestParams{
+		func(p DigestParams) DigestParams { p.Algorithm = "SHA-256-sess"; return p }(params),
+		func(p DigestParams) DigestParams { p.Qop = "auth-int"; p.Body = []byte("a=b"); return p }(params),
+	} {
+		if got, err := p.Response(); err != nil || got == plain || len(got) != 64 {
+			t.Errorf("%s %s: %s, %v", p.Algorithm, p.Qop, got, err)
+		}
+	}
+	params.Algorithm = "SHA-1"
+	if _, err := params.Response(); err == nil {
+		t.Error("SHA-1 was accepted")
+	}
+	if got := UserHash("SHA-512-256", "Jäsøn Doe", "api@example.org"); got != "793263caabb707a56211940d90411ea4a575adeccb7e360aeb624ed06ece9b0b" {
+		t.Errorf("UserHash = %s", got)
+	}
+}
+
+// TestAuthenticator は 401 のチャレンジ、Basic・Bearer・Digest の検証、nc の再利用の拒否、期限切れの nonce の stale を確認します。
+func TestAuthenticator(t *testing.T) {
+	a := New("test", map[string]string{"alice": "secret"})
+	a.Logf = t.Logf
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+	srv := httptest.NewServer(a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		w.Write([]byte(id.Scheme + ":" + id.User))
+	})))
+	defer srv.Close()
+
+	do := func(authorization string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/dir/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := do("")
+	challenges := ParseChallenges(resp.Header.Values("WWW-Authenticate"))
+	if resp.StatusCode != http.StatusUnauthorized || len(challenges) != 4 {
+		t.Fatalf("%d %v", resp.StatusCode, resp.Header)
+	}
+	digest := challenges[0]
+	if !digest.Is(Digest) || digest.Param("algorithm") != "SHA-256" || digest.Param("userhash") != "true" || !challenges[2].Is(Basic) {
+		t.Errorf("challenges: %+v", challenges)
+	}
+
+	basic := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	if resp := do(basic("alice", "secret")); resp.StatusCode != http.StatusOK {
+		t.Errorf("Basic: %d", resp.StatusCode)
+	}
+	if resp := do(basic("alice", "wrong")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Basic with a wrong password: %d", resp.StatusCode)
+	}
+
+	token, _ := a.IssueToken("alice")
+	if resp := do("Bearer " + token); resp.StatusCode != http.StatusOK {
+		t.Errorf("Bearer: %d", resp.StatusCode)
+	}
+	now = now.Add(DefaultTokenTTL)
+	resp = do("Bearer " + token)
+	if c := ParseChallenges(resp.Header.Values("WWW-Authenticate")); resp.StatusCode != http.StatusUnauthorized || c[3].Param("error") != "invalid_token" {
+		t.Errorf("expired Bearer: %d %+v", resp.StatusCode, c)
+	}
+
+	authorization := func(nonce, nc string) string {
+		p := DigestParams{
+			Algorithm: "SHA-256", Username: "alice", Realm: "test", Password: "secret",
+			Method: http.MethodGet, URI: "/dir/", Nonce: nonce, CNonce: "cnonce", NC: nc, Qop: "auth",
+		}
+		response, _ := p.Response()
+		return Challenge{Scheme: Digest, Params: map[string]string{
+			"username": UserHash("SHA-256", "alice", "test"), "userhash": "true", "realm": "test", "uri": "/dir/",
+			"algorithm": "SHA-256", "nonce": nonce, "nc": nc, "cnonce": "cnonce", "qop": "auth",
+			"response": response, "opaque": digest.Param("opaque"),
+		}}.String()
+	}
+	nonce := a.newNonce()
+	if resp := do(authorization(nonce, "00000001")); resp.StatusCode != http.StatusOK || resp.Header.Get("Authentication-Info") != "" {
+		t.Errorf("Digest: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := do(authorization(nonce, "00000001")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("replayed nc: %d", resp.StatusCode)
+	}
+	now = now.Add(DefaultNonceTTL * 3 / 4)
+	if resp := do(authorization(nonce, "00000002")); resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Authentication-Info"), "nextnonce=") {
+		t.Errorf("Digest near expiry: %d %v", resp.StatusCode, resp.Header)
+	}
+	now = now.Add(DefaultNonceTTL)
+	resp = do(authorization(nonce, "00000003"))
+	if c := ParseChallenges(resp.Header.Values("WWW-Authenticate")); resp.StatusCode != http.StatusUnauthorized || c[0].Param("stale") != "true" {
+		t.Errorf("expired nonce: %d %+v", resp.StatusCode, c)
+	}
+}
@@ -0,0 +1,377 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"real-world-http-learn/internal/httpauth"
+)
+
+// Auth は 401 の WWW-Authenticate に応じて Authorization を付け、リクエストを送り直す設定です（curl の --anyauth 相当）。
+// Transport で RoundTripper を包んで使います。req.SetBasicAuth と違い、サーバーが求める方式で答えられます。
+//
+// 応じる方式は Bearer（Token がある場合）・Digest・Basic（Username がある場合）の順に優先します。
+// Digest はアルゴリズムの強いもの（SHA-512-256・SHA-256・MD5）を選び、qop は auth-int（ボディも含めて署名）を auth より優先します。
+// 一度応じたオリジンには、次のリクエストから 401 を待たずに Authorization を付けます（Digest は同じ nonce で nc を増やします）。
+type Auth struct {
+	// Username と Password は Basic・Digest で使います。
+	Username, Password string
+	// Token は Bearer のアクセストークンを返します（nil なら Bearer に応じません）。最初に必要になったとき 1 回だけ呼びます。
+	Token func(ctx context.Context) (string, error)
+	// Refresh はトークンが拒否された（Bearer で 401 が返った）ときに新しいトークンを返します。nil なら送り直しません。
+	Refresh func(ctx context.Context) (string, error)
+	// Schemes は応じる方式です（nil なら Bearer・Digest・Basic）。
+	Schemes []string
+	// Origin を設定すると、そのオリジン（"https://example.com:8443" の形式）にだけ資格情報を送ります。
+	// リダイレクトで別のオリジンへ移ったとき、パスワードやトークンを送らないために使います。
+	Origin string
+	// Logf を設定すると、どの方式で応じたかを受け取れます（-v の表示用）。
+	Logf func(format string, args ...any)
+
+	mu     sync.Mutex
+	token  string
+	spaces map[string]*authSpace // オリジン → 最後に応じた方式
+	cnonce func() string
+}
+
+// authSpace はオリジンごとに、最後に応じた方式と Digest の状態を覚えておくものです。
+type authSpace struct {
+	scheme string
+	digest *digestState
+}
+
+// digestState は Digest のチャレンジと、その nonce で送った回数（nc）です。
+type digestState struct {
+	challenge httpauth.Challenge
+	nc        uint32
+}
+
+// Transport は next へ送り、401 に応じて Authorization を付けて送り直す RoundTripper を返します。
+// ボディのあるリクエストを送り直すには GetBody が必要です（ない場合は 401 をそのまま返します）。
+func (a *Auth) Transport(next http.RoundTripper) http.RoundTripper {
+	return &authTransport{auth: a, next: next}
+}
+
+type authTransport struct {
+	auth *Auth
+	next http.RoundTripper
+}
+
+func origin(u *url.URL) string {
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	a := t.auth
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" ||
+		a.Origin != "" && !strings.EqualFold(origin(req.URL), strings.TrimSuffix(a.Origin, "/")) {
+		return t.next.RoundTrip(req)
+	}
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	key := origin(req.URL)
+	refreshed, answered := false, false
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("httpclient: auth: %w", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		sent, authorization, err := a.authorization(req, key)
+		if err != nil {
+			return nil, err
+		}
+		if authorization != "" {
+			if attemptReq == req {
+				attemptReq = req.Clone(req.Context())
+			}
+			attemptReq.Header.Set("Authorization", authorization)
+		}
+		resp, err := t.next.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			a.succeeded(key, sent, resp)
+			return resp, nil
+		}
+		if attempt >= 3 || !rewindable {
+			return resp, nil
+		}
+
+		// 401: 送った方式で答え直せる（stale・トークンの更新）か、まだ試していない方式があれば送り直す
+		challenges := httpauth.ParseChallenges(resp.Header.Values("WWW-Authenticate"))
+		retry := false
+		switch {
+		case sent == httpauth.Bearer && a.Refresh != nil && !refreshed:
+			token, err := a.Refresh(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("httpclient: auth: refreshing token: %w", err)
+			}
+			a.mu.Lock()
+			a.token = token
+			a.mu.Unlock()
+			a.logf("認証: %s のトークンを更新して送り直します", key)
+			refreshed, retry = true, true
+		case sent == httpauth.Digest:
+			if c, ok := a.chooseDigest(challenges, req); ok && strings.EqualFold(c.Param("stale"), "true") {
+				a.setSpace(key, httpauth.Digest, &digestState{challenge: c})
+				a.logf("認証: %s の nonce が期限切れ（stale）のため、新しい nonce で送り直します", key)
+				retry = true
+			}
+		case !answered:
+			// 初めての 401 か、前のリクエストで応じた資格情報（サーバーが忘れた nonce など）が通らなかった。
+			// Basic と Bearer は同じものを送り直しても通らないので、ほかの方式を探す
+			skip := sent
+			if sent == httpauth.Digest {
+				skip = ""
+			}
+			retry, answered = a.answer(key, challenges, req, skip), true
+		}
+		if !retry {
+			return resp, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+	}
+}
+
+func (a *Auth) logf(format string, args ...any) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
+
+func (a *Auth) accepts(scheme string) bool {
+	if a.Schemes == nil {
+		return true
+	}
+	return slices.ContainsFunc(a.Schemes, func(s string) bool { return strings.EqualFold(s, scheme) })
+}
+
+func (a *Auth) setSpace(key, scheme string, d *digestState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.spaces == nil {
+		a.spaces = map[string]*authSpace{}
+	}
+	a.spaces[key] = &authSpace{scheme: scheme, digest: d}
+}
+
+// answer はチャレンジの中から（skip 以外で）応じる方式を選んで覚えます。応じられるものがなければ false です。
+func (a *Auth) answer(key string, challenges []httpauth.Challenge, req *http.Request, skip string) bool {
+	has := func(scheme string) bool {
+		return scheme != skip && slices.ContainsFunc(challenges, func(c httpauth.Challenge) bool { return c.Is(scheme) })
+	}
+	switch {
+	case a.Token != nil && a.accepts(httpauth.Bearer) && has(httpauth.Bearer):
+		a.setSpace(key, httpauth.Bearer, nil)
+		a.logf("認証: %s に Bearer で応じます", key)
+		return true
+	case a.Username != "" && a.accepts(httpauth.Digest) && has(httpauth.Digest):
+		if c, ok := a.chooseDigest(challenges, req); ok {
+			a.setSpace(key, httpauth.Digest, &digestState{challenge: c})
+			a.logf("認証: %s に Digest（%s, qop=%s）で応じます", key, c.Param("algorithm"), digestQop(c, req))
+			return true
+		}
+	}
+	if a.Username != "" && a.accepts(httpauth.Basic) && has(httpauth.Basic) {
+		a.setSpace(key, httpauth.Basic, nil)
+		a.logf("認証: %s に Basic で応じます", key)
+		return true
+	}
+	return false
+}
+
+// chooseDigest は扱えるアルゴリズムと qop の Digest のチャレンジのうち、アルゴリズムの最も強いものを選びます。
+func (a *Auth) chooseDigest(challenges []httpauth.Challenge, req *http.Request) (httpauth.Challenge, bool) {
+	var best httpauth.Challenge
+	bestRank := len(httpauth.DigestAlgorithms)
+	for _, c := range challenges {
+		if !c.Is(httpauth.Digest) || !httpauth.SupportedAlgorithm(c.Param("algorithm")) || digestQop(c, req) == "" {
+			continue
+		}
+		alg := strings.TrimSuffix(strings.ToUpper(c.Param("algorithm")), "-SESS")
+		if alg == "" {
+			alg = "MD5"
+		}
+		if rank := slices.Index(httpauth.DigestAlgorithms, alg); rank >= 0 && rank < bestRank {
+			best, bestRank = c, rank
+		}
+	}
+	return best, bestRank < len(httpauth.DigestAlgorithms)
+}
+
+// digestQop はチャレンジの qop から使うものを選びます。auth-int はボディを読み直せる場合だけ使います。
+func digestQop(c httpauth.Challenge, req *http.Request) string {
+	var offered []string
+	for q := range strings.SplitSeq(c.Param("qop"), ",") {
+		offered = append(offered, strings.TrimSpace(q))
+	}
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	switch {
+	case slices.Contains(offered, "auth-int") && (!hasBody || req.GetBody != nil):
+		return "auth-int"
+	case slices.Contains(offered, "auth"):
+		return "auth"
+	}
+	return ""
+}
+
+// authorization はオリジンで最後に応じた方式の Authorization を作ります。まだ応じていなければ、
+// トークンがあれば Bearer を、なければ何も付けません。
+func (a *Auth) authorization(req *http.Request, key string) (scheme, value string, err error) {
+	a.mu.Lock()
+	space := a.spaces[key]
+	a.mu.Unlock()
+	switch {
+	case space == nil && a.Token != nil && a.accepts(httpauth.Bearer):
+		scheme = httpauth.Bearer
+	case space == nil:
+		return "", "", nil
+	default:
+		scheme = space.scheme
+	}
+	switch scheme {
+	case httpauth.Bearer:
+		token, err := a.bearerToken(req.Context())
+		if err != nil {
+			return "", "", err
+		}
+		return scheme, "Bearer " + token, nil
+	case httpauth.Basic:
+		return scheme, "Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+a.Password)), nil
+	}
+	value, err = a.digestAuthorization(req, space.digest)
+	return scheme, value, err
+}
+
+func (a *Auth) bearerToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	token := a.token
+	a.mu.Unlock()
+	if token != "" {
+		return token, nil
+	}
+	token, err := a.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("httpclient: auth: getting token: %w", err)
+	}
+	a.mu.Lock()
+	a.token = token
+	a.mu.Unlock()
+	return token, nil
+}
+
+// digestAuthorization は nc を 1 つ増やして、Digest の Authorization を作ります（RFC 7616 §3.4）。
+func (a *Auth) digestAuthorization(req *http.Request, d *digestState) (string, error) {
+	c := d.challenge
+	a.mu.Lock()
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+	a.mu.Unlock()
+	cnonce := a.newCNonce()
+	params := httpauth.DigestParams{
+		Algorithm: c.Param("algorithm"),
+		Username:  a.Username,
+		Realm:     c.Param("realm"),
+		Password:  a.Password,
+		Method:    req.Method,
+		URI:       req.URL.RequestURI(),
+		Nonce:     c.Param("nonce"),
+		CNonce:    cnonce,
+		NC:        nc,
+		Qop:       digestQop(c, req),
+	}
+	if params.Qop == "auth-int" && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", fmt.Errorf("httpclient: auth: %w", err)
+		}
+		params.Body, err = io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return "", fmt.Errorf("httpclient: auth: %w", err)
+		}
+	}
+	response, err := params.Response()
+	if err != nil {
+		return "", err
+	}
+	cred := httpauth.Challenge{Scheme: httpauth.Digest, Params: map[string]string{
+		"realm":    params.Realm,
+		"uri":      params.URI,
+		"nonce":    params.Nonce,
+		"nc":       nc,
+		"cnonce":   cnonce,
+		"qop":      params.Qop,
+		"response": response,
+	}}
+	switch {
+	case strings.EqualFold(c.Param("userhash"), "true"):
+		cred.Params["username"] = httpauth.UserHash(params.Algorithm, a.Username, params.Realm)
+		cred.Params["userhash"] = "true"
+	case !isASCII(a.Username):
+		// 引用符の中に ASCII 以外を書けないので、RFC 8187 の ext-value で送る（RFC 7616 §3.4.4）
+		cred.Params["username*"] = "UTF-8''" + url.PathEscape(a.Username)
+	default:
+		cred.Params["username"] = a.Username
+	}
+	if alg := c.Param("algorithm"); alg != "" {
+		cred.Params["algorithm"] = alg
+	}
+	if opaque := c.Param("opaque"); opaque != "" {
+		cred.Params["opaque"] = opaque
+	}
+	return cred.String(), nil
+}
+
+func (a *Auth) newCNonce() string {
+	if a.cnonce != nil {
+		return a.cnonce()
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// succeeded は 401 以外が返ったときに呼び、Digest の Authentication-Info に nextnonce があれば次からそれを使います。
+func (a *Auth) succeeded(key, scheme string, resp *http.Response) {
+	if scheme != httpauth.Digest {
+		return
+	}
+	info, ok := httpauth.ParseAuthorization("Digest " + resp.Header.Get("Authentication-Info"))
+	if !ok || info.Param("nextnonce") == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if space := a.spaces[key]; space != nil && space.digest != nil {
+		c := space.digest.challenge
+		params := maps.Clone(c.Params)
+		params["nonce"] = info.Param("nextnonce")
+		space.digest = &digestState{challenge: httpauth.Challenge{Scheme: c.Scheme, Params: params}}
+	}
+}
@@ -0,0 +1,115 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"real-world-http-learn/internal/httpauth"
+)
+
+// TestAuth は Digest（auth-int・nc の増加・stale）・Basic・Bearer（トークンの更新）で応じることと、
+// Origin 以外へは資格情報を送らないことを確認します。
+func TestAuth(t *testing.T) {
+	authenticator := httpauth.New("test", map[string]string{"alice": "secret"})
+	authenticator.Logf = t.Logf
+	authenticator.NonceTTL = 300 * time.Millisecond
+	authenticator.TokenTTL = 300 * time.Millisecond
+	var sent []string // サーバーが受け取った Authorization
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := httpauth.FromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, id.Scheme+":"+id.User+":"+string(body))
+	})))
+	mux.Handle("/auth/token", authenticator.Middleware(authenticator.TokenHandler()))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("Authorization"))
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	do := func(auth *Auth, method, path, body string) (int, string) {
+		t.Helper()
+		client, err := New(Options{Auth: auth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if body == "" {
+			req.Body, req.GetBody = http.NoBody, nil
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	digest := &Auth{Username: "alice", Password: "secret", Logf: t.Logf, cnonce: func() string { return "fixed" }}
+	if code, body := do(digest, http.MethodPost, "/auth/", "a=b"); code != http.StatusOK || body != "Digest:alice:a=b" {
+		t.Fatalf("Digest: %d %q", code, body)
+	}
+	cred, _ := httpauth.ParseAuthorization(sent[len(sent)-1])
+	if len(sent) != 2 || sent[0] != "" || cred.Param("algorithm") != "SHA-256" || cred.Param("qop") != "auth-int" ||
+		cred.Param("cnonce") != "fixed" || cred.Param("nc") != "00000001" || cred.Param("userhash") != "true" {
+		t.Errorf("Digest credentials: %q", sent)
+	}
+	// 2 回目からは同じ nonce で nc を増やして最初から送る
+	sent = nil
+	if code, _ := do(digest, http.MethodGet, "/auth/", ""); code != http.StatusOK || len(sent) != 1 {
+		t.Errorf("preemptive Digest: %d %q", code, sent)
+	}
+	if cred, _ := httpauth.ParseAuthorization(sent[0]); cred.Param("nc") != "00000002" || cred.Param("nonce") == "" {
+		t.Errorf("nc: %q", sent[0])
+	}
+	// nonce の期限が切れると stale=true が返り、新しい nonce で送り直す
+	time.Sleep(authenticator.NonceTTL)
+	sent = nil
+	if code, _ := do(digest, http.MethodGet, "/auth/", ""); code != http.StatusOK || len(sent) != 2 {
+		t.Errorf("stale: %d %q", code, sent)
+	}
+
+	sent = nil
+	basic := &Auth{Username: "alice", Password: "secret", Schemes: []string{httpauth.Basic}}
+	if code, body := do(basic, http.MethodGet, "/auth/", ""); code != http.StatusOK || body != "Basic:alice:" || !strings.HasPrefix(sent[1], "Basic ") {
+		t.Errorf("Basic: %d %q %q", code, body, sent)
+	}
+	if code, _ := do(&Auth{Username: "alice", Password: "wrong"}, http.MethodGet, "/auth/", ""); code != http.StatusUnauthorized {
+		t.Errorf("wrong password: %d", code)
+	}
+
+	fetchToken := func(ctx context.Context) (string, error) {
+		_, body := do(&Auth{Username: "alice", Password: "secret"}, http.MethodPost, "/auth/token", "")
+		var tok struct {
+			AccessToken string `json:"access_token"`
+		}
+		err := json.Unmarshal([]byte(body), &tok)
+		return tok.AccessToken, err
+	}
+	refreshed := 0
+	bearer := &Auth{Token: fetchToken, Refresh: func(ctx context.Context) (string, error) {
+		refreshed++
+		return fetchToken(ctx)
+	}}
+	if code, body := do(bearer, http.MethodGet, "/auth/", ""); code != http.StatusOK || body != "Bearer:alice:" {
+		t.Errorf("Bearer: %d %q", code, body)
+	}
+	time.Sleep(authenticator.TokenTTL)
+	if code, _ := do(bearer, http.MethodGet, "/auth/", ""); code != http.StatusOK || refreshed != 1 {
+		t.Errorf("Bearer after expiry: %d, refreshed %d", code, refreshed)
+	}
+
+	sent = nil
+	other := &Auth{Username: "alice", Password: "secret", Origin: "http://example.com"}
+	if code, _ := do(other, http.MethodGet, "/auth/", ""); code != http.StatusUnauthorized || len(sent) != 1 || sent[0] != "" {
+		t.Errorf("other origin: %d %q", code, sent)
+	}
+}
@@ -0,0 +1,139 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Body はリクエストボディとその Content-Type です。
+type Body struct {
+	Reader      io.Reader
+	ContentType string
+	// Length はボディの長さです（-1 なら不明で、chunked で送られます）。
+	Length int64
+	// GetBody は同じボディを最初から読み直すための関数です（307/308 のリダイレクトで再送する場合に使います）。
+	GetBody func() (io.ReadCloser, error)
+}
+
+// Data は curl の -d / --data-binary / --data-urlencode の引数を解釈し、"&" でつないだ文字列を返します。
+//
+//   - data: "a=b" はそのまま、"@file" はファイルの中身（改行を取り除く）
+//   - binary: data と同じですが、"@file" の改行を取り除きません
+//   - urlencode: "content"・"=content" は content を、"name=content" は content だけを
+//     パーセントエンコードします。"@file"・"name@file" はファイルの中身をエンコードします
+func Data(data, binary, urlencode []string) (string, error) {
+	var parts []string
+	for _, arg := range data {
+		s, err := readAt(arg)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(arg, "@") {
+			s = strings.NewReplacer("\r", "", "\n", "").Replace(s)
+		}
+		parts = append(parts, s)
+	}
+	for _, arg := range binary {
+		s, err := readAt(arg)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	for _, arg := range urlencode {
+		s, err := encodeDataArg(arg)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "&"), nil
+}
+
+// readAt は "@file" ならファイルの中身（"@-" は標準入力）を、それ以外は arg をそのまま返します。
+func readAt(arg string) (string, error) {
+	name, ok := strings.CutPrefix(arg, "@")
+	if !ok {
+		return arg, nil
+	}
+	if name == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(name)
+	return string(data), err
+}
+
+func encodeDataArg(arg string) (string, error) {
+	if i := strings.IndexAny(arg, "=@"); i >= 0 {
+		name, rest := arg[:i], arg[i+1:]
+		if arg[i] == '@' {
+			content, err := readAt("@" + rest)
+			if err != nil {
+				return "", err
+			}
+			rest = content
+		}
+		if name == "" {
+			return url.QueryEscape(rest), nil
+		}
+		return name + "=" + url.QueryEscape(rest), nil
+	}
+	return url.QueryEscape(arg), nil
+}
+
+// FormField は multipart/form-data の 1 フィールドです（curl の -F の引数 1 つ分）。
+type FormField struct {
+	Name  string
+	Value string
+	// File が空でなければ、そのファイルをファイルとして添付します。
+	File string
+	// Filename は送信するファイル名です（空なら File のベース名）。
+	Filename string
+	// ContentType はパートの Content-Type です（空ならファイルは拡張子と内容から判定し、値には付けません）。
+	ContentType string
+}
+
+// ParseFormField は curl の -F の引数を解釈します。
+//
+//	name=value                   テキストのフィールド
+//	name=@path;type=image/jpeg   ファイルの添付（;type= と ;filename= は省略可）
+//	name=<path                   ファイルの中身をテキストのフィールドとして送る
+func ParseFormField(arg string) (FormField, error) {
+	name, value, ok := strings.Cut(arg, "=")
+	if !ok || name == "" {
+		return FormField{}, fmt.Errorf("httpclient: form field %q must be name=value", arg)
+	}
+	f := FormField{Name: name}
+	switch {
+	case strings.HasPrefix(value, "@"):
+		params := strings.Split(value[1:], ";")
+		f.File = params[0]
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(p, "=")
+			switch strings.ToLower(strings.TrimSpace(k)) {
+			case "type":
+				f.ContentType = v
+			case "filename":
+				f.Filename = strings.Trim(v, `"`)
+			default:
+				return FormField{}, fmt.Errorf("httpclient: unknown form field parameter %q in %q", k, arg)
+			}
+		}
+		if f.File == "" {
+			return FormField{}, fmt.Errorf("httpclient: form field %q has no file name", arg)
+		}
+	case strings.HasPrefix(value, "<"):
+		data, err := os.ReadFile(value[1:])
+		if err != nil {
+			return FormField{}, err
+		}
+		f.Value = string(data)
+	default:
+		f.Value = value
+	}
+	return f, nil
+}
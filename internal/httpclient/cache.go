@@ -0,0 +1,736 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheStatusName は Cache-Status（RFC 9211）に書くキャッシュの名前です。
+const cacheStatusName = "httpclient"
+
+// Cache は RFC 9111 に従うプライベートキャッシュ（ブラウザのキャッシュと同じく、利用者 1 人のためのもの）の RoundTripper です。
+//
+// GET のレスポンスを Store に保存し、新しいうちはサーバーへ送らずに返します。古くなったら ETag（If-None-Match）と
+// Last-Modified（If-Modified-Since）で再検証し、304 なら保存したボディを返します。次の Cache-Control に従います。
+//
+//   - レスポンスの max-age・Expires（なければ Last-Modified からの経過時間の 10%、最大 24 時間）で新しさを決める
+//   - no-store は保存しない、no-cache は毎回再検証する、must-revalidate は古くなったら必ず再検証する（できなければ 504）
+//   - stale-while-revalidate=N は古くなって N 秒までは保存したものを返しつつ、裏で再検証する
+//   - stale-if-error=N は再検証が接続エラーや 5xx になったとき、古くなって N 秒までは保存したものを返す
+//   - リクエストの max-age・min-fresh・max-stale・no-cache・no-store・only-if-cached
+//
+// Vary のあるレスポンスは、Vary に挙げたリクエストヘッダの値ごとに別々に保存します（Vary: * は保存しません）。
+// POST・PUT・DELETE などが成功したら、その URL（と同じオリジンの Location・Content-Location）の保存分を捨てます。
+// Range や If-None-Match などの条件付きリクエストは、キャッシュを使わずにそのまま送ります。
+//
+// 返すレスポンスには Cache-Status ヘッダ（RFC 9211）で、保存したものを返したか（hit）、サーバーへ送った理由（fwd）、
+// 残りの新しさ（ttl）、保存したか（stored）を付けます（例: "httpclient; hit; ttl=42"、"httpclient; fwd=stale; fwd-status=304"）。
+type Cache struct {
+	// Transport は実際にリクエストを送る RoundTripper です（nil なら http.DefaultTransport）。
+	Transport http.RoundTripper
+	// Store は保存先です。
+	Store CacheStore
+	// MaxBodyBytes はボディを保存する大きさの上限です（0 なら 32MB）。
+	MaxBodyBytes int64
+	// Logf を設定すると、リクエストごとにキャッシュの結果（Cache-Status）と保存先のエラーを書き出します。
+	Logf func(format string, args ...any)
+
+	now        func() time.Time
+	mu         sync.Mutex // 同じ URL の索引を同時に書き換えないようにする
+	background sync.Map   // stale-while-revalidate で再検証中のキー
+}
+
+// NewCache は store（nil ならメモリの NewMemoryCacheStore(0)）に保存する Cache を返します。
+func NewCache(transport http.RoundTripper, store CacheStore) *Cache {
+	if store == nil {
+		store = NewMemoryCacheStore(0)
+	}
+	return &Cache{Transport: transport, Store: store}
+}
+
+func (c *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return c.transport().RoundTrip(req)
+	}
+	if req.Method != http.MethodGet {
+		resp, err := c.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if !isSafeMethod(req.Method) && resp.StatusCode < 400 {
+			c.invalidate(req.URL, resp)
+		}
+		c.setCacheStatus(req, resp.Header, fmt.Sprintf("fwd=method; fwd-status=%d", resp.StatusCode))
+		return resp, nil
+	}
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") {
+		return c.fetch(req, "", "bypass", "request no-store")
+	}
+	for _, name := range []string{"Range", "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		if req.Header.Get(name) != "" {
+			return c.fetch(req, "", "bypass", strings.ToLower(name))
+		}
+	}
+
+	key, entry, miss, err := c.lookup(req)
+	if err != nil {
+		c.logf("キャッシュ: %v", err)
+	}
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			return c.gatewayTimeout(req, "fwd="+miss+`; detail="only-if-cached"`), nil
+		}
+		return c.fetch(req, "", miss, "")
+	}
+
+	now := c.clock()
+	respCC := parseCacheControl(entry.Header)
+	lifetime, age := entry.lifetime(respCC), entry.age(now)
+	noCache := reqCC.has("no-cache") || respCC.has("no-cache") ||
+		req.Header.Get("Cache-Control") == "" && strings.Contains(strings.ToLower(req.Header.Get("Pragma")), "no-cache")
+	mustRevalidate := respCC.has("must-revalidate")
+	if !noCache && acceptable(reqCC, age, lifetime, mustRevalidate) {
+		return c.serve(req, entry, age, fmt.Sprintf("hit; ttl=%d", seconds(lifetime-age))), nil
+	}
+	if stale := age - lifetime; !noCache && !mustRevalidate && stale > 0 {
+		if swr, ok := respCC.seconds("stale-while-revalidate"); ok && stale <= swr {
+			c.revalidateInBackground(req, key, entry)
+			return c.serve(req, entry, age, fmt.Sprintf(`hit; ttl=%d; detail="stale-while-revalidate"`, seconds(lifetime-age))), nil
+		}
+	}
+	if reqCC.has("only-if-cached") {
+		return c.gatewayTimeout(req, `fwd=stale; detail="only-if-cached"`), nil
+	}
+	fwd := "stale"
+	if age < lifetime {
+		fwd = "request" // no-cache やリクエストの max-age で、新しいが再検証する
+	}
+	return c.revalidate(req, key, entry, fwd)
+}
+
+func (c *Cache) transport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+	return c.Transport
+}
+
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Cache) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+func (c *Cache) maxBodyBytes() int64 {
+	if c.MaxBodyBytes <= 0 {
+		return 32 << 20
+	}
+	return c.MaxBodyBytes
+}
+
+// acceptable は age の保存分をリクエストの Cache-Control のもとで再検証せずに使えるかどうかです。
+func acceptable(reqCC cacheControl, age, lifetime time.Duration, mustRevalidate bool) bool {
+	if d, ok := reqCC.seconds("max-age"); ok && age > d {
+		return false
+	}
+	if d, ok := reqCC.seconds("min-fresh"); ok && lifetime-age < d {
+		return false
+	}
+	if age < lifetime {
+		return true
+	}
+	if mustRevalidate {
+		return false
+	}
+	if v, ok := reqCC["max-stale"]; ok {
+		if v == "" {
+			return true
+		}
+		d, ok := reqCC.seconds("max-stale")
+		return ok && age-lifetime <= d
+	}
+	return false
+}
+
+// fetch は req をそのまま送り、保存できるレスポンスなら保存します。
+// oldKey は再検証で置き換える保存分のキーで、保存できないレスポンスならそれを捨てます。
+func (c *Cache) fetch(req *http.Request, oldKey, fwd, detail string) (*http.Response, error) {
+	reqTime := c.clock()
+	resp, err := c.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.received(req, resp, reqTime, oldKey, fwd, detail), nil
+}
+
+// received はサーバーから受け取った resp に Cache-Status を付け、保存できるなら最後まで読んだときに保存します。
+func (c *Cache) received(req *http.Request, resp *http.Response, reqTime time.Time, oldKey, fwd, detail string) *http.Response {
+	status := fmt.Sprintf("fwd=%s; fwd-status=%d", fwd, resp.StatusCode)
+	if fwd != "bypass" && c.storable(req, resp) {
+		c.storeOnEOF(req, resp, reqTime)
+		status += "; stored"
+	} else if oldKey != "" {
+		c.deleteEntry(oldKey)
+	}
+	if detail != "" {
+		status += fmt.Sprintf("; detail=%q", detail)
+	}
+	c.setCacheStatus(req, resp.Header, status)
+	return resp
+}
+
+// revalidate は保存分の ETag と Last-Modified を付けた条件付きリクエストを送ります。
+func (c *Cache) revalidate(req *http.Request, key string, entry *cacheEntry, fwd string) (*http.Response, error) {
+	cond := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lm := entry.Header.Get("Last-Modified"); lm != "" {
+		cond.Header.Set("If-Modified-Since", lm)
+	}
+	reqTime := c.clock()
+	resp, err := c.transport().RoundTrip(cond)
+	now := c.clock()
+	respCC := parseCacheControl(entry.Header)
+
+	if err != nil || resp.StatusCode >= 500 {
+		fwdStatus := "; detail=" + strconv.Quote(fmt.Sprint(err))
+		if resp != nil {
+			fwdStatus = "; fwd-status=" + strconv.Itoa(resp.StatusCode)
+		}
+		age := entry.age(now)
+		if c.staleIfError(req, respCC, age-entry.lifetime(respCC)) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return c.serve(req, entry, age, "hit; fwd="+fwd+fwdStatus+`; detail="stale-if-error"`), nil
+		}
+		if err != nil {
+			if respCC.has("must-revalidate") {
+				// must-revalidate の保存分は、再検証できなければ使わずに 504 を返す（RFC 9111 5.2.2.2）
+				c.logf("キャッシュ: %s の再検証に失敗: %v", req.URL.Redacted(), err)
+				return c.gatewayTimeout(req, "fwd="+fwd+`; detail="must-revalidate"`), nil
+			}
+			return nil, err
+		}
+		return c.received(req, resp, reqTime, "", fwd, ""), nil
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		updated := entry.update(resp.Header, reqTime, now)
+		if err := c.save(req, updated); err != nil {
+			c.logf("キャッシュ: %v", err)
+		}
+		return c.serve(req, updated, updated.age(now), "fwd="+fwd+"; fwd-status=304"), nil
+	}
+	// 304 以外は新しい内容なので保存分を置き換える（保存できないレスポンスなら捨てる）
+	return c.received(req, resp, reqTime, key, fwd, ""), nil
+}
+
+// staleIfError は stale だけ古くなった保存分を、エラーの代わりに返してよいかどうかです（RFC 5861）。
+func (c *Cache) staleIfError(req *http.Request, respCC cacheControl, stale time.Duration) bool {
+	if respCC.has("must-revalidate") {
+		return false
+	}
+	for _, cc := range []cacheControl{parseCacheControl(req.Header), respCC} {
+		if d, ok := cc.seconds("stale-if-error"); ok && stale <= d {
+			return true
+		}
+	}
+	return false
+}
+
+// revalidateInBackground は stale-while-revalidate の再検証を、呼び出し元を待たせずに行います（同じ保存分は 1 つだけ）。
+func (c *Cache) revalidateInBackground(req *http.Request, key string, entry *cacheEntry) {
+	if _, running := c.background.LoadOrStore(key, true); running {
+		return
+	}
+	bg := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer c.background.Delete(key)
+		resp, err := c.revalidate(bg, key, entry, "stale")
+		if err != nil {
+			c.logf("キャッシュ: %s の再検証に失敗: %v", req.URL.Redacted(), err)
+			return
+		}
+		// 最後まで読むと保存される
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// serve は保存分からレスポンスを作ります。
+func (c *Cache) serve(req *http.Request, e *cacheEntry, age time.Duration, status string) *http.Response {
+	h := e.Header.Clone()
+	h.Set("Age", strconv.FormatInt(seconds(age), 10))
+	h.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	c.setCacheStatus(req, h, status)
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// gatewayTimeout は保存分を使えず、サーバーにも送れないときの 504 を作ります。
+func (c *Cache) gatewayTimeout(req *http.Request, status string) *http.Response {
+	body := "504 Gateway Timeout（キャッシュに使えるレスポンスがありません）\n"
+	h := http.Header{"Content-Type": {"text/plain; charset=utf-8"}, "Content-Length": {strconv.Itoa(len(body))}}
+	c.setCacheStatus(req, h, status)
+	return &http.Response{
+		Status:        "504 Gateway Timeout",
+		StatusCode:    http.StatusGatewayTimeout,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// setCacheStatus は Cache-Status にこのキャッシュの結果を足し（サーバー側のキャッシュの結果の後ろに続けます）、Logf に書き出します。
+func (c *Cache) setCacheStatus(req *http.Request, h http.Header, status string) {
+	v := cacheStatusName + "; " + status
+	if prev := h.Get("Cache-Status"); prev != "" {
+		v = prev + ", " + v
+	}
+	h.Set("Cache-Status", v)
+	c.logf("キャッシュ: %s %s", req.URL.Redacted(), status)
+}
+
+// storable は resp を保存してよいかどうかです（RFC 9111 3 章）。
+func (c *Cache) storable(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet || resp.StatusCode < 200 ||
+		resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	reqCC, respCC := parseCacheControl(req.Header), parseCacheControl(resp.Header)
+	if reqCC.has("no-store") || respCC.has("no-store") || slices.Contains(varyFields(resp.Header), "*") {
+		return false
+	}
+	if resp.ContentLength > c.maxBodyBytes() {
+		return false
+	}
+	// プライベートキャッシュなので private も保存できる
+	return respCC.has("max-age") || respCC.has("public") || respCC.has("private") ||
+		resp.Header.Get("Expires") != "" || heuristicallyCacheable(resp.StatusCode)
+}
+
+// storeOnEOF は resp のボディを最後まで読んだときに保存するよう、ボディを包みます。
+func (c *Cache) storeOnEOF(req *http.Request, resp *http.Response, reqTime time.Time) {
+	entry := &cacheEntry{
+		Status:      resp.Status,
+		StatusCode:  resp.StatusCode,
+		Header:      storedHeader(resp.Header),
+		RequestTime: reqTime,
+	}
+	resp.Body = &cacheBody{ReadCloser: resp.Body, max: c.maxBodyBytes(), done: func(body []byte) {
+		entry.ResponseTime = c.clock()
+		entry.Body = body
+		if err := c.save(req, entry); err != nil {
+			c.logf("キャッシュ: %v", err)
+		}
+	}}
+}
+
+// cacheBody はボディを読みながら写し取り、最後まで読んだら done を呼びます（途中で閉じたら保存しません）。
+type cacheBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	max  int64
+	done func(body []byte)
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done != nil {
+		b.buf.Write(p[:n])
+		if int64(b.buf.Len()) > b.max {
+			b.done = nil
+			b.buf = bytes.Buffer{}
+		}
+	}
+	if err == io.EOF && b.done != nil {
+		b.done(bytes.Clone(b.buf.Bytes()))
+		b.done = nil
+	}
+	return n, err
+}
+
+// invalidate は安全でないメソッドが成功したとき、対象の URL と、同じオリジンの Location・Content-Location の保存分を捨てます（RFC 9111 4.4）。
+func (c *Cache) invalidate(target *url.URL, resp *http.Response) {
+	targets := []*url.URL{target}
+	for _, name := range []string{"Location", "Content-Location"} {
+		if v := resp.Header.Get(name); v != "" {
+			if u, err := target.Parse(v); err == nil && sameOrigin(target, u) {
+				targets = append(targets, u)
+			}
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, u := range targets {
+		index, err := c.loadIndex(u)
+		if err != nil {
+			c.logf("キャッシュ: %v", err)
+		}
+		for _, v := range index {
+			c.Store.Delete(v.Key)
+		}
+		if len(index) > 0 {
+			c.Store.Delete(indexKey(u))
+			c.logf("キャッシュ: %s を破棄しました", u.Redacted())
+		}
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// heuristicallyCacheable は明示的な期限がなくても保存してよいステータスコードです（RFC 9110 15.1）。
+func heuristicallyCacheable(code int) bool {
+	switch code {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+// ---- 保存分と Vary の索引 ----
+
+// cacheEntry は保存したレスポンス 1 つです。
+type cacheEntry struct {
+	Status       string      `json:"status"`
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header"`
+	RequestTime  time.Time   `json:"requestTime"`
+	ResponseTime time.Time   `json:"responseTime"`
+	Body         []byte      `json:"-"`
+}
+
+// cacheVariant は索引の 1 行で、Vary に挙げたリクエストヘッダの値と保存分のキーです。
+type cacheVariant struct {
+	Key    string            `json:"key"`
+	Fields []string          `json:"fields,omitempty"`
+	Values map[string]string `json:"values,omitempty"` // ヘッダがなかったフィールドは含めない
+}
+
+// matches は req の Vary のヘッダの値がこの保存分と同じかどうかです。
+func (v cacheVariant) matches(req *http.Request) bool {
+	for _, name := range v.Fields {
+		got, ok := varyValue(req.Header, name)
+		want, stored := v.Values[name]
+		if ok != stored || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// indexKey は URL ごとの索引（保存分の一覧）のキーです。
+func indexKey(u *url.URL) string {
+	return "index " + cacheURL(u)
+}
+
+func cacheURL(u *url.URL) string {
+	c := *u
+	c.Fragment, c.RawFragment = "", ""
+	return c.String()
+}
+
+func (c *Cache) loadIndex(u *url.URL) ([]cacheVariant, error) {
+	data, ok, err := c.Store.Get(indexKey(u))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var index []cacheVariant
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("httpclient: cache index for %s: %w", u.Redacted(), err)
+	}
+	return index, nil
+}
+
+// lookup は req に合う保存分を探します。なければ miss が理由（RFC 9211 の fwd の値）です。
+func (c *Cache) lookup(req *http.Request) (key string, e *cacheEntry, miss string, err error) {
+	index, err := c.loadIndex(req.URL)
+	if err != nil || len(index) == 0 {
+		return "", nil, "uri-miss", err
+	}
+	// 後から保存したものほど新しい
+	for _, v := range slices.Backward(index) {
+		if !v.matches(req) {
+			continue
+		}
+		data, ok, err := c.Store.Get(v.Key)
+		if err != nil || !ok {
+			return "", nil, "miss", err
+		}
+		e, err := decodeCacheEntry(data)
+		if err != nil {
+			return "", nil, "miss", err
+		}
+		return v.Key, e, "", nil
+	}
+	return "", nil, "vary-miss", nil
+}
+
+// save は e を保存し、req の Vary のヘッダの値で索引に登録します（同じ値の保存分は置き換えます）。
+func (c *Cache) save(req *http.Request, e *cacheEntry) error {
+	v := cacheVariant{Fields: varyFields(e.Header), Values: map[string]string{}}
+	h := sha256.New()
+	for _, name := range v.Fields {
+		if value, ok := varyValue(req.Header, name); ok {
+			v.Values[name] = value
+			fmt.Fprintf(h, "%s: %s\n", name, value)
+		} else {
+			fmt.Fprintf(h, "%s\n", name)
+		}
+	}
+	v.Key = "entry " + cacheURL(req.URL) + " " + hex.EncodeToString(h.Sum(nil)[:8])
+
+	data, err := encodeCacheEntry(e)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.Store.Set(v.Key, data); err != nil {
+		return err
+	}
+	index, err := c.loadIndex(req.URL)
+	if err != nil {
+		index = nil
+	}
+	index = slices.DeleteFunc(index, func(old cacheVariant) bool { return old.Key == v.Key })
+	index = append(index, v)
+	data, err = json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return c.Store.Set(indexKey(req.URL), data)
+}
+
+func (c *Cache) deleteEntry(key string) {
+	if err := c.Store.Delete(key); err != nil {
+		c.logf("キャッシュ: %v", err)
+	}
+}
+
+// encodeCacheEntry は 1 行の JSON のメタデータの後ろにボディをそのまま続けます。
+func encodeCacheEntry(e *cacheEntry) ([]byte, error) {
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(meta)+1+len(e.Body))
+	data = append(append(append(data, meta...), '\n'), e.Body...)
+	return data, nil
+}
+
+func decodeCacheEntry(data []byte) (*cacheEntry, error) {
+	meta, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return nil, errors.New("httpclient: broken cache entry")
+	}
+	e := &cacheEntry{}
+	if err := json.Unmarshal(meta, e); err != nil {
+		return nil, fmt.Errorf("httpclient: broken cache entry: %w", err)
+	}
+	e.Body = body
+	return e, nil
+}
+
+// varyFields は Vary に挙げたヘッダ名です（正規化して並べ替えます）。
+func varyFields(h http.Header) []string {
+	var fields []string
+	for _, line := range h.Values("Vary") {
+		for name := range strings.SplitSeq(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				fields = append(fields, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(fields)
+	return slices.Compact(fields)
+}
+
+// varyValue は Vary で比べるヘッダの値です（複数行は ", " でつなぎ、空白をまとめます）。
+func varyValue(h http.Header, name string) (string, bool) {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(strings.Fields(strings.Join(values, ", ")), " "), true
+}
+
+// ---- 新しさの計算（RFC 9111 4.2） ----
+
+// notStoredHeaders は保存しない、304 で更新しないヘッダです（接続ごとのヘッダと、保存したボディに合わせるヘッダ）。
+var notStoredHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade", "Cache-Status"}
+
+func storedHeader(h http.Header) http.Header {
+	stored := h.Clone()
+	for _, name := range notStoredHeaders {
+		stored.Del(name)
+	}
+	return stored
+}
+
+// update は 304 のヘッダで保存分のヘッダを更新したものを返します（RFC 9111 3.2）。
+func (e *cacheEntry) update(h http.Header, reqTime, respTime time.Time) *cacheEntry {
+	n := *e
+	n.Header = e.Header.Clone()
+	for name, values := range storedHeader(h) {
+		if name == "Content-Length" || name == "Content-Encoding" || name == "Content-Range" {
+			continue
+		}
+		n.Header[name] = values
+	}
+	n.RequestTime, n.ResponseTime = reqTime, respTime
+	return &n
+}
+
+func (e *cacheEntry) date() time.Time {
+	if t, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return t
+	}
+	return e.ResponseTime
+}
+
+// lifetime は保存したときからの新しさの長さです（max-age、Expires、Last-Modified の順）。
+func (e *cacheEntry) lifetime(cc cacheControl) time.Duration {
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+	if v := e.Header.Get("Expires"); v != "" {
+		// "0" のような日付でない Expires はすでに古いものとする
+		t, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return max(t.Sub(e.date()), 0)
+	}
+	if lm, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && heuristicallyCacheable(e.StatusCode) {
+		return min(max(e.date().Sub(lm), 0)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// age は now における保存分の経過時間です（Age ヘッダと転送にかかった時間を含みます）。
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparent := max(e.ResponseTime.Sub(e.date()), 0)
+	ageValue, _ := deltaSeconds(e.Header.Get("Age"))
+	corrected := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	return max(apparent, corrected) + now.Sub(e.ResponseTime)
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+// ---- Cache-Control ----
+
+// cacheControl は Cache-Control の指示子（小文字）と値です。値のない指示子は "" です。
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, line := range h.Values("Cache-Control") {
+		for len(line) > 0 {
+			var name, value string
+			i := strings.IndexAny(line, "=,")
+			if i < 0 {
+				name, line = line, ""
+			} else {
+				name, line = line[:i], line[i:]
+			}
+			if strings.HasPrefix(line, "=") {
+				line = strings.TrimLeft(line[1:], " \t")
+				if strings.HasPrefix(line, `"`) {
+					// no-cache="Set-Cookie, Set-Cookie2" のような引用符付きの値
+					end := strings.Index(line[1:], `"`)
+					if end < 0 {
+						end = len(line) - 1
+					}
+					value, line = line[1:end+1], line[min(end+2, len(line)):]
+				} else if j := strings.IndexByte(line, ','); j >= 0 {
+					value, line = line[:j], line[j:]
+				} else {
+					value, line = line, ""
+				}
+			}
+			line = strings.TrimLeft(line, ", \t")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				if _, dup := cc[name]; !dup {
+					cc[name] = strings.TrimSpace(value)
+				}
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds は max-age=120 のような秒数の指示子を読みます（不正な値なら ok が false）。
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	return deltaSeconds(v)
+}
+
+// maxDeltaSeconds は秒数の値の上限です。大きすぎる値はこの秒数として扱います（RFC 9111 1.2.2）。
+const maxDeltaSeconds = 1 << 31
+
+// deltaSeconds は Age や max-age の delta-seconds を読みます（不正な値なら ok が false）。
+func deltaSeconds(v string) (time.Duration, bool) {
+	n, err := strconv.ParseUint(v, 10, 63)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return maxDeltaSeconds * time.Second, true
+		}
+		return 0, false
+	}
+	return time.Duration(min(n, maxDeltaSeconds)) * time.Second, true
+}
@@ -0,0 +1,128 @@
+package httpclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStore は Cache が使う保存先です。キーと値は Cache が作り、保存先はそのまま保存します。
+// 複数の goroutine から同時に呼ばれます。
+type CacheStore interface {
+	// Get は key の値を返します。なければ ok が false です。
+	Get(key string) (value []byte, ok bool, err error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+}
+
+// MemoryCacheStore はメモリに保存する CacheStore です。合計の大きさが上限を超えたら、最も長く使われていない値から捨てます。
+type MemoryCacheStore struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List // 先頭が最近使ったもの
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCacheStore は合計 maxBytes バイトまで保存する MemoryCacheStore を返します（0 以下なら 64MB）。
+func NewMemoryCacheStore(maxBytes int64) *MemoryCacheStore {
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &MemoryCacheStore{maxBytes: maxBytes, lru: list.New(), items: map[string]*list.Element{}}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheItem).value, true, nil
+}
+
+func (s *MemoryCacheStore) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	if int64(len(value)) > s.maxBytes {
+		return nil
+	}
+	s.items[key] = s.lru.PushFront(&memoryCacheItem{key: key, value: value})
+	s.size += int64(len(value))
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	return nil
+}
+
+func (s *MemoryCacheStore) remove(key string) {
+	if e, ok := s.items[key]; ok {
+		s.size -= int64(len(e.Value.(*memoryCacheItem).value))
+		s.lru.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// DiskCacheStore はディレクトリにファイルとして保存する CacheStore です。プロセスを終了しても残ります。
+// ファイル名はキーの SHA-256 で、書き込みは一時ファイルの rename で行うため、途中までしか書かれていないファイルは読みません。
+// 大きさの上限はないので、不要になったらディレクトリごと削除してください。
+type DiskCacheStore struct {
+	dir string
+}
+
+// NewDiskCacheStore は dir（なければ作ります）に保存する DiskCacheStore を返します。
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DiskCacheStore{dir: dir}, nil
+}
+
+func (s *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *DiskCacheStore) Get(key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (s *DiskCacheStore) Set(key string, value []byte) error {
+	return writeFileAtomic(s.path(key), value)
+}
+
+func (s *DiskCacheStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
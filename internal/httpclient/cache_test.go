@@ -0,0 +1,264 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCache は新しさ・再検証（304）・Vary・no-store・stale-if-error・stale-while-revalidate・must-revalidate と、
+// 安全でないメソッドでの破棄を、メモリとディスクの両方の保存先で確認します。
+func TestCache(t *testing.T) {
+	disk, err := NewDiskCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]CacheStore{"memory": NewMemoryCacheStore(0), "disk": disk} {
+		t.Run(name, func(t *testing.T) { testCache(t, store) })
+	}
+}
+
+func testCache(t *testing.T, store CacheStore) {
+	// サーバーの Date もキャッシュと同じ時計にする（秒の境目から始め、Date の丸めで経過時間がずれないようにする）
+	var clockMu sync.Mutex
+	now := time.Now().Truncate(time.Second)
+	clock := func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		clockMu.Lock()
+		now = now.Add(d)
+		clockMu.Unlock()
+	}
+
+	// ?cc= を Cache-Control に、?vary= を Vary にして、If-None-Match が ETag と一致すれば 304 を返す。
+	// mode が "error" なら 500、"drop" なら接続を切る
+	var (
+		calls, notModified atomic.Int32
+		mu                 sync.Mutex
+		version            = "v1"
+		mode               string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Date", clock().UTC().Format(http.TimeFormat))
+		mu.Lock()
+		v, m := version, mode
+		mu.Unlock()
+		switch m {
+		case "error":
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		case "drop":
+			panic(http.ErrAbortHandler)
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Location", "/items")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if cc := r.URL.Query().Get("cc"); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		if vary := r.URL.Query().Get("vary"); vary != "" {
+			w.Header().Set("Vary", vary)
+		}
+		w.Header().Set("ETag", `"`+v+`"`)
+		if r.Header.Get("If-None-Match") == `"`+v+`"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, v+" "+r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+	set := func(v, m string) {
+		mu.Lock()
+		version, mode = v, m
+		mu.Unlock()
+	}
+
+	cache := NewCache(http.DefaultTransport, store)
+	cache.now = clock
+	client := &http.Client{Transport: cache}
+
+	// do は path を GET し、ボディと Cache-Status の httpclient の部分を返す
+	do := func(method, path string, header ...string) (int, string, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		status := resp.Header.Get("Cache-Status")
+		if !strings.HasPrefix(status, cacheStatusName+"; ") {
+			t.Fatalf("%s %s: Cache-Status %q", method, path, status)
+		}
+		return resp.StatusCode, string(body), strings.TrimPrefix(status, cacheStatusName+"; ")
+	}
+	type step struct {
+		advance time.Duration
+		header  []string
+		body    string
+		status  string // Cache-Status の先頭
+		calls   int32  // この手順でサーバーに届くリクエストの数
+	}
+	check := func(name, path string, steps []step) {
+		t.Helper()
+		for i, s := range steps {
+			advance(s.advance)
+			before := calls.Load()
+			_, body, status := do("GET", path, s.header...)
+			if body != s.body || !strings.HasPrefix(status, s.status) || calls.Load()-before != s.calls {
+				t.Errorf("%s #%d: body %q, status %q, %d calls; want %q, %q, %d",
+					name, i, body, status, calls.Load()-before, s.body, s.status, s.calls)
+			}
+		}
+	}
+
+	check("max-age", "/a?cc=max-age=60", []step{
+		{0, nil, "v1 ", "fwd=uri-miss; fwd-status=200; stored", 1},
+		{30 * time.Second, nil, "v1 ", "hit; ttl=30", 0},
+		{31 * time.Second, nil, "v1 ", "fwd=stale; fwd-status=304", 1},
+		{30 * time.Second, nil, "v1 ", "hit; ttl=30", 0},
+		{0, []string{"Cache-Control", "max-age=0"}, "v1 ", "fwd=request; fwd-status=304", 1},
+		{0, []string{"Cache-Control", "no-store"}, "v1 ", "fwd=bypass; fwd-status=200", 1},
+	})
+	set("v2", "")
+	check("更新", "/a?cc=max-age=60", []step{
+		{61 * time.Second, nil, "v2 ", "fwd=stale; fwd-status=200; stored", 1},
+		{0, nil, "v2 ", "hit", 0},
+		{0, []string{"If-None-Match", `"v2"`}, "", "fwd=bypass; fwd-status=304", 1},
+	})
+	check("no-store", "/b?cc=no-store", []step{
+		{0, nil, "v2 ", "fwd=uri-miss; fwd-status=200", 1},
+		{0, nil, "v2 ", "fwd=uri-miss; fwd-status=200", 1},
+	})
+	if code, _, status := do("GET", "/b?cc=no-store", "Cache-Control", "only-if-cached"); code != http.StatusGatewayTimeout || !strings.HasPrefix(status, "fwd=uri-miss") {
+		t.Errorf("only-if-cached: %d %q", code, status)
+	}
+	check("no-cache", "/c?cc=no-cache", []step{
+		{0, nil, "v2 ", "fwd=uri-miss; fwd-status=200; stored", 1},
+		{0, nil, "v2 ", "fwd=stale; fwd-status=304", 1},
+	})
+	check("Vary", "/d?cc=max-age=60&vary=Accept-Language", []step{
+		{0, []string{"Accept-Language", "ja"}, "v2 ja", "fwd=uri-miss; fwd-status=200; stored", 1},
+		{0, []string{"Accept-Language", "en"}, "v2 en", "fwd=vary-miss; fwd-status=200; stored", 1},
+		{0, []string{"Accept-Language", "ja"}, "v2 ja", "hit", 0},
+		{0, []string{"Accept-Language", "en"}, "v2 en", "hit", 0},
+		{0, nil, "v2 ", "fwd=vary-miss", 1},
+	})
+
+	set("v2", "error")
+	check("stale-if-error", "/e?cc=max-age=1,stale-if-error=60", []step{
+		{0, nil, "down\n", "fwd=uri-miss; fwd-status=500", 1},
+	})
+	set("v2", "")
+	check("stale-if-error", "/e?cc=max-age=1,stale-if-error=60", []step{
+		{0, nil, "v2 ", "fwd=uri-miss; fwd-status=200; stored", 1},
+	})
+	set("v2", "error")
+	check("stale-if-error", "/e?cc=max-age=1,stale-if-error=60", []step{
+		{30 * time.Second, nil, "v2 ", `hit; fwd=stale; fwd-status=500; detail="stale-if-error"`, 1},
+		{60 * time.Second, nil, "down\n", "fwd=stale; fwd-status=500", 1},
+	})
+
+	// must-revalidate は古くなったら再検証できなければ使わない（接続を切ると 504）
+	set("v2", "")
+	do("GET", "/f?cc=max-age=1,must-revalidate,stale-if-error=60")
+	set("v2", "drop")
+	advance(2 * time.Second)
+	if code, _, status := do("GET", "/f?cc=max-age=1,must-revalidate,stale-if-error=60"); code != http.StatusGatewayTimeout || !strings.Contains(status, "must-revalidate") {
+		t.Errorf("must-revalidate: %d %q", code, status)
+	}
+	set("v2", "")
+
+	// stale-while-revalidate は古いものをすぐ返し、裏で再検証する
+	path := "/g?cc=max-age=1,stale-while-revalidate=60"
+	do("GET", path)
+	advance(2 * time.Second)
+	before := notModified.Load()
+	if _, body, status := do("GET", path); body != "v2 " || !strings.Contains(status, "stale-while-revalidate") {
+		t.Errorf("stale-while-revalidate: %q %q", body, status)
+	}
+	for deadline := time.Now().Add(5 * time.Second); notModified.Load() == before; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("stale-while-revalidate: not revalidated in background")
+		}
+	}
+	busy := func() (running bool) {
+		cache.background.Range(func(any, any) bool { running = true; return false })
+		return running
+	}
+	for busy() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	check("stale-while-revalidate", path, []step{{0, nil, "v2 ", "hit; ttl=", 0}})
+
+	// POST が成功したら、その URL と同じオリジンの Location の保存分を捨てる
+	do("GET", "/items?cc=max-age=60")
+	check("POST 前", "/items?cc=max-age=60", []step{{0, nil, "v2 ", "hit", 0}})
+	if code, _, status := do("POST", "/items?cc=max-age=60"); code != http.StatusCreated || status != "fwd=method; fwd-status=201" {
+		t.Errorf("POST: %d %q", code, status)
+	}
+	check("POST 後", "/items?cc=max-age=60", []step{{0, nil, "v2 ", "fwd=uri-miss", 1}})
+}
+
+// TestParseCacheControl は引用符付きの値・大文字小文字・重複した指示子と、秒数の読み方を確認します。
+func TestParseCacheControl(t *testing.T) {
+	h := http.Header{"Cache-Control": {`Max-Age=60, no-cache="Set-Cookie, X-Foo", private`, "max-age=5, stale-if-error=99999999999999999999, max-stale"}}
+	cc := parseCacheControl(h)
+	if d, ok := cc.seconds("max-age"); !ok || d != time.Minute {
+		t.Errorf("max-age: %v %v", d, ok)
+	}
+	if cc["no-cache"] != "Set-Cookie, X-Foo" || !cc.has("private") || !cc.has("max-stale") || cc["max-stale"] != "" {
+		t.Errorf("directives: %#v", cc)
+	}
+	if d, ok := cc.seconds("stale-if-error"); !ok || d != time.Duration(1<<31)*time.Second {
+		t.Errorf("stale-if-error: %v %v", d, ok)
+	}
+	if _, ok := cc.seconds("private"); ok {
+		t.Error("private has no seconds")
+	}
+}
+
+// TestCacheEntryAge は Age ヘッダを経過時間に加え、大きすぎる値を 2^31 秒に切り詰めて桁あふれしないことを確認します。
+func TestCacheEntryAge(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		age  string
+		want time.Duration
+	}{
+		{"", 0},
+		{"60", time.Minute},
+		{"-5", 0},
+		{"abc", 0},
+		{"99999999999", maxDeltaSeconds * time.Second},
+		{"99999999999999999999", maxDeltaSeconds * time.Second},
+	}
+	for _, tt := range tests {
+		e := &cacheEntry{Header: http.Header{}, RequestTime: now, ResponseTime: now}
+		e.Header.Set("Date", now.Format(http.TimeFormat))
+		if tt.age != "" {
+			e.Header.Set("Age", tt.age)
+		}
+		if got := e.age(now); got != tt.want {
+			t.Errorf("Age: %q: %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// パッケージ httpclient は、ch04 のクライアントサンプルが個別に書いていた処理
+// （プロキシ（PAC・NO_PROXY）・リダイレクトの追い方・再試行・HTTP 認証・キャッシュ・Content-Encoding の展開・通信のトレース・Cookie Jar・file / data / embed スキーム・フォームや multipart のボディ作成・リクエスト/レスポンスのダンプ）を
+// まとめた共通のクライアント部品です。ch04/10_httpcli のコマンドから使います。
+package httpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Options は New で作るクライアントの設定です。
+type Options struct {
+	// Proxy はプロキシの URL です（例: http://localhost:18888）。空なら環境変数（HTTP_PROXY など）に従います。
+	Proxy string
+	// NoProxy はプロキシを使わないホストの一覧です（NO_PROXY 形式。環境変数の NO_PROXY を置き換えます）。
+	NoProxy string
+	// PAC はプロキシ自動設定ファイルのパスか URL です。指定すると Proxy や環境変数より優先します。
+	PAC string
+	// Jar は Cookie Jar です。nil なら Cookie を保持しません。
+	Jar http.CookieJar
+	// Timeout はリクエスト全体のタイムアウトです（0 なら無制限）。
+	Timeout time.Duration
+	// FollowRedirects が false ならリダイレクトを追わず、3xx のレスポンスをそのまま返します（curl と同じ既定）。
+	FollowRedirects bool
+	// Redirect は FollowRedirects が true のときのリダイレクトの追い方です（上限・同一オリジン・メソッドの維持・資格情報の扱い）。
+	Redirect RedirectPolicy
+	// Retry は接続エラーや 429・503 などのレスポンスを再試行する設定です（MaxRetries が 0 なら再試行しません）。
+	Retry RetryPolicy
+	// Auth を指定すると、401 の WWW-Authenticate に応じて Basic・Digest・Bearer の Authorization を付けて送り直します。
+	Auth *Auth
+	// Cache を指定すると、レスポンスをそこへ保存して RFC 9111 に従って使い回します（NewCache。nil ならキャッシュしません）。
+	Cache CacheStore
+	// Insecure が true ならサーバー証明書を検証しません（自己署名の ch07 サーバー向け）。
+	Insecure bool
+	// FileRoot を指定すると file:// スキームをそのディレクトリ以下のファイルとして扱います（NewFileTransport）。
+	FileRoot string
+	// Protocols は追加で登録する HTTP 以外のスキームです（embed: など）。data: は常に登録します。
+	Protocols Protocols
+	// Decoder を指定すると、Accept-Encoding を送り、gzip・deflate・br・zstd のレスポンスを展開します（nil なら net/http の gzip の自動展開だけ）。
+	Decoder *Decoder
+	// Tracer を指定すると、実際に送った往復ごとに DNS・接続・TLS・最初のバイトまでの時間などを記録します。
+	Tracer *Tracer
+	// Verbose を指定すると、送受信するヘッダをそこへ書き出します（curl -v 相当）。
+	Verbose io.Writer
+}
+
+// New は opts に従ったクライアントを返します。
+func New(opts Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxy, err := proxyConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy.ProxyFunc()
+	if opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	protocols := Protocols{"data": DataTransport{}}
+	if opts.FileRoot != "" {
+		protocols["file"] = NewFileTransport(opts.FileRoot)
+	}
+	maps.Copy(protocols, opts.Protocols)
+	protocols.Install(transport)
+
+	var rt http.RoundTripper = transport
+	if opts.Tracer != nil {
+		rt = opts.Tracer.Transport(rt)
+	}
+	if opts.Verbose != nil {
+		rt = &Verbose{Transport: rt, Out: opts.Verbose}
+	}
+	if opts.Retry.MaxRetries > 0 {
+		retry := opts.Retry
+		if opts.Verbose != nil && retry.OnRetry == nil {
+			retry.OnRetry = func(req *http.Request, attempt RetryAttempt) {
+				fmt.Fprintf(opts.Verbose, "* 再試行: %s\n", attempt)
+			}
+		}
+		rt = retry.Transport(rt)
+	}
+	if opts.Auth != nil {
+		// 401 に応じた送り直しは再試行の回数に数えない
+		if opts.Verbose != nil && opts.Auth.Logf == nil {
+			opts.Auth.Logf = func(format string, args ...any) {
+				fmt.Fprintf(opts.Verbose, "* "+format+"\n", args...)
+			}
+		}
+		rt = opts.Auth.Transport(rt)
+	}
+	if opts.Cache != nil {
+		// 再試行より外側に置き、キャッシュから返せるものは再試行の対象にしない
+		cache := NewCache(rt, opts.Cache)
+		if opts.Verbose != nil {
+			cache.Logf = func(format string, args ...any) {
+				fmt.Fprintf(opts.Verbose, "* "+format+"\n", args...)
+			}
+		}
+		rt = cache
+	}
+	if opts.Decoder != nil {
+		// キャッシュより外側に置き、キャッシュには受け取ったままの（圧縮された）表現を保存する
+		decoder := *opts.Decoder
+		if opts.Verbose != nil && decoder.OnDecode == nil {
+			decoder.OnDecode = func(r DecodeReport) {
+				fmt.Fprintf(opts.Verbose, "* 展開: %s\n", r)
+			}
+		}
+		rt = decoder.Transport(rt)
+	}
+	client := &http.Client{
+		Transport: rt,
+		Jar:       opts.Jar,
+		Timeout:   opts.Timeout,
+	}
+	policy := opts.Redirect
+	if !opts.FollowRedirects {
+		policy.MaxHops = -1
+	}
+	if opts.Verbose != nil && policy.OnRedirect == nil {
+		policy.OnRedirect = func(hop RedirectHop) {
+			fmt.Fprintf(opts.Verbose, "* リダイレクト: %s\n", hop)
+		}
+	}
+	client.CheckRedirect = policy.CheckRedirect
+	return client, nil
+}
+
+// proxyConfig は opts のプロキシの設定（なければ環境変数）から ProxyConfig を作ります。
+func proxyConfig(opts Options) (*ProxyConfig, error) {
+	var cfg *ProxyConfig
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, errors.New("httpclient: proxy must be an absolute URL like http://host:port")
+		}
+		cfg = &ProxyConfig{HTTPProxy: proxyURL, HTTPSProxy: proxyURL}
+	} else {
+		var err error
+		if cfg, err = ProxyFromEnvironment(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.NoProxy != "" {
+		noProxy, err := ParseNoProxy(opts.NoProxy)
+		if err != nil {
+			return nil, fmt.Errorf("httpclient: no proxy: %w", err)
+		}
+		cfg.NoProxy = noProxy
+	}
+	if opts.PAC != "" {
+		pac, err := LoadPAC(opts.PAC)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PAC = pac
+	}
+	if opts.Verbose != nil {
+		if cfg.PAC != nil {
+			cfg.PAC.Logf = func(format string, args ...any) {
+				fmt.Fprintf(opts.Verbose, "* "+format+"\n", args...)
+			}
+		}
+		cfg.OnDecision = func(req *http.Request, d ProxyDecision) {
+			fmt.Fprintf(opts.Verbose, "* %s のプロキシ: %s\n", req.URL.Host, d)
+		}
+	}
+	return cfg, nil
+}
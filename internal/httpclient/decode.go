@@ -0,0 +1,182 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"real-world-http-learn/internal/contentcoding"
+)
+
+// maxDecodeLayers は展開する Content-Encoding の重ねがけの上限です（展開で巨大になるボディへの備え）。
+const maxDecodeLayers = 4
+
+// Decoder は Accept-Encoding を送り、レスポンスの Content-Encoding（gzip・deflate・br・zstd と、その重ねがけ）を
+// 展開する設定です（curl の --compressed 相当）。Transport で RoundTripper を包んで使います。
+//
+// net/http の Transport は、自分で Accept-Encoding: gzip を付けたときだけ gzip を展開します。
+// Decoder は Accept-Encoding を付けるので Transport は展開せず、受け取ったバイト列を Decoder が展開します。
+type Decoder struct {
+	// Encodings は Accept-Encoding で送るコーディング（優先する順）です。nil なら contentcoding.Supported です。
+	// リクエストにすでに Accept-Encoding があればそちらを送ります。
+	Encodings []string
+	// OnDecode を設定すると、展開したボディを読み終えたとき（または閉じたとき）に圧縮前後の大きさを受け取れます（-v の表示用）。
+	OnDecode func(DecodeReport)
+}
+
+// DecodeReport はレスポンス 1 つ分の展開の記録です。
+type DecodeReport struct {
+	URL *url.URL
+	// Encodings は Content-Encoding に書かれた、サーバーが適用した順のコーディングです（展開は逆の順）。
+	Encodings []string
+	// Encoded は受け取った（圧縮された）バイト数で、Decoded は展開後のバイト数です。
+	Encoded, Decoded int64
+	// Err は展開しなかった・できなかった理由です。
+	Err error
+}
+
+// Ratio は圧縮後の大きさの、展開後の大きさに対する割合です（0.25 なら 1/4 に縮んでいた）。
+func (r DecodeReport) Ratio() float64 {
+	if r.Decoded == 0 {
+		return 0
+	}
+	return float64(r.Encoded) / float64(r.Decoded)
+}
+
+func (r DecodeReport) String() string {
+	s := fmt.Sprintf("%s: %d → %d bytes", strings.Join(r.Encodings, ", "), r.Encoded, r.Decoded)
+	if r.Decoded > 0 {
+		s += fmt.Sprintf("（圧縮率 %.1f%%）", 100*r.Ratio())
+	}
+	if r.Err != nil {
+		s += fmt.Sprintf("（%v）", r.Err)
+	}
+	return s
+}
+
+// Transport は next へ Accept-Encoding 付きでリクエストを送り、レスポンスのボディを展開する RoundTripper を返します。
+// 展開したレスポンスからは Content-Encoding と Content-Length を外し、Uncompressed を true にします。
+func (d *Decoder) Transport(next http.RoundTripper) http.RoundTripper {
+	return &decodeTransport{decoder: d, next: next}
+}
+
+type decodeTransport struct {
+	decoder *Decoder
+	next    http.RoundTripper
+}
+
+func (t *decodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return t.next.RoundTrip(req)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		encodings := t.decoder.Encodings
+		if encodings == nil {
+			encodings = contentcoding.Supported
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", strings.Join(encodings, ", "))
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	var codings []string
+	for _, v := range resp.Header.Values("Content-Encoding") {
+		for coding := range strings.SplitSeq(v, ",") {
+			if coding = contentcoding.Canonical(coding); coding != "" && coding != contentcoding.Identity {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	// 206 は圧縮後のバイト列の一部なので、単独では展開できない
+	if len(codings) == 0 || req.Method == http.MethodHead || resp.StatusCode == http.StatusPartialContent ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	report := DecodeReport{URL: req.URL, Encodings: codings}
+	if len(codings) > maxDecodeLayers {
+		report.Err = fmt.Errorf("httpclient: %d layers of content coding (max %d)", len(codings), maxDecodeLayers)
+		t.report(report)
+		return resp, nil
+	}
+
+	body := &decodeBody{orig: resp.Body, report: report, done: t.report}
+	var r io.Reader = countingReader{r: resp.Body, n: &body.report.Encoded}
+	for _, coding := range slices.Backward(codings) {
+		rc, err := contentcoding.NewReader(coding, r)
+		if err != nil {
+			report.Err = err
+			t.report(report)
+			return resp, nil
+		}
+		body.layers = append(body.layers, rc)
+		r = rc
+	}
+	body.Reader = r
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+func (t *decodeTransport) report(r DecodeReport) {
+	if t.decoder.OnDecode != nil {
+		t.decoder.OnDecode(r)
+	}
+}
+
+// countingReader は読んだバイト数を n に足します。
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// decodeBody は展開したボディです。読み終えたか閉じたときに、圧縮前後の大きさを 1 回だけ報告します。
+type decodeBody struct {
+	io.Reader
+	orig   io.ReadCloser
+	layers []io.ReadCloser // 外側（最初に展開する）から順
+	report DecodeReport
+	once   sync.Once
+	done   func(DecodeReport)
+}
+
+func (b *decodeBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.report.Decoded += int64(n)
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *decodeBody) Close() error {
+	for _, layer := range slices.Backward(b.layers) {
+		layer.Close()
+	}
+	err := b.orig.Close()
+	b.finish(nil)
+	return err
+}
+
+func (b *decodeBody) finish(err error) {
+	b.once.Do(func() {
+		if err != nil && err != io.EOF {
+			b.report.Err = err
+		}
+		b.done(b.report)
+	})
+}
@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"real-world-http-learn/internal/contentcoding"
+)
+
+// TestDecoder は Accept-Encoding を送ること、重ねがけした Content-Encoding を逆の順に展開すること、
+// 展開できないものはそのまま返すことと、圧縮前後の大きさの報告を確認します。
+func TestDecoder(t *testing.T) {
+	want := strings.Repeat("compressed body\n", 500)
+	encode := func(data []byte, codings ...string) []byte {
+		for _, coding := range codings {
+			var buf bytes.Buffer
+			enc, err := contentcoding.NewWriter(coding, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc.Write(data)
+			enc.Close()
+			data = buf.Bytes()
+		}
+		return data
+	}
+	var accepted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		switch r.URL.Path {
+		case "/stacked":
+			w.Header().Set("Content-Encoding", "gzip, identity, br")
+			w.Write(encode([]byte(want), "gzip", "br"))
+		case "/zstd":
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write(encode([]byte(want), "zstd"))
+		case "/unknown":
+			w.Header().Set("Content-Encoding", "compress")
+			io.WriteString(w, "raw")
+		default:
+			io.WriteString(w, want)
+		}
+	}))
+	defer srv.Close()
+
+	var reports []DecodeReport
+	client, err := New(Options{Decoder: &Decoder{OnDecode: func(r DecodeReport) { reports = append(reports, r) }}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("/stacked")
+	if body != want || resp.Header.Get("Content-Encoding") != "" || !resp.Uncompressed || resp.ContentLength != -1 {
+		t.Errorf("stacked: %d bytes, %v", len(body), resp.Header)
+	}
+	if accepted != "zstd, br, gzip, deflate" {
+		t.Errorf("Accept-Encoding = %q", accepted)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("reports %v", reports)
+	}
+	r := reports[0]
+	if strings.Join(r.Encodings, ",") != "gzip,br" || r.Decoded != int64(len(want)) || r.Encoded == 0 || r.Ratio() >= 0.1 || r.Err != nil {
+		t.Errorf("report %+v", r)
+	}
+
+	if _, body := get("/zstd"); body != want || len(reports) != 2 {
+		t.Errorf("zstd: %d bytes, %d reports", len(body), len(reports))
+	}
+	if resp, body := get("/unknown"); body != "raw" || resp.Header.Get("Content-Encoding") != "compress" || reports[2].Err == nil {
+		t.Errorf("unknown: %q %v %v", body, resp.Header, reports[2:])
+	}
+	if _, body := get("/plain"); body != want || len(reports) != 3 {
+		t.Errorf("plain: %d bytes, %d reports", len(body), len(reports))
+	}
+}
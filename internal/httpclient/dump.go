@@ -0,0 +1,51 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+)
+
+// Verbose は送受信するリクエストとレスポンスのヘッダを Out に書き出す RoundTripper です（curl -v 相当）。
+// リダイレクトを追う場合も 1 往復ごとに書き出します。
+type Verbose struct {
+	Transport http.RoundTripper
+	Out       io.Writer
+}
+
+func (v *Verbose) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" || req.URL.Scheme == "https" {
+		if dump, err := httputil.DumpRequestOut(req, false); err == nil {
+			writePrefixed(v.Out, "> ", dump)
+		}
+	} else {
+		fmt.Fprintf(v.Out, "> %s %s\n", req.Method, req.URL)
+	}
+	resp, err := v.Transport.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(v.Out, "* %v\n", err)
+		return nil, err
+	}
+	DumpResponse(v.Out, resp)
+	return resp, nil
+}
+
+// DumpResponse はレスポンスのステータス行とヘッダを "< " を付けて w に書きます。
+func DumpResponse(w io.Writer, resp *http.Response) error {
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		return err
+	}
+	writePrefixed(w, "< ", dump)
+	return nil
+}
+
+// writePrefixed は dump（CRLF 区切りのヘッダ）の各行に prefix を付けて書きます。
+func writePrefixed(w io.Writer, prefix string, dump []byte) {
+	for _, line := range bytes.Split(bytes.TrimRight(dump, "\r\n"), []byte("\r\n")) {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+	fmt.Fprintln(w, prefix[:1])
+}
@@ -0,0 +1,302 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Entry は Jar が保持する 1 つの Cookie です（RFC 6265 5.3 のストレージモデル）。
+type Entry struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	HostOnly bool   `json:"hostOnly"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"httpOnly"`
+	SameSite string `json:"sameSite,omitempty"`
+	// Expires がゼロ値ならセッション Cookie です。
+	Expires    time.Time `json:"expires,omitzero"`
+	Creation   time.Time `json:"creation"`
+	LastAccess time.Time `json:"lastAccess"`
+}
+
+func (e *Entry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// Jar はファイルに保存できる http.CookieJar です。
+// net/http/cookiejar と同じく Public Suffix List（golang.org/x/net/publicsuffix）で
+// "co.jp" のような公開接尾辞への Domain 指定を拒否し、期限切れの Cookie は送りません。
+//
+// OpenJar で開いた Jar は Save でファイルへ書き戻せます。保存時はファイルをロックしてから読み直し、
+// この Jar で変更した Cookie だけを重ねるため、複数のプロセスが同じファイルを使っても互いの変更を消しません。
+type Jar struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+	// changed は最後の保存以降に追加・更新（値が Entry）・削除（値が nil）したエントリです。
+	changed map[string]*Entry
+	path    string
+	now     func() time.Time
+}
+
+// NewJar は空の Jar を返します。
+func NewJar() *Jar {
+	return &Jar{
+		entries: map[string]*Entry{},
+		changed: map[string]*Entry{},
+		now:     time.Now,
+	}
+}
+
+// SetCookies は u へのレスポンスで受け取った Cookie を保存します。
+// Max-Age が 0 以下か Expires が過去の Cookie は、同じ Cookie を削除する指示として扱います。
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	for _, c := range cookies {
+		e, remove, ok := j.newEntry(c, u, host, now)
+		if !ok {
+			continue
+		}
+		key := e.key()
+		old := j.entries[key]
+		if remove {
+			if old != nil {
+				delete(j.entries, key)
+				j.changed[key] = nil
+			}
+			continue
+		}
+		if old != nil {
+			e.Creation = old.Creation
+		}
+		j.entries[key] = e
+		j.changed[key] = e
+	}
+}
+
+// newEntry は受け取った Cookie をエントリにします。ok が false なら拒否された Cookie です。
+func (j *Jar) newEntry(c *http.Cookie, u *url.URL, host string, now time.Time) (e *Entry, remove, ok bool) {
+	if c.Name == "" {
+		return nil, false, false
+	}
+	if c.Secure && u.Scheme != "https" && !isLoopback(host) {
+		// RFC 6265bis: 安全でないオリジンは Secure 属性付きの Cookie を設定できない（ループバックは安全とみなす）
+		return nil, false, false
+	}
+	e = &Entry{
+		Name:       c.Name,
+		Value:      c.Value,
+		Secure:     c.Secure,
+		HttpOnly:   c.HttpOnly,
+		SameSite:   sameSiteName(c.SameSite),
+		Creation:   now,
+		LastAccess: now,
+	}
+
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	switch {
+	case domain == "":
+		e.Domain, e.HostOnly = host, true
+	case isIP(host):
+		// IP アドレスには Domain 属性を使えない（同じアドレスなら host-only として受け入れる）
+		if domain != host {
+			return nil, false, false
+		}
+		e.Domain, e.HostOnly = host, true
+	case isPublicSuffix(domain):
+		// 公開接尾辞そのものを Domain にした Cookie は、そのホスト自身からなら host-only として受け入れる
+		if domain != host {
+			return nil, false, false
+		}
+		e.Domain, e.HostOnly = host, true
+	case !domainMatch(host, domain):
+		return nil, false, false
+	default:
+		e.Domain = domain
+	}
+
+	e.Path = c.Path
+	if e.Path == "" || e.Path[0] != '/' {
+		e.Path = defaultPath(u.Path)
+	}
+
+	switch {
+	case c.MaxAge < 0:
+		return e, true, true
+	case c.MaxAge > 0:
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		if !c.Expires.After(now) {
+			return e, true, true
+		}
+		e.Expires = c.Expires
+	}
+	return e, false, true
+}
+
+// Cookies は u へのリクエストで送る Cookie を返します（パスの長いもの、作成の古いものから順）。
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	secure := u.Scheme == "https" || isLoopback(host)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	var selected []*Entry
+	for key, e := range j.entries {
+		if e.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+		if e.Secure && !secure {
+			continue
+		}
+		if e.HostOnly && e.Domain != host || !e.HostOnly && !domainMatch(host, e.Domain) {
+			continue
+		}
+		if !pathMatch(path, e.Path) {
+			continue
+		}
+		e.LastAccess = now
+		selected = append(selected, e)
+	}
+	sort.Slice(selected, func(a, b int) bool {
+		if len(selected[a].Path) != len(selected[b].Path) {
+			return len(selected[a].Path) > len(selected[b].Path)
+		}
+		return selected[a].Creation.Before(selected[b].Creation)
+	})
+	cookies := make([]*http.Cookie, len(selected))
+	for i, e := range selected {
+		cookies[i] = &http.Cookie{Name: e.Name, Value: e.Value}
+	}
+	return cookies
+}
+
+// Entries は期限切れでないすべてのエントリのコピーをドメイン・パス・名前の順に返します。
+func (j *Jar) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return sortedEntries(j.entries, j.now())
+}
+
+func sortedEntries(entries map[string]*Entry, now time.Time) []Entry {
+	out := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if !e.expired(now) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Domain != out[b].Domain {
+			return out[a].Domain < out[b].Domain
+		}
+		if out[a].Path != out[b].Path {
+			return out[a].Path < out[b].Path
+		}
+		return out[a].Name < out[b].Name
+	})
+	return out
+}
+
+func sameSiteName(s http.SameSite) string {
+	switch s {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
+
+// canonicalHost はポートを除き、小文字にしたホスト名を返します。
+func canonicalHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", net.InvalidAddrError("empty host")
+	}
+	return host, nil
+}
+
+func isIP(host string) bool {
+	return net.ParseIP(strings.Trim(host, "[]")) != nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// isPublicSuffix は domain が公開接尾辞（com・co.jp・github.io など）そのものかどうかです。
+// 一覧にない 1 ラベルの名前（localhost など）も公開接尾辞になるため、ホスト自身なら host-only として扱います。
+func isPublicSuffix(domain string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+// domainMatch は RFC 6265 5.1.3 のドメイン一致です。
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return !isIP(host) && strings.HasSuffix(host, "."+domain)
+}
+
+// defaultPath は RFC 6265 5.1.4 の既定のパス（最後の "/" より前）です。
+func defaultPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if p == "" || p[0] != '/' || i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// pathMatch は RFC 6265 5.1.4 のパス一致です。
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
@@ -0,0 +1,148 @@
+package httpclient
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := []string{}
+	for _, c := range cookies {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// TestJarDomainAndPath は Domain・Path の一致と公開接尾辞の拒否を確認します。
+func TestJarDomainAndPath(t *testing.T) {
+	j := NewJar()
+	j.SetCookies(mustURL(t, "https://www.example.co.jp/app/login"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "shared", Value: "1", Domain: "example.co.jp", Path: "/"},
+		{Name: "suffix", Value: "1", Domain: "co.jp"},
+		{Name: "other", Value: "1", Domain: "example.com"},
+		{Name: "deep", Value: "1", Path: "/app/admin"},
+	})
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://www.example.co.jp/app/x", []string{"host", "shared"}},
+		{"https://www.example.co.jp/app/admin/users", []string{"deep", "host", "shared"}},
+		{"https://api.example.co.jp/app/x", []string{"shared"}},
+		{"https://www.example.co.jp/application", []string{"shared"}},
+		{"https://other.co.jp/", []string{}},
+	}
+	for _, tt := range tests {
+		got := cookieNames(j.Cookies(mustURL(t, tt.url)))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.url, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.url, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// TestJarExpiry は Max-Age による期限切れと削除を確認します。
+func TestJarExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	j := NewJar()
+	j.now = func() time.Time { return now }
+	u := mustURL(t, "http://localhost:18888/")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", MaxAge: 60}, {Name: "b", Value: "1"}})
+
+	now = now.Add(2 * time.Minute)
+	if got := cookieNames(j.Cookies(u)); len(got) != 1 || got[0] != "b" {
+		t.Errorf("after expiry: got %v, want [b]", got)
+	}
+	j.SetCookies(u, []*http.Cookie{{Name: "b", MaxAge: -1}})
+	if got := j.Cookies(u); len(got) != 0 {
+		t.Errorf("after delete: got %v", cookieNames(got))
+	}
+}
+
+// TestJarSaveMerges は 2 つの Jar が同じファイルへ保存しても互いの Cookie が残ることを確認します。
+func TestJarSaveMerges(t *testing.T) {
+	for _, name := range []string{"cookies.txt", "cookies.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		u := mustURL(t, "http://localhost:18888/")
+		a, err := OpenJar(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := OpenJar(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", HttpOnly: true, MaxAge: 3600}})
+		b.SetCookies(u, []*http.Cookie{{Name: "b", Value: "2"}})
+		if err := a.Save(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Save(); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := OpenJar(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := c.Entries()
+		if len(entries) != 2 || entries[0].Name != "a" || !entries[0].HttpOnly || entries[0].Expires.IsZero() || entries[1].Name != "b" {
+			t.Errorf("%s: entries = %+v", name, entries)
+		}
+	}
+}
+
+// TestNetscapeRoundTrip は curl 形式のファイルを読み書きしても内容が変わらないことを確認します。
+func TestNetscapeRoundTrip(t *testing.T) {
+	in := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t1893456000\tid\tabc\n" +
+		"#HttpOnly_localhost\tFALSE\t/app\tFALSE\t0\tsession\txyz\n"
+	entries, err := ReadNetscape(bytes.NewBufferString(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries", len(entries))
+	}
+	if e := entries[0]; e.Domain != "example.com" || e.HostOnly || !e.Secure || e.Expires.Unix() != 1893456000 {
+		t.Errorf("entry 0 = %+v", e)
+	}
+	if e := entries[1]; e.Domain != "localhost" || !e.HostOnly || !e.HttpOnly || !e.Expires.IsZero() {
+		t.Errorf("entry 1 = %+v", e)
+	}
+
+	var out bytes.Buffer
+	if err := WriteNetscape(&out, []Entry{*entries[0], *entries[1]}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadNetscape(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entries {
+		if *again[i] != *entries[i] {
+			t.Errorf("round trip %d: %+v != %+v", i, *again[i], *entries[i])
+		}
+	}
+}
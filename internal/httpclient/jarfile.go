@@ -0,0 +1,238 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// netscapeHeader は Netscape 形式（curl や wget の cookies.txt）の先頭行です。
+const netscapeHeader = "# Netscape HTTP Cookie File"
+
+// httpOnlyPrefix は curl が HttpOnly の Cookie のドメインに付ける接頭辞です。
+const httpOnlyPrefix = "#HttpOnly_"
+
+// OpenJar は name のファイルから Cookie を読み込んだ Jar を返します（ファイルがなければ空の Jar）。
+// 返した Jar の Save は同じファイルへ書き戻します。
+// 形式は内容から判定し、保存時は拡張子が .json なら JSON、それ以外は Netscape 形式で書きます。
+func OpenJar(name string) (*Jar, error) {
+	j := NewJar()
+	j.path = name
+	unlock, err := lockFile(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := readJarFile(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		j.entries[e.key()] = e
+	}
+	return j, nil
+}
+
+// Load は name のファイルの Cookie をこの Jar に加えます（curl の -b にファイルを渡した場合に相当）。
+// 読み込んだ Cookie は変更として扱わないため、Save で書き出し先へは書かれません。
+func (j *Jar) Load(name string) error {
+	unlock, err := lockFile(name, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readJarFile(name)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range entries {
+		if _, ok := j.entries[e.key()]; !ok {
+			j.entries[e.key()] = e
+		}
+	}
+	return nil
+}
+
+// Save は OpenJar で開いたファイルへ Cookie を書き戻します。
+// ファイルをロックして読み直し、この Jar で追加・更新・削除した Cookie だけを反映してから置き換えるため、
+// 同じファイルを使う別のプロセスが保存した Cookie は残ります。期限切れの Cookie は書きません。
+func (j *Jar) Save() error {
+	if j.path == "" {
+		return errors.New("httpclient: jar was not opened from a file")
+	}
+	unlock, err := lockFile(j.path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := readJarFile(j.path)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	merged := make(map[string]*Entry, len(current))
+	for _, e := range current {
+		merged[e.key()] = e
+	}
+	for key, e := range j.changed {
+		if e == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = e
+		}
+	}
+	entries := sortedEntries(merged, j.now())
+
+	var buf bytes.Buffer
+	if strings.EqualFold(filepath.Ext(j.path), ".json") {
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	} else {
+		err = WriteNetscape(&buf, entries)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(j.path, buf.Bytes()); err != nil {
+		return err
+	}
+
+	// 他のプロセスが保存した Cookie も以後のリクエストで使う
+	j.entries = make(map[string]*Entry, len(entries))
+	for i := range entries {
+		j.entries[entries[i].key()] = &entries[i]
+	}
+	j.changed = map[string]*Entry{}
+	return nil
+}
+
+// readJarFile は Netscape 形式か JSON のファイルを読みます。ファイルがなければ空を返します。
+func readJarFile(name string) ([]*Entry, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []*Entry
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("httpclient: %s: %w", name, err)
+		}
+		return entries, nil
+	}
+	entries, err := ReadNetscape(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("httpclient: %s: %w", name, err)
+	}
+	return entries, nil
+}
+
+// ReadNetscape は Netscape 形式の Cookie を読みます。
+// 各行はタブ区切りで domain・includeSubdomains・path・secure・expires・name・value の 7 項目です。
+// expires が 0 の行はセッション Cookie、domain の "#HttpOnly_" は HttpOnly を表します。
+func ReadNetscape(r io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(text, httpOnlyPrefix); ok {
+			text, httpOnly = rest, true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: want 7 tab-separated fields, got %d", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expires %q", line, fields[4])
+		}
+		e := &Entry{
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			e.Expires = time.Unix(expires, 0)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// WriteNetscape は entries を Netscape 形式で書きます。
+func WriteNetscape(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, netscapeHeader)
+	fmt.Fprintln(bw, "# このファイルは real-world-http-learn の httpclient が書き出しました。")
+	fmt.Fprintln(bw)
+	for _, e := range entries {
+		domain, includeSub := e.Domain, "FALSE"
+		if !e.HostOnly {
+			domain, includeSub = "."+e.Domain, "TRUE"
+		}
+		if e.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Unix()
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, includeSub, e.Path, netscapeBool(e.Secure), expires, e.Name, e.Value)
+	}
+	return bw.Flush()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// writeFileAtomic は一時ファイルに書いてから置き換えます（Cookie を含むため所有者のみ読み書き可）。
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,34 @@
+//go:build !unix
+
+package httpclient
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// lockTimeout は他のプロセスのロックの解除を待つ上限です。
+const lockTimeout = 10 * time.Second
+
+// lockFile は flock のない環境向けに "name.lock" を排他的に作成してロックとします。
+// 共有ロックは使えないため、exclusive にかかわらず排他ロックになります。
+func lockFile(name string, exclusive bool) (unlock func(), err error) {
+	lockName := name + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockName) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("httpclient: timed out waiting for " + lockName)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
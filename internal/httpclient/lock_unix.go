@@ -0,0 +1,36 @@
+//go:build unix
+
+package httpclient
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile は name の隣の "name.lock" を flock でロックし、解除する関数を返します。
+// 保存は一時ファイルの rename で行うため、Cookie のファイルそのものではなく別のファイルをロックします。
+// exclusive が false なら共有ロック（読み込み同士は並行できる）です。
+func lockFile(name string, exclusive bool) (unlock func(), err error) {
+	f, err := os.OpenFile(name+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
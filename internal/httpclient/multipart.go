@@ -0,0 +1,296 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MultipartOptions は Multipart の設定です。
+type MultipartOptions struct {
+	// Boundary はパートの区切り文字列です（空ならランダムに生成します）。
+	Boundary string
+	// FilenameEncoding は filename パラメータの書き方です。
+	//   - "" / "utf8": UTF-8 のまま書き、" と改行だけを %22・%0D・%0A にする（ブラウザの form と同じ。RFC 7578 4.2）
+	//   - "percent": ASCII の英数字と一部の記号以外をパーセントエンコードする（UTF-8 を扱えないサーバー向け）
+	// RFC 7578 は filename*（RFC 5987）を使ってはならないとしているため、どちらも filename だけを使います。
+	FilenameEncoding string
+	// Progress を指定すると、ボディを読み出すたびに送信済みのバイト数と全体の長さ（不明なら -1）で呼ばれます。
+	Progress func(sent, total int64)
+}
+
+// segment は multipart のボディの一部です。data（区切りとヘッダ、テキストの値）かファイルのどちらかです。
+type segment struct {
+	data []byte
+	file string
+	size int64 // ファイルの長さ（-1 なら不明）
+}
+
+// Multipart は fields を multipart/form-data のボディにします。
+//
+// ボディ全体をメモリに作らず、区切りとヘッダだけを先に組み立てておき、ファイルは送信中に順に開いて読みます。
+// そのためギガバイト単位のファイルでも一定のメモリで送れます。すべてのファイルが通常のファイルなら
+// 長さを前もって計算して Content-Length を付け、標準入力（"-"）などの長さが分からない入力があれば chunked で送ります。
+// ファイルの Content-Type を指定しなければ、拡張子と先頭 512 バイトの内容から判定します。
+func Multipart(fields []FormField, opts MultipartOptions) (*Body, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if opts.Boundary != "" {
+		if err := mw.SetBoundary(opts.Boundary); err != nil {
+			return nil, err
+		}
+	}
+	var segs []segment
+	flush := func() {
+		if buf.Len() > 0 {
+			segs = append(segs, segment{data: bytes.Clone(buf.Bytes())})
+			buf.Reset()
+		}
+	}
+
+	for _, f := range fields {
+		h := make(textproto.MIMEHeader)
+		if f.File == "" {
+			h.Set("Content-Disposition", `form-data; name="`+escapeFormParam(f.Name)+`"`)
+			if f.ContentType != "" {
+				h.Set("Content-Type", f.ContentType)
+			}
+			w, err := mw.CreatePart(h)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.WriteString(w, f.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		size, head, err := inspectFile(f.File)
+		if err != nil {
+			return nil, err
+		}
+		filename := f.Filename
+		if filename == "" {
+			filename = baseName(f.File)
+		}
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = DetectContentType(filename, head)
+		}
+		encoded, err := encodeFilename(filename, opts.FilenameEncoding)
+		if err != nil {
+			return nil, err
+		}
+		h.Set("Content-Disposition", `form-data; name="`+escapeFormParam(f.Name)+`"; filename="`+encoded+`"`)
+		h.Set("Content-Type", contentType)
+		if _, err := mw.CreatePart(h); err != nil {
+			return nil, err
+		}
+		flush()
+		segs = append(segs, segment{file: f.File, size: size})
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	length := int64(0)
+	for _, s := range segs {
+		if s.file == "" {
+			length += int64(len(s.data))
+			continue
+		}
+		if s.size < 0 {
+			length = -1
+			break
+		}
+		length += s.size
+	}
+
+	open := func() io.ReadCloser {
+		var r io.ReadCloser = &multipartReader{segs: segs}
+		if opts.Progress != nil {
+			r = &progressReader{r: r, total: length, progress: opts.Progress}
+		}
+		return r
+	}
+	body := &Body{Reader: open(), ContentType: mw.FormDataContentType(), Length: length}
+	if length >= 0 {
+		// 標準入力を含むボディは読み直せない
+		body.GetBody = func() (io.ReadCloser, error) { return open(), nil }
+	}
+	return body, nil
+}
+
+// inspectFile はファイルの長さ（通常のファイル以外は -1）と、Content-Type の判定に使う先頭部分を返します。
+func inspectFile(name string) (size int64, head []byte, err error) {
+	if name == "-" {
+		return -1, nil, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return -1, nil, nil
+	}
+	head = make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, nil, err
+	}
+	return info.Size(), head[:n], nil
+}
+
+// DetectContentType はファイル名の拡張子から、分からなければ内容の先頭部分から Content-Type を判定します。
+// 拡張子を優先するのは、.json や .css のような内容からは text/plain としか判定できない形式があるためです。
+func DetectContentType(filename string, head []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(filename)); t != "" {
+		return t
+	}
+	if len(head) > 0 {
+		return http.DetectContentType(head)
+	}
+	return "application/octet-stream"
+}
+
+// formParamEscaper は HTML の form 送信と同じく、引用符付きの値の " と改行をパーセントエンコードします。
+var formParamEscaper = strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A")
+
+func escapeFormParam(s string) string {
+	return formParamEscaper.Replace(s)
+}
+
+// encodeFilename は filename パラメータの値を MultipartOptions.FilenameEncoding に従って書きます。
+func encodeFilename(name, encoding string) (string, error) {
+	switch encoding {
+	case "", "utf8":
+		return escapeFormParam(name), nil
+	case "percent":
+		return url.PathEscape(name), nil
+	}
+	return "", fmt.Errorf("httpclient: unknown filename encoding %q", encoding)
+}
+
+// baseName はパスの最後の要素を返します（Windows の区切り文字も考慮します）。
+func baseName(p string) string {
+	if i := strings.LastIndexAny(p, `/\`); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
+
+// multipartReader は segment を順に読み出します。ファイルは読む順番が来てから開き、読み終えたら閉じます。
+type multipartReader struct {
+	segs   []segment
+	next   int
+	cur    io.Reader
+	file   *os.File
+	seg    segment
+	copied int64
+}
+
+func (m *multipartReader) Read(p []byte) (int, error) {
+	for {
+		if m.cur == nil {
+			if m.next >= len(m.segs) {
+				return 0, io.EOF
+			}
+			if err := m.open(m.segs[m.next]); err != nil {
+				return 0, err
+			}
+			m.next++
+		}
+		n, err := m.cur.Read(p)
+		m.copied += int64(n)
+		if err == io.EOF {
+			if err := m.finish(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (m *multipartReader) open(s segment) error {
+	m.seg, m.copied = s, 0
+	if s.file == "" {
+		m.cur = bytes.NewReader(s.data)
+		return nil
+	}
+	if s.file == "-" {
+		m.cur = os.Stdin
+		return nil
+	}
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+	m.file = f
+	if s.size >= 0 {
+		// Content-Length を計算した後でファイルが伸びても、その長さまでしか送らない
+		m.cur = io.LimitReader(f, s.size)
+	} else {
+		m.cur = f
+	}
+	return nil
+}
+
+// finish は今のセグメントを閉じ、ファイルが計算時より短くなっていればエラーにします。
+func (m *multipartReader) finish() error {
+	m.cur = nil
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+	if m.seg.file != "" && m.seg.size >= 0 && m.copied != m.seg.size {
+		return fmt.Errorf("httpclient: %s changed while sending (%d of %d bytes)", m.seg.file, m.copied, m.seg.size)
+	}
+	return nil
+}
+
+func (m *multipartReader) Close() error {
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+	m.cur = nil
+	m.next = len(m.segs)
+	return nil
+}
+
+// progressReader は読み出したバイト数を progress に知らせます。
+type progressReader struct {
+	r        io.ReadCloser
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.progress(p.sent, p.total)
+	}
+	return n, err
+}
+
+func (p *progressReader) Close() error { return p.r.Close() }
@@ -0,0 +1,77 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMultipartStreams は計算した長さが実際のボディと一致し、標準のパーサーで読み戻せることを確認します。
+func TestMultipartStreams(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789"), 100_000)
+	path := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var lastSent int64
+	body, err := Multipart([]FormField{
+		{Name: "title", Value: "こんにちは"},
+		{Name: "file", File: path, Filename: `報告 "最終".json`},
+	}, MultipartOptions{Progress: func(sent, total int64) { lastSent = sent }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(body.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(raw)) != body.Length || lastSent != body.Length {
+		t.Errorf("length = %d, read %d, progress %d", body.Length, len(raw), lastSent)
+	}
+
+	_, params, err := mime.ParseMediaType(body.ContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(bytes.NewReader(raw), params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := io.ReadAll(part); part.FormName() != "title" || string(v) != "こんにちは" {
+		t.Errorf("part 1 = %s %q", part.FormName(), v)
+	}
+	part, err = mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := part.Header.Get("Content-Disposition"); !strings.Contains(got, `filename="報告 %22最終%22.json"`) {
+		t.Errorf("Content-Disposition = %s", got)
+	}
+	if got := part.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %s", got)
+	}
+	if v, _ := io.ReadAll(part); !bytes.Equal(v, data) {
+		t.Errorf("file content differs (%d bytes)", len(v))
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("want EOF after 2 parts, got %v", err)
+	}
+
+	// 読み直したボディも同じ内容になる
+	again, err := body.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw2, _ := io.ReadAll(again)
+	if !bytes.Equal(raw, raw2) {
+		t.Error("GetBody returned a different body")
+	}
+}
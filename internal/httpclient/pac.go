@@ -0,0 +1,993 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PAC はプロキシ自動設定ファイル（FindProxyForURL を定義した JavaScript）です。
+//
+// JavaScript のエンジンは組み込まず、PAC でよく使われる範囲だけを解釈します。
+//
+//   - function 宣言（FindProxyForURL 以外の補助関数も可）、var、代入、if / else、return、三項演算子
+//   - 文字列・数値・true / false / null、+ - ! && || == != === !== < > <= >=
+//   - 文字列の toLowerCase・toUpperCase・indexOf・substring・startsWith・endsWith・length
+//   - PAC の関数 isPlainHostName・dnsDomainIs・localHostOrDomainIs・isResolvable・isInNet・dnsResolve・
+//     myIpAddress・dnsDomainLevels・shExpMatch・convert_addr・weekdayRange・timeRange・alert
+//
+// ループ・正規表現・dateRange などは読み込み時にエラーになります。
+type PAC struct {
+	// LookupHost は dnsResolve・isInNet などの名前解決に使います（nil なら net.DefaultResolver）。
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+	// Logf は alert() の出力先です（nil なら捨てます）。
+	Logf func(format string, args ...any)
+
+	funcs   map[string]*pacFunc
+	globals []pacStmt
+	now     func() time.Time
+}
+
+// LoadPAC はファイルのパス、または http(s):// の URL から PAC を読み込みます。
+// URL の取得にはプロキシを使いません。
+func LoadPAC(location string) (*PAC, error) {
+	var src []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := &http.Client{Transport: &http.Transport{Proxy: nil}, Timeout: 10 * time.Second}
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("pac: %s: %s", location, resp.Status)
+		}
+		if src, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if src, err = os.ReadFile(location); err != nil {
+			return nil, err
+		}
+	}
+	return ParsePAC(string(src))
+}
+
+// ParsePAC は PAC のソースを解釈します。FindProxyForURL がないか、未対応の構文や関数があればエラーを返します。
+func ParsePAC(src string) (*PAC, error) {
+	toks, err := lexPAC(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &pacParser{toks: toks, pac: &PAC{funcs: map[string]*pacFunc{}}}
+	if err := p.parseProgram(); err != nil {
+		return nil, err
+	}
+	main, ok := p.pac.funcs["FindProxyForURL"]
+	if !ok {
+		return nil, fmt.Errorf("pac: FindProxyForURL is not defined")
+	}
+	if len(main.params) != 2 {
+		return nil, fmt.Errorf("pac: line %d: FindProxyForURL must take (url, host)", main.line)
+	}
+	for _, c := range p.calls {
+		if _, ok := p.pac.funcs[c.name]; ok {
+			continue
+		}
+		if _, ok := pacBuiltins[c.name]; !ok {
+			return nil, fmt.Errorf("pac: line %d: unsupported function %s", c.line, c.name)
+		}
+	}
+	return p.pac, nil
+}
+
+// FindProxyForURL は u について PAC の FindProxyForURL を評価し、戻り値と、それを返した return の行番号を返します。
+// ブラウザと同じく、https の URL はパスとクエリを取り除いて渡します。
+func (p *PAC) FindProxyForURL(u *url.URL) (result string, line int, err error) {
+	rawURL := u.String()
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		rawURL = u.Scheme + "://" + u.Host + "/"
+	}
+	env := &pacEnv{pac: p, globals: map[string]pacValue{}}
+	for _, s := range p.globals {
+		if _, err := env.exec(s, env.globals); err != nil {
+			return "", 0, err
+		}
+	}
+	v, line, err := env.call(p.funcs["FindProxyForURL"], []pacValue{rawURL, strings.ToLower(u.Hostname())}, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", line, fmt.Errorf("pac: line %d: FindProxyForURL returned %s, not a string", line, pacString(v))
+	}
+	return s, line, nil
+}
+
+// 構文木
+
+type pacFunc struct {
+	name   string
+	params []string
+	body   []pacStmt
+	line   int
+}
+
+type pacStmt interface{ stmtLine() int }
+
+type (
+	pacBlock struct{ list []pacStmt }
+	pacIf    struct {
+		cond      pacExpr
+		then, els pacStmt
+		line      int
+	}
+	pacReturn struct {
+		x    pacExpr // nil なら undefined
+		line int
+	}
+	// pacAssign は var 宣言（decl）と代入です。
+	pacAssign struct {
+		name string
+		x    pacExpr
+		decl bool
+		line int
+	}
+	pacExprStmt struct {
+		x    pacExpr
+		line int
+	}
+)
+
+func (s *pacBlock) stmtLine() int {
+	if len(s.list) > 0 {
+		return s.list[0].stmtLine()
+	}
+	return 0
+}
+func (s *pacIf) stmtLine() int       { return s.line }
+func (s *pacReturn) stmtLine() int   { return s.line }
+func (s *pacAssign) stmtLine() int   { return s.line }
+func (s *pacExprStmt) stmtLine() int { return s.line }
+
+type pacExpr interface{}
+
+type (
+	pacLit   struct{ v pacValue }
+	pacIdent struct {
+		name string
+		line int
+	}
+	pacCall struct {
+		name string
+		args []pacExpr
+		line int
+	}
+	pacMethod struct {
+		recv pacExpr
+		name string
+		args []pacExpr
+		call bool // false ならプロパティの参照（length）
+		line int
+	}
+	pacUnary struct {
+		op string
+		x  pacExpr
+	}
+	pacBinary struct {
+		op   string
+		x, y pacExpr
+		line int
+	}
+	pacCond struct{ cond, x, y pacExpr }
+)
+
+// 字句解析
+
+type pacToken struct {
+	kind byte // 'i' 識別子, 's' 文字列, 'n' 数値, 'p' 記号, 0 終端
+	text string
+	line int
+}
+
+var pacPuncts = []string{"===", "!==", "==", "!=", "<=", ">=", "&&", "||", "(", ")", "{", "}", ";", ",", ".", "!", "<", ">", "=", "+", "-", "?", ":"}
+
+func lexPAC(src string) ([]pacToken, error) {
+	var toks []pacToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("pac: line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\n' {
+					return nil, fmt.Errorf("pac: line %d: unterminated string", line)
+				}
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[j])
+					}
+					continue
+				}
+				b.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("pac: line %d: unterminated string", line)
+			}
+			toks = append(toks, pacToken{'s', b.String(), line})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, pacToken{'n', src[i:j], line})
+			i = j
+		case c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '$' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, pacToken{'i', src[i:j], line})
+			i = j
+		default:
+			matched := false
+			for _, p := range pacPuncts {
+				if strings.HasPrefix(src[i:], p) {
+					toks = append(toks, pacToken{'p', p, line})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("pac: line %d: unexpected character %q", line, c)
+			}
+		}
+	}
+	return append(toks, pacToken{line: line}), nil
+}
+
+// 構文解析
+
+type pacParser struct {
+	toks  []pacToken
+	pos   int
+	pac   *PAC
+	calls []*pacCall
+}
+
+func (p *pacParser) peek() pacToken { return p.toks[p.pos] }
+
+func (p *pacParser) next() pacToken {
+	t := p.toks[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+// is は次のトークンが記号かキーワードの text かどうかです。
+func (p *pacParser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == 'p' || t.kind == 'i') && t.text == text
+}
+
+func (p *pacParser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pacParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *pacParser) errorf(format string, args ...any) error {
+	t := p.peek()
+	found := "end of file"
+	if t.kind != 0 {
+		found = strconv.Quote(t.text)
+	}
+	return fmt.Errorf("pac: line %d: %s, found %s", t.line, fmt.Sprintf(format, args...), found)
+}
+
+func (p *pacParser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != 'i' {
+		return "", p.errorf("expected identifier")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *pacParser) parseProgram() error {
+	for p.peek().kind != 0 {
+		if p.is("function") {
+			if err := p.parseFunction(); err != nil {
+				return err
+			}
+			continue
+		}
+		s, err := p.parseStmt()
+		if err != nil {
+			return err
+		}
+		if s != nil {
+			p.pac.globals = append(p.pac.globals, s)
+		}
+	}
+	return nil
+}
+
+func (p *pacParser) parseFunction() error {
+	line := p.next().line
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	f := &pacFunc{name: name, line: line}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for !p.accept(")") {
+		param, err := p.ident()
+		if err != nil {
+			return err
+		}
+		f.params = append(f.params, param)
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+		}
+	}
+	block, err := p.parseBlock()
+	if err != nil {
+		return err
+	}
+	f.body = block.list
+	p.pac.funcs[name] = f
+	return nil
+}
+
+func (p *pacParser) parseBlock() (*pacBlock, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	b := &pacBlock{}
+	for !p.accept("}") {
+		if p.peek().kind == 0 {
+			return nil, p.errorf("expected \"}\"")
+		}
+		s, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			b.list = append(b.list, s)
+		}
+	}
+	return b, nil
+}
+
+// parseStmt は文を 1 つ読みます。空文なら nil を返します。
+func (p *pacParser) parseStmt() (pacStmt, error) {
+	t := p.peek()
+	switch {
+	case p.accept(";"):
+		return nil, nil
+	case p.is("{"):
+		return p.parseBlock()
+	case p.accept("if"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		s := &pacIf{cond: cond, line: t.line}
+		if s.then, err = p.parseStmt(); err != nil {
+			return nil, err
+		}
+		if p.accept("else") {
+			if s.els, err = p.parseStmt(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case p.accept("return"):
+		s := &pacReturn{line: t.line}
+		if !p.is(";") && !p.is("}") {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			s.x = x
+		}
+		p.accept(";")
+		return s, nil
+	case p.accept("var"):
+		var list []pacStmt
+		for {
+			line := p.peek().line
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			s := &pacAssign{name: name, decl: true, line: line, x: &pacLit{}}
+			if p.accept("=") {
+				if s.x, err = p.parseExpr(); err != nil {
+					return nil, err
+				}
+			}
+			list = append(list, s)
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.accept(";")
+		if len(list) == 1 {
+			return list[0], nil
+		}
+		return &pacBlock{list: list}, nil
+	case t.kind == 'i' && p.toks[p.pos+1].kind == 'p' && p.toks[p.pos+1].text == "=":
+		p.pos += 2
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.accept(";")
+		return &pacAssign{name: t.text, x: x, line: t.line}, nil
+	case t.kind == 'i' && pacUnsupportedKeywords[t.text]:
+		return nil, fmt.Errorf("pac: line %d: %q is not supported", t.line, t.text)
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	return &pacExprStmt{x: x, line: t.line}, nil
+}
+
+var pacUnsupportedKeywords = map[string]bool{
+	"for": true, "while": true, "do": true, "switch": true, "let": true, "const": true, "try": true, "new": true,
+}
+
+func (p *pacParser) parseExpr() (pacExpr, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	y, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &pacCond{cond: cond, x: x, y: y}, nil
+}
+
+// pacPrecedence は二項演算子の優先順位です（低い順）。
+var pacPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+}
+
+func (p *pacParser) parseBinary(level int) (pacExpr, error) {
+	if level == len(pacPrecedence) {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		op := ""
+		if t.kind == 'p' {
+			for _, o := range pacPrecedence[level] {
+				if t.text == o {
+					op = o
+				}
+			}
+		}
+		if op == "" {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &pacBinary{op: op, x: x, y: y, line: t.line}
+	}
+}
+
+func (p *pacParser) parseUnary() (pacExpr, error) {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &pacUnary{op: op, x: x}, nil
+		}
+	}
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is(".") {
+		p.pos++
+		line := p.peek().line
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		m := &pacMethod{recv: x, name: name, line: line}
+		if p.is("(") {
+			m.call = true
+			if m.args, err = p.parseArgs(); err != nil {
+				return nil, err
+			}
+			if _, ok := pacStringMethods[name]; !ok {
+				return nil, fmt.Errorf("pac: line %d: unsupported method %s", line, name)
+			}
+		} else if name != "length" {
+			return nil, fmt.Errorf("pac: line %d: unsupported property %s", line, name)
+		}
+		x = m
+	}
+	return x, nil
+}
+
+func (p *pacParser) parseArgs() ([]pacExpr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []pacExpr
+	for !p.accept(")") {
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return args, nil
+}
+
+func (p *pacParser) parsePrimary() (pacExpr, error) {
+	t := p.peek()
+	switch t.kind {
+	case 's':
+		p.pos++
+		return &pacLit{v: t.text}, nil
+	case 'n':
+		p.pos++
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pac: line %d: invalid number %q", t.line, t.text)
+		}
+		return &pacLit{v: f}, nil
+	case 'i':
+		p.pos++
+		switch t.text {
+		case "true":
+			return &pacLit{v: true}, nil
+		case "false":
+			return &pacLit{v: false}, nil
+		case "null", "undefined":
+			return &pacLit{}, nil
+		}
+		if !p.is("(") {
+			return &pacIdent{name: t.text, line: t.line}, nil
+		}
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		c := &pacCall{name: t.text, args: args, line: t.line}
+		p.calls = append(p.calls, c)
+		return c, nil
+	case 'p':
+		if t.text == "(" {
+			p.pos++
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, p.errorf("unexpected token")
+}
+
+// 評価
+
+// pacValue は string・float64・bool・nil（null / undefined）のいずれかです。
+type pacValue any
+
+type pacEnv struct {
+	pac     *PAC
+	globals map[string]pacValue
+}
+
+// maxPACDepth は補助関数の再帰呼び出しの上限です。
+const maxPACDepth = 64
+
+// call は関数を呼び出し、戻り値とそれを返した return の行番号を返します。
+func (e *pacEnv) call(f *pacFunc, args []pacValue, depth int) (pacValue, int, error) {
+	if depth > maxPACDepth {
+		return nil, 0, fmt.Errorf("pac: line %d: too much recursion in %s", f.line, f.name)
+	}
+	locals := map[string]pacValue{}
+	for i, name := range f.params {
+		if i < len(args) {
+			locals[name] = args[i]
+		} else {
+			locals[name] = nil
+		}
+	}
+	for _, s := range f.body {
+		ret, err := e.execDepth(s, locals, depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ret != nil {
+			return ret.v, ret.line, nil
+		}
+	}
+	if f.name == "FindProxyForURL" {
+		return nil, 0, fmt.Errorf("pac: FindProxyForURL returned no value")
+	}
+	return nil, 0, nil
+}
+
+type pacResult struct {
+	v    pacValue
+	line int
+}
+
+func (e *pacEnv) exec(s pacStmt, locals map[string]pacValue) (*pacResult, error) {
+	return e.execDepth(s, locals, 0)
+}
+
+// execDepth は文を実行し、return に達したらその値を返します。
+func (e *pacEnv) execDepth(s pacStmt, locals map[string]pacValue, depth int) (*pacResult, error) {
+	switch s := s.(type) {
+	case *pacBlock:
+		for _, inner := range s.list {
+			ret, err := e.execDepth(inner, locals, depth)
+			if err != nil || ret != nil {
+				return ret, err
+			}
+		}
+	case *pacIf:
+		cond, err := e.eval(s.cond, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		if pacTruthy(cond) {
+			return e.execDepth(s.then, locals, depth)
+		}
+		if s.els != nil {
+			return e.execDepth(s.els, locals, depth)
+		}
+	case *pacReturn:
+		var v pacValue
+		if s.x != nil {
+			var err error
+			if v, err = e.eval(s.x, locals, depth); err != nil {
+				return nil, err
+			}
+		}
+		return &pacResult{v: v, line: s.line}, nil
+	case *pacAssign:
+		v, err := e.eval(s.x, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := locals[s.name]; ok || s.decl {
+			locals[s.name] = v
+		} else if _, ok := e.globals[s.name]; ok {
+			e.globals[s.name] = v
+		} else {
+			locals[s.name] = v
+		}
+	case *pacExprStmt:
+		if _, err := e.eval(s.x, locals, depth); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (e *pacEnv) eval(x pacExpr, locals map[string]pacValue, depth int) (pacValue, error) {
+	switch x := x.(type) {
+	case *pacLit:
+		return x.v, nil
+	case *pacIdent:
+		if v, ok := locals[x.name]; ok {
+			return v, nil
+		}
+		if v, ok := e.globals[x.name]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("pac: line %d: %s is not defined", x.line, x.name)
+	case *pacCond:
+		cond, err := e.eval(x.cond, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		if pacTruthy(cond) {
+			return e.eval(x.x, locals, depth)
+		}
+		return e.eval(x.y, locals, depth)
+	case *pacUnary:
+		v, err := e.eval(x.x, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		if x.op == "!" {
+			return !pacTruthy(v), nil
+		}
+		return -pacNumber(v), nil
+	case *pacBinary:
+		return e.evalBinary(x, locals, depth)
+	case *pacCall:
+		args, err := e.evalArgs(x.args, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := e.pac.funcs[x.name]; ok {
+			v, _, err := e.call(f, args, depth+1)
+			return v, err
+		}
+		v, err := pacBuiltins[x.name](e.pac, args)
+		if err != nil {
+			return nil, fmt.Errorf("pac: line %d: %s: %w", x.line, x.name, err)
+		}
+		return v, nil
+	case *pacMethod:
+		recv, err := e.eval(x.recv, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		s := pacString(recv)
+		if !x.call {
+			return float64(len([]rune(s))), nil
+		}
+		args, err := e.evalArgs(x.args, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		return pacStringMethods[x.name](s, args), nil
+	}
+	return nil, fmt.Errorf("pac: unknown expression %T", x)
+}
+
+func (e *pacEnv) evalArgs(exprs []pacExpr, locals map[string]pacValue, depth int) ([]pacValue, error) {
+	args := make([]pacValue, len(exprs))
+	for i, a := range exprs {
+		v, err := e.eval(a, locals, depth)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func (e *pacEnv) evalBinary(x *pacBinary, locals map[string]pacValue, depth int) (pacValue, error) {
+	l, err := e.eval(x.x, locals, depth)
+	if err != nil {
+		return nil, err
+	}
+	// && と || は JavaScript と同じく短絡評価し、オペランドの値をそのまま返す
+	switch x.op {
+	case "&&":
+		if !pacTruthy(l) {
+			return l, nil
+		}
+		return e.eval(x.y, locals, depth)
+	case "||":
+		if pacTruthy(l) {
+			return l, nil
+		}
+		return e.eval(x.y, locals, depth)
+	}
+	r, err := e.eval(x.y, locals, depth)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "+":
+		_, ls := l.(string)
+		_, rs := r.(string)
+		if ls || rs {
+			return pacString(l) + pacString(r), nil
+		}
+		return pacNumber(l) + pacNumber(r), nil
+	case "-":
+		return pacNumber(l) - pacNumber(r), nil
+	case "==", "===":
+		return pacEqual(l, r, x.op == "==="), nil
+	case "!=", "!==":
+		return !pacEqual(l, r, x.op == "!=="), nil
+	}
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		switch x.op {
+		case "<":
+			return ls < rs, nil
+		case ">":
+			return ls > rs, nil
+		case "<=":
+			return ls <= rs, nil
+		default:
+			return ls >= rs, nil
+		}
+	}
+	ln, rn := pacNumber(l), pacNumber(r)
+	switch x.op {
+	case "<":
+		return ln < rn, nil
+	case ">":
+		return ln > rn, nil
+	case "<=":
+		return ln <= rn, nil
+	default:
+		return ln >= rn, nil
+	}
+}
+
+func pacTruthy(v pacValue) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+func pacString(v pacValue) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return "null"
+}
+
+func pacNumber(v pacValue) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+func pacEqual(l, r pacValue, strict bool) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+	if fmt.Sprintf("%T", l) == fmt.Sprintf("%T", r) {
+		return l == r
+	}
+	if strict {
+		return false
+	}
+	return pacNumber(l) == pacNumber(r)
+}
+
+var pacStringMethods = map[string]func(s string, args []pacValue) pacValue{
+	"toLowerCase": func(s string, _ []pacValue) pacValue { return strings.ToLower(s) },
+	"toUpperCase": func(s string, _ []pacValue) pacValue { return strings.ToUpper(s) },
+	"indexOf": func(s string, args []pacValue) pacValue {
+		if len(args) == 0 {
+			return float64(-1)
+		}
+		i := strings.Index(s, pacString(args[0]))
+		if i < 0 {
+			return float64(-1)
+		}
+		return float64(len([]rune(s[:i])))
+	},
+	"substring": func(s string, args []pacValue) pacValue {
+		rs := []rune(s)
+		clamp := func(v pacValue) int {
+			return min(max(int(pacNumber(v)), 0), len(rs))
+		}
+		start, end := 0, len(rs)
+		if len(args) > 0 {
+			start = clamp(args[0])
+		}
+		if len(args) > 1 && args[1] != nil {
+			end = clamp(args[1])
+		}
+		if start > end {
+			start, end = end, start
+		}
+		return string(rs[start:end])
+	},
+	"startsWith": func(s string, args []pacValue) pacValue {
+		return len(args) > 0 && strings.HasPrefix(s, pacString(args[0]))
+	},
+	"endsWith": func(s string, args []pacValue) pacValue {
+		return len(args) > 0 && strings.HasSuffix(s, pacString(args[0]))
+	},
+}
@@ -0,0 +1,187 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// pacBuiltins は PAC から呼べる関数です（名前は Netscape の PAC の仕様のとおり）。
+var pacBuiltins = map[string]func(p *PAC, args []pacValue) (pacValue, error){
+	"isPlainHostName": func(_ *PAC, args []pacValue) (pacValue, error) {
+		return !strings.Contains(pacArg(args, 0), "."), nil
+	},
+	"dnsDomainIs": func(_ *PAC, args []pacValue) (pacValue, error) {
+		return strings.HasSuffix(strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))), nil
+	},
+	"localHostOrDomainIs": func(_ *PAC, args []pacValue) (pacValue, error) {
+		host, hostdom := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+		return host == hostdom || (!strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+".")), nil
+	},
+	"isResolvable": func(p *PAC, args []pacValue) (pacValue, error) {
+		return p.resolve(pacArg(args, 0)) != nil, nil
+	},
+	"dnsResolve": func(p *PAC, args []pacValue) (pacValue, error) {
+		if ip := p.resolve(pacArg(args, 0)); ip != nil {
+			return ip.String(), nil
+		}
+		return nil, nil
+	},
+	"isInNet": func(p *PAC, args []pacValue) (pacValue, error) {
+		pattern, mask := net.ParseIP(pacArg(args, 1)).To4(), net.ParseIP(pacArg(args, 2)).To4()
+		if pattern == nil || mask == nil {
+			return nil, errors.New("pattern and mask must be IPv4 addresses")
+		}
+		ip := p.resolve(pacArg(args, 0))
+		if ip == nil {
+			return false, nil
+		}
+		m := net.IPMask(mask)
+		return ip.Mask(m).Equal(pattern.Mask(m)), nil
+	},
+	"myIpAddress": func(_ *PAC, _ []pacValue) (pacValue, error) {
+		// UDP は connect してもパケットを送らないので、外向きに使われるアドレスだけがわかる
+		conn, err := net.Dial("udp", "192.0.2.1:80")
+		if err != nil {
+			return "127.0.0.1", nil
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+	},
+	"dnsDomainLevels": func(_ *PAC, args []pacValue) (pacValue, error) {
+		return float64(strings.Count(pacArg(args, 0), ".")), nil
+	},
+	"shExpMatch": func(_ *PAC, args []pacValue) (pacValue, error) {
+		return shExpMatch(pacArg(args, 0), pacArg(args, 1)), nil
+	},
+	"convert_addr": func(_ *PAC, args []pacValue) (pacValue, error) {
+		ip := net.ParseIP(pacArg(args, 0)).To4()
+		if ip == nil {
+			return float64(0), nil
+		}
+		return float64(uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])), nil
+	},
+	"weekdayRange": func(p *PAC, args []pacValue) (pacValue, error) {
+		now, args := p.clock(args)
+		days := []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+		index := func(v pacValue) int {
+			for i, d := range days {
+				if strings.EqualFold(pacString(v), d) {
+					return i
+				}
+			}
+			return -1
+		}
+		if len(args) == 0 || len(args) > 2 {
+			return nil, errors.New("expected 1 or 2 weekdays")
+		}
+		from, to := index(args[0]), index(args[len(args)-1])
+		if from < 0 || to < 0 {
+			return nil, errors.New("weekday must be SUN..SAT")
+		}
+		return inRange(int(now.Weekday()), from, to), nil
+	},
+	"timeRange": func(p *PAC, args []pacValue) (pacValue, error) {
+		now, args := p.clock(args)
+		n := make([]int, len(args))
+		for i, a := range args {
+			n[i] = int(pacNumber(a))
+		}
+		switch len(n) {
+		case 1:
+			return now.Hour() == n[0], nil
+		case 2:
+			// 終わりの時刻は含まない（timeRange(9, 17) は 9:00〜16:59）
+			return inRange(now.Hour(), n[0], n[1]-1), nil
+		case 4:
+			minutes := now.Hour()*60 + now.Minute()
+			return inRange(minutes, n[0]*60+n[1], n[2]*60+n[3]-1), nil
+		}
+		return nil, errors.New("expected (hour), (hour1, hour2) or (hour1, min1, hour2, min2)")
+	},
+	"alert": func(p *PAC, args []pacValue) (pacValue, error) {
+		if p.Logf != nil {
+			p.Logf("pac: alert: %s", pacArg(args, 0))
+		}
+		return nil, nil
+	},
+}
+
+func pacArg(args []pacValue, i int) string {
+	if i < len(args) {
+		return pacString(args[i])
+	}
+	return ""
+}
+
+// clock は現在時刻を返します。最後の引数が "GMT" なら UTC にし、引数から取り除きます。
+func (p *PAC) clock(args []pacValue) (time.Time, []pacValue) {
+	now := time.Now()
+	if p.now != nil {
+		now = p.now()
+	}
+	if len(args) > 0 && strings.EqualFold(pacString(args[len(args)-1]), "GMT") {
+		return now.UTC(), args[:len(args)-1]
+	}
+	return now, args
+}
+
+// inRange は from から to まで（to を含む）に v があるかどうかです。from > to なら一周して戻る範囲とみなします。
+func inRange(v, from, to int) bool {
+	if from <= to {
+		return from <= v && v <= to
+	}
+	return v >= from || v <= to
+}
+
+// resolve は host の IPv4 アドレスを返します（IP アドレスならそのまま。解決できなければ nil）。
+func (p *PAC) resolve(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	lookup := p.LookupHost
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if ip := net.ParseIP(a).To4(); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+// shExpMatch は shell 形式のパターン（* は任意の文字列、? は任意の 1 文字）に s 全体が一致するかどうかです。
+// path.Match と違い、* は "/" にも一致します。
+func shExpMatch(s, pattern string) bool {
+	sr, pr := []rune(s), []rune(pattern)
+	// star は直前の * の位置、mark はそのときの s の位置（一致しなければ * の範囲を 1 文字ずつ伸ばして戻る）
+	si, pi, star, mark := 0, 0, -1, 0
+	for si < len(sr) {
+		switch {
+		case pi < len(pr) && (pr[pi] == '?' || pr[pi] == sr[si]):
+			si++
+			pi++
+		case pi < len(pr) && pr[pi] == '*':
+			star, mark = pi, si
+			pi++
+		case star >= 0:
+			mark++
+			si, pi = mark, star+1
+		default:
+			return false
+		}
+	}
+	for pi < len(pr) && pr[pi] == '*' {
+		pi++
+	}
+	return pi == len(pr)
+}
@@ -0,0 +1,302 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Protocols は HTTP 以外のスキームの RoundTripper です（キーはスキーム名）。
+// Install で http.Transport に登録すると、同じ http.Client で file: や data: の URL も取得できます。
+type Protocols map[string]http.RoundTripper
+
+// Install は p のスキームを t に登録します。http と https、登録済みのスキームは登録できません（panic します）。
+func (p Protocols) Install(t *http.Transport) {
+	for scheme, rt := range p {
+		t.RegisterProtocol(scheme, rt)
+	}
+}
+
+// FSTransport は fs.FS のファイルを返す RoundTripper です。file: には NewFileTransport、
+// embed.FS には FSTransport{FS: fixtures} を使います（例: embed:///fixtures/hello.txt）。
+//
+// http.ServeContent で応答するため、Range（206・416）、If-Modified-Since と If-None-Match（304）、
+// If-Range を HTTP のサーバーと同じように扱います。ファイルがなければ 404、読めなければ 403、
+// GET と HEAD 以外は 405 を返します。ディレクトリは http.FileServer と同じ形の一覧を返します。
+type FSTransport struct {
+	FS fs.FS
+}
+
+// NewFileTransport は root 以下のファイルを file: の URL で返す RoundTripper を返します。
+// URL のホストが localhost 以外なら、パスの先頭として扱います（file://./main.go は root/main.go）。
+func NewFileTransport(root string) *FSTransport {
+	return &FSTransport{FS: os.DirFS(root)}
+}
+
+func (t *FSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return serveResponse(req, http.HandlerFunc(t.serve))
+}
+
+func (t *FSTransport) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := fsName(r.URL)
+	f, err := t.FS.Open(name)
+	if err != nil {
+		fsError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fsError(w, err)
+		return
+	}
+	if info.IsDir() {
+		t.serveDir(w, r, name)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			fsError(w, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	if info.ModTime().IsZero() {
+		// embed.FS は更新時刻を持たないので、If-None-Match で比べられるよう内容のハッシュを ETag にする
+		h := sha256.New()
+		if _, err := io.Copy(h, content); err != nil {
+			fsError(w, err)
+			return
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			fsError(w, err)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, h.Sum(nil)[:16]))
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+func (t *FSTransport) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(t.FS, name)
+	if err != nil {
+		fsError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintln(w, "<!doctype html>\n<pre>")
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() {
+			n += "/"
+		}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", (&url.URL{Path: n}).EscapedPath(), html.EscapeString(n))
+	}
+	fmt.Fprintln(w, "</pre>")
+}
+
+// fsName は URL を fs.FS のパスにします（"/../" などで FS の外には出られません）。
+func fsName(u *url.URL) string {
+	host := u.Host
+	if host == "localhost" {
+		host = ""
+	}
+	name := strings.TrimPrefix(path.Clean("/"+host+"/"+u.Path), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// fsError はファイルを開けなかった理由を HTTP のステータスで返します。
+func fsError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		status = http.StatusForbidden
+	case errors.Is(err, fs.ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// DataTransport は data: の URL（RFC 2397）の中身を返す RoundTripper です。
+// Content-Type は URL のメディアタイプ（省略時は text/plain; charset=US-ASCII）で、Range にも応答します。
+// 形式が正しくない URL はブラウザと同じくネットワークエラー（err）として扱います。
+type DataTransport struct{}
+
+func (DataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mediaType, data, err := ParseDataURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	return serveResponse(req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", mediaType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+// ParseDataURL は data:[<mediatype>][;base64],<data> を読み、メディアタイプと中身を返します。
+func ParseDataURL(u *url.URL) (mediaType string, data []byte, err error) {
+	if u.Scheme != "data" {
+		return "", nil, fmt.Errorf("httpclient: %q is not a data URL", u.Redacted())
+	}
+	// data:text/plain,... は Opaque に、まれな data:/... の形は Path に入る
+	raw := u.Opaque
+	if raw == "" {
+		raw = u.EscapedPath()
+		if u.RawQuery != "" {
+			raw += "?" + u.RawQuery
+		}
+	} else if u.RawQuery != "" {
+		raw += "?" + u.RawQuery
+	}
+	meta, body, ok := strings.Cut(raw, ",")
+	if !ok {
+		return "", nil, errors.New("httpclient: data URL has no comma")
+	}
+	meta = strings.TrimSpace(meta)
+	isBase64 := false
+	if i := strings.LastIndex(meta, ";"); i >= 0 && strings.EqualFold(strings.TrimSpace(meta[i+1:]), "base64") {
+		isBase64 = true
+		meta = meta[:i]
+	}
+	if unescaped, err := url.PathUnescape(meta); err == nil {
+		meta = unescaped
+	}
+	if strings.HasPrefix(meta, ";") {
+		meta = "text/plain" + meta
+	}
+	mediaType = "text/plain; charset=US-ASCII"
+	if meta != "" {
+		// 解釈できないメディアタイプは既定のものにする（WHATWG の data: URL processor と同じ）
+		if mt, params, err := mime.ParseMediaType(meta); err == nil {
+			mediaType = mime.FormatMediaType(mt, params)
+		}
+	}
+
+	decoded := percentDecode(body)
+	if !isBase64 {
+		return mediaType, decoded, nil
+	}
+	// base64 は空白を無視し、末尾の = の省略も受け付ける
+	s := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			return -1
+		}
+		return r
+	}, string(decoded))
+	data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return "", nil, fmt.Errorf("httpclient: data URL: %w", err)
+	}
+	return mediaType, data, nil
+}
+
+// percentDecode は %XX をバイトに戻します。url.PathUnescape と違い、不正な % はそのまま残します。
+func percentDecode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, s[i])
+	}
+	return out
+}
+
+// serveResponse は h が req に書いた応答を *http.Response として返します。
+// ボディはパイプでつなぐため、大きなファイルでもメモリに溜めずに読めます。
+func serveResponse(req *http.Request, h http.Handler) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{req: req, header: http.Header{}, pw: pw, pr: pr, respc: make(chan *http.Response, 1)}
+	go func() {
+		defer pw.Close()
+		h.ServeHTTP(w, req)
+		w.WriteHeader(http.StatusOK)
+	}()
+	return <-w.respc, nil
+}
+
+// pipeResponseWriter は http.ResponseWriter への書き込みを *http.Response に変換します。
+type pipeResponseWriter struct {
+	req    *http.Request
+	header http.Header
+	pw     *io.PipeWriter
+	pr     *io.PipeReader
+	respc  chan *http.Response
+	sent   bool
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(code int) {
+	if w.sent {
+		return
+	}
+	w.sent = true
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header.Clone(),
+		Body:          w.pr,
+		ContentLength: -1,
+		Request:       w.req,
+	}
+	if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = n
+	}
+	if code == http.StatusNotModified || code == http.StatusNoContent {
+		resp.ContentLength = 0
+	}
+	if w.req.Method == http.MethodHead || resp.ContentLength == 0 {
+		resp.Body = http.NoBody
+		w.pr.Close()
+	}
+	w.respc <- resp
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.req.Method == http.MethodHead {
+		return len(p), nil
+	}
+	return w.pw.Write(p)
+}
@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestFSTransport は Range・If-Modified-Since・If-None-Match とエラーのステータスを確認します。
+func TestFSTransport(t *testing.T) {
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	transport := &http.Transport{}
+	Protocols{
+		"file":  &FSTransport{FS: fstest.MapFS{"dir/a.txt": {Data: []byte("0123456789"), ModTime: modTime}}},
+		"embed": &FSTransport{FS: fstest.MapFS{"b.json": {Data: []byte(`{"b":1}`)}}},
+	}.Install(transport)
+	client := &http.Client{Transport: transport}
+
+	get := func(method, target string, header ...string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("GET", "file:///dir/a.txt")
+	if resp.StatusCode != 200 || body != "0123456789" || resp.Header.Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+		t.Errorf("GET: %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	resp, body = get("GET", "file://localhost/dir/../dir/a.txt", "Range", "bytes=2-4")
+	if resp.StatusCode != 206 || body != "234" || resp.Header.Get("Content-Range") != "bytes 2-4/10" {
+		t.Errorf("Range: %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	resp, _ = get("GET", "file:///dir/a.txt", "Range", "bytes=20-")
+	if resp.StatusCode != 416 {
+		t.Errorf("unsatisfiable Range: %d", resp.StatusCode)
+	}
+	resp, body = get("GET", "file:///dir/a.txt", "If-Modified-Since", modTime.Add(time.Hour).Format(http.TimeFormat))
+	if resp.StatusCode != 304 || body != "" || resp.ContentLength != 0 {
+		t.Errorf("If-Modified-Since: %d %q", resp.StatusCode, body)
+	}
+	resp, _ = get("HEAD", "file:///dir/a.txt")
+	if resp.StatusCode != 200 || resp.ContentLength != 10 {
+		t.Errorf("HEAD: %d %d", resp.StatusCode, resp.ContentLength)
+	}
+	if resp, _ = get("GET", "file:///../../etc/passwd"); resp.StatusCode != 404 {
+		t.Errorf("outside of FS: %d", resp.StatusCode)
+	}
+	if resp, _ = get("PUT", "file:///dir/a.txt"); resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Errorf("PUT: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp, body = get("GET", "embed:///b.json")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != 200 || body != `{"b":1}` || etag == "" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("embed: %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	if resp, _ = get("GET", "embed:///b.json", "If-None-Match", etag); resp.StatusCode != 304 {
+		t.Errorf("If-None-Match: %d", resp.StatusCode)
+	}
+}
+
+// TestParseDataURL は RFC 2397 の例と、省略・エンコードの扱いを確認します。
+func TestParseDataURL(t *testing.T) {
+	tests := []struct {
+		url, mediaType, data string
+	}{
+		{"data:,A%20brief%20note", "text/plain; charset=US-ASCII", "A brief note"},
+		{"data:text/plain;charset=iso-8859-7,%be%fg%be", "text/plain; charset=iso-8859-7", "\xbe%fg\xbe"},
+		{"data:;charset=utf-8,%E3%81%82", "text/plain; charset=utf-8", "あ"},
+		{"data:image/gif;base64,R0lG ODlh", "image/gif", "GIF89a"},
+		{"data:text/plain;BASE64,SGk", "text/plain", "Hi"},
+		{"data:not a type,x", "text/plain; charset=US-ASCII", "x"},
+	}
+	for _, tt := range tests {
+		mediaType, data, err := ParseDataURL(mustURL(t, tt.url))
+		if err != nil || mediaType != tt.mediaType || string(data) != tt.data {
+			t.Errorf("%s: got %q %q %v, want %q %q", tt.url, mediaType, data, err, tt.mediaType, tt.data)
+		}
+	}
+	for _, bad := range []string{"data:text/plain", "data:;base64,@@@"} {
+		if _, _, err := ParseDataURL(mustURL(t, bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ProxyDecision はあるリクエストにどのプロキシを使うかの判定結果です。
+type ProxyDecision struct {
+	// URL は使うプロキシです。nil なら直接接続します。
+	URL *url.URL
+	// Rule は判定の決め手になった規則です（例: `NO_PROXY "10.0.0.0/8"`、`PAC 12 行目 "PROXY proxy:8080; DIRECT"`）。
+	Rule string
+}
+
+func (d ProxyDecision) String() string {
+	if d.URL == nil {
+		return "DIRECT（" + d.Rule + "）"
+	}
+	return d.URL.Redacted() + "（" + d.Rule + "）"
+}
+
+// ProxyConfig はリクエストごとにプロキシを選ぶ設定です。ProxyFunc を http.Transport.Proxy に設定して使います。
+// NoProxy に一致すれば直接接続し、PAC があればその結果を使い、どちらでもなければスキームごとのプロキシを使います。
+type ProxyConfig struct {
+	// HTTPProxy と HTTPSProxy は http:// と https:// のリクエストに使うプロキシです（nil なら直接接続）。
+	HTTPProxy  *url.URL
+	HTTPSProxy *url.URL
+	// NoProxy に一致するホストには、PAC やプロキシの設定にかかわらず直接接続します。
+	NoProxy NoProxy
+	// PAC を設定すると、NoProxy に一致しないリクエストは FindProxyForURL の結果に従います。
+	PAC *PAC
+	// OnDecision を設定すると、判定のたびに結果を受け取れます（-v の表示やデバッグ用）。
+	OnDecision func(req *http.Request, d ProxyDecision)
+}
+
+// ProxyFromEnvironment は HTTP_PROXY・HTTPS_PROXY・NO_PROXY（小文字も可）から ProxyConfig を作ります。
+// net/http の既定と同じく、localhost とループバックアドレスにはプロキシを使いません。
+func ProxyFromEnvironment() (*ProxyConfig, error) {
+	cfg := &ProxyConfig{}
+	var err error
+	if cfg.HTTPProxy, err = parseProxyEnv("HTTP_PROXY"); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPSProxy, err = parseProxyEnv("HTTPS_PROXY"); err != nil {
+		return nil, err
+	}
+	noProxy := getEnvAny("NO_PROXY")
+	if cfg.NoProxy, err = ParseNoProxy("localhost,127.0.0.0/8,::1," + noProxy); err != nil {
+		return nil, fmt.Errorf("httpclient: NO_PROXY: %w", err)
+	}
+	return cfg, nil
+}
+
+func getEnvAny(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+func parseProxyEnv(name string) (*url.URL, error) {
+	v := getEnvAny(name)
+	if v == "" {
+		return nil, nil
+	}
+	u, err := parseProxyURL(v)
+	if err != nil {
+		return nil, fmt.Errorf("httpclient: %s: %w", name, err)
+	}
+	return u, nil
+}
+
+// parseProxyURL はプロキシの URL を読みます。環境変数でよく使われる "host:port" だけの形は http:// とみなします。
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		if u2, err2 := url.Parse("http://" + s); err2 == nil && u2.Host != "" {
+			return u2, nil
+		}
+		if err == nil {
+			err = errors.New("proxy must be an absolute URL like http://host:port")
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// Decide は u へのリクエストに使うプロキシを判定します。PAC の評価に失敗した場合はエラーを返します。
+func (c *ProxyConfig) Decide(u *url.URL) (ProxyDecision, error) {
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = defaultPort(u.Scheme)
+	}
+	if rule, ok := c.NoProxy.Match(host, port); ok {
+		return ProxyDecision{Rule: fmt.Sprintf("NO_PROXY %q", rule)}, nil
+	}
+	if c.PAC != nil {
+		result, line, err := c.PAC.FindProxyForURL(u)
+		if err != nil {
+			return ProxyDecision{}, err
+		}
+		proxyURL, err := ParsePACResult(result)
+		if err != nil {
+			return ProxyDecision{}, fmt.Errorf("pac: line %d: %w", line, err)
+		}
+		return ProxyDecision{URL: proxyURL, Rule: fmt.Sprintf("PAC %d 行目 %q", line, result)}, nil
+	}
+	switch {
+	case u.Scheme == "https" && c.HTTPSProxy != nil:
+		return ProxyDecision{URL: c.HTTPSProxy, Rule: "https のプロキシ"}, nil
+	case u.Scheme == "http" && c.HTTPProxy != nil:
+		return ProxyDecision{URL: c.HTTPProxy, Rule: "http のプロキシ"}, nil
+	}
+	return ProxyDecision{Rule: "プロキシの設定なし"}, nil
+}
+
+// ProxyFunc は http.Transport.Proxy に設定する関数を返します。
+func (c *ProxyConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		d, err := c.Decide(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		if c.OnDecision != nil {
+			c.OnDecision(req, d)
+		}
+		return d.URL, nil
+	}
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+	return ""
+}
+
+// ParsePACResult は FindProxyForURL の戻り値（"PROXY a:8080; SOCKS5 b:1080; DIRECT"）から使うプロキシを選びます。
+// http.Transport は 1 つのプロキシしか扱えないため、使える最初の項目を返します（DIRECT なら nil）。
+func ParsePACResult(result string) (*url.URL, error) {
+	for _, item := range strings.Split(result, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			return nil, nil
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid proxy %q", strings.TrimSpace(item))
+		}
+		var scheme string
+		switch kind {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			// SOCKS4 などは http.Transport が扱えないので次の候補へ
+			continue
+		}
+		return &url.URL{Scheme: scheme, Host: fields[1]}, nil
+	}
+	return nil, fmt.Errorf("no usable proxy in %q", result)
+}
+
+// NoProxy は NO_PROXY 形式（カンマ区切り）のバイパス規則です。
+//
+//   - "*" はすべてのホストに一致します。
+//   - "10.0.0.0/8" や "fd00::/8" は CIDR の範囲の IP アドレスに一致します（ホスト名は解決しません）。
+//   - "192.168.1.10" や "[::1]" はその IP アドレスに一致します。
+//   - "example.com" はそのドメインとサブドメインに、".example.com" と "*.example.com" はサブドメインだけに一致します。
+//   - "example.com:8080" のようにポートを付けると、そのポートへのリクエストだけに一致します。
+type NoProxy []noProxyRule
+
+type noProxyRule struct {
+	text    string
+	any     bool
+	cidr    *net.IPNet
+	ip      net.IP
+	domain  string
+	subOnly bool
+	port    string
+}
+
+// ParseNoProxy は NO_PROXY 形式の一覧を読みます。
+func ParseNoProxy(list string) (NoProxy, error) {
+	var rules NoProxy
+	for _, text := range strings.Split(list, ",") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		rule := noProxyRule{text: text}
+		s := strings.ToLower(text)
+		switch {
+		case s == "*":
+			rule.any = true
+		case strings.Contains(s, "/"):
+			_, cidr, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", text)
+			}
+			rule.cidr = cidr
+		default:
+			if host, port, err := net.SplitHostPort(s); err == nil {
+				s, rule.port = host, port
+			}
+			s = strings.Trim(s, "[]")
+			if ip := net.ParseIP(s); ip != nil {
+				rule.ip = ip
+				break
+			}
+			if strings.HasPrefix(s, "*.") {
+				s = s[1:]
+			}
+			if strings.HasPrefix(s, ".") {
+				rule.subOnly = true
+				s = s[1:]
+			}
+			if s == "" || strings.ContainsAny(s, "*") {
+				return nil, fmt.Errorf("invalid NO_PROXY entry %q", text)
+			}
+			rule.domain = strings.TrimSuffix(s, ".")
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Match は host（ポートを除いたホスト名か IP アドレス）と port が一致する最初の規則を返します。
+func (n NoProxy) Match(host, port string) (rule string, ok bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	ip := net.ParseIP(host)
+	for _, r := range n {
+		if r.port != "" && r.port != port {
+			continue
+		}
+		var matched bool
+		switch {
+		case r.any:
+			matched = true
+		case r.cidr != nil:
+			matched = ip != nil && r.cidr.Contains(ip)
+		case r.ip != nil:
+			matched = ip != nil && r.ip.Equal(ip)
+		case ip == nil:
+			matched = strings.HasSuffix(host, "."+r.domain) || (!r.subOnly && host == r.domain)
+		}
+		if matched {
+			return r.text, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,127 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPAC = `
+// 社内向けの例
+var corp = "PROXY proxy.corp.example:8080; DIRECT";
+
+function isInternal(host) {
+	return dnsDomainIs(host, ".corp.example") || isInNet(host, "10.0.0.0", "255.0.0.0");
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || isInternal(host))
+		return "DIRECT";
+	if (url.substring(0, 6) == "https:" && shExpMatch(host, "*.secure.example"))
+		return "HTTPS secure-proxy.example:443";
+	/* 営業時間外は SOCKS */
+	if (!timeRange(9, 18, "GMT")) {
+		return "SOCKS4 old:1080; SOCKS5 socks.example:1080";
+	}
+	return dnsDomainLevels(host) > 2 ? corp : "PROXY proxy.example:3128";
+}
+`
+
+// TestPAC は PAC の評価結果と、それを返した return の行番号を確認します。
+func TestPAC(t *testing.T) {
+	pac, err := ParsePAC(testPAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pac.LookupHost = func(_ context.Context, host string) ([]string, error) {
+		if host == "db.internal" {
+			return []string{"10.1.2.3"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	pac.now = func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		url, want string
+		line      int
+	}{
+		{"http://intranet/", "DIRECT", 12},
+		{"http://WIKI.corp.example/page", "DIRECT", 12},
+		{"http://db.internal:5432/", "DIRECT", 12},
+		{"https://api.secure.example/path?q=1", "HTTPS secure-proxy.example:443", 14},
+		{"http://api.secure.example/", "PROXY proxy.example:3128", 19},
+		{"http://a.b.example.com/", "PROXY proxy.corp.example:8080; DIRECT", 19},
+	}
+	for _, tt := range tests {
+		got, line, err := pac.FindProxyForURL(mustURL(t, tt.url))
+		if err != nil || got != tt.want || line != tt.line {
+			t.Errorf("%s: got %q (line %d), %v; want %q (line %d)", tt.url, got, line, err, tt.want, tt.line)
+		}
+	}
+
+	pac.now = func() time.Time { return time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC) }
+	cfg := &ProxyConfig{PAC: pac}
+	d, err := cfg.Decide(mustURL(t, "http://example.com/"))
+	if err != nil || d.URL == nil || d.URL.String() != "socks5://socks.example:1080" || !strings.HasPrefix(d.Rule, "PAC 17 行目") {
+		t.Errorf("Decide = %v, %v", d, err)
+	}
+
+	for _, src := range []string{
+		"function FindProxyForURL(url, host) { for (;;) {} }",
+		"function FindProxyForURL(url, host) { return dateRange(1) ? 'DIRECT' : 'DIRECT'; }",
+		"function F(url, host) { return 'DIRECT'; }",
+	} {
+		if _, err := ParsePAC(src); err == nil {
+			t.Errorf("ParsePAC(%q) succeeded", src)
+		}
+	}
+}
+
+// TestNoProxy は NO_PROXY のドメイン・CIDR・ポートの一致と、PAC より優先されることを確認します。
+func TestNoProxy(t *testing.T) {
+	noProxy, err := ParseNoProxy("example.com, .internal, *.svc.local, 10.0.0.0/8, [::1], fd00::/8, api.test:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url, rule string
+	}{
+		{"http://example.com/", "example.com"},
+		{"https://www.Example.COM/", "example.com"},
+		{"http://notexample.com/", ""},
+		{"http://internal/", ""},
+		{"http://db.internal/", ".internal"},
+		{"http://a.b.svc.local/", "*.svc.local"},
+		{"http://10.20.30.40:8080/", "10.0.0.0/8"},
+		{"http://11.0.0.1/", ""},
+		{"http://[::1]:18888/", "[::1]"},
+		{"http://[fd00::1]/", "fd00::/8"},
+		{"https://api.test:8443/", "api.test:8443"},
+		{"https://api.test/", ""},
+	}
+	pac, err := ParsePAC(`function FindProxyForURL(url, host) { return "PROXY proxy:8080"; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ProxyConfig{NoProxy: noProxy, PAC: pac}
+	for _, tt := range tests {
+		d, err := cfg.Decide(mustURL(t, tt.url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.rule == "" {
+			if d.URL == nil || d.URL.Host != "proxy:8080" {
+				t.Errorf("%s: got %v, want the PAC proxy", tt.url, d)
+			}
+		} else if d.URL != nil || !strings.Contains(d.Rule, `"`+tt.rule+`"`) {
+			t.Errorf("%s: got %v, want DIRECT by %q", tt.url, d, tt.rule)
+		}
+	}
+
+	if _, err := ParseNoProxy("10.0.0.0/33"); err == nil {
+		t.Error("invalid CIDR was accepted")
+	}
+}
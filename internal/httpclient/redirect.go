@@ -0,0 +1,232 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// リダイレクトを追うのをやめた理由です。client.Do は *url.Error に包んで返すので errors.Is で調べます。
+var (
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrCrossOrigin       = errors.New("redirect to another origin")
+	ErrBodyNotRewindable = errors.New("request body cannot be resent")
+)
+
+// credentialHeaders は別のオリジンへのリダイレクトで送らないヘッダです（net/http は別のドメインのときだけ消します）。
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// bodyHeaders はボディと一緒に送り、ボディを送らないときは消すヘッダです（net/http と同じ）。
+var bodyHeaders = []string{"Content-Type", "Content-Encoding", "Content-Language", "Content-Location"}
+
+// RedirectPolicy はリダイレクトの追い方です。CheckRedirect を http.Client.CheckRedirect に設定して使います。
+//
+// net/http の既定は 10 回まで追いかけ、301・302・303 では POST を GET に変え、
+// 別のドメインへ移るときだけ Authorization と Cookie を消します（同じホストの別のポートやスキームには送ります）。
+// RedirectPolicy はそれぞれを選べるようにし、オリジン（スキーム・ホスト・ポート）が変わったら資格情報を消します。
+//
+// 307・308 でボディを送り直すには、最初のリクエストに GetBody が必要です（http.NewRequest に
+// bytes.Reader・strings.Reader などを渡すと設定されます）。GetBody のないボディは net/http が送り直さず、
+// CheckRedirect が呼ばれないまま 307・308 のレスポンスがそのまま返ります。
+type RedirectPolicy struct {
+	// MaxHops は追いかけるリダイレクトの上限です（0 なら 10、負の値なら追わずに 3xx のレスポンスを返します）。
+	MaxHops int
+	// SameOrigin が true なら、最初のリクエストと別のオリジンへのリダイレクトを ErrCrossOrigin で止めます。
+	SameOrigin bool
+	// KeepMethod は元のメソッドとボディのまま追いかけるステータスコードです。nil なら 307 と 308 です（RFC 9110 とブラウザの動作）。
+	// curl の --post301 --post302 と同じにするには []int{301, 302, 307, 308} を指定します。
+	// それ以外のステータスコードでは、GET と HEAD 以外のメソッドを GET に変えてボディを送りません。
+	KeepMethod []int
+	// KeepCredentials が true なら、別のオリジンへのリダイレクトでも Authorization と明示した Cookie ヘッダを送ります（curl の --location-trusted）。
+	// Jar の Cookie は KeepCredentials にかかわらず、送り先のドメインのものだけが付きます。
+	KeepCredentials bool
+	// OnRedirect を設定すると、リダイレクトのたびに（止めた場合も）結果を受け取れます（-v の表示やデバッグ用）。
+	OnRedirect func(hop RedirectHop)
+}
+
+// RedirectHop はリダイレクト 1 回分の記録です。
+type RedirectHop struct {
+	// Method と URL は 3xx を返したリクエストです。
+	Method string
+	URL    *url.URL
+	// StatusCode は 3xx のステータスコードで、Location はその Location ヘッダを URL に解決したものです。
+	StatusCode int
+	Location   *url.URL
+	// NextMethod は Location へ送るメソッドで、WithBody はボディも送り直すかどうかです。
+	NextMethod string
+	WithBody   bool
+	// CrossOrigin は Location が最初のリクエストと別のオリジンかどうかです。
+	CrossOrigin bool
+	// Stripped は最初のリクエストにあったが、Location へは引き継がないヘッダです（Jar の Cookie は送り先のものが付きます）。
+	Stripped []string
+	// Err はここでリダイレクトを止めた理由です（追いかけた場合は nil）。
+	Err error
+}
+
+func (h RedirectHop) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s %s → %s %s", h.StatusCode, h.Method, h.URL.Redacted(), h.NextMethod, h.Location.Redacted())
+	if h.WithBody {
+		b.WriteString("（ボディを送り直す）")
+	}
+	if len(h.Stripped) > 0 {
+		fmt.Fprintf(&b, "（別オリジンのため %s を送らない）", strings.Join(h.Stripped, "・"))
+	}
+	if h.Err != nil {
+		fmt.Fprintf(&b, "（中止: %v）", h.Err)
+	}
+	return b.String()
+}
+
+// RedirectChain はリクエスト 1 つで追いかけたリダイレクトの記録です。WithRedirectChain で作ります。
+type RedirectChain struct {
+	Hops []RedirectHop
+}
+
+func (c *RedirectChain) String() string {
+	lines := make([]string, len(c.Hops))
+	for i, h := range c.Hops {
+		lines[i] = h.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+type redirectChainKey struct{}
+
+// WithRedirectChain は RedirectPolicy がリダイレクトを記録する先を ctx に付けます。
+// 返した context でリクエストを送ると、レスポンスを受け取った後に chain.Hops で経路を調べられます。
+//
+//	ctx, chain := httpclient.WithRedirectChain(ctx)
+//	resp, err := client.Do(req.WithContext(ctx))
+//	fmt.Println(chain)
+func WithRedirectChain(ctx context.Context) (context.Context, *RedirectChain) {
+	chain := &RedirectChain{}
+	return context.WithValue(ctx, redirectChainKey{}, chain), chain
+}
+
+// CheckRedirect は http.Client.CheckRedirect です。req は次に送るリクエストで、via はこれまでに送ったリクエストです。
+func (p RedirectPolicy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if p.MaxHops < 0 {
+		return http.ErrUseLastResponse
+	}
+	prev := via[len(via)-1]
+	hop := RedirectHop{
+		Method:     prev.Method,
+		URL:        prev.URL,
+		StatusCode: req.Response.StatusCode,
+		Location:   req.URL,
+	}
+	hop.Err = p.apply(req, via, &hop)
+	if chain, ok := req.Context().Value(redirectChainKey{}).(*RedirectChain); ok {
+		chain.Hops = append(chain.Hops, hop)
+	}
+	if p.OnRedirect != nil {
+		p.OnRedirect(hop)
+	}
+	if hop.Err != nil {
+		return fmt.Errorf("httpclient: %w", hop.Err)
+	}
+	return nil
+}
+
+// apply は req のメソッド・ボディ・ヘッダをポリシーに合わせて書き換え、hop に記録します。
+func (p RedirectPolicy) apply(req *http.Request, via []*http.Request, hop *RedirectHop) error {
+	first, prev := via[0], via[len(via)-1]
+	max := p.MaxHops
+	if max == 0 {
+		max = 10
+	}
+	hop.NextMethod = req.Method
+	if len(via) > max {
+		return fmt.Errorf("%w (%d)", ErrTooManyRedirects, max)
+	}
+
+	// 一度でも別のオリジンに移ったら、最初のオリジンに戻っても資格情報は送らない（net/http と同じ）
+	hop.CrossOrigin = !sameOrigin(first.URL, req.URL)
+	for _, r := range via[1:] {
+		hop.CrossOrigin = hop.CrossOrigin || !sameOrigin(first.URL, r.URL)
+	}
+	if hop.CrossOrigin && p.SameOrigin {
+		return fmt.Errorf("%w: %s://%s", ErrCrossOrigin, req.URL.Scheme, req.URL.Host)
+	}
+
+	keep := []int{http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
+	if p.KeepMethod != nil {
+		keep = p.KeepMethod
+	}
+	prevHasBody := prev.Body != nil && prev.Body != http.NoBody
+	switch {
+	case slices.Contains(keep, hop.StatusCode):
+		// net/http は 301・302・303 で GET に変え、一度ボディを落とすと 307・308 でも送らないので、最初のリクエストから戻す
+		req.Method = prev.Method
+		if prevHasBody && (req.Body == nil || req.Body == http.NoBody) {
+			if first.GetBody == nil {
+				return ErrBodyNotRewindable
+			}
+			body, err := first.GetBody()
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrBodyNotRewindable, err)
+			}
+			req.Body, req.GetBody, req.ContentLength = body, first.GetBody, first.ContentLength
+			for _, name := range bodyHeaders {
+				if v := first.Header.Values(name); len(v) > 0 {
+					req.Header[name] = v
+				}
+			}
+		}
+	case req.Method != http.MethodGet && req.Method != http.MethodHead:
+		// 307・308 でも KeepMethod になければ GET に変える
+		req.Method = http.MethodGet
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+		for _, name := range bodyHeaders {
+			req.Header.Del(name)
+		}
+	}
+	hop.NextMethod = req.Method
+	hop.WithBody = req.Body != nil && req.Body != http.NoBody
+
+	if !hop.CrossOrigin {
+		return nil
+	}
+	// via[0] の Cookie ヘッダには送信時に Jar の Cookie が足されているので、送り直すのは Authorization だけにする
+	auth := first.Header.Values("Authorization")
+	if p.KeepCredentials {
+		if len(auth) > 0 {
+			// net/http が別のドメインで消したものも送り直す
+			req.Header["Authorization"] = auth
+		}
+		return nil
+	}
+	for _, name := range credentialHeaders {
+		if len(first.Header.Values(name)) > 0 {
+			req.Header.Del(name)
+			hop.Stripped = append(hop.Stripped, name)
+		}
+	}
+	return nil
+}
+
+// sameOrigin は a と b のスキーム・ホスト・ポートが同じかどうかです（ポートの省略は既定のポートとみなします）。
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && originPort(a) == originPort(b)
+}
+
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
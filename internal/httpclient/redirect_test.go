@@ -0,0 +1,140 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRedirectServer は ch06/03_xmlhttprequest の /redirect（?status=&to=）と /echo と同じ動きのサーバーです（?loop で自分自身へ戻します）。
+func newRedirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		status, to := http.StatusFound, "/echo"
+		switch r.URL.Query().Get("status") {
+		case "303":
+			status = http.StatusSeeOther
+		case "307":
+			status = http.StatusTemporaryRedirect
+		case "308":
+			status = http.StatusPermanentRedirect
+		}
+		if t := r.URL.Query().Get("to"); t != "" {
+			to = t
+		}
+		if r.URL.Query().Has("loop") {
+			to = r.URL.RequestURI()
+		}
+		http.Redirect(w, r, to, status)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":        r.Method,
+			"body":          string(body),
+			"content-type":  r.Header.Get("Content-Type"),
+			"authorization": r.Header.Get("Authorization"),
+			"cookie":        r.Header.Get("Cookie"),
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestRedirectPolicy はメソッドとボディの維持、別オリジンでの資格情報の削除、上限と記録を確認します。
+func TestRedirectPolicy(t *testing.T) {
+	a, b := newRedirectServer(t), newRedirectServer(t)
+
+	do := func(p RedirectPolicy, method, target string) (map[string]string, *RedirectChain, error) {
+		t.Helper()
+		client := &http.Client{CheckRedirect: p.CheckRedirect}
+		req, err := http.NewRequest(method, target, strings.NewReader("a=1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Cookie", "session=secret")
+		req.SetBasicAuth("user", "pass")
+		ctx, chain := WithRedirectChain(req.Context())
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, chain, err
+		}
+		defer resp.Body.Close()
+		var echo map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&echo); err != nil {
+			t.Fatal(err)
+		}
+		return echo, chain, nil
+	}
+
+	tests := []struct {
+		name   string
+		policy RedirectPolicy
+		query  string
+		method string
+		body   string
+	}{
+		{"302 は GET に変える", RedirectPolicy{}, "", "GET", ""},
+		{"303 は GET に変える", RedirectPolicy{}, "status=303", "GET", ""},
+		{"307 はそのまま", RedirectPolicy{}, "status=307", "POST", "a=1"},
+		{"308 はそのまま", RedirectPolicy{}, "status=308", "POST", "a=1"},
+		{"--post302", RedirectPolicy{KeepMethod: []int{302, 307, 308}}, "", "POST", "a=1"},
+		{"307 も GET に変える", RedirectPolicy{KeepMethod: []int{}}, "status=307", "GET", ""},
+	}
+	for _, tt := range tests {
+		echo, chain, err := do(tt.policy, "POST", a.URL+"/redirect?"+tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if echo["method"] != tt.method || echo["body"] != tt.body || (tt.body != "") != (echo["content-type"] != "") {
+			t.Errorf("%s: got %v", tt.name, echo)
+		}
+		if echo["authorization"] == "" || echo["cookie"] != "session=secret" {
+			t.Errorf("%s: credentials not sent to the same origin: %v", tt.name, echo)
+		}
+		if len(chain.Hops) != 1 || chain.Hops[0].NextMethod != tt.method || chain.Hops[0].Location.Path != "/echo" {
+			t.Errorf("%s: chain %v", tt.name, chain)
+		}
+	}
+
+	// 同じホストの別のポート（別オリジン）へは、net/http の既定と違い資格情報を送らない
+	crossURL := a.URL + "/redirect?status=307&to=" + b.URL + "/echo"
+	echo, chain, err := do(RedirectPolicy{}, "POST", crossURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if echo["authorization"] != "" || echo["cookie"] != "" || echo["body"] != "a=1" {
+		t.Errorf("cross origin: %v", echo)
+	}
+	if hop := chain.Hops[0]; !hop.CrossOrigin || strings.Join(hop.Stripped, ",") != "Authorization,Cookie" {
+		t.Errorf("cross origin: hop %+v", hop)
+	}
+	if echo, _, _ := do(RedirectPolicy{KeepCredentials: true}, "GET", crossURL); echo["authorization"] == "" {
+		t.Errorf("KeepCredentials: %v", echo)
+	}
+	if _, chain, err := do(RedirectPolicy{SameOrigin: true}, "GET", crossURL); !errors.Is(err, ErrCrossOrigin) || chain.Hops[0].Err == nil {
+		t.Errorf("SameOrigin: %v %v", err, chain)
+	}
+
+	// 上限を超えたら止め、止めたリダイレクトも記録する
+	loop := a.URL + "/redirect?loop"
+	if _, chain, err := do(RedirectPolicy{MaxHops: 3}, "GET", loop); !errors.Is(err, ErrTooManyRedirects) || len(chain.Hops) != 4 {
+		t.Errorf("MaxHops: %v %d", err, len(chain.Hops))
+	}
+	client := &http.Client{CheckRedirect: RedirectPolicy{MaxHops: -1}.CheckRedirect}
+	resp, err := client.Get(loop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("MaxHops -1: %d", resp.StatusCode)
+	}
+}
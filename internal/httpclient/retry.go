@@ -0,0 +1,250 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy は失敗したリクエストの再試行の仕方です。Transport で RoundTripper を包んで使います。
+//
+// 再試行するのは接続エラー（TLS の証明書エラーと context のキャンセル・期限切れを除く）と RetryStatus のレスポンスで、
+// 待ち時間は BaseDelay から 1 回ごとに倍にした値を上限とする乱数（Full Jitter）です。
+// 429 と 503 に Retry-After があればその時間だけ待ちます（MaxDelay より長ければ再試行せずにレスポンスを返します）。
+//
+// 同じリクエストを 2 回処理されても困らないメソッド（GET・HEAD・OPTIONS・TRACE・PUT・DELETE）と、
+// Idempotency-Key ヘッダを付けた POST・PATCH だけを再試行します。ボディは GetBody で最初から送り直すので、
+// GetBody のないボディを持つリクエストは再試行しません。
+type RetryPolicy struct {
+	// MaxRetries は最初の 1 回に加えて再試行する回数の上限です（0 なら再試行しません）。
+	MaxRetries int
+	// BaseDelay は最初の再試行の待ち時間の上限です（0 なら 200ms）。
+	BaseDelay time.Duration
+	// MaxDelay は 1 回の待ち時間の上限です（0 なら 30s）。
+	MaxDelay time.Duration
+	// RetryStatus は再試行するステータスコードです（nil なら 429・502・503・504）。
+	RetryStatus []int
+	// OnRetry を設定すると、失敗した回の結果を（待つ前に）受け取れます。再試行しない場合もその理由とともに呼びます（-v の表示やデバッグ用）。
+	OnRetry func(req *http.Request, attempt RetryAttempt)
+}
+
+// RetryAttempt はリクエストを 1 回送った結果です。
+type RetryAttempt struct {
+	// Attempt は 1 から数えた回数です。
+	Attempt int
+	// StatusCode はレスポンスのステータスコードで、Err は接続エラーです（どちらか一方）。
+	StatusCode int
+	Err        error
+	// Retry はこの後に再試行したかどうかで、Delay はそのために待った時間です。
+	Retry bool
+	Delay time.Duration
+	// Reason は再試行した（またはしなかった）理由です。再試行の対象でない結果（成功や 404 など）では空です。
+	Reason string
+}
+
+func (a RetryAttempt) String() string {
+	result := strconv.Itoa(a.StatusCode)
+	if a.Err != nil {
+		result = a.Err.Error()
+	}
+	switch {
+	case a.Retry:
+		return fmt.Sprintf("%d 回目: %s → %v 後に再試行（%s）", a.Attempt, result, a.Delay.Round(time.Millisecond), a.Reason)
+	case a.Reason != "":
+		return fmt.Sprintf("%d 回目: %s → 再試行しない（%s）", a.Attempt, result, a.Reason)
+	}
+	return fmt.Sprintf("%d 回目: %s", a.Attempt, result)
+}
+
+// RetryLog はリクエスト 1 つで送った回数とそれぞれの結果の記録です。WithRetryLog で作ります。
+type RetryLog struct {
+	Attempts []RetryAttempt
+}
+
+func (l *RetryLog) String() string {
+	lines := make([]string, len(l.Attempts))
+	for i, a := range l.Attempts {
+		lines[i] = a.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+type retryLogKey struct{}
+
+// WithRetryLog は RetryPolicy の RoundTripper が結果を記録する先を ctx に付けます。
+// リダイレクトを追う場合は、たどったリクエストそれぞれの試行が順に記録されます。
+//
+//	ctx, log := httpclient.WithRetryLog(ctx)
+//	resp, err := client.Do(req.WithContext(ctx))
+//	fmt.Println(len(log.Attempts), log)
+func WithRetryLog(ctx context.Context) (context.Context, *RetryLog) {
+	log := &RetryLog{}
+	return context.WithValue(ctx, retryLogKey{}, log), log
+}
+
+// Transport は next で送り、失敗したら p に従って再試行する RoundTripper を返します。
+func (p RetryPolicy) Transport(next http.RoundTripper) http.RoundTripper {
+	return &retryTransport{policy: p, next: next, sleep: sleepContext}
+}
+
+type retryTransport struct {
+	policy RetryPolicy
+	next   http.RoundTripper
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log, _ := req.Context().Value(retryLogKey{}).(*RetryLog)
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	for n := 1; ; n++ {
+		attemptReq := req
+		if n > 1 && hasBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("httpclient: retry: %w", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		resp, err := t.next.RoundTrip(attemptReq)
+		attempt := RetryAttempt{Attempt: n, Err: err}
+		if resp != nil {
+			attempt.StatusCode = resp.StatusCode
+		}
+		attempt.Delay, attempt.Reason = t.retryDelay(req, resp, err, n)
+		attempt.Retry = attempt.Delay >= 0
+		if !attempt.Retry {
+			attempt.Delay = 0
+		}
+		if log != nil {
+			log.Attempts = append(log.Attempts, attempt)
+		}
+		if t.policy.OnRetry != nil && attempt.Reason != "" {
+			t.policy.OnRetry(req, attempt)
+		}
+		if !attempt.Retry {
+			if err != nil && n > 1 {
+				return nil, fmt.Errorf("httpclient: gave up after %d attempts: %w", n, err)
+			}
+			return resp, err
+		}
+		if resp != nil {
+			// 接続を使い回せるよう、小さなボディは読み捨ててから閉じる
+			io.CopyN(io.Discard, resp.Body, 4<<10)
+			resp.Body.Close()
+		}
+		if err := t.sleep(req.Context(), attempt.Delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay は n 回目の結果を見て、再試行までの待ち時間と理由を返します（再試行しないなら負の値）。
+func (t *retryTransport) retryDelay(req *http.Request, resp *http.Response, err error, n int) (time.Duration, string) {
+	p := t.policy
+	statuses := p.RetryStatus
+	if statuses == nil {
+		statuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	var reason string
+	switch {
+	case err != nil:
+		if req.Context().Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return -1, ""
+		}
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			return -1, "証明書の検証エラー"
+		}
+		reason = "接続エラー"
+	case slices.Contains(statuses, resp.StatusCode):
+		reason = resp.Status
+	default:
+		return -1, ""
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return -1, req.URL.Scheme + ": は再試行しない"
+	}
+	if !isIdempotent(req) {
+		return -1, req.Method + " は冪等でない（Idempotency-Key がない）"
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return -1, "ボディを送り直せない（GetBody がない）"
+	}
+	if n > p.MaxRetries {
+		return -1, fmt.Sprintf("再試行の上限（%d 回）", p.MaxRetries)
+	}
+
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if d > maxDelay {
+				return -1, fmt.Sprintf("Retry-After %v が上限 %v より長い", d, maxDelay)
+			}
+			return d, reason + "、Retry-After"
+		}
+	}
+	base := p.BaseDelay
+	if base <= 0 {
+		base = 200 * time.Millisecond
+	}
+	// Full Jitter: [0, min(maxDelay, base×2^(n-1))) の乱数。
+	// base<<shift があふれて負や 0 にならないよう、シフトする前に maxDelay と比べる
+	ceiling := maxDelay
+	if shift := n - 1; shift < 63 && base <= maxDelay>>shift {
+		ceiling = base << shift
+	}
+	return rand.N(ceiling), reason
+}
+
+// isIdempotent は req を自動で再試行してよいかどうかです（RFC 9110 の冪等なメソッドと、Idempotency-Key 付きの POST・PATCH）。
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost, http.MethodPatch:
+		return req.Header.Get("Idempotency-Key") != ""
+	}
+	return false
+}
+
+// parseRetryAfter は Retry-After（秒数か HTTP-date）を now からの待ち時間にします。
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(min(secs, int64(time.Duration(1<<62)/time.Second))) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,147 @@
+package httpclient
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetry は再試行する条件（メソッド・Idempotency-Key・GetBody）、Retry-After、記録した回数と理由を確認します。
+func TestRetry(t *testing.T) {
+	// 最初の fails 回は 503（Retry-After: 2）を返し、その後は受け取ったボディを返す
+	var calls, fails atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= fails.Load() {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	var slept []time.Duration
+	rt := RetryPolicy{MaxRetries: 3}.Transport(http.DefaultTransport).(*retryTransport)
+	rt.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	client := &http.Client{Transport: rt}
+
+	var got string
+	do := func(method string, body io.Reader, header ...string) (*http.Response, *RetryLog, error) {
+		t.Helper()
+		calls.Store(0)
+		slept = nil
+		req, err := http.NewRequest(method, srv.URL, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		ctx, log := WithRetryLog(req.Context())
+		resp, err := client.Do(req.WithContext(ctx))
+		if resp != nil {
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			got = string(b)
+		}
+		return resp, log, err
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		body     io.Reader
+		header   []string
+		fails    int32
+		status   int
+		attempts int
+	}{
+		{"GET は再試行する", "GET", nil, nil, 2, 200, 3},
+		{"PUT はボディを送り直す", "PUT", strings.NewReader("data"), nil, 1, 200, 2},
+		{"上限を超えたら最後のレスポンスを返す", "GET", nil, nil, 10, 503, 4},
+		{"POST は再試行しない", "POST", strings.NewReader("data"), nil, 1, 503, 1},
+		{"Idempotency-Key 付きの POST は再試行する", "POST", strings.NewReader("data"), []string{"Idempotency-Key", "k1"}, 1, 200, 2},
+		{"GetBody のないボディは再試行しない", "PUT", io.MultiReader(strings.NewReader("data")), nil, 1, 503, 1},
+	}
+	for _, tt := range tests {
+		fails.Store(tt.fails)
+		resp, log, err := do(tt.method, tt.body, tt.header...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.StatusCode != tt.status || len(log.Attempts) != tt.attempts || int(calls.Load()) != tt.attempts {
+			t.Errorf("%s: status %d, %d attempts, %d calls\n%v", tt.name, resp.StatusCode, len(log.Attempts), calls.Load(), log)
+		}
+		if tt.status == 200 && tt.body != nil && got != "data" {
+			t.Errorf("%s: body %q", tt.name, got)
+		}
+		for i, d := range slept {
+			if d != 2*time.Second || !log.Attempts[i].Retry || log.Attempts[i].Delay != d {
+				t.Errorf("%s: slept %v\n%v", tt.name, slept, log)
+			}
+		}
+		if last := log.Attempts[len(log.Attempts)-1]; last.Retry || (tt.status != 200) != (last.Reason != "") {
+			t.Errorf("%s: last attempt %+v", tt.name, last)
+		}
+	}
+
+	// 接続エラーは指数バックオフで再試行し、最後のエラーを返す
+	srv.Close()
+	_, log, err := do("GET", nil)
+	if err == nil || len(log.Attempts) != 4 || log.Attempts[0].Err == nil {
+		t.Fatalf("connection error: %v\n%v", err, log)
+	}
+	for i, d := range slept {
+		if ceiling := 200 * time.Millisecond << i; d < 0 || d >= ceiling {
+			t.Errorf("backoff %d: %v (ceiling %v)", i+1, d, ceiling)
+		}
+	}
+}
+
+// TestRetryDelayOverflow は回数が増えて base×2^(n-1) があふれても、待ち時間が [0, MaxDelay) に収まることを確認します。
+func TestRetryDelayOverflow(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	resp := &http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway", Header: http.Header{}}
+	for _, p := range []RetryPolicy{
+		{MaxRetries: 100, BaseDelay: 1 << 33},
+		{MaxRetries: 100, BaseDelay: time.Millisecond, MaxDelay: time.Duration(1<<63 - 1)},
+	} {
+		rt := &retryTransport{policy: p}
+		maxDelay := cmp.Or(p.MaxDelay, 30*time.Second)
+		for n := 1; n <= p.MaxRetries; n++ {
+			if d, reason := rt.retryDelay(req, resp, nil, n); d < 0 || d >= maxDelay {
+				t.Fatalf("BaseDelay %v, attempt %d: %v (%s)", p.BaseDelay, n, d, reason)
+			}
+		}
+	}
+}
+
+// TestParseRetryAfter は秒数と HTTP-date の Retry-After を確認します。
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		v  string
+		d  time.Duration
+		ok bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		if d, ok := parseRetryAfter(tt.v, now); d != tt.d || ok != tt.ok {
+			t.Errorf("%q: got %v %v, want %v %v", tt.v, d, ok, tt.d, tt.ok)
+		}
+	}
+}
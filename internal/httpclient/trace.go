@@ -0,0 +1,350 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer は net/http/httptrace でリクエストごとの各段階（DNS・TCP 接続・TLS ハンドシェイク・最初のバイト・ボディの転送）の
+// 時刻と接続の再利用を記録します。Transport で RoundTripper を包んで使います。
+//
+// リダイレクトや再試行では、実際に送った 1 往復ごとに Trace を 1 つ記録します。
+// Trace はボディを最後まで読むか閉じた時点で完成し、Traces に加わって OnTrace が呼ばれます。
+type Tracer struct {
+	// OnTrace を設定すると、1 往復が終わるたびに結果を受け取れます（--trace の表示用）。
+	OnTrace func(t *Trace)
+
+	mu     sync.Mutex
+	traces []*Trace
+}
+
+// Traces はこれまでに終わった往復の記録です（終わった順）。
+func (tr *Tracer) Traces() []*Trace {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]*Trace(nil), tr.traces...)
+}
+
+func (tr *Tracer) finish(t *Trace) {
+	tr.mu.Lock()
+	tr.traces = append(tr.traces, t)
+	tr.mu.Unlock()
+	if tr.OnTrace != nil {
+		tr.OnTrace(t)
+	}
+}
+
+// Transport は next で送り、その往復を記録する RoundTripper を返します。
+func (tr *Tracer) Transport(next http.RoundTripper) http.RoundTripper {
+	return &traceTransport{tracer: tr, next: next}
+}
+
+type traceTransport struct {
+	tracer *Tracer
+	next   http.RoundTripper
+}
+
+func (tt *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := &Trace{Method: req.Method, URL: req.URL.Redacted(), Start: time.Now()}
+	// 呼び出し元が付けたトレースのフックも呼ばれるよう、context のトレースに合成する
+	ctx := httptrace.WithClientTrace(req.Context(), t.clientTrace())
+	resp, err := tt.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		t.mu.Lock()
+		t.Err, t.Done = err, time.Now()
+		t.mu.Unlock()
+		tt.tracer.finish(t)
+		return nil, err
+	}
+	t.mu.Lock()
+	t.StatusCode, t.Proto = resp.StatusCode, resp.Proto
+	if resp.TLS != nil {
+		// 再利用した接続では TLS のフックが呼ばれないので、レスポンスから読む
+		t.TLSVersion = tls.VersionName(resp.TLS.Version)
+		t.CipherSuite = tls.CipherSuiteName(resp.TLS.CipherSuite)
+		t.ALPN = resp.TLS.NegotiatedProtocol
+		t.TLSResumed = resp.TLS.DidResume
+	}
+	t.mu.Unlock()
+	resp.Body = &traceBody{ReadCloser: resp.Body, trace: t, done: tt.tracer.finish}
+	return resp, nil
+}
+
+// traceBody は読んだバイト数を数え、最後まで読むか閉じたときに記録を終えます。
+type traceBody struct {
+	io.ReadCloser
+	trace *Trace
+	once  sync.Once
+	done  func(t *Trace)
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.trace.mu.Lock()
+	b.trace.BodyBytes += int64(n)
+	b.trace.mu.Unlock()
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(nil)
+	return err
+}
+
+func (b *traceBody) finish(err error) {
+	b.once.Do(func() {
+		b.trace.mu.Lock()
+		b.trace.Done = time.Now()
+		if err != nil && err != io.EOF {
+			b.trace.Err = err
+		}
+		b.trace.mu.Unlock()
+		b.done(b.trace)
+	})
+}
+
+// Trace は 1 往復の各段階の時刻です。段階がなかった場合（再利用した接続の DNS や、http の TLS など）はゼロ値です。
+type Trace struct {
+	Method, URL string
+
+	Start                     time.Time
+	DNSStart, DNSDone         time.Time
+	ConnectStart, ConnectDone time.Time
+	TLSStart, TLSDone         time.Time
+	// GotConn は接続を得た時刻、WroteRequest はリクエストを送り終えた時刻、FirstByte はレスポンスの最初のバイトが届いた時刻です。
+	GotConn, WroteRequest, FirstByte time.Time
+	// Done はボディを最後まで読んだ（または閉じた）時刻です。
+	Done time.Time
+
+	// RemoteAddr は接続先のアドレスで、Reused は Keep-Alive で接続を使い回したかどうかです。
+	RemoteAddr string
+	Reused     bool
+	WasIdle    bool
+	IdleTime   time.Duration
+
+	TLSVersion, CipherSuite, ALPN string
+	TLSResumed                    bool
+
+	StatusCode int
+	Proto      string
+	BodyBytes  int64
+	// Err は接続エラーや、ボディの途中で起きたエラーです。
+	Err error
+
+	mu sync.Mutex
+}
+
+func (t *Trace) clientTrace() *httptrace.ClientTrace {
+	// フックは別の goroutine から呼ばれることがある
+	set := func(f func()) {
+		t.mu.Lock()
+		f()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(func() { t.DNSStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { set(func() { t.DNSDone = time.Now() }) },
+		ConnectStart: func(_, _ string) {
+			set(func() {
+				// Happy Eyeballs で複数のアドレスへ並行して接続する場合は最初の開始時刻を使う
+				if t.ConnectStart.IsZero() {
+					t.ConnectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				set(func() { t.ConnectDone = time.Now() })
+			}
+		},
+		TLSHandshakeStart: func() { set(func() { t.TLSStart = time.Now() }) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(func() { t.TLSDone = time.Now() }) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			set(func() {
+				t.GotConn = time.Now()
+				t.Reused, t.WasIdle, t.IdleTime = info.Reused, info.WasIdle, info.IdleTime
+				if addr := info.Conn.RemoteAddr(); addr != nil {
+					t.RemoteAddr = addr.String()
+				}
+			})
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(func() { t.WroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() { set(func() { t.FirstByte = time.Now() }) },
+	}
+}
+
+// TraceTimings は curl -w の time_* と同じく、リクエストの開始からの経過時間です。
+// その段階がなかった場合は curl と同じく 0 です（http の AppConnect や、再利用した接続の NameLookup・Connect）。
+type TraceTimings struct {
+	NameLookup    time.Duration // DNS の解決を終えるまで（time_namelookup）
+	Connect       time.Duration // TCP の接続を終えるまで（time_connect）
+	AppConnect    time.Duration // TLS のハンドシェイクを終えるまで（time_appconnect）
+	PreTransfer   time.Duration // 接続を得てリクエストを送り始めるまで（time_pretransfer）
+	StartTransfer time.Duration // レスポンスの最初のバイトが届くまで（time_starttransfer）
+	Total         time.Duration // ボディを読み終えるまで（time_total）
+}
+
+// Timings は t の curl -w 形式の経過時間です。
+func (t *Trace) Timings() TraceTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since := func(at time.Time) time.Duration {
+		if at.IsZero() {
+			return 0
+		}
+		return at.Sub(t.Start)
+	}
+	return TraceTimings{
+		NameLookup:    since(t.DNSDone),
+		Connect:       since(t.ConnectDone),
+		AppConnect:    since(t.TLSDone),
+		PreTransfer:   since(t.GotConn),
+		StartTransfer: since(t.FirstByte),
+		Total:         since(t.Done),
+	}
+}
+
+// String は curl -w で各 time_* を並べたような内訳で、段階ごとの所要時間を添えます。
+//
+//	GET http://localhost:18888/ → 200 HTTP/1.1（127.0.0.1:18888, 新しい接続, 32 bytes）
+//	  time_namelookup     0.000451s  +451µs    DNS の解決
+//	  time_connect        0.001034s  +582µs    TCP 接続
+//	  time_appconnect     0.000000s
+//	  time_pretransfer    0.001067s  +33µs     接続の取得
+//	  time_starttransfer  0.001618s  +552µs    サーバーの処理（最初のバイトまで）
+//	  time_total          0.001709s  +91µs     ボディの転送
+func (t *Trace) String() string {
+	tm := t.Timings()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s → ", t.Method, t.URL)
+	if t.StatusCode != 0 {
+		fmt.Fprintf(&b, "%d %s", t.StatusCode, t.Proto)
+	} else {
+		b.WriteString("エラー")
+	}
+	var conn []string
+	if t.RemoteAddr != "" {
+		conn = append(conn, t.RemoteAddr)
+	}
+	switch {
+	case t.Reused:
+		conn = append(conn, fmt.Sprintf("接続を再利用（アイドル %v）", t.IdleTime.Round(time.Millisecond)))
+	case !t.GotConn.IsZero():
+		conn = append(conn, "新しい接続")
+	}
+	if t.TLSVersion != "" {
+		tlsInfo := t.TLSVersion + " " + t.CipherSuite
+		if t.ALPN != "" {
+			tlsInfo += " ALPN=" + t.ALPN
+		}
+		if t.TLSResumed {
+			tlsInfo += " セッション再開"
+		}
+		conn = append(conn, tlsInfo)
+	}
+	conn = append(conn, fmt.Sprintf("%d bytes", t.BodyBytes))
+	fmt.Fprintf(&b, "（%s）\n", strings.Join(conn, ", "))
+
+	// 段階がなかった行は所要時間を付けず、次の段階は直前にあった段階からの差を示す
+	prev := time.Duration(0)
+	for _, row := range []struct {
+		name  string
+		at    time.Duration
+		phase string
+	}{
+		{"time_namelookup", tm.NameLookup, "DNS の解決"},
+		{"time_connect", tm.Connect, "TCP 接続"},
+		{"time_appconnect", tm.AppConnect, "TLS ハンドシェイク"},
+		{"time_pretransfer", tm.PreTransfer, "接続の取得"},
+		{"time_starttransfer", tm.StartTransfer, "サーバーの処理（最初のバイトまで）"},
+		{"time_total", tm.Total, "ボディの転送"},
+	} {
+		fmt.Fprintf(&b, "  %-18s  %.6fs", row.name, row.at.Seconds())
+		if row.at > 0 {
+			fmt.Fprintf(&b, "  %-9s %s", "+"+(row.at-prev).Round(time.Microsecond).String(), row.phase)
+			prev = row.at
+		}
+		b.WriteString("\n")
+	}
+	if t.Err != nil {
+		fmt.Fprintf(&b, "  error: %v\n", t.Err)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// MarshalJSON は curl -w '%{json}' に近い名前（秒単位の time_* など）の JSON にします。
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	tm := t.Timings()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v := struct {
+		Method            string  `json:"method"`
+		URL               string  `json:"url"`
+		ResponseCode      int     `json:"response_code,omitempty"`
+		HTTPVersion       string  `json:"http_version,omitempty"`
+		RemoteAddr        string  `json:"remote_addr,omitempty"`
+		Reused            bool    `json:"conn_reused"`
+		IdleTime          float64 `json:"conn_idle_time,omitempty"`
+		TLSVersion        string  `json:"tls_version,omitempty"`
+		CipherSuite       string  `json:"tls_cipher,omitempty"`
+		ALPN              string  `json:"alpn,omitempty"`
+		TLSResumed        bool    `json:"tls_resumed,omitempty"`
+		SizeDownload      int64   `json:"size_download"`
+		TimeNameLookup    float64 `json:"time_namelookup"`
+		TimeConnect       float64 `json:"time_connect"`
+		TimeAppConnect    float64 `json:"time_appconnect"`
+		TimePreTransfer   float64 `json:"time_pretransfer"`
+		TimeStartTransfer float64 `json:"time_starttransfer"`
+		TimeTotal         float64 `json:"time_total"`
+		Error             string  `json:"error,omitempty"`
+	}{
+		Method:            t.Method,
+		URL:               t.URL,
+		ResponseCode:      t.StatusCode,
+		HTTPVersion:       t.Proto,
+		RemoteAddr:        t.RemoteAddr,
+		Reused:            t.Reused,
+		IdleTime:          t.IdleTime.Seconds(),
+		TLSVersion:        t.TLSVersion,
+		CipherSuite:       t.CipherSuite,
+		ALPN:              t.ALPN,
+		TLSResumed:        t.TLSResumed,
+		SizeDownload:      t.BodyBytes,
+		TimeNameLookup:    tm.NameLookup.Seconds(),
+		TimeConnect:       tm.Connect.Seconds(),
+		TimeAppConnect:    tm.AppConnect.Seconds(),
+		TimePreTransfer:   tm.PreTransfer.Seconds(),
+		TimeStartTransfer: tm.StartTransfer.Seconds(),
+		TimeTotal:         tm.Total.Seconds(),
+	}
+	if t.Err != nil {
+		v.Error = t.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// TraceWriter は format（"text" か "json"）で Trace を w に書き出す関数を返します（Tracer.OnTrace に使います）。
+// json は 1 往復を 1 行にした JSON Lines です。
+func TraceWriter(w io.Writer, format string) (func(t *Trace), error) {
+	switch format {
+	case "text":
+		return func(t *Trace) { fmt.Fprintln(w, t) }, nil
+	case "json":
+		enc := json.NewEncoder(w)
+		return func(t *Trace) { enc.Encode(t) }, nil
+	}
+	return nil, fmt.Errorf("httpclient: unknown trace format %q (text or json)", format)
+}
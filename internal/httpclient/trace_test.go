@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTracer は TLS の新しい接続と再利用した接続の段階の記録、text と JSON の書き出し、接続エラーの記録を確認します。
+func TestTracer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	onTrace, err := TraceWriter(&out, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &Tracer{OnTrace: onTrace}
+	client := &http.Client{Transport: tracer.Transport(srv.Client().Transport)}
+	for range 2 {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	traces := tracer.Traces()
+	if len(traces) != 2 {
+		t.Fatalf("%d traces", len(traces))
+	}
+	first, second := traces[0], traces[1]
+	tm := first.Timings()
+	if first.Reused || first.TLSVersion == "" || first.StatusCode != 200 || first.BodyBytes != 5 ||
+		tm.Connect <= 0 || tm.AppConnect < tm.Connect || tm.PreTransfer < tm.AppConnect ||
+		tm.StartTransfer < tm.PreTransfer || tm.Total < tm.StartTransfer {
+		t.Errorf("first: %+v\n%v", tm, first)
+	}
+	if tm := second.Timings(); !second.Reused || tm.Connect != 0 || tm.AppConnect != 0 || tm.Total <= 0 {
+		t.Errorf("second: %+v\n%v", tm, second)
+	}
+	if s := second.String(); !strings.Contains(s, "接続を再利用") || !strings.Contains(s, "time_starttransfer") {
+		t.Errorf("text:\n%s", s)
+	}
+
+	// JSON Lines で 1 往復 1 行
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("json: %q", out.String())
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["response_code"] != 200.0 || got["conn_reused"] != false || got["time_appconnect"].(float64) <= 0 || got["size_download"] != 5.0 {
+		t.Errorf("json: %v", got)
+	}
+
+	// 接続エラーもレスポンスなしで記録する
+	srv.Close()
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("no error")
+	}
+	if traces := tracer.Traces(); len(traces) != 3 || traces[2].Err == nil || traces[2].StatusCode != 0 {
+		t.Errorf("error trace: %v", traces[len(traces)-1])
+	}
+	if _, err := TraceWriter(&out, "yaml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,391 @@
+// パッケージ idnurl は、利用者が入力した URL のホストを UTS #46（IDNA の互換処理）で正規化します。
+//
+// ch04/09_idn/idn_convert.go は 1 つの文字列を idna.ToASCII に渡すだけでしたが、このパッケージは URL 全体を受け取り、
+// ホストのラベルごとに次の処理をします。
+//
+//   - プロファイル（Lookup・Registration・Display）に従った UTS #46 の変換と検証
+//     （全角英数字や大文字の変換、「。」「．」をドットとして扱うなど）
+//   - Punycode（xn--）への変換と、表示用の Unicode への変換
+//   - 用字（Latin・Han・Katakana など）の混在と、紛らわしい文字（ホモグラフ）の検出（UTS #39 の一部）
+//
+// 問題はラベルごとに LabelError として報告します。日本語のドメイン（漢字・ひらがな・カタカナと英数字の組み合わせ）は
+// そのまま受け付け、「аpple.com」のようにキリル文字で英字を装ったホストや、「エ場.jp」のように漢字に見えるカタカナを
+// 混ぜたホストを検出します。
+package idnurl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Profile は UTS #46 の処理の種類です。
+type Profile int
+
+const (
+	// Lookup は名前解決の前に使う処理です。全角文字や大文字を変換して受け付け、紛らわしいホストはエラーにします。
+	Lookup Profile = iota
+	// Registration はドメインの登録時に使う厳格な処理です。変換を行わず、正規化済みの入力だけを受け付けます。
+	Registration
+	// Display は表示に使う処理です。紛らわしいラベルはエラーにせず、Unicode ではなく Punycode のまま表示します。
+	Display
+)
+
+func (p Profile) String() string {
+	switch p {
+	case Lookup:
+		return "lookup"
+	case Registration:
+		return "registration"
+	case Display:
+		return "display"
+	}
+	return fmt.Sprintf("Profile(%d)", int(p))
+}
+
+// ParseProfile は "lookup"・"registration"・"display" を Profile にします。
+func ParseProfile(s string) (Profile, error) {
+	for _, p := range []Profile{Lookup, Registration, Display} {
+		if strings.EqualFold(s, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("idnurl: unknown profile %q (lookup, registration, display)", s)
+}
+
+func (p Profile) idna() *idna.Profile {
+	switch p {
+	case Registration:
+		return idna.Registration
+	case Display:
+		return idna.Display
+	}
+	return idna.Lookup
+}
+
+// ラベルの問題の種類です。LabelError.Err を errors.Is で比べられます。
+var (
+	// ErrInvalidLabel は UTS #46 の検証（使えない文字・ハイフンの位置・Bidi 規則など）に失敗したラベルです。
+	ErrInvalidLabel = errors.New("invalid label")
+	// ErrMixedScript は組み合わせられない用字を混在させたラベルです（例: Latin と Cyrillic）。
+	ErrMixedScript = errors.New("mixed scripts")
+	// ErrConfusable は別の文字に見える文字を使ったラベルです（例: キリル文字だけで書いた「раураl」）。
+	ErrConfusable = errors.New("confusable characters")
+)
+
+// LabelError はホストのラベル 1 つの問題です。
+type LabelError struct {
+	// Index はホストの中でのラベルの位置（0 始まり）です。
+	Index int
+	// Label は問題のあったラベル（入力のまま）です。
+	Label string
+	// Err は ErrInvalidLabel・ErrMixedScript・ErrConfusable のいずれかです。
+	Err error
+	// Detail は問題の詳細です（idna のエラーや、混在した用字・似ている文字など）。
+	Detail string
+}
+
+func (e *LabelError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("label %d %q: %v", e.Index, e.Label, e.Err)
+	}
+	return fmt.Sprintf("label %d %q: %v: %s", e.Index, e.Label, e.Err, e.Detail)
+}
+
+func (e *LabelError) Unwrap() error { return e.Err }
+
+// Error はホストの正規化に失敗したことを表し、ラベルごとの問題を保持します。
+type Error struct {
+	Host   string
+	Labels []*LabelError
+	// Err はラベルに限らないホスト全体の問題です（長すぎるなど）。
+	Err error
+}
+
+func (e *Error) Error() string {
+	var msgs []string
+	if e.Err != nil {
+		msgs = append(msgs, e.Err.Error())
+	}
+	for _, l := range e.Labels {
+		msgs = append(msgs, l.Error())
+	}
+	return fmt.Sprintf("idnurl: host %q: %s", e.Host, strings.Join(msgs, "; "))
+}
+
+func (e *Error) Unwrap() []error {
+	errs := make([]error, 0, len(e.Labels)+1)
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	for _, l := range e.Labels {
+		errs = append(errs, l)
+	}
+	return errs
+}
+
+// Label はホストのラベル 1 つの正規化の結果です。
+type Label struct {
+	// Input は入力のラベルです。
+	Input string
+	// ASCII は Punycode に変換したラベル（ASCII のラベルならそのまま）です。
+	ASCII string
+	// Unicode は UTS #46 で正規化した Unicode のラベルです。
+	Unicode string
+	// Scripts はラベルに含まれる用字です（Common と Inherited を除く。例: [Han Hiragana]）。
+	Scripts []string
+	// Err はこのラベルの問題です。Display では紛らわしいラベルもエラーにせず、ここにだけ記録します。
+	Err *LabelError
+}
+
+// Result は URL の正規化の結果です。
+type Result struct {
+	// URL はホストを ASCII にし、パスとクエリの非 ASCII 文字をパーセントエンコードした URL です。リクエストにはこちらを使います。
+	URL *url.URL
+	// Host は ASCII のホスト名（ポートを除く）です。
+	Host string
+	// DisplayHost は表示用のホスト名です。紛らわしいラベルは Punycode のまま残します。
+	DisplayHost string
+	Labels      []Label
+}
+
+// String はリクエストに使う ASCII の URL です。
+func (r *Result) String() string { return r.URL.String() }
+
+// Display は表示用の URL です。ホストは DisplayHost にし、パスとクエリの非 ASCII 文字はパーセントエンコードを戻します。
+func (r *Result) Display() string {
+	u := r.URL
+	var b strings.Builder
+	b.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		b.WriteString(u.User.String() + "@")
+	}
+	host := r.DisplayHost
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	b.WriteString(host)
+	b.WriteString(decodeNonASCII(u.EscapedPath()))
+	if u.ForceQuery || u.RawQuery != "" {
+		b.WriteString("?" + decodeNonASCII(u.RawQuery))
+	}
+	if u.Fragment != "" {
+		b.WriteString("#" + decodeNonASCII(u.EscapedFragment()))
+	}
+	return b.String()
+}
+
+// Parse は URL を解析し、ホストを profile で正規化します。スキームがなければ http:// を補います（"例え.テスト/パス"）。
+// ホストに問題があれば *Error を返しますが、Result も返すため Display で表示には使えます。
+func Parse(rawURL string, profile Profile) (*Result, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host, port := u.Hostname(), u.Port()
+	res := &Result{URL: u}
+
+	var herr error
+	if ip := net.ParseIP(host); ip != nil && strings.Contains(host, ":") {
+		// IPv6 のアドレスはそのまま
+		res.Host, res.DisplayHost = host, host
+	} else {
+		res.Labels, herr = NormalizeHost(host, profile)
+		ascii := make([]string, len(res.Labels))
+		display := make([]string, len(res.Labels))
+		for i, l := range res.Labels {
+			ascii[i] = l.ASCII
+			display[i] = l.Unicode
+			if l.Err != nil || display[i] == "" {
+				display[i] = l.ASCII
+			}
+		}
+		res.Host = strings.Join(ascii, ".")
+		res.DisplayHost = strings.Join(display, ".")
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(res.Host, port)
+	} else if strings.Contains(res.Host, ":") {
+		u.Host = "[" + res.Host + "]"
+	} else {
+		u.Host = res.Host
+	}
+	// パスとフラグメントは URL.String() がエンコードするが、RawQuery は入力のまま出力されるため
+	u.RawQuery = encodeNonASCII(u.RawQuery)
+	if herr != nil {
+		return res, herr
+	}
+	return res, nil
+}
+
+// NormalizeHost はホスト名をラベルに分け、それぞれを profile で正規化して検査します。
+// 末尾のドット（"example.jp."）は最後の空のラベルとして残します。
+// 問題があれば *Error を返します（ラベルはその場合も返します）。
+func NormalizeHost(host string, profile Profile) ([]Label, error) {
+	// UTS #46 では「。」（U+3002）・全角と半角の句点もドットとして扱う
+	if profile != Registration {
+		host = strings.NewReplacer("。", ".", "．", ".", "｡", ".").Replace(host)
+	}
+	inputs := strings.Split(host, ".")
+	labels := make([]Label, len(inputs))
+	herr := &Error{Host: host}
+	p := profile.idna()
+	for i, in := range inputs {
+		l := Label{Input: in}
+		if in == "" {
+			if i == len(inputs)-1 && i > 0 {
+				labels[i] = l
+				continue
+			}
+			l.Err = &LabelError{Index: i, Label: in, Err: ErrInvalidLabel, Detail: "empty label"}
+			labels[i] = l
+			herr.Labels = append(herr.Labels, l.Err)
+			continue
+		}
+		ascii, err := p.ToASCII(in)
+		if err == nil && len(ascii) > 63 {
+			err = fmt.Errorf("label is longer than 63 bytes (%d)", len(ascii))
+		}
+		if err != nil {
+			l.ASCII = in
+			l.Err = &LabelError{Index: i, Label: in, Err: ErrInvalidLabel, Detail: err.Error()}
+			labels[i] = l
+			herr.Labels = append(herr.Labels, l.Err)
+			continue
+		}
+		l.ASCII = ascii
+		if l.Unicode, err = p.ToUnicode(ascii); err != nil {
+			l.Unicode = ascii
+		}
+		l.Scripts = scriptsOf(l.Unicode)
+		labels[i] = l
+	}
+
+	// 用字の検査には TLD の用字も使うため、すべてのラベルを変換してから行う
+	tld := labels[len(labels)-1]
+	if tld.Input == "" && len(labels) > 1 {
+		tld = labels[len(labels)-2]
+	}
+	for i := range labels {
+		l := &labels[i]
+		if l.Err != nil || l.Unicode == "" || !strings.HasPrefix(l.ASCII, "xn--") {
+			continue
+		}
+		if err := checkSpoof(l.Unicode, l.Scripts, tld.Scripts); err != nil {
+			err.Index, err.Label = i, l.Input
+			l.Err = err
+			if profile != Display {
+				herr.Labels = append(herr.Labels, err)
+			}
+		}
+	}
+
+	total := 0
+	for _, l := range labels {
+		total += len(l.ASCII) + 1
+	}
+	if total-1 > 253 {
+		herr.Err = fmt.Errorf("host is longer than 253 bytes (%d)", total-1)
+	}
+	if herr.Err != nil || len(herr.Labels) > 0 {
+		return labels, herr
+	}
+	return labels, nil
+}
+
+// ToASCII は URL のホストを Lookup で Punycode にした URL を返します。
+func ToASCII(rawURL string) (string, error) {
+	res, err := Parse(rawURL, Lookup)
+	if err != nil {
+		return "", err
+	}
+	return res.String(), nil
+}
+
+// ToUnicode は URL を表示用に変換します（Punycode のホストは安全なら Unicode に戻します）。
+func ToUnicode(rawURL string) (string, error) {
+	res, err := Parse(rawURL, Display)
+	if res == nil {
+		return "", err
+	}
+	return res.Display(), err
+}
+
+// encodeNonASCII は非 ASCII 文字と空白をパーセントエンコードします（すでにある %XX や区切り文字はそのまま）。
+func encodeNonASCII(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= utf8.RuneSelf || c <= ' ' || c == 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// decodeNonASCII はパーセントエンコードされた UTF-8 の非 ASCII 文字だけを戻します
+// （"%2F" や "%20" のような ASCII は意味が変わらないよう残します）。
+func decodeNonASCII(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		// %XX の並びを 1 文字分だけ読んで、非 ASCII の正しい UTF-8 なら戻す
+		var buf []byte
+		j := i
+		for j+2 < len(s) && s[j] == '%' && len(buf) < utf8.UTFMax {
+			c, ok := unhex(s[j+1 : j+3])
+			if !ok {
+				break
+			}
+			buf = append(buf, c)
+			j += 3
+			if utf8.FullRune(buf) {
+				break
+			}
+		}
+		if r, size := utf8.DecodeRune(buf); len(buf) > 0 && r >= utf8.RuneSelf && r != utf8.RuneError && size == len(buf) && !isInvisible(r) {
+			b.WriteRune(r)
+			i = j
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+func unhex(s string) (byte, bool) {
+	var v byte
+	for i := 0; i < 2; i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		v = v<<4 | c
+	}
+	return v, true
+}
@@ -0,0 +1,78 @@
+package idnurl
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParse は日本語のドメインの変換と、表示用の URL への戻し方を確認します。
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		profile Profile
+		ascii   string
+		display string
+	}{
+		{"https://例え。テスト/パス?q=日本#frag", Lookup,
+			"https://xn--r8jz45g.xn--zckzah/%E3%83%91%E3%82%B9?q=%E6%97%A5%E6%9C%AC#frag", "https://例え.テスト/パス?q=日本#frag"},
+		{"ＷＷＷ．ＥＸＡＭＰＬＥ．ｃｏｍ/", Lookup, "http://www.example.com/", "http://www.example.com/"},
+		{"１２７．０．０．１:18888", Lookup, "http://127.0.0.1:18888", "http://127.0.0.1:18888"},
+		{"http://user@xn--wgv71a.jp:8080/a%20b/%E6%97%A5", Display,
+			"http://user@xn--wgv71a.jp:8080/a%20b/%E6%97%A5", "http://user@日本.jp:8080/a%20b/日"},
+		{"http://[::1]:18888/", Registration, "http://[::1]:18888/", "http://[::1]:18888/"},
+		{"пример.рф", Registration, "http://xn--e1afmkfd.xn--p1ai", "http://пример.рф"},
+	}
+	for _, tt := range tests {
+		res, err := Parse(tt.in, tt.profile)
+		if err != nil {
+			t.Errorf("%s (%s): %v", tt.in, tt.profile, err)
+			continue
+		}
+		if res.String() != tt.ascii || res.Display() != tt.display {
+			t.Errorf("%s (%s): got %s | %s, want %s | %s", tt.in, tt.profile, res, res.Display(), tt.ascii, tt.display)
+		}
+	}
+}
+
+// TestLabelErrors はラベルごとの問題の報告と、Display で紛らわしいラベルを Punycode のまま表示することを確認します。
+func TestLabelErrors(t *testing.T) {
+	tests := []struct {
+		host    string
+		profile Profile
+		index   int
+		want    error
+	}{
+		{"www.аpple.com", Lookup, 1, ErrMixedScript},
+		{"раураӏ.com", Lookup, 0, ErrConfusable},
+		{"エ場.jp", Lookup, 0, ErrConfusable},
+		{"へルプ.jp", Lookup, 0, ErrConfusable},
+		{"ーー.jp", Lookup, 0, ErrConfusable},
+		{"a.-abc.jp", Lookup, 1, ErrInvalidLabel},
+		{"a..b", Lookup, 1, ErrInvalidLabel},
+		{"ｅｘａｍｐｌｅ.jp", Registration, 0, ErrInvalidLabel},
+	}
+	for _, tt := range tests {
+		res, err := Parse(tt.host, tt.profile)
+		var herr *Error
+		if !errors.As(err, &herr) || len(herr.Labels) != 1 {
+			t.Errorf("%s: got %v, want one label error", tt.host, err)
+			continue
+		}
+		if le := herr.Labels[0]; le.Index != tt.index || !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v at label %d", tt.host, le, tt.want, tt.index)
+		}
+		if res == nil {
+			t.Errorf("%s: no result", tt.host)
+		}
+	}
+
+	res, err := Parse("www.аpple.com", Display)
+	if err != nil || res.DisplayHost != "www.xn--pple-43d.com" || res.Labels[1].Err == nil {
+		t.Errorf("Display: got %v, %v", res.DisplayHost, err)
+	}
+	for _, host := range []string{"爆竜戦隊アバレンジャー.jp", "カード.jp", "工場.jp", "ひらがなとカタカナ.jp", "東京2026.jp"} {
+		if _, err := Parse(host, Lookup); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package idnurl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// commonScripts は先に調べる用字です（unicode.Scripts 全体を探す前に当たることが多いもの）。
+var commonScripts = []string{"Latin", "Han", "Hiragana", "Katakana", "Hangul", "Cyrillic", "Greek", "Armenian", "Bopomofo"}
+
+// scriptOf は r の用字の名前です。Common（数字・ハイフン・「ー」など）と Inherited（結合文字）は "" を返します。
+func scriptOf(r rune) string {
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for _, name := range commonScripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return "Unknown"
+}
+
+// scriptsOf は s に含まれる用字を名前順に返します。
+func scriptsOf(s string) []string {
+	var scripts []string
+	for _, r := range s {
+		if name := scriptOf(r); name != "" && !slices.Contains(scripts, name) {
+			scripts = append(scripts, name)
+		}
+	}
+	slices.Sort(scripts)
+	return scripts
+}
+
+// allowedMixes は 1 つのラベルで組み合わせてよい用字です（UTS #39 の Highly Restrictive）。
+// 日本語の漢字・ひらがな・カタカナと英数字の組み合わせはここに含まれます。
+var allowedMixes = [][]string{
+	{"Han", "Hiragana", "Katakana", "Latin"},
+	{"Bopomofo", "Han", "Latin"},
+	{"Hangul", "Han", "Latin"},
+}
+
+// latinLookalikes は英字に見える他の用字の文字です（UTS #39 の confusables.txt のうち、よく悪用されるもの）。
+var latinLookalikes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k', 'ӏ': 'l',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r', 'ѕ': 's', 'т': 't', 'ц': 'u', 'ѵ': 'v',
+	'ԝ': 'w', 'х': 'x', 'у': 'y', 'ү': 'y', 'ь': 'b', 'ѡ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w',
+	// Armenian
+	'ա': 'w', 'զ': 'q', 'հ': 'h', 'ո': 'n', 'ս': 'u', 'ց': 'g', 'օ': 'o', 'ք': 'p',
+}
+
+// kanaHanLookalikes は漢字に見えるカタカナです（「エ場」「カ士」など）。
+var kanaHanLookalikes = map[rune]rune{
+	'エ': '工', 'カ': '力', 'ニ': '二', 'ハ': '八', 'ト': '卜', 'ロ': '口', 'タ': '夕', 'ヒ': '匕', 'ミ': '三',
+}
+
+// kanaLookalikes はひらがなとカタカナでほとんど同じ形の文字です。
+var kanaLookalikes = map[rune]rune{
+	'へ': 'ヘ', 'べ': 'ベ', 'ぺ': 'ペ', 'ヘ': 'へ', 'ベ': 'べ', 'ペ': 'ぺ',
+}
+
+// checkSpoof は正規化した Unicode のラベルが、別の文字列に見えるように作られていないかを調べます。
+// tldScripts は TLD の用字で、TLD と同じ用字だけで書いたラベル（「пример.рф」など）は紛らわしいとみなしません。
+func checkSpoof(label string, scripts, tldScripts []string) *LabelError {
+	if len(scripts) > 1 && !slices.ContainsFunc(allowedMixes, func(allowed []string) bool {
+		for _, s := range scripts {
+			if !slices.Contains(allowed, s) {
+				return false
+			}
+		}
+		return true
+	}) {
+		return &LabelError{Err: ErrMixedScript, Detail: strings.Join(scripts, "+") + mixedDetail(label)}
+	}
+
+	// 英字以外の 1 つの用字だけで、英字に見える文字だけを使ったラベル（Whole-Script Confusable）
+	if len(scripts) == 1 && scripts[0] != "Latin" && !slices.Contains(tldScripts, scripts[0]) {
+		var skeleton strings.Builder
+		lookalike := true
+		for _, r := range label {
+			if l, ok := latinLookalikes[r]; ok {
+				skeleton.WriteRune(l)
+			} else if r < unicode.MaxASCII && scriptOf(r) == "" {
+				skeleton.WriteRune(r)
+			} else {
+				lookalike = false
+				break
+			}
+		}
+		if lookalike {
+			return &LabelError{Err: ErrConfusable, Detail: fmt.Sprintf("all-%s label looks like %q", scripts[0], skeleton.String())}
+		}
+	}
+
+	runes := []rune(label)
+	has := func(script string) bool { return slices.Contains(scripts, script) }
+	for i, r := range runes {
+		switch r {
+		case 'ー':
+			// 長音記号はかなの後ろでだけ使う（漢字の「一」やハイフンに見えるため）
+			if i == 0 || (scriptOf(runes[i-1]) != "Hiragana" && scriptOf(runes[i-1]) != "Katakana" && runes[i-1] != 'ー') {
+				return &LabelError{Err: ErrConfusable, Detail: `"ー" (U+30FC) not after kana looks like "一" or "-"`}
+			}
+		case '・':
+			// 中黒は RFC 5892 の CONTEXTO で、かなか漢字を含むラベルでだけ使える
+			if !has("Hiragana") && !has("Katakana") && !has("Han") {
+				return &LabelError{Err: ErrInvalidLabel, Detail: `"・" (U+30FB) requires Hiragana, Katakana or Han in the label`}
+			}
+		}
+	}
+	if has("Han") && has("Katakana") {
+		if r, han, ok := onlyLookalikes(runes, "Katakana", kanaHanLookalikes); ok {
+			return &LabelError{Err: ErrConfusable, Detail: fmt.Sprintf("Katakana %q looks like Han %q", r, han)}
+		}
+	}
+	if has("Hiragana") && has("Katakana") {
+		for _, script := range []string{"Katakana", "Hiragana"} {
+			if r, other, ok := onlyLookalikes(runes, script, kanaLookalikes); ok {
+				return &LabelError{Err: ErrConfusable, Detail: fmt.Sprintf("%s %q looks like %q", script, r, other)}
+			}
+		}
+	}
+	return nil
+}
+
+// onlyLookalikes は runes のうち script の文字がすべて table にあるかどうかです（あれば最初の文字と似ている文字を返します）。
+func onlyLookalikes(runes []rune, script string, table map[rune]rune) (r, like rune, ok bool) {
+	for _, c := range runes {
+		if scriptOf(c) != script {
+			continue
+		}
+		l, found := table[c]
+		if !found {
+			return 0, 0, false
+		}
+		if r == 0 {
+			r, like = c, l
+		}
+	}
+	return r, like, r != 0
+}
+
+// mixedDetail は混在したラベルのうち、英字に見える文字を示します（"аpple" なら Cyrillic "а" looks like "a"）。
+func mixedDetail(label string) string {
+	for _, r := range label {
+		if l, ok := latinLookalikes[r]; ok {
+			return fmt.Sprintf(` (%s %q looks like %q)`, scriptOf(r), r, l)
+		}
+	}
+	return ""
+}
+
+// isInvisible は表示すると見えない・紛らわしい文字（制御文字・書式文字・空白）かどうかです。
+func isInvisible(r rune) bool {
+	return unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zs, unicode.Zl, unicode.Zp)
+}
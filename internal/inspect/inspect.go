@@ -0,0 +1,402 @@
+// パッケージ inspect は、capture.Recorder が記録したリクエストをブラウザで眺めるダッシュボード（/_inspect）です。
+//
+// 記録は Server-Sent Events（/_inspect/events）で届いた順にブラウザへ送られ、
+// 画面ではパスとメソッドで絞り込み、ヘッダ・ボディ・multipart の各パート・Cookie を確認できます。
+// 「再送」ボタンは記録したリクエストを同じサーバーへそのまま送り直します。
+package inspect
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"real-world-http-learn/internal/capture"
+	"real-world-http-learn/internal/proxy"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// Dashboard は /_inspect 以下のハンドラです。
+type Dashboard struct {
+	recorder *capture.Recorder
+
+	// done はサーバーの停止時に閉じ、SSE の接続を終わらせます（Shutdown が待ち続けないように）。
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New は recorder の記録を表示する Dashboard を返します。
+func New(recorder *capture.Recorder) *Dashboard {
+	return &Dashboard{recorder: recorder, done: make(chan struct{})}
+}
+
+// Close は SSE の接続をすべて終わらせます。http.Server.RegisterOnShutdown に渡して使います。
+func (d *Dashboard) Close() {
+	d.closeOnce.Do(func() { close(d.done) })
+}
+
+// ServeHTTP は次のパスを処理します（/_inspect と /_inspect/ の両方に登録してください）。
+//
+//	GET  /_inspect                     ダッシュボードの HTML
+//	GET  /_inspect/events?method=&path= 記録の SSE（Last-Event-ID / ?after= 以降の既存分から送る）
+//	GET  /_inspect/records/{id}        1 件の詳細（ヘッダ・ボディ・パート・Cookie）
+//	POST /_inspect/replay/{id}         記録したリクエストを同じサーバーへ再送
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/_inspect"), "/")
+	switch {
+	case rest == "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardHTML)
+	case rest == "events":
+		d.events(w, r)
+	case strings.HasPrefix(rest, "records/"):
+		d.detail(w, r, strings.TrimPrefix(rest, "records/"))
+	case strings.HasPrefix(rest, "replay/"):
+		d.replay(w, r, strings.TrimPrefix(rest, "replay/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Summary は一覧に表示する 1 件分の要約です。
+type Summary struct {
+	ID          int64     `json:"id"`
+	StartedAt   time.Time `json:"startedAt"`
+	Method      string    `json:"method"`
+	Target      string    `json:"target"`
+	Host        string    `json:"host"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	Status      int       `json:"status"`
+	DurationMs  float64   `json:"durationMs"`
+	BodySize    int64     `json:"bodySize"`
+	ContentType string    `json:"contentType,omitempty"`
+}
+
+func summarize(rec capture.Record) Summary {
+	s := Summary{
+		ID:          rec.ID,
+		StartedAt:   rec.StartedAt,
+		Method:      rec.Method,
+		Target:      rec.Target,
+		Host:        rec.Host,
+		RemoteAddr:  rec.RemoteAddr,
+		DurationMs:  rec.DurationMs,
+		BodySize:    rec.BodySize,
+		ContentType: rec.Header().Get("Content-Type"),
+	}
+	if rec.Response != nil {
+		s.Status = rec.Response.Status
+	}
+	return s
+}
+
+// matches は一覧の絞り込み条件（メソッドの完全一致とパスの部分一致）です。
+func matches(rec capture.Record, method, path string) bool {
+	if method != "" && !strings.EqualFold(rec.Method, method) {
+		return false
+	}
+	return path == "" || strings.Contains(rec.Target, path)
+}
+
+// events は既存の記録を送ったあと、新しい記録が届くたびに SSE で送ります。
+func (d *Dashboard) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	method, path := q.Get("method"), q.Get("path")
+	after := q.Get("after")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		after = id // 再接続時は受け取り済みの続きから
+	}
+	lastID, _ := strconv.ParseInt(after, 10, 64)
+
+	// 既存分を送る前に購読しておき、その間に届いた記録を取りこぼさないようにする
+	live, cancel := d.recorder.Subscribe(64)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	send := func(rec capture.Record) bool {
+		if rec.ID <= lastID {
+			return true
+		}
+		lastID = rec.ID
+		if !matches(rec, method, path) {
+			return true
+		}
+		data, err := json.Marshal(summarize(rec))
+		if err != nil {
+			return true
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: record\ndata: %s\n\n", rec.ID, data)
+		return err == nil
+	}
+
+	fmt.Fprint(w, "retry: 2000\n\n")
+	for _, rec := range d.recorder.Records() {
+		if !send(rec) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-d.done:
+			return
+		case <-keepAlive.C:
+			// プロキシにアイドル接続として切られないようにコメント行を送る
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case rec := <-live:
+			if !send(rec) {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// Part は multipart/form-data の 1 パートです。
+type Part struct {
+	Name        string   `json:"name"`
+	FileName    string   `json:"fileName,omitempty"`
+	ContentType string   `json:"contentType,omitempty"`
+	HeaderLines []string `json:"headerLines"`
+	Size        int      `json:"size"`
+	// Text はパートの内容が UTF-8 のテキストのときだけ入ります。
+	Text string `json:"text,omitempty"`
+}
+
+// Detail は 1 件の詳細です。
+type Detail struct {
+	Record     capture.Record `json:"record"`
+	Body       string         `json:"body"`    // デコード済みのリクエストボディ（バイナリは � を含む）
+	BodyBinary bool           `json:"binary"`  // ボディが UTF-8 のテキストでない
+	Query      [][2]string    `json:"query"`   // クエリパラメータ（出現順）
+	Cookies    [][2]string    `json:"cookies"` // Cookie ヘッダの名前と値
+	SetCookies []string       `json:"setCookies"`
+	Parts      []Part         `json:"parts,omitempty"`
+	PartsError string         `json:"partsError,omitempty"`
+	Response   string         `json:"responseBody"`
+}
+
+func (d *Dashboard) lookup(w http.ResponseWriter, idText string) (capture.Record, bool) {
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return capture.Record{}, false
+	}
+	rec, ok := d.recorder.Get(id)
+	if !ok {
+		http.Error(w, "record not found", http.StatusNotFound)
+		return capture.Record{}, false
+	}
+	return rec, true
+}
+
+func (d *Dashboard) detail(w http.ResponseWriter, r *http.Request, idText string) {
+	rec, ok := d.lookup(w, idText)
+	if !ok {
+		return
+	}
+	header := rec.Header()
+	out := Detail{
+		Record:     rec,
+		Query:      [][2]string{},
+		Cookies:    [][2]string{},
+		SetCookies: []string{},
+	}
+	body, _ := rec.BodyBytes()
+	out.Body = string(body)
+	out.BodyBinary = !utf8.Valid(body)
+
+	if u, err := url.Parse(rec.Target); err == nil {
+		for _, pair := range strings.Split(u.RawQuery, "&") {
+			if pair == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(pair, "=")
+			k, _ = url.QueryUnescape(k)
+			v, _ = url.QueryUnescape(v)
+			out.Query = append(out.Query, [2]string{k, v})
+		}
+	}
+	for _, c := range (&http.Request{Header: header}).Cookies() {
+		out.Cookies = append(out.Cookies, [2]string{c.Name, c.Value})
+	}
+	if rec.Response != nil {
+		out.SetCookies = append(out.SetCookies, rec.Response.Header().Values("Set-Cookie")...)
+		if b, err := rec.Response.BodyBytes(); err == nil {
+			out.Response = string(b)
+		}
+	}
+	if mt, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil && strings.HasPrefix(mt, "multipart/") {
+		out.Parts, err = parts(body, params["boundary"])
+		if err != nil {
+			out.PartsError = err.Error()
+			if rec.BodyTruncated {
+				out.PartsError += "（ボディが保存上限で切り詰められています）"
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(out)
+}
+
+// parts は multipart のボディをパートごとに分けます。
+func parts(body []byte, boundary string) ([]Part, error) {
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	out := []Part{}
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return out, err
+		}
+		part := Part{
+			Name:        p.FormName(),
+			FileName:    p.FileName(),
+			ContentType: p.Header.Get("Content-Type"),
+			HeaderLines: []string{},
+			Size:        len(data),
+		}
+		for name, values := range p.Header {
+			for _, v := range values {
+				part.HeaderLines = append(part.HeaderLines, name+": "+v)
+			}
+		}
+		if utf8.Valid(data) {
+			part.Text = string(data)
+		}
+		out = append(out, part)
+	}
+}
+
+// sameOrigin はリクエストがダッシュボードと同じオリジンのページから送られたかどうかです。
+// Sec-Fetch-Site があればそれが same-origin であること、なければ Origin がこのサーバーのオリジンと一致することを求めます。
+// curl などから送るときは -H 'Origin: http://localhost:18888' のように Origin を付けます。
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin"
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	origin := r.Header.Get("Origin")
+	return origin != "" && strings.EqualFold(origin, scheme+"://"+r.Host)
+}
+
+// replay は記録したリクエストを、このリクエストを受けたのと同じ待ち受けアドレスへ送り直します。
+// 接続先は Host ヘッダではなく実際に受け付けたローカルアドレスに固定するため、他のホストへは送れません。
+func (d *Dashboard) replay(w http.ResponseWriter, r *http.Request, idText string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		// 開いているほかのサイトのページから、記録した Cookie や Authorization 付きで送り直させない（CSRF の対策）
+		http.Error(w, "replay is only allowed from the dashboard (same-origin)", http.StatusForbidden)
+		return
+	}
+	rec, ok := d.lookup(w, idText)
+	if !ok {
+		return
+	}
+	if !strings.HasPrefix(rec.Target, "/") {
+		// OPTIONS * のようなアスタリスク形式はパスを持たないため、"http://host" に続けて送り直せない
+		http.Error(w, "only origin-form targets (/path) can be replayed, not "+strconv.Quote(rec.Target), http.StatusBadRequest)
+		return
+	}
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		http.Error(w, "local address unknown", http.StatusInternalServerError)
+		return
+	}
+	body, err := rec.BodyBytes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	host := rec.Host
+	if host == "" {
+		host = "localhost"
+	}
+	req, err := http.NewRequestWithContext(r.Context(), rec.Method, "http://"+host+rec.Target, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header = rec.Header()
+	proxy.RemoveHopHeaders(req.Header)
+	req.Header.Del("Content-Length")
+	// 記録したボディはデコード済みなので Content-Encoding を外す
+	req.Header.Del("Content-Encoding")
+	req.Header.Set("X-Replayed-From", strconv.FormatInt(rec.ID, 10))
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, local.Network(), local.String())
+			},
+			DisableCompression: true,
+		},
+		// リダイレクトは追わず、記録と同じ 1 往復だけを行う
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, capture.DefaultMaxBody))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(map[string]any{
+		"replayedFrom": rec.ID,
+		"status":       resp.StatusCode,
+		"header":       resp.Header,
+		"body":         string(respBody),
+		"durationMs":   float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
@@ -0,0 +1,96 @@
+package inspect
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"real-world-http-learn/internal/capture"
+)
+
+// TestReplaySameOrigin は再送がダッシュボードと同じオリジンからのリクエストだけに限られることを確認します。
+func TestReplaySameOrigin(t *testing.T) {
+	rc, err := capture.NewRecorder("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/_inspect/", New(rc))
+	mux.Handle("/", rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/secret", nil)
+	req.Header.Set("Cookie", "SID=victim")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"no Origin", nil, http.StatusForbidden},
+		{"cross-site", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"same-site", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"other Origin", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"same-origin", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": srv.URL}, http.StatusOK},
+		{"matching Origin", map[string]string{"Origin": srv.URL}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/_inspect/replay/1", nil)
+		for name, value := range tt.header {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+	if n := len(rc.Records()); n != 3 {
+		t.Errorf("%d records, want the original and 2 replays", n)
+	}
+}
+
+// TestReplayAsteriskForm はアスタリスク形式（*）のリクエストを再送せずに 400 を返すことを確認します。
+func TestReplayAsteriskForm(t *testing.T) {
+	rc, err := capture.NewRecorder("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// OPTIONS * は net/http が自分で応答してハンドラに届かないため、別のメソッドで送る
+	io.WriteString(conn, "GET * HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	io.ReadAll(conn)
+	conn.Close()
+	records := rc.Records()
+	if len(records) != 1 || records[0].Target != "*" {
+		t.Fatalf("records: %+v", records)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/_inspect/replay/"+strconv.FormatInt(records[0].ID, 10), nil)
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	w := httptest.NewRecorder()
+	New(rc).ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("%d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,229 @@
+// パッケージ listener は、server.go の待ち受け先の指定とグレースフルシャットダウンをまとめたものです。
+//
+// 待ち受け先は 1 つの文字列で指定します。
+//
+//	:18888 / 127.0.0.1:0   TCP（ポート 0 なら空いているポートを OS が選ぶ）
+//	unix:/tmp/http.sock    Unix ドメインソケット
+//	fd:3                   親プロセスから受け継いだファイルディスクリプタ
+//	systemd                systemd のソケットアクティベーション（LISTEN_FDS / LISTEN_PID）の最初のソケット
+//
+// 実際に待ち受けたアドレスは Announce で JSON 1 行として出力するため、
+// テストハーネスはポート 0 で起動してから接続先を読み取れます。
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFdsStart は systemd が受け渡すファイルディスクリプタの先頭番号です（sd_listen_fds(3)）。
+const listenFdsStart = 3
+
+// Listen は spec で指定された待ち受け先を開きます。
+func Listen(spec string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(spec, "unix:"):
+		return listenUnix(strings.TrimPrefix(spec, "unix:"))
+	case strings.HasPrefix(spec, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(spec, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("listener: invalid fd in %q", spec)
+		}
+		return fileListener(fd, spec)
+	case spec == "systemd":
+		n, err := systemdFds()
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, errors.New("listener: no sockets passed by systemd (LISTEN_FDS)")
+		}
+		return fileListener(listenFdsStart, "systemd")
+	default:
+		return net.Listen("tcp", spec)
+	}
+}
+
+// listenUnix は Unix ドメインソケットで待ち受けます。
+// 前回の異常終了で残ったソケットファイルは、接続できない（誰も待ち受けていない）場合に限り削除します。
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("listener: unix socket path is empty")
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("listener: %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Close 時にソケットファイルも削除する
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	return ln, nil
+}
+
+// systemdFds は自分宛てに渡されたソケットの数を返します。
+// 使い終わった環境変数は子プロセスへ引き継がないよう削除します。
+func systemdFds() (int, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if fds == "" {
+		return 0, nil
+	}
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, fmt.Errorf("listener: LISTEN_PID=%s is not this process (%d)", pid, os.Getpid())
+	}
+	return strconv.Atoi(fds)
+}
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("listener: invalid fd %d", fd)
+	}
+	defer f.Close() // FileListener が複製を持つので元は閉じてよい
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("listener: fd %d is not a listening socket: %w", fd, err)
+	}
+	return ln, nil
+}
+
+// Bound は実際に待ち受けたアドレスです。Announce で JSON として出力します。
+type Bound struct {
+	Event   string `json:"event"` // 常に "listening"
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+	// URL は接続に使える URL です（TCP のみ。ワイルドカードアドレスは localhost に置き換えます）。
+	URL string `json:"url,omitempty"`
+	PID int    `json:"pid"`
+}
+
+// Describe は ln の待ち受けアドレスを Bound にします。
+func Describe(ln net.Listener) Bound {
+	addr := ln.Addr()
+	b := Bound{Event: "listening", Network: addr.Network(), Addr: addr.String(), PID: os.Getpid()}
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		host := tcp.IP.String()
+		if tcp.IP == nil || tcp.IP.IsUnspecified() {
+			host = "localhost"
+		}
+		b.URL = "http://" + net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+	}
+	return b
+}
+
+// Announce は待ち受けアドレスを JSON 1 行で w に書き、file が空でなければ同じ内容をファイルにも書きます。
+// ファイルは一時ファイルから rename するため、読み手が書きかけの内容を見ることはありません。
+func Announce(w io.Writer, file string, b Bound) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if file == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// IsLoopback は addr が同じホストからしか接続できないアドレス（ループバックアドレスか Unix ドメインソケット）かどうかを返します。
+// 0.0.0.0 や :: のようなワイルドカードアドレスはすべてのインターフェースで待ち受けるため false です。
+func IsLoopback(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		return a.IP.IsLoopback()
+	}
+	return false
+}
+
+// LoopbackOnly は next をループバックアドレスと Unix ドメインソケットからのリクエストにだけ応じるようにします。
+// /_captures のように受信したリクエストの Cookie や Authorization をそのまま返す管理用のパスに使います。
+func LoopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLocal(r) {
+			http.Error(w, r.URL.Path+" is only available from a loopback address", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLocal は r が同じホストから届いたかどうかを返します。
+// Unix ドメインソケットの RemoteAddr は空（または "@"）なので、待ち受け側のアドレスで判断します。
+func isLocal(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Serve は srv で ln を待ち受け、ctx が終わったら新規接続の受け付けを止めて
+// 処理中のリクエストが終わるのを最大 drain だけ待ちます（グレースフルシャットダウン）。
+// drain を過ぎても終わらない接続は強制的に閉じます。
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutdown: 新規接続の受け付けを停止し、処理中のリクエストを最大 %s 待ちます", drain)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Println("shutdown: 時間内に終わらなかった接続を閉じます")
+		err = srv.Close()
+	}
+	if serveErr := <-errc; !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
+	}
+	return err
+}
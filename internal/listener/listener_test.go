@@ -0,0 +1,177 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestListen は TCP・Unix ドメインソケット・fd・systemd の待ち受け先の指定を確認します。
+func TestListen(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := Describe(ln); b.Network != "tcp" || !strings.HasPrefix(b.URL, "http://127.0.0.1:") || strings.HasSuffix(b.URL, ":0") {
+		t.Errorf("tcp: %+v", b)
+	}
+	ln.Close()
+
+	sock := filepath.Join(t.TempDir(), "http.sock")
+	ln, err = Listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := Describe(ln); b.Network != "unix" || b.Addr != sock || b.URL != "" {
+		t.Errorf("unix: %+v", b)
+	}
+	if _, err := Listen("unix:" + sock); err == nil {
+		t.Error("listened on a socket in use")
+	}
+	// 異常終了で残ったソケットファイルは削除して待ち受け直す
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err := os.Stat(sock); err != nil {
+		t.Fatal(err)
+	}
+	ln, err = Listen("unix:" + sock)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	ln.Close()
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket file was left after Close: %v", err)
+	}
+
+	for _, spec := range []string{"unix:", "fd:", "fd:x", "fd:-1", "127.0.0.1:-1"} {
+		if ln, err := Listen(spec); err == nil {
+			ln.Close()
+			t.Errorf("%q: no error", spec)
+		}
+	}
+
+	tests := []struct {
+		pid, fds string
+		want     string // エラーに含まれること
+	}{
+		{"", "", "no sockets"},
+		{"", "0", "no sockets"},
+		{"1", "1", "is not this process"},
+		{strconv.Itoa(os.Getpid()), "x", "invalid syntax"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LISTEN_PID", tt.pid)
+		t.Setenv("LISTEN_FDS", tt.fds)
+		_, err := Listen("systemd")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("systemd LISTEN_PID=%q LISTEN_FDS=%q: %v", tt.pid, tt.fds, err)
+		}
+		if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+			t.Error("LISTEN_FDS was not unset")
+		}
+	}
+}
+
+// TestDescribe はワイルドカードアドレスの URL を localhost に置き換えることを確認します。
+func TestDescribe(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	if b := Describe(ln); b.URL != "http://localhost:"+strconv.Itoa(port) || b.Event != "listening" || b.PID != os.Getpid() {
+		t.Errorf("%+v", b)
+	}
+}
+
+// TestAnnounce は待ち受けアドレスを JSON 1 行で書き、ファイルにも同じ内容を一時ファイルを残さずに書くことを確認します。
+func TestAnnounce(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "addr.json")
+	b := Bound{Event: "listening", Network: "tcp", Addr: "127.0.0.1:18888", URL: "http://127.0.0.1:18888", PID: 42}
+	var out bytes.Buffer
+	if err := Announce(&out, file, b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "}\n") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("output: %q", out.String())
+	}
+	var got Bound
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil || got != b {
+		t.Errorf("decoded: %+v %v", got, err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil || !bytes.Equal(data, out.Bytes()) {
+		t.Errorf("file: %q %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files were left: %v", entries)
+	}
+
+	out.Reset()
+	if err := Announce(&out, "", b); err != nil || out.Len() == 0 {
+		t.Errorf("without a file: %v", err)
+	}
+	if err := Announce(&out, filepath.Join(dir, "missing", "addr.json"), b); err == nil {
+		t.Error("wrote to a missing directory")
+	}
+}
+
+// TestLoopbackOnly はループバックアドレスと Unix ドメインソケットからのリクエストだけを通すことを確認します。
+func TestLoopbackOnly(t *testing.T) {
+	h := LoopbackOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		remote string
+		local  net.Addr
+		want   int
+	}{
+		{"127.0.0.1:1234", nil, http.StatusOK},
+		{"[::1]:1234", nil, http.StatusOK},
+		{"192.0.2.1:1234", nil, http.StatusForbidden},
+		{"[2001:db8::1]:1234", nil, http.StatusForbidden},
+		{"", nil, http.StatusForbidden},
+		{"@", &net.UnixAddr{Name: "/tmp/http.sock", Net: "unix"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/_captures", nil)
+		r.RemoteAddr = tt.remote
+		if tt.local != nil {
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, tt.local))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%q: %d, want %d", tt.remote, w.Code, tt.want)
+		}
+	}
+}
+
+// TestIsLoopback はループバックアドレスと Unix ドメインソケットだけを同じホスト限定とみなすことを確認します。
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want bool
+	}{
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 18888}, true},
+		{&net.TCPAddr{IP: net.IPv6loopback, Port: 18888}, true},
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 18888}, false},
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 18888}, false},
+		{&net.TCPAddr{Port: 18888}, false},
+		{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 18888}, false},
+		{&net.UnixAddr{Name: "/tmp/http.sock", Net: "unix"}, true},
+	}
+	for _, tt := range tests {
+		if got := IsLoopback(tt.addr); got != tt.want {
+			t.Errorf("IsLoopback(%v) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
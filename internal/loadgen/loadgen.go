@@ -0,0 +1,382 @@
+// パッケージ loadgen は、リポジトリのサーバーに一定のレートでリクエストを送り、レイテンシを HDR ヒストグラムに記録する
+// 負荷試験の部品です。cmd/loadgen から使います。
+//
+// 2 つの送り方があります。
+//
+//   - クローズドループ（closed）: Concurrency 個の worker が、それぞれ前のレスポンスを受け取ってから次を送ります。
+//     サーバーが遅くなると送る量も減るため、遅い時間帯のリクエストが少なく記録されます（Coordinated Omission）。
+//     Rate を指定した場合は、その間隔で送れなかった分を補正したヒストグラム（Corrected）も作ります。
+//   - オープンループ（open）: 利用者が増えていくように、サーバーの応答を待たずに Rate で決めた予定時刻ごとに送ります。
+//     レイテンシは予定時刻から測るので、空いている worker を待った時間も含みます。
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"real-world-http-learn/internal/hdrhist"
+)
+
+// ヒストグラムはマイクロ秒で、1µs から 1 時間までを有効数字 3 桁で記録する
+const (
+	histLowest  = 1
+	histHighest = int64(time.Hour / time.Microsecond)
+	histSigfigs = 3
+)
+
+// Options は負荷のかけ方です。
+type Options struct {
+	// Method・URL・Header・Body は毎回送るリクエストです（Method が空なら GET）。
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+
+	// Mode は "closed"（クローズドループ、既定）か "open"（オープンループ）です。
+	Mode string
+	// Rate は全体で 1 秒あたりに送るリクエストの目標数です。closed で 0 なら待たずに送り続けます。open では必須です。
+	Rate float64
+	// Concurrency は同時に送るリクエストの上限（worker の数）です（0 なら 1）。
+	Concurrency int
+	// Duration は送り続ける時間で、Requests は送るリクエストの数の上限です（どちらか先に達したら終わります）。
+	Duration time.Duration
+	Requests int64
+
+	// HTTP は "1.1"（既定）か "2" です。"2" は https なら ALPN で、http なら h2c（事前知識による HTTP/2）で接続します。
+	HTTP string
+	// DisableKeepAlives が true なら、リクエストごとに新しい接続を作ります（ch07/01_keep-alive との比較用）。
+	DisableKeepAlives bool
+	// Insecure が true ならサーバー証明書を検証しません。
+	Insecure bool
+	// Timeout は 1 リクエストのタイムアウトです（0 なら 30 秒）。
+	Timeout time.Duration
+}
+
+// Result は負荷試験の結果です。
+type Result struct {
+	Options Options
+	// Elapsed は最初のリクエストから最後のレスポンスまでの時間です。
+	Elapsed time.Duration
+	// Requests は送ったリクエストの数（エラーを含む）で、Errors はそのうち接続エラーやタイムアウトになった数です。
+	Requests, Errors int64
+	// Status はステータスコードごとの、ErrorKinds はエラーの種類ごとの数です。
+	Status     map[int]int64
+	ErrorKinds map[string]int64
+	// Protocols はレスポンスのプロトコル（HTTP/1.1・HTTP/2.0）ごとの数です。
+	Protocols map[string]int64
+	// NewConns は新しく作った接続の数です（キープアライブが効いていればリクエスト数より十分小さい）。
+	NewConns int64
+	// Bytes は受け取ったボディの合計です。
+	Bytes int64
+	// Latency はレスポンスを受け取ったリクエストのレイテンシ（マイクロ秒）です。
+	Latency *hdrhist.Histogram
+	// Corrected は closed で Rate を指定したときの、Coordinated Omission を補正したレイテンシです（それ以外は nil）。
+	Corrected *hdrhist.Histogram
+}
+
+// RPS は実際に送れた 1 秒あたりのリクエスト数です。
+func (r *Result) RPS() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Run は opts に従ってリクエストを送り、ctx がキャンセルされるか Duration・Requests に達したら結果を返します。
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if opts.Method == "" {
+		opts.Method = http.MethodGet
+	}
+	if opts.Mode == "" {
+		opts.Mode = "closed"
+	}
+	opts.Concurrency = max(opts.Concurrency, 1)
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	switch {
+	case opts.Mode != "closed" && opts.Mode != "open":
+		return nil, fmt.Errorf("loadgen: unknown mode %q (closed or open)", opts.Mode)
+	case opts.Mode == "open" && opts.Rate <= 0:
+		return nil, errors.New("loadgen: open loop needs a rate")
+	case opts.Duration <= 0 && opts.Requests <= 0:
+		return nil, errors.New("loadgen: either duration or number of requests is required")
+	}
+	if _, err := http.NewRequest(opts.Method, opts.URL, nil); err != nil {
+		return nil, err
+	}
+	client, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	// schedule は送る予定時刻を worker へ渡す。open ではレートで決めた時刻、closed では worker ごとに決める
+	schedule := make(chan time.Time)
+	var budget sync.Mutex
+	sent := int64(0)
+	take := func() bool {
+		budget.Lock()
+		defer budget.Unlock()
+		if opts.Requests > 0 && sent >= opts.Requests {
+			return false
+		}
+		sent++
+		return true
+	}
+
+	start := time.Now()
+	workers := make([]*worker, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := range workers {
+		w, err := newWorker(client, opts)
+		if err != nil {
+			return nil, err
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if opts.Mode == "open" {
+				for intended := range schedule {
+					w.do(ctx, intended)
+				}
+				return
+			}
+			w.closedLoop(ctx, start, take, opts.Rate/float64(opts.Concurrency))
+		}()
+	}
+	if opts.Mode == "open" {
+		interval := time.Duration(float64(time.Second) / opts.Rate)
+	dispatch:
+		for i := int64(0); take(); i++ {
+			intended := start.Add(time.Duration(i) * interval)
+			timer := time.NewTimer(time.Until(intended))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				break dispatch
+			}
+			// worker が空くまで待つ間も予定時刻は変えない（待った時間もレイテンシに含める）
+			select {
+			case schedule <- intended:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		close(schedule)
+	}
+	wg.Wait()
+
+	result := &Result{
+		Options:    opts,
+		Elapsed:    time.Since(start),
+		Status:     map[int]int64{},
+		ErrorKinds: map[string]int64{},
+		Protocols:  map[string]int64{},
+	}
+	result.Latency, _ = hdrhist.New(histLowest, histHighest, histSigfigs)
+	if opts.Mode == "closed" && opts.Rate > 0 {
+		result.Corrected, _ = hdrhist.New(histLowest, histHighest, histSigfigs)
+	}
+	for _, w := range workers {
+		w.mergeInto(result)
+	}
+	return result, nil
+}
+
+// newClient は opts の HTTP のバージョンとキープアライブの設定で http.Client を作ります。
+func newClient(opts Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DisableKeepAlives = opts.DisableKeepAlives
+	// 既定の 2 では、worker の数だけ同時に送るとすぐ接続を閉じて作り直すことになる
+	transport.MaxIdleConnsPerHost = opts.Concurrency
+	transport.MaxIdleConns = max(transport.MaxIdleConns, opts.Concurrency)
+	// 圧縮の展開はサーバーの性能と関係ないので行わない
+	transport.DisableCompression = true
+	if opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	protocols := new(http.Protocols)
+	switch opts.HTTP {
+	case "", "1.1", "1":
+		protocols.SetHTTP1(true)
+	case "2":
+		protocols.SetHTTP2(true)
+		if strings.HasPrefix(strings.ToLower(opts.URL), "http://") {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+	default:
+		return nil, fmt.Errorf("loadgen: unknown HTTP version %q (1.1 or 2)", opts.HTTP)
+	}
+	transport.Protocols = protocols
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		// リダイレクトは追わず、3xx もそのまま数える
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}, nil
+}
+
+// worker は 1 つの goroutine の記録です（終わってから Result にまとめるので、記録の間はロックしない）。
+type worker struct {
+	client *http.Client
+	opts   Options
+
+	requests, errors, newConns, bytes int64
+	status                            map[int]int64
+	errorKinds                        map[string]int64
+	protocols                         map[string]int64
+	latency, corrected                *hdrhist.Histogram
+	trace                             *httptrace.ClientTrace
+}
+
+func newWorker(client *http.Client, opts Options) (*worker, error) {
+	w := &worker{client: client, opts: opts, status: map[int]int64{}, errorKinds: map[string]int64{}, protocols: map[string]int64{}}
+	var err error
+	if w.latency, err = hdrhist.New(histLowest, histHighest, histSigfigs); err != nil {
+		return nil, err
+	}
+	if w.corrected, err = hdrhist.New(histLowest, histHighest, histSigfigs); err != nil {
+		return nil, err
+	}
+	w.trace = &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		if !info.Reused {
+			w.newConns++
+		}
+	}}
+	return w, nil
+}
+
+// closedLoop は前のレスポンスを受け取ってから次を送ります。perWorkerRate が正なら、その間隔より早くは送りません。
+func (w *worker) closedLoop(ctx context.Context, start time.Time, take func() bool, perWorkerRate float64) {
+	var interval time.Duration
+	if perWorkerRate > 0 {
+		interval = time.Duration(float64(time.Second) / perWorkerRate)
+	}
+	next := start
+	for ctx.Err() == nil && take() {
+		if interval > 0 {
+			if d := time.Until(next); d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+			next = next.Add(interval)
+			// 遅れを取り戻そうとまとめて送らないよう、予定より遅れていたら今から数え直す
+			if now := time.Now(); next.Before(now) {
+				next = now
+			}
+		}
+		latency, ok := w.do(ctx, time.Now())
+		if ok && interval > 0 {
+			w.corrected.RecordCorrected(min(latency.Microseconds(), histHighest), interval.Microseconds())
+		}
+	}
+}
+
+// do はリクエストを 1 つ送り、intended（送る予定だった時刻）からボディを読み終えるまでのレイテンシを記録します。
+func (w *worker) do(ctx context.Context, intended time.Time) (time.Duration, bool) {
+	var body io.Reader
+	if w.opts.Body != nil {
+		body = bytes.NewReader(w.opts.Body)
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, w.trace), w.opts.Method, w.opts.URL, body)
+	if err != nil {
+		w.fail(err)
+		return 0, false
+	}
+	for name, values := range w.opts.Header {
+		req.Header[name] = values
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	w.requests++
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// 試験の終了で打ち切ったリクエストは数えない
+			w.requests--
+			return 0, false
+		}
+		w.fail(err)
+		return 0, false
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	latency := time.Since(intended)
+	if err != nil {
+		if ctx.Err() != nil {
+			w.requests--
+			return 0, false
+		}
+		w.fail(err)
+		return 0, false
+	}
+	w.bytes += n
+	w.status[resp.StatusCode]++
+	w.protocols[resp.Proto]++
+	w.latency.Record(min(latency.Microseconds(), histHighest))
+	return latency, true
+}
+
+func (w *worker) fail(err error) {
+	w.errors++
+	w.errorKinds[errorKind(err)]++
+}
+
+func (w *worker) mergeInto(r *Result) {
+	r.Requests += w.requests
+	r.Errors += w.errors
+	r.NewConns += w.newConns
+	r.Bytes += w.bytes
+	for k, v := range w.status {
+		r.Status[k] += v
+	}
+	for k, v := range w.errorKinds {
+		r.ErrorKinds[k] += v
+	}
+	for k, v := range w.protocols {
+		r.Protocols[k] += v
+	}
+	r.Latency.Merge(w.latency)
+	if r.Corrected != nil {
+		r.Corrected.Merge(w.corrected)
+	}
+}
+
+// errorKind はエラーを集計用の短い種類にまとめます（アドレスやポート番号の違いで別々に数えないように）。
+func errorKind(err error) string {
+	msg := err.Error()
+	for _, kind := range []string{"connection refused", "connection reset", "timeout", "Client.Timeout", "EOF", "broken pipe", "no such host", "certificate"} {
+		if strings.Contains(msg, kind) {
+			return kind
+		}
+	}
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		return msg[i+2:]
+	}
+	return msg
+}
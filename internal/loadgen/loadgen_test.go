@@ -0,0 +1,91 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRun はクローズドループ・オープンループそれぞれで送った数、接続の使い回し、h2c を確認します。
+func TestRun(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	h2c := httptest.NewUnstartedServer(handler)
+	h2c.Config.Protocols = new(http.Protocols)
+	h2c.Config.Protocols.SetHTTP1(true)
+	h2c.Config.Protocols.SetUnencryptedHTTP2(true)
+	h2c.Start()
+	defer h2c.Close()
+
+	tests := []struct {
+		name      string
+		opts      Options
+		conns     int64 // 0 なら確認しない
+		protocol  string
+		corrected bool
+	}{
+		{"closed", Options{URL: srv.URL, Concurrency: 4, Requests: 200}, 4, "HTTP/1.1", false},
+		{"closed rate", Options{URL: srv.URL, Concurrency: 2, Requests: 40, Rate: 400}, 0, "HTTP/1.1", true},
+		{"no keep-alive", Options{URL: srv.URL, Concurrency: 2, Requests: 50, DisableKeepAlives: true}, 50, "HTTP/1.1", false},
+		{"open", Options{URL: srv.URL, Mode: "open", Rate: 500, Concurrency: 4, Requests: 100}, 0, "HTTP/1.1", false},
+		{"h2c", Options{URL: h2c.URL, HTTP: "2", Concurrency: 4, Requests: 100}, 1, "HTTP/2.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Run(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := tt.opts.Requests
+			if r.Requests != n || r.Errors != 0 || r.Status[200] != n || r.Latency.Count() != n {
+				t.Errorf("requests %d, errors %d %v, status %v, latency count %d", r.Requests, r.Errors, r.ErrorKinds, r.Status, r.Latency.Count())
+			}
+			if r.Protocols[tt.protocol] != n {
+				t.Errorf("protocols %v", r.Protocols)
+			}
+			if tt.conns > 0 && r.NewConns != tt.conns {
+				t.Errorf("new conns %d, want %d", r.NewConns, tt.conns)
+			}
+			if r.Bytes != 2*n {
+				t.Errorf("bytes %d", r.Bytes)
+			}
+			if (r.Corrected != nil) != tt.corrected {
+				t.Errorf("corrected %v, want %v", r.Corrected != nil, tt.corrected)
+			}
+		})
+	}
+
+	// 時間で止める場合と、エラーのステータスの集計と JSON の要約
+	r, err := Run(context.Background(), Options{URL: srv.URL + "/missing", Duration: 200 * time.Millisecond, Rate: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Requests < 10 || r.Requests > 30 || r.Status[404] != r.Requests {
+		t.Errorf("requests %d, status %v", r.Requests, r.Status)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary map[string]any
+	json.Unmarshal(data, &summary)
+	for _, key := range []string{"mode", "rps", "status", "new_conns", "latency_ms", "corrected_latency_ms"} {
+		if _, ok := summary[key]; !ok {
+			t.Errorf("JSON summary has no %q: %s", key, data)
+		}
+	}
+
+	if _, err := Run(context.Background(), Options{URL: srv.URL, Mode: "open", Requests: 1}); err == nil {
+		t.Error("open loop without a rate was accepted")
+	}
+}
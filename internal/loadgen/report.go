@@ -0,0 +1,157 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"real-world-http-learn/internal/hdrhist"
+)
+
+// Percentiles は要約に載せるパーセンタイルです。
+var Percentiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99}
+
+// WriteText は結果の要約とパーセンタイルの表（ミリ秒）を書きます。
+func (r *Result) WriteText(w io.Writer) error {
+	o := r.Options
+	rate := "上限なし"
+	if o.Rate > 0 {
+		rate = fmt.Sprintf("目標 %g rps", o.Rate)
+	}
+	keepAlive := "keep-alive"
+	if o.DisableKeepAlives {
+		keepAlive = "keep-alive なし"
+	}
+	fmt.Fprintf(w, "%s %s\n", o.Method, o.URL)
+	fmt.Fprintf(w, "モード: %s（%s、同時 %d）HTTP/%s %s\n", o.Mode, rate, o.Concurrency, httpVersion(o.HTTP), keepAlive)
+	fmt.Fprintf(w, "送信: %d 件 / %.2fs = %.1f rps、エラー %d 件、新しい接続 %d、受信 %d bytes\n",
+		r.Requests, r.Elapsed.Seconds(), r.RPS(), r.Errors, r.NewConns, r.Bytes)
+	fmt.Fprintf(w, "ステータス: %s\n", formatCounts(r.Status))
+	if len(r.Protocols) > 0 {
+		fmt.Fprintf(w, "プロトコル: %s\n", formatCounts(r.Protocols))
+	}
+	if len(r.ErrorKinds) > 0 {
+		fmt.Fprintf(w, "エラー: %s\n", formatCounts(r.ErrorKinds))
+	}
+	if r.Latency.Count() == 0 {
+		_, err := fmt.Fprintln(w, "レスポンスを受け取れたリクエストがありません")
+		return err
+	}
+
+	fmt.Fprintf(w, "\nレイテンシ（ms）  min %.3f  mean %.3f  stddev %.3f  max %.3f\n",
+		ms(r.Latency.Min()), r.Latency.Mean()/1000, r.Latency.StdDev()/1000, ms(r.Latency.Max()))
+	header := fmt.Sprintf("  %-8s %10s", "", "latency")
+	if r.Corrected != nil {
+		header += fmt.Sprintf(" %12s", "corrected")
+	}
+	fmt.Fprintln(w, header)
+	for _, p := range append(slices.Clone(Percentiles), 100) {
+		label := "p" + strconv.FormatFloat(p, 'f', -1, 64)
+		if p == 100 {
+			label = "max"
+		}
+		line := fmt.Sprintf("  %-8s %10.3f", label, ms(r.Latency.ValueAtPercentile(p)))
+		if r.Corrected != nil {
+			line += fmt.Sprintf(" %12.3f", ms(r.Corrected.ValueAtPercentile(p)))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	if r.Corrected != nil {
+		_, err := fmt.Fprintln(w, "  （corrected は送れなかった予定の分を補正した値。Coordinated Omission を参照）")
+		return err
+	}
+	return nil
+}
+
+// MarshalJSON は結果の要約（レイテンシはミリ秒）を JSON にします。
+func (r *Result) MarshalJSON() ([]byte, error) {
+	o := r.Options
+	type latency struct {
+		Count  int64              `json:"count"`
+		Min    float64            `json:"min"`
+		Mean   float64            `json:"mean"`
+		StdDev float64            `json:"stddev"`
+		Max    float64            `json:"max"`
+		P      map[string]float64 `json:"percentiles"`
+	}
+	summary := func(h *hdrhist.Histogram) *latency {
+		if h == nil {
+			return nil
+		}
+		l := &latency{Count: h.Count(), Min: ms(h.Min()), Mean: h.Mean() / 1000, StdDev: h.StdDev() / 1000, Max: ms(h.Max()), P: map[string]float64{}}
+		for _, p := range Percentiles {
+			l.P["p"+strconv.FormatFloat(p, 'f', -1, 64)] = ms(h.ValueAtPercentile(p))
+		}
+		return l
+	}
+	status := map[string]int64{}
+	for code, n := range r.Status {
+		status[strconv.Itoa(code)] = n
+	}
+	return json.Marshal(struct {
+		Method      string           `json:"method"`
+		URL         string           `json:"url"`
+		Mode        string           `json:"mode"`
+		HTTP        string           `json:"http"`
+		KeepAlive   bool             `json:"keep_alive"`
+		Concurrency int              `json:"concurrency"`
+		TargetRPS   float64          `json:"target_rps"`
+		Elapsed     float64          `json:"elapsed_s"`
+		Requests    int64            `json:"requests"`
+		RPS         float64          `json:"rps"`
+		Errors      int64            `json:"errors"`
+		ErrorKinds  map[string]int64 `json:"error_kinds"`
+		Status      map[string]int64 `json:"status"`
+		Protocols   map[string]int64 `json:"protocols"`
+		NewConns    int64            `json:"new_conns"`
+		Bytes       int64            `json:"bytes"`
+		Latency     *latency         `json:"latency_ms"`
+		Corrected   *latency         `json:"corrected_latency_ms,omitempty"`
+	}{
+		Method:      o.Method,
+		URL:         o.URL,
+		Mode:        o.Mode,
+		HTTP:        httpVersion(o.HTTP),
+		KeepAlive:   !o.DisableKeepAlives,
+		Concurrency: o.Concurrency,
+		TargetRPS:   o.Rate,
+		Elapsed:     r.Elapsed.Seconds(),
+		Requests:    r.Requests,
+		RPS:         r.RPS(),
+		Errors:      r.Errors,
+		ErrorKinds:  r.ErrorKinds,
+		Status:      status,
+		Protocols:   r.Protocols,
+		NewConns:    r.NewConns,
+		Bytes:       r.Bytes,
+		Latency:     summary(r.Latency),
+		Corrected:   summary(r.Corrected),
+	})
+}
+
+func httpVersion(v string) string {
+	if v == "2" {
+		return "2"
+	}
+	return "1.1"
+}
+
+// ms はマイクロ秒をミリ秒にします。
+func ms(us int64) float64 {
+	return float64(us) / 1000
+}
+
+// formatCounts は "200=980 503=20" のように、キーの順に数を並べます。
+func formatCounts[K int | string](counts map[K]int64) string {
+	parts := make([]string, 0, len(counts))
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		parts = append(parts, fmt.Sprintf("%v=%d", k, counts[k]))
+	}
+	return strings.Join(parts, " ")
+}
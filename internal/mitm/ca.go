@@ -0,0 +1,109 @@
+// パッケージ mitm は、フォワードプロキシ（internal/proxy）の CONNECT のトンネルを終端し、
+// HTTPS の通信を復号して中身を確認するための部品です。
+//
+// クライアントが CONNECT で指定したホスト（TLS の SNI）ごとに、ch07/02_tls/ca の自前 CA で署名した
+// サーバー証明書をその場で発行してキャッシュします。クライアントがこの CA を信頼していれば、
+// 復号した HTTP/1.1 と HTTP/2 のリクエストを（Dump が有効ならログに出してから）本来の転送先へ送り直します。
+// ローカルでのテストで、自分たちの HTTPS クライアントが実際に何を送っているかを確かめる用途のためのものです。
+package mitm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// 既定の CA のファイル（リポジトリのルートからの相対パス）です。
+// 秘密鍵はコミットしていないため、ch07/02_tls/README.md の手順で作成しておきます。
+const (
+	DefaultCACert = "ch07/02_tls/ca/certs/ca.crt"
+	DefaultCAKey  = "ch07/02_tls/ca/private/ca.key"
+)
+
+// CA はサーバー証明書の署名に使う認証局です。
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// LoadCA は PEM 形式の CA 証明書と秘密鍵（PKCS#8・SEC 1・PKCS#1）を読み込みます。
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("mitm: CA の秘密鍵 %s がありません（ch07/02_tls/README.md の手順で作成してください）: %w", keyFile, err)
+		}
+		return nil, err
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("mitm: %s is not a PEM certificate", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("mitm: %s is not a CA certificate", certFile)
+	}
+
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("mitm: %s: %w", keyFile, err)
+	}
+	if !publicKeyEqual(cert.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("mitm: %s does not match %s", keyFile, certFile)
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// parseKey は PEM の秘密鍵を読みます（openssl genpkey の PKCS#8 と、従来形式の EC / RSA）。
+func parseKey(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported key type %T", key)
+			}
+			return signer, nil
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		}
+		// "EC PARAMETERS" などは読み飛ばす
+	}
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	switch k := a.(type) {
+	case *ecdsa.PublicKey:
+		return k.Equal(b)
+	case *rsa.PublicKey:
+		return k.Equal(b)
+	case ed25519.PublicKey:
+		return k.Equal(b)
+	}
+	return false
+}
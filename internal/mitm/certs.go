@@ -0,0 +1,159 @@
+package mitm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// leafValidity は発行するサーバー証明書の有効期間です（CA の期限を超える場合は CA の期限まで）。
+	leafValidity = 30 * 24 * time.Hour
+	// renewBefore は期限までこれより短くなった証明書を使わずに発行し直す時間です。
+	renewBefore = time.Hour
+	// MaxCerts はキャッシュしておく証明書の上限です。超えたら最後に使ったのが古いものから捨てます。
+	MaxCerts = 1000
+)
+
+// CertCache はホスト名ごとに発行したサーバー証明書を保持します。
+// 同じホストへの接続が同時に来ても、発行は 1 回だけ行います。
+type CertCache struct {
+	ca *CA
+
+	mu      sync.Mutex
+	certs   map[string]*cachedCert
+	pending map[string]*pendingCert
+	uses    uint64 // Get のたびに増やし、cachedCert.lastUsed に記録する
+	// key はすべてのサーバー証明書で共有する鍵です（ホストごとに鍵を作るより発行がずっと速い）。
+	key *ecdsa.PrivateKey
+}
+
+type cachedCert struct {
+	cert     *tls.Certificate
+	lastUsed uint64
+}
+
+type pendingCert struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+// NewCertCache は ca で署名する CertCache を返します。
+func NewCertCache(ca *CA) (*CertCache, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CertCache{
+		ca:      ca,
+		certs:   map[string]*cachedCert{},
+		pending: map[string]*pendingCert{},
+		key:     key,
+	}, nil
+}
+
+// Get は host（ホスト名か IP アドレス）のサーバー証明書を返します。キャッシュになければ発行します。
+func (c *CertCache) Get(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	c.mu.Lock()
+	c.uses++
+	if cached, ok := c.certs[host]; ok && time.Until(cached.cert.Leaf.NotAfter) > renewBefore {
+		cached.lastUsed = c.uses
+		c.mu.Unlock()
+		return cached.cert, nil
+	}
+	if p, ok := c.pending[host]; ok {
+		c.mu.Unlock()
+		<-p.done
+		return p.cert, p.err
+	}
+	p := &pendingCert{done: make(chan struct{})}
+	c.pending[host] = p
+	c.mu.Unlock()
+
+	p.cert, p.err = c.issue(host)
+
+	c.mu.Lock()
+	delete(c.pending, host)
+	if p.err == nil {
+		c.certs[host] = &cachedCert{cert: p.cert, lastUsed: c.uses}
+		c.prune(time.Now())
+	}
+	c.mu.Unlock()
+	close(p.done)
+	return p.cert, p.err
+}
+
+// Len はキャッシュしている証明書の数です。
+func (c *CertCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.certs)
+}
+
+// prune は期限の近い証明書を捨て、MaxCerts を超えた分を最後に使ったのが古い順に捨てます（c.mu を保持して呼ぶこと）。
+func (c *CertCache) prune(now time.Time) {
+	for host, cached := range c.certs {
+		if cached.cert.Leaf.NotAfter.Sub(now) <= renewBefore {
+			delete(c.certs, host)
+		}
+	}
+	for len(c.certs) > MaxCerts {
+		var oldest string
+		for host, cached := range c.certs {
+			if oldest == "" || cached.lastUsed < c.certs[oldest].lastUsed {
+				oldest = host
+			}
+		}
+		delete(c.certs, oldest)
+	}
+}
+
+// issue は host のサーバー証明書を CA で署名して作ります。
+func (c *CertCache) issue(host string) (*tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(c.ca.Cert.NotAfter) {
+		notAfter = c.ca.Cert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"real-world-http-learn MITM"}},
+		// 時計のずれで「まだ有効でない」とされないよう少し前から有効にする
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.ca.Cert, &c.key.PublicKey, c.ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, c.ca.Cert.Raw},
+		PrivateKey:  c.key,
+		Leaf:        leaf,
+	}, nil
+}
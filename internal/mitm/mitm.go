@@ -0,0 +1,239 @@
+package mitm
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"real-world-http-learn/internal/proxy"
+)
+
+// MITM は proxy.Interceptor の実装で、CONNECT のトンネルの TLS を終端して中身を転送先へ送り直します。
+type MITM struct {
+	Certs *CertCache
+	// Transport は復号したリクエストを本来の転送先へ送ります。
+	Transport http.RoundTripper
+	// Middleware を設定すると、復号したリクエストの処理をそれで包みます
+	// （capture.Recorder.Middleware を渡せば /_captures や /_inspect で中身を見られます）。
+	Middleware func(http.Handler) http.Handler
+	// Dump が true なら、復号したリクエストとレスポンスのヘッダをログに出します。
+	// Cookie や Authorization もそのまま出るため、既定では無効です。
+	Dump bool
+	// HandshakeTimeout はクライアントとの TLS ハンドシェイクのタイムアウトです（0 なら 10 秒）。
+	HandshakeTimeout time.Duration
+	// Logf はログの出力先です（nil なら log.Printf）。
+	Logf func(format string, args ...any)
+
+	exchanges atomic.Int64
+}
+
+var _ proxy.Interceptor = (*MITM)(nil)
+
+// New は ca で証明書を発行する MITM を返します。
+// 転送先の証明書はシステムの CA に加えて ca でも検証するため、ch07/02_tls のサーバーにもそのまま転送できます。
+func New(ca *CA) (*MITM, error) {
+	certs, err := NewCertCache(ca)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	roots.AddCert(ca.Cert)
+	return &MITM{
+		Certs: certs,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			TLSClientConfig:     &tls.Config{RootCAs: roots},
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+			// 転送先の Content-Encoding をそのままクライアントへ渡す
+			DisableCompression: true,
+		},
+	}, nil
+}
+
+func (m *MITM) logf(format string, args ...any) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Intercept はクライアントとの接続で TLS を終端し、接続が閉じるまでリクエストを転送先へ送り直します。
+// トンネルの中身が TLS でなければ（CONNECT host:80 など）平文の HTTP/1.1 として扱います。
+func (m *MITM) Intercept(client net.Conn, target string) error {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(client)
+	first, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+	conn := net.Conn(&peekedConn{Conn: client, r: br})
+	scheme := "http"
+	// TLS のレコードは 0x16（handshake）で始まる
+	if first[0] == 0x16 {
+		tlsConn := tls.Server(conn, &tls.Config{
+			NextProtos: []string{"h2", "http/1.1"},
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				name := hello.ServerName
+				if name == "" {
+					// SNI のない（IP アドレス宛ての）接続は CONNECT のホストで発行する
+					name = host
+				}
+				return m.Certs.Get(name)
+			},
+		})
+		timeout := m.HandshakeTimeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			// クライアントが CA を信頼していない場合はここで失敗する（"unknown certificate authority" など）
+			return fmt.Errorf("TLS handshake: %w", err)
+		}
+		state := tlsConn.ConnectionState()
+		m.logf("mitm: %s を復号します（%s, ALPN %q, SNI %q）", target, tls.VersionName(state.Version), state.NegotiatedProtocol, state.ServerName)
+		conn, scheme = tlsConn, "https"
+	}
+
+	var handler http.Handler = &forwarder{m: m, scheme: scheme, target: target}
+	if m.Middleware != nil {
+		handler = m.Middleware(handler)
+	}
+	ln := newSingleListener(conn)
+	srv := &http.Server{
+		Handler: handler,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				ln.Close()
+			}
+		},
+		ReadHeaderTimeout: time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+	// TLSConfig が nil の Serve は、ALPN で h2 が選ばれた *tls.Conn を HTTP/2 で処理する
+	srv.Serve(ln)
+	return nil
+}
+
+// forwarder は復号したリクエストを本来の転送先へ送り直すハンドラです。
+type forwarder struct {
+	m      *MITM
+	scheme string
+	target string
+}
+
+func (f *forwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := f.m.exchanges.Add(1)
+	start := time.Now()
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.URL.Scheme = f.scheme
+	out.URL.Host = f.target
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+	proxy.RemoveHopHeaders(out.Header)
+	if _, ok := out.Header["User-Agent"]; !ok {
+		out.Header.Set("User-Agent", "")
+	}
+	display := f.scheme + "://" + r.Host + r.URL.RequestURI()
+	if f.m.Dump {
+		if dump, err := httputil.DumpRequest(r, false); err == nil {
+			f.m.logf("mitm #%d: 復号したリクエスト（%s）\n%s", id, r.Proto, indent(dump))
+		}
+	}
+
+	resp, err := f.m.Transport.RoundTrip(out)
+	if err != nil {
+		f.m.logf("mitm #%d: %s %s: %v", id, r.Method, display, err)
+		http.Error(w, "mitm: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if f.m.Dump {
+		if dump, err := httputil.DumpResponse(resp, false); err == nil {
+			f.m.logf("mitm #%d: 転送先のレスポンス（%s）\n%s", id, resp.Proto, indent(dump))
+		}
+	}
+
+	proxy.RemoveHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	n, err := proxy.CopyFlush(w, resp.Body)
+	if err != nil {
+		f.m.logf("mitm #%d: copying response: %v", id, err)
+	}
+	f.m.logf("mitm #%d: [%s → %s] %s %s → %d (%d bytes, %v)",
+		id, r.Proto, resp.Proto, r.Method, display, resp.StatusCode, n, time.Since(start).Round(time.Millisecond))
+}
+
+// indent はダンプの各行を字下げします。
+func indent(dump []byte) string {
+	lines := strings.Split(strings.TrimRight(string(dump), "\r\n"), "\r\n")
+	return "    " + strings.Join(lines, "\n    ")
+}
+
+// peekedConn は bufio.Reader で先読みした接続を読み出します。
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// singleListener は 1 つの接続だけを返す net.Listener です。
+// 2 回目の Accept は Close されるまで待つため、http.Server.Serve は接続の処理が終わるまで戻りません。
+type singleListener struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	addr   net.Addr
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newSingleListener(conn net.Conn) *singleListener {
+	return &singleListener{conn: conn, addr: conn.LocalAddr(), closed: make(chan struct{})}
+}
+
+func (l *singleListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	conn := l.conn
+	l.conn = nil
+	l.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *singleListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *singleListener) Addr() net.Addr { return l.addr }
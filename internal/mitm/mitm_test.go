@@ -0,0 +1,150 @@
+package mitm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestCA は notAfter まで有効な自己署名の CA を作ります。
+func newTestCA(t *testing.T, notAfter time.Time) *CA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CA{Cert: cert, Key: key}
+}
+
+// TestIssue は発行したサーバー証明書が CA まで検証でき、ホスト名は DNS 名・IP アドレスは IP の SAN になることと、
+// 有効期限が CA の期限を超えないことを確認します。
+func TestIssue(t *testing.T) {
+	caNotAfter := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+	ca := newTestCA(t, caNotAfter)
+	certs, err := NewCertCache(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	tests := []struct {
+		host, name string
+		dns        []string
+		ips        []string
+	}{
+		{"Example.COM.", "example.com", []string{"example.com"}, nil},
+		{"127.0.0.1", "127.0.0.1", nil, []string{"127.0.0.1"}},
+		{"::1", "::1", nil, []string{"::1"}},
+	}
+	for _, tt := range tests {
+		cert, err := certs.Get(tt.host)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.host, err)
+		}
+		leaf := cert.Leaf
+		var ips []string
+		for _, ip := range leaf.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		if fmt.Sprint(leaf.DNSNames) != fmt.Sprint(tt.dns) || fmt.Sprint(ips) != fmt.Sprint(tt.ips) {
+			t.Errorf("%s: DNS %v, IP %v", tt.host, leaf.DNSNames, ips)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: tt.name, Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+			t.Errorf("%s: %v", tt.host, err)
+		}
+		if len(cert.Certificate) != 2 || string(cert.Certificate[1]) != string(ca.Cert.Raw) {
+			t.Errorf("%s: the chain does not end with the CA", tt.host)
+		}
+		if !leaf.NotAfter.Equal(caNotAfter) {
+			t.Errorf("%s: NotAfter %v, want the CA's %v", tt.host, leaf.NotAfter, caNotAfter)
+		}
+		if again, _ := certs.Get(tt.host); again != cert {
+			t.Errorf("%s: issued again", tt.host)
+		}
+	}
+
+	// CA を信頼するクライアントとのハンドシェイクが SNI の証明書で通ること
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		defer serverConn.Close()
+		tls.Server(serverConn, &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certs.Get(hello.ServerName)
+			},
+		}).Handshake()
+	}()
+	if err := tls.Client(clientConn, &tls.Config{ServerName: "example.com", RootCAs: roots}).Handshake(); err != nil {
+		t.Errorf("handshake: %v", err)
+	}
+}
+
+// TestCertCachePrune はキャッシュが MaxCerts を超えたら最後に使ったのが古いものから捨て、
+// 期限の近い証明書も捨てることを確認します。
+func TestCertCachePrune(t *testing.T) {
+	certs, err := NewCertCache(newTestCA(t, time.Now().Add(24*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range MaxCerts {
+		if _, err := certs.Get(fmt.Sprintf("h%d.example", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, _ := certs.Get("h0.example")
+	certs.Get("new.example")
+	if n := certs.Len(); n != MaxCerts {
+		t.Errorf("%d certificates, want %d", n, MaxCerts)
+	}
+	certs.mu.Lock()
+	_, kept0 := certs.certs["h0.example"]
+	_, kept1 := certs.certs["h1.example"]
+	certs.mu.Unlock()
+	if !kept0 || kept1 {
+		t.Errorf("h0 (recently used) kept %v, h1 (least recently used) kept %v", kept0, kept1)
+	}
+	if again, _ := certs.Get("h0.example"); again != first {
+		t.Error("a recently used certificate was issued again")
+	}
+
+	certs.mu.Lock()
+	expiring := *first
+	leaf := *first.Leaf
+	leaf.NotAfter = time.Now().Add(renewBefore / 2)
+	expiring.Leaf = &leaf
+	certs.certs["expiring.example"] = &cachedCert{cert: &expiring}
+	certs.mu.Unlock()
+	certs.Get("other.example")
+	certs.mu.Lock()
+	_, kept := certs.certs["expiring.example"]
+	certs.mu.Unlock()
+	if kept {
+		t.Error("a certificate about to expire was kept")
+	}
+}
@@ -0,0 +1,284 @@
+// パッケージ proxy は、ch04/05_proxy/proxy_request.go などのクライアントから使えるフォワードプロキシです。
+//
+// 絶対形式（GET http://example.com/ HTTP/1.1）のリクエストは転送先へ送り直してレスポンスを返し、
+// CONNECT は転送先との TCP 接続をつないだトンネルにします（HTTPS はこちらを通ります）。
+// 転送時は hop-by-hop ヘッダを取り除き、Via と Forwarded を付けます。
+// Interceptor を設定すると、CONNECT のトンネルを転送先へそのままつながずに中身を処理させられます（internal/mitm）。
+// Users を設定すると Proxy-Authorization の Basic 認証を求めます。
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultName は Via ヘッダに書くこのプロキシの名前です。
+const DefaultName = "real-world-http-learn"
+
+// Proxy はフォワードプロキシの http.Handler です。
+type Proxy struct {
+	// Name は Via ヘッダに書く名前です（空なら DefaultName）。同じ名前の Via が届いたらループとして 508 を返します。
+	Name string
+	// Users はユーザー名とパスワードです。空でなければ Proxy-Authorization の Basic 認証を求めます。
+	Users map[string]string
+	// Realm は 407 の Proxy-Authenticate に書く realm です。
+	Realm string
+	// Transport は絶対形式のリクエストの転送に使います（nil なら環境変数のプロキシを使わない専用の Transport）。
+	Transport http.RoundTripper
+	// DialTimeout は CONNECT の転送先への接続のタイムアウトです（0 なら 10 秒）。
+	DialTimeout time.Duration
+	// Logf はトンネルや転送のログの出力先です（nil なら log.Printf）。
+	Logf func(format string, args ...any)
+	// Interceptor を設定すると、CONNECT を転送先へそのままつながず、トンネルの中身を Interceptor に任せます
+	// （internal/mitm による TLS の終端と復号）。
+	Interceptor Interceptor
+
+	tunnels atomic.Int64
+}
+
+// Interceptor は CONNECT のトンネルの中身を自分で処理するものです。
+type Interceptor interface {
+	// Intercept は 200 Connection Established を返した後のクライアントとの接続を受け取り、
+	// 接続が終わるまで処理します。target は CONNECT で指定された host:port です。
+	Intercept(client net.Conn, target string) error
+}
+
+// New は既定の設定の Proxy を返します。
+func New() *Proxy {
+	return &Proxy{
+		Name:  DefaultName,
+		Realm: DefaultName,
+		Transport: &http.Transport{
+			// プロキシ自身は環境変数の HTTP_PROXY に従わない（自分自身へのループを避ける）
+			Proxy:                 nil,
+			DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			// 転送先の Content-Encoding をそのままクライアントへ渡す
+			DisableCompression: true,
+		},
+	}
+}
+
+// IsProxyRequest は r がプロキシとして処理すべきリクエスト（CONNECT か絶対形式）かどうかです。
+func IsProxyRequest(r *http.Request) bool {
+	return r.Method == http.MethodConnect || r.URL.IsAbs()
+}
+
+// Dispatch はプロキシ宛てのリクエストを p で、それ以外を next で処理するハンドラを返します。
+// server.go のように、通常のサーバーとプロキシを同じポートで兼ねるために使います。
+func (p *Proxy) Dispatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsProxyRequest(r) {
+			p.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		w.Header().Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", p.realm()))
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+	if p.looped(r) {
+		http.Error(w, "proxy loop detected", http.StatusLoopDetected)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "proxy requests must use the absolute form (GET http://host/path)", http.StatusBadRequest)
+		return
+	}
+	p.serveForward(w, r)
+}
+
+func (p *Proxy) name() string {
+	if p.Name == "" {
+		return DefaultName
+	}
+	return p.Name
+}
+
+func (p *Proxy) realm() string {
+	if p.Realm == "" {
+		return p.name()
+	}
+	return p.Realm
+}
+
+func (p *Proxy) logf(format string, args ...any) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// authorized は Proxy-Authorization の Basic 認証を確かめます（Users が空なら常に許可）。
+func (p *Proxy) authorized(r *http.Request) bool {
+	if len(p.Users) == 0 {
+		return true
+	}
+	scheme, encoded, ok := strings.Cut(r.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+	want, known := p.Users[user]
+	// ユーザーの有無で応答時間が変わらないよう、存在しない場合も比較する
+	return subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1 && known
+}
+
+// looped は自分が付けた Via がすでにあるか（自分自身への転送）どうかです。
+func (p *Proxy) looped(r *http.Request) bool {
+	for _, v := range r.Header.Values("Via") {
+		for _, hop := range strings.Split(v, ",") {
+			fields := strings.Fields(hop)
+			if len(fields) >= 2 && fields[1] == p.name() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hopHeaders は接続ごとのヘッダで、プロキシが転送してはならないものです（RFC 9110 7.6.1）。
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // 非標準だが古いクライアントが送る
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopHeaders は hop-by-hop ヘッダと、Connection に列挙されたヘッダを取り除きます（internal/mitm からも使います）。
+func RemoveHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// via は Via に追加する値（"1.1 real-world-http-learn"）です。
+func (p *Proxy) via(protoMajor, protoMinor int) string {
+	return fmt.Sprintf("%d.%d %s", protoMajor, protoMinor, p.name())
+}
+
+// forwarded は Forwarded に追加する値です（RFC 7239）。
+func forwarded(r *http.Request) string {
+	parts := []string{}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if strings.Contains(host, ":") {
+			// IPv6 は角括弧で囲み、引用符が必要
+			parts = append(parts, fmt.Sprintf(`for="[%s]"`, host))
+		} else {
+			parts = append(parts, "for="+host)
+		}
+	}
+	if r.URL.Host != "" {
+		parts = append(parts, fmt.Sprintf("host=%q", r.URL.Host))
+	}
+	if r.URL.Scheme != "" {
+		parts = append(parts, "proto="+r.URL.Scheme)
+	}
+	return strings.Join(parts, ";")
+}
+
+// serveForward は絶対形式のリクエストを転送先へ送り直します。
+func (p *Proxy) serveForward(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Host = r.URL.Host
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+	RemoveHopHeaders(out.Header)
+	out.Header.Add("Via", p.via(r.ProtoMajor, r.ProtoMinor))
+	out.Header.Add("Forwarded", forwarded(r))
+	if _, ok := out.Header["User-Agent"]; !ok {
+		// net/http が既定の User-Agent を付けないようにする
+		out.Header.Set("User-Agent", "")
+	}
+
+	transport := p.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		p.logf("proxy: %s %s: %v", r.Method, r.URL, err)
+		http.Error(w, "proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	RemoveHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Add("Via", p.via(resp.ProtoMajor, resp.ProtoMinor))
+	w.WriteHeader(resp.StatusCode)
+	n, err := CopyFlush(w, resp.Body)
+	if err != nil {
+		p.logf("proxy: %s %s: copying response: %v", r.Method, r.URL, err)
+	}
+	p.logf("proxy: %s %s %s → %d (%d bytes, %v)", r.RemoteAddr, r.Method, r.URL, resp.StatusCode, n, time.Since(start).Round(time.Millisecond))
+}
+
+// CopyFlush はレスポンスを書くたびに Flush します（Server-Sent Events などを溜め込まないため。internal/mitm からも使います）。
+func CopyFlush(w http.ResponseWriter, r io.Reader) (int64, error) {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			rc.Flush()
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAuthAndLoop は Users を設定すると Basic 認証がなければ 407 を返すことと、
+// 自分の付けた Via が届いたら 508 を返すことを確認します。
+func TestAuthAndLoop(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream")
+	}))
+	defer upstream.Close()
+	p := New()
+	p.Users = map[string]string{"alice": "secret"}
+	p.Logf = t.Logf
+
+	basic := func(userinfo string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userinfo))
+	}
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"no credentials", nil, http.StatusProxyAuthRequired},
+		{"wrong password", map[string]string{"Proxy-Authorization": basic("alice:wrong")}, http.StatusProxyAuthRequired},
+		{"unknown user", map[string]string{"Proxy-Authorization": basic("bob:secret")}, http.StatusProxyAuthRequired},
+		{"other scheme", map[string]string{"Proxy-Authorization": "Bearer secret"}, http.StatusProxyAuthRequired},
+		{"valid", map[string]string{"Proxy-Authorization": basic("alice:secret")}, http.StatusOK},
+		{"loop", map[string]string{"Proxy-Authorization": basic("alice:secret"), "Via": "1.0 other, 1.1 " + DefaultName}, http.StatusLoopDetected},
+		{"other proxy", map[string]string{"Proxy-Authorization": basic("alice:secret"), "Via": "1.1 other"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, upstream.URL+"/", nil)
+		for name, value := range tt.header {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if w.Code == http.StatusProxyAuthRequired && !strings.HasPrefix(w.Header().Get("Proxy-Authenticate"), "Basic realm=") {
+			t.Errorf("%s: Proxy-Authenticate %q", tt.name, w.Header().Get("Proxy-Authenticate"))
+		}
+	}
+}
+
+// TestForwardHopHeaders は転送時に hop-by-hop ヘッダと Connection に列挙されたヘッダを取り除き、
+// Via と Forwarded を付けることを確認します。
+func TestForwardHopHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(r.Header)
+	}))
+	defer upstream.Close()
+	p := New()
+	p.Logf = t.Logf
+
+	r := httptest.NewRequest(http.MethodGet, upstream.URL+"/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("Connection", "X-Hop")
+	r.Header.Set("X-Hop", "1")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("Proxy-Connection", "keep-alive")
+	r.Header.Set("Proxy-Authorization", "Basic eDp5")
+	r.Header.Set("Te", "trailers")
+	r.Header.Set("X-Keep", "1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	var got http.Header
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("%d: %v", w.Code, err)
+	}
+	for _, name := range []string{"X-Hop", "Keep-Alive", "Proxy-Connection", "Proxy-Authorization", "Te"} {
+		if v := got.Get(name); v != "" {
+			t.Errorf("%s: %q was forwarded", name, v)
+		}
+	}
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	if got.Get("X-Keep") != "1" || got.Get("Via") != "1.1 "+DefaultName || got.Get("Forwarded") != `for=192.0.2.1;host="`+host+`";proto=http` {
+		t.Errorf("forwarded header: %v", got)
+	}
+	if v := w.Header().Get("Via"); v != "1.1 "+DefaultName {
+		t.Errorf("response Via: %q", v)
+	}
+}
+
+// TestConnect は CONNECT でトンネルを張り、200 の直後に送ったバイトも含めて転送先と読み書きできることを確認します。
+func TestConnect(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	p := New()
+	// トンネルを閉じたときのログはテストの終了後に出ることがあるため捨てる
+	p.Logf = func(string, ...any) {}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	target := echo.Addr().String()
+	// 応答を待たずにトンネルの中身を送る（bufio に先読みされたバイトも転送されること）
+	io.WriteString(conn, "CONNECT "+target+" HTTP/1.1\r\nHost: "+target+"\r\n\r\nping")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Via") != "1.1 "+DefaultName {
+		t.Fatalf("CONNECT: %d %v", resp.StatusCode, resp.Header)
+	}
+	io.WriteString(conn, "pong")
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "pingpong" {
+		t.Errorf("tunnel: %q %v", buf, err)
+	}
+
+	r := httptest.NewRequest(http.MethodConnect, "http://example.com", nil)
+	r.RequestURI = "example.com"
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("CONNECT without a port: %d", w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serveConnect は CONNECT のトンネルを張り、終わったら転送したバイト数を記録します。
+func (p *Proxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	target := r.RequestURI
+	if _, port, err := net.SplitHostPort(target); err != nil || port == "" {
+		http.Error(w, "CONNECT target must be host:port", http.StatusBadRequest)
+		return
+	}
+	var upstream net.Conn
+	if p.Interceptor == nil {
+		timeout := p.DialTimeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		var err error
+		upstream, err = net.DialTimeout("tcp", target, timeout)
+		if err != nil {
+			p.logf("tunnel: %s → %s: %v", r.RemoteAddr, target, err)
+			http.Error(w, "proxy: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	client, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		if upstream != nil {
+			upstream.Close()
+		}
+		// HTTP/2 の接続などはハイジャックできない
+		http.Error(w, "proxy: CONNECT is not supported on this connection", http.StatusNotImplemented)
+		return
+	}
+	// サーバーの読み書きのタイムアウトをトンネルに持ち込まない
+	client.SetDeadline(time.Time{})
+
+	id := p.tunnels.Add(1)
+	start := time.Now()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\nVia: "+p.via(1, 1)+"\r\n\r\n"); err != nil {
+		client.Close()
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+
+	// CONNECT の直後にクライアントが送ったバイト（TLS の ClientHello など）が bufio に残っていれば先に送る
+	var fromClient io.Reader = client
+	if n := buffered.Reader.Buffered(); n > 0 {
+		head, _ := buffered.Reader.Peek(n)
+		fromClient = io.MultiReader(bytes.NewReader(head), client)
+	}
+
+	if p.Interceptor != nil {
+		p.logf("tunnel #%d: %s → %s を傍受します", id, r.RemoteAddr, target)
+		counted := &countingConn{Conn: client, r: fromClient}
+		if err := p.Interceptor.Intercept(counted, target); err != nil {
+			p.logf("tunnel #%d: %s → %s: %v", id, r.RemoteAddr, target, err)
+		}
+		client.Close()
+		p.logf("tunnel #%d: %s → %s を閉じました（受信 %d バイト / 送信 %d バイト, %v）",
+			id, r.RemoteAddr, target, counted.read.Load(), counted.written.Load(), time.Since(start).Round(time.Millisecond))
+		return
+	}
+
+	p.logf("tunnel #%d: %s → %s を開きました", id, r.RemoteAddr, target)
+	up, down := pipe(client, fromClient, upstream)
+	p.logf("tunnel #%d: %s → %s を閉じました（送信 %d バイト / 受信 %d バイト, %v）",
+		id, r.RemoteAddr, target, up, down, time.Since(start).Round(time.Millisecond))
+}
+
+// pipe は 2 方向のコピーを行い、両方が終わるまで待ってからそれぞれのバイト数を返します。
+// 片方向が終わったら相手側の書き込みだけを閉じ（half-close）、もう片方向の残りを流し切ります。
+func pipe(client net.Conn, fromClient io.Reader, upstream net.Conn) (up, down int64) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		up, _ = io.Copy(upstream, fromClient)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		down, _ = io.Copy(client, upstream)
+		closeWrite(client)
+	}()
+	wg.Wait()
+	client.Close()
+	upstream.Close()
+	return up, down
+}
+
+// closeWrite は書き込み側だけを閉じます（できない接続は全体を閉じます）。
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	c.Close()
+}
+
+// countingConn は先読み済みのバイトを含めてクライアントとの接続を読み書きし、そのバイト数を数えます。
+type countingConn struct {
+	net.Conn
+	r             io.Reader
+	read, written atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,336 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultIgnoreHeaders は既定で比較しないヘッダです（実行のたびに変わるもの）。
+var DefaultIgnoreHeaders = []string{"Date", "Server"}
+
+// Options は比較の設定です。
+type Options struct {
+	// IgnoreHeaders は比較しないヘッダ名です（大文字小文字は区別しません）。
+	IgnoreHeaders []string
+	// IgnoreJSONPaths は比較しない JSON の位置です（例: $.id、$.items[*].updatedAt）。
+	// 指定した位置より下もすべて無視します。"*" は任意のキー、"[*]" は任意の添字に一致します。
+	IgnoreJSONPaths []string
+	// Body はボディの比較方法です（"auto" / "json" / "text" / "none"）。
+	// auto は両方の Content-Type が JSON なら json、それ以外は text で比べます。
+	Body string
+	// ContextLines はテキストの差分で変更行の前後に表示する行数です。
+	ContextLines int
+}
+
+// Difference は 1 つの違いです。
+type Difference struct {
+	Kind string `json:"kind"` // "error" / "status" / "header" / "body"
+	Name string `json:"name,omitempty"`
+	A    string `json:"a,omitempty"`
+	B    string `json:"b,omitempty"`
+	// Diff はテキストのボディの差分（"- " が A のみ、"+ " が B のみの行）です。
+	Diff string `json:"diff,omitempty"`
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Diff != "":
+		return d.Kind + ":\n" + d.Diff
+	case d.Kind == "body":
+		// JSON の値は jsonText で表記済み
+		return fmt.Sprintf("%s %s: %s != %s", d.Kind, d.Name, d.A, d.B)
+	case d.Name != "":
+		return fmt.Sprintf("%s %s: %q != %q", d.Kind, d.Name, d.A, d.B)
+	default:
+		return fmt.Sprintf("%s: %q != %q", d.Kind, d.A, d.B)
+	}
+}
+
+// Compare は 2 つのレスポンスを比べ、違いを返します。
+func Compare(a, b Result, opts Options) []Difference {
+	var out []Difference
+	if a.Err != nil || b.Err != nil {
+		return []Difference{{Kind: "error", A: errString(a.Err), B: errString(b.Err)}}
+	}
+	if a.Status != b.Status {
+		out = append(out, Difference{Kind: "status", A: strconv.Itoa(a.Status), B: strconv.Itoa(b.Status)})
+	}
+	out = append(out, compareHeaders(a.Header, b.Header, opts.IgnoreHeaders)...)
+
+	mode := opts.Body
+	if mode == "" || mode == "auto" {
+		mode = "text"
+		if isJSON(a.Header) && isJSON(b.Header) {
+			mode = "json"
+		}
+	}
+	switch mode {
+	case "none":
+	case "json":
+		out = append(out, compareJSON(a.Body, b.Body, opts.IgnoreJSONPaths)...)
+	default:
+		if !bytes.Equal(a.Body, b.Body) {
+			ctx := opts.ContextLines
+			if ctx <= 0 {
+				ctx = 2
+			}
+			out = append(out, Difference{Kind: "body", Diff: textDiff(string(a.Body), string(b.Body), ctx)})
+		}
+	}
+	return out
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func isJSON(h http.Header) bool {
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+// compareHeaders は同名ヘッダの値を出現順に ", " でつないで比べます。
+func compareHeaders(a, b http.Header, ignore []string) []Difference {
+	skip := map[string]bool{}
+	for _, name := range ignore {
+		skip[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+	names := map[string]bool{}
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if !skip[name] {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+
+	var out []Difference
+	for _, name := range sorted {
+		va, vb := strings.Join(a.Values(name), ", "), strings.Join(b.Values(name), ", ")
+		if va != vb {
+			out = append(out, Difference{Kind: "header", Name: name, A: va, B: vb})
+		}
+	}
+	return out
+}
+
+// compareJSON は JSON として比べ、値の違う位置ごとに違いを返します（キーの順序や空白は無視されます）。
+// どちらかが JSON として読めなければテキストとして比べます。
+func compareJSON(a, b []byte, ignore []string) []Difference {
+	va, errA := decodeJSON(a)
+	vb, errB := decodeJSON(b)
+	if errA != nil || errB != nil {
+		if bytes.Equal(a, b) {
+			return nil
+		}
+		return []Difference{{Kind: "body", Diff: textDiff(string(a), string(b), 2)}}
+	}
+	var out []Difference
+	walkJSON("$", va, vb, ignore, &out)
+	return out
+}
+
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // 大きな整数や小数の表記の違いで誤差が出ないように
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func walkJSON(at string, a, b any, ignore []string, out *[]Difference) {
+	if ignoredPath(at, ignore) {
+		return
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range av {
+			keys[k] = true
+		}
+		for k := range bv {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			child := at + "." + k
+			x, inA := av[k]
+			y, inB := bv[k]
+			switch {
+			case ignoredPath(child, ignore):
+			case !inA:
+				*out = append(*out, Difference{Kind: "body", Name: child, A: "(なし)", B: jsonText(y)})
+			case !inB:
+				*out = append(*out, Difference{Kind: "body", Name: child, A: jsonText(x), B: "(なし)"})
+			default:
+				walkJSON(child, x, y, ignore, out)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		n := max(len(av), len(bv))
+		for i := 0; i < n; i++ {
+			child := at + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(av):
+				*out = append(*out, Difference{Kind: "body", Name: child, A: "(なし)", B: jsonText(bv[i])})
+			case i >= len(bv):
+				*out = append(*out, Difference{Kind: "body", Name: child, A: jsonText(av[i]), B: "(なし)"})
+			default:
+				walkJSON(child, av[i], bv[i], ignore, out)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, Difference{Kind: "body", Name: at, A: jsonText(a), B: jsonText(b)})
+	}
+}
+
+// ignoredPath は at が無視する位置（またはその下）かどうかです。
+func ignoredPath(at string, ignore []string) bool {
+	segs := splitJSONPath(at)
+	for _, pattern := range ignore {
+		ps := splitJSONPath(pattern)
+		if len(ps) > len(segs) {
+			continue
+		}
+		matched := true
+		for i, p := range ps {
+			if !segmentMatch(p, segs[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentMatch は位置の 1 要素を比べます。"*" は任意のキー、"[*]" は任意の添字に一致します。
+func segmentMatch(pattern, seg string) bool {
+	switch pattern {
+	case "*":
+		return !strings.HasPrefix(seg, "[")
+	case "[*]":
+		return strings.HasPrefix(seg, "[")
+	}
+	return pattern == seg
+}
+
+// splitJSONPath は "$.a.b[2]" を ["$", "a", "b", "[2]"] に分けます。
+func splitJSONPath(p string) []string {
+	return strings.Split(strings.ReplaceAll(p, "[", ".["), ".")
+}
+
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// maxDiffCells は行単位の差分に使う表（A の行数 × B の行数）の上限です。
+const maxDiffCells = 4_000_000
+
+// textDiff は行単位の差分を返します。一致する行は変更の前後 context 行だけを残します。
+func textDiff(a, b string, context int) string {
+	la, lb := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if len(la)*len(lb) > maxDiffCells {
+		return fmt.Sprintf("（大きすぎるため差分を省略: %d バイト / %d バイト）", len(a), len(b))
+	}
+	// 最長共通部分列の長さの表を後ろから作る
+	lcs := make([][]int, len(la)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lb)+1)
+	}
+	for i := len(la) - 1; i >= 0; i-- {
+		for j := len(lb) - 1; j >= 0; j-- {
+			if la[i] == lb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	type line struct {
+		op   byte // ' ' / '-' / '+'
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(la) || j < len(lb) {
+		switch {
+		case i < len(la) && j < len(lb) && la[i] == lb[j]:
+			lines = append(lines, line{' ', la[i]})
+			i++
+			j++
+		case i < len(la) && (j == len(lb) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', la[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', lb[j]})
+			j++
+		}
+	}
+
+	keep := make([]bool, len(lines))
+	for k, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		for c := max(0, k-context); c <= min(len(lines)-1, k+context); c++ {
+			keep[c] = true
+		}
+	}
+	var sb strings.Builder
+	skipped := false
+	for k, l := range lines {
+		if !keep[k] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			sb.WriteString("  …\n")
+			skipped = false
+		}
+		sb.WriteByte(l.op)
+		sb.WriteByte(' ')
+		sb.WriteString(l.text)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
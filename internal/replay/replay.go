@@ -0,0 +1,171 @@
+// パッケージ replay は、server.go が記録したリクエスト（capture.Record）を別のサーバーへ送り直し、
+// レスポンスを比較するための部品です。cmd/replay から使います。
+//
+// 2 つの送り先に同じリクエストを送ってステータス・ヘッダ・ボディを比べることで、
+// リポジトリのサーバーを参照実装として、新しい実装が同じ振る舞いをするかを自動で確かめられます。
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"real-world-http-learn/internal/capture"
+	"real-world-http-learn/internal/proxy"
+)
+
+// Load は記録を読み込みます。src は -capture で書き出した JSONL ファイルか、
+// 記録中のサーバーの /_captures の URL（http:// または https://）です。
+func Load(src string) ([]capture.Record, error) {
+	var r io.Reader
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		u, err := url.Parse(src)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("format", "jsonl")
+		u.RawQuery = q.Encode()
+		resp, err := http.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("replay: GET %s: %s", u, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var records []capture.Record
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*capture.DefaultMaxBody)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec capture.Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("replay: %s:%d: %w", src, line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
+
+// NewRequest は rec を base（スキーム・ホスト・パスの接頭辞）へ送るリクエストにします。
+// パスは記録したエスケープのまま送ります（/a%2Fb を /a/b に変えません）。
+// 接続ごとのヘッダ（proxy.RemoveHopHeaders）と Content-Length は引き継がず、
+// 記録したボディはデコード済みのため、Content-Encoding も外して送ります。
+func NewRequest(rec capture.Record, base *url.URL) (*http.Request, error) {
+	target, err := url.Parse(rec.Target)
+	if err != nil {
+		return nil, err
+	}
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + target.Path
+	u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + target.EscapedPath()
+	u.RawQuery = target.RawQuery
+
+	body, err := rec.BodyBytes()
+	if err != nil {
+		return nil, err
+	}
+	if rec.BodyTruncated {
+		return nil, fmt.Errorf("replay: record %d: body was truncated when captured", rec.ID)
+	}
+	req, err := http.NewRequest(rec.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = rec.Header()
+	proxy.RemoveHopHeaders(req.Header)
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Encoding")
+	return req, nil
+}
+
+// Result は 1 回分のレスポンスです。
+type Result struct {
+	Status     int
+	Header     http.Header
+	Body       []byte
+	DurationMs float64
+	Err        error
+}
+
+// NewClient は送り直し用のクライアントを返します。
+// 記録と同じ 1 往復を比べるため、リダイレクトは追わず、gzip の自動展開もしません。
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment, DisableCompression: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// Do は rec を base へ送り、結果を返します。送信に失敗した場合は Result.Err に入ります。
+func Do(client *http.Client, rec capture.Record, base *url.URL) Result {
+	req, err := NewRequest(rec, base)
+	if err != nil {
+		return Result{Err: err}
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return Result{
+		Status:     resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Err:        err,
+	}
+}
+
+// Recorded は記録時のレスポンスを Result にします（送り先が 1 つのときの比較相手）。
+func Recorded(rec capture.Record) (Result, bool) {
+	if rec.Response == nil {
+		return Result{}, false
+	}
+	body, err := rec.Response.BodyBytes()
+	if rec.Response.BodyTruncated {
+		err = fmt.Errorf("replay: record %d: response body was truncated when captured", rec.ID)
+	}
+	return Result{Status: rec.Response.Status, Header: rec.Response.Header(), Body: body, Err: err}, true
+}
+
+// Select は記録をメソッド・パスの接頭辞・ID で絞り込みます（空・0 の条件は使いません）。
+func Select(records []capture.Record, method, pathPrefix string, ids map[int64]bool) []capture.Record {
+	var out []capture.Record
+	for _, rec := range records {
+		if method != "" && !strings.EqualFold(rec.Method, method) {
+			continue
+		}
+		if pathPrefix != "" && !strings.HasPrefix(rec.Target, pathPrefix) {
+			continue
+		}
+		if len(ids) > 0 && !ids[rec.ID] {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package replay
+
+import (
+	"net/url"
+	"testing"
+
+	"real-world-http-learn/internal/capture"
+)
+
+// TestNewRequest は記録したパスのエスケープを保ったまま base の接頭辞に続けることと、
+// 接続ごとのヘッダ・Content-Length・Content-Encoding を引き継がないことを確認します。
+func TestNewRequest(t *testing.T) {
+	rec := capture.Record{
+		Method: "POST",
+		Target: "/a%2Fb/c%20d?x=%2F",
+		HeaderLines: []string{
+			"Host: example.com",
+			"Connection: close, X-Hop",
+			"X-Hop: 1",
+			"Proxy-Authorization: Basic eDp5",
+			"Content-Length: 4",
+			"Content-Encoding: gzip",
+			"X-Keep: 1",
+		},
+		Body: "body",
+	}
+	tests := []struct {
+		base, want string
+	}{
+		{"http://localhost:8080", "http://localhost:8080/a%2Fb/c%20d?x=%2F"},
+		{"http://localhost:8080/api/", "http://localhost:8080/api/a%2Fb/c%20d?x=%2F"},
+		{"http://localhost:8080/v%2F1", "http://localhost:8080/v%2F1/a%2Fb/c%20d?x=%2F"},
+	}
+	for _, tt := range tests {
+		base, _ := url.Parse(tt.base)
+		req, err := NewRequest(rec, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.URL.String(); got != tt.want {
+			t.Errorf("base %s: %s, want %s", tt.base, got, tt.want)
+		}
+	}
+
+	base, _ := url.Parse("http://localhost:8080")
+	req, _ := NewRequest(rec, base)
+	for _, name := range []string{"Connection", "X-Hop", "Proxy-Authorization", "Content-Length", "Content-Encoding"} {
+		if v := req.Header.Get(name); v != "" {
+			t.Errorf("%s: %q was copied", name, v)
+		}
+	}
+	if req.Header.Get("X-Keep") != "1" || req.ContentLength != 4 {
+		t.Errorf("header %v, length %d", req.Header, req.ContentLength)
+	}
+
+	rec.BodyTruncated = true
+	if _, err := NewRequest(rec, base); err == nil {
+		t.Error("truncated body was replayed")
+	}
+}
@@ -0,0 +1,455 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxBodySize は一致したリクエストのボディ（テンプレートの .Body）と、/_rules に送るルールの最大バイト数です。
+// 超えた場合は 413 で応答します。
+const MaxBodySize = 1 << 20
+
+// Engine は現在有効なルール一覧を保持し、リクエストに応答します。
+// ルールはファイルからの読み込み（Watch でホットリロード）と /_rules からの操作の両方で更新できます。
+type Engine struct {
+	mu      sync.RWMutex
+	rules   []compiled
+	file    string
+	modTime time.Time
+}
+
+// NewEngine は空のルールを持つ Engine を返します。
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Load はファイルからルールを読み込んで置き換えます。以後 Reload と Watch はこのファイルを対象にします。
+func (e *Engine) Load(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	rules, err := LoadFile(name)
+	if err != nil {
+		return err
+	}
+	if err := e.Set(rules); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.file, e.modTime = name, info.ModTime()
+	e.mu.Unlock()
+	return nil
+}
+
+// Reload は Load したファイルを読み直します。
+func (e *Engine) Reload() error {
+	e.mu.RLock()
+	name := e.file
+	e.mu.RUnlock()
+	if name == "" {
+		return errNoFile
+	}
+	return e.Load(name)
+}
+
+var errNoFile = &adminError{http.StatusConflict, "no rules file loaded"}
+
+// Watch は interval ごとにルールファイルの更新時刻を確認し、変わっていれば読み直します。
+// 読み込みに失敗した場合は直前のルールを使い続けます。ctx が終了すると戻ります。
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		e.mu.RLock()
+		name, last := e.file, e.modTime
+		e.mu.RUnlock()
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || info.ModTime().Equal(last) {
+			continue
+		}
+		if err := e.Load(name); err != nil {
+			log.Printf("rules: reload %s: %v（以前のルールを継続）", name, err)
+			continue
+		}
+		log.Printf("rules: reloaded %s (%d rules)", name, len(e.Rules()))
+	}
+}
+
+// Set はルール一覧を検証して置き換えます。
+func (e *Engine) Set(rules []Rule) error {
+	c, err := compile(rules)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.rules = c
+	e.mu.Unlock()
+	return nil
+}
+
+// Update は現在のルール一覧を f で変更したものに置き換えます。読み出しから置き換えまでロックを保つので、
+// /_rules の操作どうしや、ファイルの読み直しと同時に行われても変更が失われません。
+func (e *Engine) Update(f func([]Rule) []Rule) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	current := make([]Rule, len(e.rules))
+	for i, c := range e.rules {
+		current[i] = c.Rule
+	}
+	c, err := compile(f(current))
+	if err != nil {
+		return err
+	}
+	e.rules = c
+	return nil
+}
+
+// Rules は現在のルール一覧を返します。
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make([]Rule, len(e.rules))
+	for i, c := range e.rules {
+		out[i] = c.Rule
+	}
+	return out
+}
+
+// find は r に最初に一致したルールを返します。
+func (e *Engine) find(r *http.Request) (compiled, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, c := range e.rules {
+		if c.Match.matches(r) {
+			return c, true
+		}
+	}
+	return compiled{}, false
+}
+
+func (m Match) matches(r *http.Request) bool {
+	if len(m.Methods) > 0 {
+		ok := false
+		for _, method := range m.Methods {
+			if strings.EqualFold(method, r.Method) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if m.Path != "" {
+		if ok, _ := path.Match(m.Path, r.URL.Path); !ok {
+			return false
+		}
+	}
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+	for name, want := range m.Headers {
+		if !valueMatches(r.Header.Values(name), want) {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for name, want := range m.Query {
+		if !valueMatches(query[name], want) {
+			return false
+		}
+	}
+	return true
+}
+
+func valueMatches(values []string, want string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	if want == "*" {
+		return true
+	}
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware はルールに一致したリクエストにルールの内容で応答し、一致しなければ next に渡します。
+// "/_" で始まる管理用パスにはルールを適用しません。
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/_") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rule, ok := e.find(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		log.Printf("rules: %s %s → %s", r.Method, r.URL.Path, rule.Name)
+		rule.serve(w, r)
+	})
+}
+
+// TemplateData はボディテンプレートに渡す値です。
+type TemplateData struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+	Rule   string
+	Now    time.Time
+}
+
+func (c compiled) serve(w http.ResponseWriter, r *http.Request) {
+	reqBody, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	if err != nil {
+		http.Error(w, "rules: request body: "+err.Error(), bodyErrorStatus(err))
+		return
+	}
+	var body bytes.Buffer
+	err = c.body.Execute(&body, TemplateData{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header,
+		Body:   string(reqBody),
+		Rule:   c.Name,
+		Now:    time.Now(),
+	})
+	if err != nil {
+		http.Error(w, "rules: template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !sleep(r.Context(), c.delay) {
+		return
+	}
+
+	// ヘッダは記述どおりの綴りで送るため、正規化せずに map へ直接入れる。
+	// ただし net/http がフレーミングや自動付与の判断に使うヘッダは正規化した名前にまとめる
+	// （"content-length" のままだと自動の Content-Length と重複し、長さの食い違う応答になる）
+	h := w.Header()
+	for _, hd := range c.Response.Headers {
+		name := hd.Name
+		if canonical := http.CanonicalHeaderKey(name); framingHeaders[canonical] {
+			name = canonical
+		}
+		h[name] = append(h[name], hd.Value)
+	}
+	if h.Get("Content-Type") == "" && body.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(body.Bytes()))
+	}
+	if h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" && c.Response.ChunkSize == 0 {
+		// 途中切断のときもクライアントが「本来の長さ」を知れるよう Content-Length を付ける
+		h.Set("Content-Length", strconv.Itoa(body.Len()))
+	}
+	status := c.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	payload := body.Bytes()
+	drop := -1
+	if c.Response.DropAfterBytes != nil {
+		drop = min(*c.Response.DropAfterBytes, len(payload))
+		payload = payload[:drop]
+	}
+	chunk := c.Response.ChunkSize
+	if chunk <= 0 {
+		chunk = len(payload)
+	}
+	rc := http.NewResponseController(w)
+	for len(payload) > 0 {
+		n := min(chunk, len(payload))
+		if _, err := w.Write(payload[:n]); err != nil {
+			return
+		}
+		payload = payload[n:]
+		if c.Response.ChunkSize > 0 {
+			_ = rc.Flush()
+			if len(payload) > 0 && !sleep(r.Context(), c.chunkDelay) {
+				return
+			}
+		}
+	}
+	if drop >= 0 {
+		// 書いた分を送り出してから接続を中断する（HTTP/2 ではストリームのリセット）
+		_ = rc.Flush()
+		log.Printf("rules: %s: dropped connection after %d bytes", c.Name, drop)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// framingHeaders は綴りを保たずに正規化して送るヘッダです。
+var framingHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Transfer-Encoding": true,
+}
+
+// sleep は d だけ待ちます。途中でクライアントが切断したら false を返します。
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// adminError は /_rules が返すエラーです。
+type adminError struct {
+	status int
+	msg    string
+}
+
+func (e *adminError) Error() string { return e.msg }
+
+// AdminHandler は /_rules の管理用ハンドラを返します。
+//
+//	GET    /_rules                 → 現在のルール一覧（JSON）
+//	PUT    /_rules                 → ルール一覧を置き換え（JSON または YAML）
+//	POST   /_rules                 → ルールを 1 件末尾に追加（?first=1 で先頭に追加）
+//	DELETE /_rules?name=moved      → 指定した名前のルールを削除（name 省略で全削除）
+//	POST   /_rules/reload          → ルールファイルを読み直す
+//
+// /_rules で加えた変更はメモリ上のみです。ファイルが更新されるとファイルの内容で置き換わります。
+func (e *Engine) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		switch {
+		case r.URL.Path == "/_rules/reload" && r.Method == http.MethodPost:
+			err = e.Reload()
+		case r.URL.Path != "/_rules":
+			http.NotFound(w, r)
+			return
+		case r.Method == http.MethodGet:
+		case r.Method == http.MethodPut:
+			var rules []Rule
+			if rules, err = readRules(w, r); err == nil {
+				err = e.Set(rules)
+			}
+		case r.Method == http.MethodPost:
+			var rule Rule
+			if rule, err = readRule(w, r); err == nil {
+				first := r.URL.Query().Get("first") != ""
+				err = e.Update(func(current []Rule) []Rule {
+					if first {
+						return append([]Rule{rule}, current...)
+					}
+					return append(current, rule)
+				})
+			}
+		case r.Method == http.MethodDelete:
+			name := r.URL.Query().Get("name")
+			err = e.Update(func(current []Rule) []Rule {
+				var kept []Rule
+				for _, rule := range current {
+					if name != "" && rule.Name != name {
+						kept = append(kept, rule)
+					}
+				}
+				return kept
+			})
+		default:
+			http.Error(w, "GET, PUT, POST or DELETE only", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			if ae, ok := err.(*adminError); ok {
+				status = ae.status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(e.Rules())
+	})
+}
+
+// bodyFormat は Content-Type からリクエストボディの形式を判断します。
+func bodyFormat(r *http.Request) string {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt == "application/json" {
+		return "json"
+	}
+	return "yaml"
+}
+
+// bodyErrorStatus はボディの読み込みエラーに返すステータスコードです。
+func bodyErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// readBody は /_rules に送られたボディを MaxBodySize まで読みます。
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	if err != nil {
+		return nil, &adminError{bodyErrorStatus(err), err.Error()}
+	}
+	return data, nil
+}
+
+func readRules(w http.ResponseWriter, r *http.Request) ([]Rule, error) {
+	data, err := readBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, bodyFormat(r))
+}
+
+func readRule(w http.ResponseWriter, r *http.Request) (Rule, error) {
+	data, err := readBody(w, r)
+	if err != nil {
+		return Rule{}, err
+	}
+	var rule Rule
+	if err := decode(data, bodyFormat(r), &rule); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
@@ -0,0 +1,186 @@
+// パッケージ rules は、server.go の応答をルールファイルで切り替えるための小さなルールエンジンです。
+// メソッド・パス・ヘッダ・クエリでリクエストを照合し、ステータス・ヘッダ・テンプレート化したボディ・
+// 遅延・低速送信・ボディ途中での切断などを返せるようにします。
+// これにより ch04 のクライアントから、リダイレクトや 4xx/5xx、遅いレスポンスを観察できます。
+//
+// ルールは YAML か JSON で記述し、先頭から順に評価して最初に一致したものを使います。
+// 記述例はリポジトリ直下の rules.example.yaml を参照してください。
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule は照合条件と応答内容の組です。
+type Rule struct {
+	Name     string   `json:"name" yaml:"name"`
+	Match    Match    `json:"match" yaml:"match"`
+	Response Response `json:"response" yaml:"response"`
+}
+
+// Match はリクエストの照合条件です。空のフィールドは条件に含めません（すべて AND）。
+type Match struct {
+	// Methods のいずれかに一致すること（大文字小文字は区別しない）。"GET" のように 1 つだけでも書けます。
+	Methods StringList `json:"method,omitempty" yaml:"method,omitempty"`
+	// Path は path.Match 形式のパターン（例: /users/*）。完全一致にもなります。
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// PathPrefix はパスの前方一致です。
+	PathPrefix string `json:"pathPrefix,omitempty" yaml:"pathPrefix,omitempty"`
+	// Headers は名前 → 値。値が "*" なら存在だけを確認します。
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Query は名前 → 値。値が "*" なら存在だけを確認します。
+	Query map[string]string `json:"query,omitempty" yaml:"query,omitempty"`
+}
+
+// StringList は文字列 1 つ、または文字列の配列として書ける値です。
+type StringList []string
+
+// UnmarshalYAML は "GET" と [GET, HEAD] の両方を受け付けます。
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var s string
+		if err := node.Decode(&s); err != nil {
+			return err
+		}
+		*l = StringList{s}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// UnmarshalJSON は "GET" と ["GET", "HEAD"] の両方を受け付けます。
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Response は一致したときの応答内容です。
+type Response struct {
+	Status int `json:"status,omitempty" yaml:"status,omitempty"`
+	// Headers は記述どおりの大文字小文字で送信します（重複も可）。同名のヘッダは記述順に並びますが、
+	// ヘッダ同士の順序は net/http が名前でソートするため記述順にはなりません。
+	// Content-Length・Content-Type・Transfer-Encoding だけは正規化した名前で送ります。
+	Headers []Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Body は text/template として評価します（TemplateData を参照）。
+	Body string `json:"body,omitempty" yaml:"body,omitempty"`
+	// Delay はヘッダ送信前に待つ時間です（例: "1.5s"）。
+	Delay string `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// ChunkSize と ChunkDelay を指定すると、ボディを少しずつ Flush しながら送ります。
+	ChunkSize  int    `json:"chunkSize,omitempty" yaml:"chunkSize,omitempty"`
+	ChunkDelay string `json:"chunkDelay,omitempty" yaml:"chunkDelay,omitempty"`
+	// DropAfterBytes を指定すると、そのバイト数だけ送ったところで接続を切断します。
+	DropAfterBytes *int `json:"dropAfterBytes,omitempty" yaml:"dropAfterBytes,omitempty"`
+}
+
+// Header は送信するヘッダ 1 行です。
+type Header struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// compiled は検証済みのルールです。テンプレートと時間をあらかじめ解釈しておきます。
+type compiled struct {
+	Rule
+	body       *template.Template
+	delay      time.Duration
+	chunkDelay time.Duration
+}
+
+func compile(rules []Rule) ([]compiled, error) {
+	out := make([]compiled, 0, len(rules))
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if r.Match.Path != "" {
+			if _, err := path.Match(r.Match.Path, "/"); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid path pattern: %w", name, err)
+			}
+		}
+		if r.Response.Status != 0 && (r.Response.Status < 100 || r.Response.Status > 999) {
+			return nil, fmt.Errorf("rule %s: invalid status %d", name, r.Response.Status)
+		}
+		tmpl, err := template.New(name).Parse(r.Response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: body template: %w", name, err)
+		}
+		c := compiled{Rule: r, body: tmpl}
+		if c.delay, err = parseDuration(r.Response.Delay); err != nil {
+			return nil, fmt.Errorf("rule %s: delay: %w", name, err)
+		}
+		if c.chunkDelay, err = parseDuration(r.Response.ChunkDelay); err != nil {
+			return nil, fmt.Errorf("rule %s: chunkDelay: %w", name, err)
+		}
+		c.Name = name
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Parse は data を YAML または JSON としてルール一覧に変換します。
+// format が "json" なら JSON、それ以外は YAML（JSON は YAML のサブセットなのでどちらも読めます）。
+func Parse(data []byte, format string) ([]Rule, error) {
+	var rules []Rule
+	if err := decode(data, format, &rules); err != nil {
+		return nil, err
+	}
+	if _, err := compile(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func decode(data []byte, format string, v any) error {
+	if format == "json" {
+		return json.Unmarshal(data, v)
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+// LoadFile は拡張子（.json / .yaml / .yml）に応じてルールファイルを読み込みます。
+func LoadFile(name string) ([]Rule, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		return Parse(data, "json")
+	case ".yaml", ".yml":
+		return Parse(data, "yaml")
+	default:
+		return nil, errors.New("rules: unsupported file extension " + ext)
+	}
+}
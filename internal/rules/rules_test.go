@@ -0,0 +1,313 @@
+package rules
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustEngine(t *testing.T, rules []Rule) *Engine {
+	t.Helper()
+	e := NewEngine()
+	if err := e.Set(rules); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// rawGet は path を GET し、ステータス行とヘッダ行を送られたとおりに返します。
+func rawGet(t *testing.T, srv *httptest.Server, path string) []string {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	var lines []string
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if err != nil || line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// TestServeHeaders は記述どおりの綴りで送ることと、小文字で書いた Content-Length・Content-Type が
+// 自動で付けるものと重複しないことを確認します。
+func TestServeHeaders(t *testing.T) {
+	e := mustEngine(t, []Rule{
+		{Name: "odd", Match: Match{Path: "/odd"}, Response: Response{
+			Headers: []Header{{"x-lower-case", "as-is"}, {"X-Dup", "1"}, {"X-Dup", "2"}},
+			Body:    "odd",
+		}},
+		{Name: "lower", Match: Match{Path: "/lower"}, Response: Response{
+			Headers: []Header{{"content-length", "3"}, {"content-type", "text/x-rule"}},
+			Body:    "abc",
+		}},
+	})
+	srv := httptest.NewServer(e.Middleware(http.NotFoundHandler()))
+	defer srv.Close()
+
+	count := func(lines []string, name string) (n int) {
+		for _, line := range lines {
+			if k, _, _ := strings.Cut(line, ":"); strings.EqualFold(k, name) {
+				n++
+			}
+		}
+		return n
+	}
+	lines := rawGet(t, srv, "/odd")
+	if !strings.Contains(strings.Join(lines, "\n"), "x-lower-case: as-is") || count(lines, "X-Dup") != 2 {
+		t.Errorf("/odd: %q", lines)
+	}
+	lines = rawGet(t, srv, "/lower")
+	if count(lines, "Content-Length") != 1 || count(lines, "Content-Type") != 1 || !strings.Contains(strings.Join(lines, "\n"), "Content-Type: text/x-rule") {
+		t.Errorf("/lower: %q", lines)
+	}
+}
+
+// TestParseMethod は method を 1 つの文字列でも配列でも書けることを確認します。
+func TestParseMethod(t *testing.T) {
+	tests := []struct {
+		data, format string
+		want         []string
+	}{
+		{"- match: {method: GET}", "yaml", []string{"GET"}},
+		{"- match: {method: [GET, HEAD]}", "yaml", []string{"GET", "HEAD"}},
+		{`[{"match": {"method": "POST"}}]`, "json", []string{"POST"}},
+		{`[{"match": {"method": ["PUT", "PATCH"]}}]`, "json", []string{"PUT", "PATCH"}},
+	}
+	for _, tt := range tests {
+		rules, err := Parse([]byte(tt.data), tt.format)
+		if err != nil || len(rules) != 1 || strings.Join(rules[0].Match.Methods, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Parse(%q) = %+v, %v", tt.data, rules, err)
+		}
+	}
+	if _, err := Parse([]byte("- match: {method: {a: b}}"), "yaml"); err == nil {
+		t.Error("a mapping was accepted as method")
+	}
+	if _, err := LoadFile("../../rules.example.yaml"); err != nil {
+		t.Errorf("rules.example.yaml: %v", err)
+	}
+}
+
+// TestMatch はメソッド・パス・前方一致・ヘッダ・クエリの照合と、先頭から評価して最初に一致したルールを使うことを確認します。
+func TestMatch(t *testing.T) {
+	e := mustEngine(t, []Rule{
+		{Name: "post-only", Match: Match{Methods: StringList{"post"}, Path: "/users/*"}},
+		{Name: "header", Match: Match{Headers: map[string]string{"X-Debug": "1"}}},
+		{Name: "query", Match: Match{PathPrefix: "/search", Query: map[string]string{"q": "*"}}},
+		{Name: "prefix", Match: Match{PathPrefix: "/search"}},
+	})
+	tests := []struct {
+		method, target string
+		header         string
+		want           string
+	}{
+		{"POST", "/users/1", "", "post-only"},
+		{"GET", "/users/1", "", ""},
+		{"POST", "/users/1/x", "", ""},
+		{"GET", "/any", "1", "header"},
+		{"GET", "/any", "0", ""},
+		{"GET", "/search/a?q=", "", "query"},
+		{"GET", "/search/a?x=1", "", "prefix"},
+		{"POST", "/users/2", "1", "post-only"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.header != "" {
+			r.Header.Set("X-Debug", tt.header)
+		}
+		if rule, _ := e.find(r); rule.Name != tt.want {
+			t.Errorf("%s %s (X-Debug %q) = %q, want %q", tt.method, tt.target, tt.header, rule.Name, tt.want)
+		}
+	}
+	if err := e.Set([]Rule{{Match: Match{Path: "["}}}); err == nil {
+		t.Error("invalid path pattern was accepted")
+	}
+}
+
+// TestServe はボディのテンプレート・ステータス・大きすぎるボディの拒否・HEAD・途中での切断と、一致しないリクエストが next に渡ることを確認します。
+func TestServe(t *testing.T) {
+	drop := 4
+	e := mustEngine(t, []Rule{
+		{Name: "echo", Match: Match{Path: "/echo"}, Response: Response{
+			Status: http.StatusTeapot,
+			Body:   `{{ .Method }} {{ .Path }} q={{ .Query.Get "q" }} ua={{ .Header.Get "User-Agent" }} body={{ .Body }} rule={{ .Rule }}`,
+		}},
+		{Match: Match{Path: "/broken"}, Response: Response{Body: "0123456789", DropAfterBytes: &drop}},
+		{Match: Match{Path: "/_rules"}, Response: Response{Status: http.StatusGone}},
+	})
+	srv := httptest.NewServer(e.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "next")
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/echo?q=1", strings.NewReader("hi"))
+	req.Header.Set("User-Agent", "test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot || string(body) != "POST /echo q=1 ua=test body=hi rule=echo" ||
+		resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("/echo: %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+
+	resp, err = http.Post(srv.URL+"/echo", "text/plain", strings.NewReader(strings.Repeat("x", MaxBodySize+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("/echo with a large body: %d", resp.StatusCode)
+	}
+
+	resp, err = http.Head(srv.URL + "/echo")
+	if err != nil || resp.StatusCode != http.StatusTeapot || resp.ContentLength <= 0 {
+		t.Errorf("HEAD /echo: %v %v", resp, err)
+	}
+
+	resp, err = http.Get(srv.URL + "/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "0123" || err == nil || resp.ContentLength != 10 {
+		t.Errorf("/broken: %q %v (length %d)", body, err, resp.ContentLength)
+	}
+
+	for _, path := range []string{"/other", "/_rules"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "next" {
+			t.Errorf("%s: %d %q", path, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestWatch はルールファイルが更新されたら読み直し、壊れた内容なら直前のルールを使い続けることを確認します。
+func TestWatch(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rules.yaml")
+	write := func(data string, age time.Duration) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// 更新時刻の分解能が粗いファイルシステムでも変化が分かるよう、時刻をずらす
+		mtime := time.Now().Add(age)
+		os.Chtimes(name, mtime, mtime)
+	}
+	write("- name: v1\n  match: {path: /}\n", -time.Hour)
+	e := NewEngine()
+	if err := e.Load(name); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, 5*time.Millisecond)
+
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if rules := e.Rules(); len(rules) == 1 && rules[0].Name == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("rules = %+v, want %s", e.Rules(), want)
+	}
+	write("- name: v2\n  match: {path: /}\n", -time.Minute)
+	waitFor("v2")
+	write("- name: [broken\n", 0)
+	time.Sleep(50 * time.Millisecond)
+	waitFor("v2")
+}
+
+// TestAdminHandler は /_rules の一覧・置き換え・追加・削除・大きすぎるボディの拒否と、同時に追加しても失われないことを確認します。
+func TestAdminHandler(t *testing.T) {
+	e := NewEngine()
+	srv := httptest.NewServer(e.AdminHandler())
+	defer srv.Close()
+
+	do := func(method, target, contentType, body string) (int, []Rule) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+target, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var rules []Rule
+		json.NewDecoder(resp.Body).Decode(&rules)
+		return resp.StatusCode, rules
+	}
+	names := func(rules []Rule) string {
+		var out []string
+		for _, r := range rules {
+			out = append(out, r.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	if code, rules := do(http.MethodPut, "/_rules", "", "- name: a\n- name: b\n"); code != http.StatusOK || names(rules) != "a,b" {
+		t.Errorf("PUT: %d %s", code, names(rules))
+	}
+	if code, rules := do(http.MethodPost, "/_rules?first=1", "application/json", `{"name": "c", "match": {"method": "GET"}}`); code != http.StatusOK || names(rules) != "c,a,b" {
+		t.Errorf("POST first: %d %s", code, names(rules))
+	}
+	if code, _ := do(http.MethodPost, "/_rules", "", "name: bad\nresponse: {status: 42}\n"); code != http.StatusBadRequest {
+		t.Errorf("POST invalid rule: %d", code)
+	}
+	if code, rules := do(http.MethodDelete, "/_rules?name=a", "", ""); code != http.StatusOK || names(rules) != "c,b" {
+		t.Errorf("DELETE: %d %s", code, names(rules))
+	}
+	if code, _ := do(http.MethodPut, "/_rules", "", strings.Repeat("#", MaxBodySize+1)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT a large body: %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/_rules/reload", "", ""); code != http.StatusConflict {
+		t.Errorf("reload without a file: %d", code)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do(http.MethodPost, "/_rules", "", fmt.Sprintf("name: r%d\n", i))
+		}()
+	}
+	wg.Wait()
+	if _, rules := do(http.MethodGet, "/_rules", "", ""); len(rules) != 22 {
+		t.Errorf("after concurrent POSTs: %d rules (%s)", len(rules), names(rules))
+	}
+	if code, rules := do(http.MethodDelete, "/_rules", "", ""); code != http.StatusOK || len(rules) != 0 {
+		t.Errorf("DELETE all: %d %s", code, names(rules))
+	}
+}
@@ -0,0 +1,243 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"real-world-http-learn/internal/cookiecodec"
+)
+
+// Manager は Cookie とストアを結び付けてセッションの開始・保存・再生成・破棄を行います。
+type Manager struct {
+	Store SessionStore
+	// CookieName はセッション ID を運ぶ Cookie の名前です。
+	CookieName string
+	// TTL は最後のアクセスからセッションが失効するまでの時間です（アクセスのたびに延長します）。
+	TTL time.Duration
+	// Codec を指定すると Cookie の値（セッション ID）を署名します。nil なら ID をそのまま送ります。
+	Codec *cookiecodec.Codec
+	// Secure は Cookie に Secure 属性を付けるかどうかです（HTTPS で運用する場合は true）。
+	Secure bool
+}
+
+// Load は Cookie からセッションを読み出します。
+// Cookie がなければ http.ErrNoCookie、署名が不正なら cookiecodec のエラー、
+// ストアに存在しなければ ErrNotFound を返します。
+func (m *Manager) Load(r *http.Request) (*Session, error) {
+	id, err := m.readID(r)
+	if err != nil {
+		return nil, err
+	}
+	return m.Store.Get(id)
+}
+
+func (m *Manager) readID(r *http.Request) (string, error) {
+	if m.Codec != nil {
+		return m.Codec.ReadCookie(r, m.CookieName)
+	}
+	c, err := r.Cookie(m.CookieName)
+	if err != nil {
+		return "", err
+	}
+	return c.Value, nil
+}
+
+// New は新しいセッションを作ります。Save を呼ぶまでストアにも Cookie にも反映されません。
+func (m *Manager) New(r *http.Request) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		ID:        id,
+		Values:    map[string]string{},
+		CreatedAt: time.Now(),
+		RemoteIP:  remoteIP(r),
+		UserAgent: r.UserAgent(),
+	}, nil
+}
+
+// Save は最終アクセス時刻と期限を更新して保存し、Cookie の期限も延長します。
+func (m *Manager) Save(w http.ResponseWriter, s *Session) error {
+	now := time.Now()
+	s.LastSeen = now
+	s.ExpiresAt = now.Add(m.TTL)
+	if err := m.Store.Save(s); err != nil {
+		return err
+	}
+	return m.setCookie(w, s.ID, s.ExpiresAt)
+}
+
+// Regenerate はセッションの内容を引き継いだまま ID を振り直し、古い ID を無効にします。
+// ログインなど権限が変わる直前・直後に呼ぶことで、攻撃者が事前に仕込んだ ID（セッション固定）を使えなくします。
+func (m *Manager) Regenerate(w http.ResponseWriter, s *Session) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	next := s.clone()
+	next.ID = id
+	if err := m.Save(w, next); err != nil {
+		return nil, err
+	}
+	if err := m.Store.Delete(s.ID); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// Login は user でログインした状態にし、ID を再生成したセッションを返します。
+func (m *Manager) Login(w http.ResponseWriter, s *Session, user string) (*Session, error) {
+	s.User = user
+	return m.Regenerate(w, s)
+}
+
+// Logout はユーザーを外し、ID を再生成したセッションを返します（訪問回数などの値は残します）。
+func (m *Manager) Logout(w http.ResponseWriter, s *Session) (*Session, error) {
+	s.User = ""
+	return m.Regenerate(w, s)
+}
+
+// Destroy はセッションを削除し、Cookie も消します。
+func (m *Manager) Destroy(w http.ResponseWriter, s *Session) error {
+	if err := m.Store.Delete(s.ID); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, id string, expires time.Time) error {
+	c := &http.Cookie{
+		Name:     m.CookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   m.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if m.Codec != nil {
+		return m.Codec.SetCookie(w, c)
+	}
+	http.SetCookie(w, c)
+	return nil
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Summary は /_sessions の一覧に載せるセッションの要約です。
+// セッション ID はそれだけで本人になりすませる値なので、一覧には載せずに Digest を ID として出します。
+type Summary struct {
+	ID        string            `json:"id"` // Digest(セッション ID)
+	User      string            `json:"user,omitempty"`
+	Values    map[string]string `json:"values"`
+	CreatedAt time.Time         `json:"createdAt"`
+	LastSeen  time.Time         `json:"lastSeen"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	RemoteIP  string            `json:"remoteIP,omitempty"`
+	UserAgent string            `json:"userAgent,omitempty"`
+}
+
+// Digest はセッション ID の SHA-256 の先頭 8 バイトを 16 進数にしたものです。
+// ログや管理画面でセッションを見分けるのに使い、元の ID は復元できません。
+func Digest(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// AdminHandler は /_sessions の管理用ハンドラを返します。ループバックアドレスからのリクエストにだけ応じます。
+//
+//	GET    /_sessions              → 有効なセッションの一覧（JSON。id は Digest）
+//	DELETE /_sessions?id=...       → 指定した Digest のセッションを失効させる
+//	DELETE /_sessions?user=alice   → 指定ユーザーのセッションをすべて失効させる
+//	DELETE /_sessions              → すべて失効させる
+func (m *Manager) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(remoteIP(r)); ip == nil || !ip.IsLoopback() {
+			http.Error(w, "/_sessions is only available from a loopback address", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			list, err := m.Store.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			summaries := make([]Summary, len(list))
+			for i, s := range list {
+				summaries[i] = Summary{
+					ID:        Digest(s.ID),
+					User:      s.User,
+					Values:    s.Values,
+					CreatedAt: s.CreatedAt,
+					LastSeen:  s.LastSeen,
+					ExpiresAt: s.ExpiresAt,
+					RemoteIP:  s.RemoteIP,
+					UserAgent: s.UserAgent,
+				}
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(summaries)
+		case http.MethodDelete:
+			revoked, err := m.revoke(r.URL.Query().Get("id"), r.URL.Query().Get("user"))
+			if errors.Is(err, ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_ = json.NewEncoder(w).Encode(map[string]int{"revoked": revoked})
+		default:
+			http.Error(w, "GET or DELETE only", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// revoke は Digest（またはユーザー名）に一致するセッションを削除して件数を返します。
+// Digest を指定して一致するものがなければ ErrNotFound を返します。
+func (m *Manager) revoke(digest, user string) (int, error) {
+	list, err := m.Store.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range list {
+		if digest != "" && Digest(s.ID) != digest || user != "" && s.User != user {
+			continue
+		}
+		if err := m.Store.Delete(s.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if digest != "" && n == 0 {
+		return 0, ErrNotFound
+	}
+	return n, nil
+}
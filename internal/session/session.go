@@ -0,0 +1,65 @@
+// パッケージ session は、Cookie には推測できないセッション ID だけを置き、
+// 状態をサーバー側のストアに保持するセッション管理を提供します。
+//
+// ストアは SessionStore インターフェイスで差し替えられ、TTL で期限切れを掃除するメモリ実装（MemoryStore）と、
+// 再起動後も残る JSON ファイル実装（FileStore）を用意しています。
+// 権限が変わるとき（ログイン・ログアウト）は Manager.Regenerate で ID を振り直し、セッション固定攻撃を防ぎます。
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// ErrNotFound はストアにセッションがない（期限切れ・失効済みを含む）ことを表します。
+var ErrNotFound = errors.New("session: not found")
+
+// Session は 1 つのセッションの状態です。
+type Session struct {
+	ID        string            `json:"id"`
+	User      string            `json:"user,omitempty"` // ログイン中のユーザー（空なら匿名）
+	Values    map[string]string `json:"values"`
+	CreatedAt time.Time         `json:"createdAt"`
+	LastSeen  time.Time         `json:"lastSeen"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	RemoteIP  string            `json:"remoteIP,omitempty"`
+	UserAgent string            `json:"userAgent,omitempty"`
+}
+
+// Expired は now の時点で期限切れかどうかを返します。
+func (s *Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// clone はストアの内部状態を呼び出し側と共有しないためのコピーを返します。
+func (s *Session) clone() *Session {
+	c := *s
+	c.Values = make(map[string]string, len(s.Values))
+	for k, v := range s.Values {
+		c.Values[k] = v
+	}
+	return &c
+}
+
+// SessionStore はセッションの保存先です。実装は並行呼び出しに対して安全である必要があります。
+type SessionStore interface {
+	// Get は ID のセッションを返します。存在しないか期限切れなら ErrNotFound を返します。
+	Get(id string) (*Session, error)
+	// Save はセッションを保存（上書き）します。
+	Save(s *Session) error
+	// Delete はセッションを削除します。存在しなくてもエラーにしません。
+	Delete(id string) error
+	// List は期限切れでないセッションを返します。
+	List() ([]*Session, error)
+}
+
+// newID は 256 ビットの乱数から URL セーフなセッション ID を作ります。
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,156 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMemoryStoreEviction は期限切れのセッションが Get・List から見えなくなり、掃除で削除されることを確認します。
+func TestMemoryStoreEviction(t *testing.T) {
+	m := NewMemoryStore(10 * time.Millisecond)
+	defer m.Close()
+	now := time.Now()
+	m.Save(&Session{ID: "live", ExpiresAt: now.Add(time.Hour)})
+	m.Save(&Session{ID: "soon", ExpiresAt: now.Add(30 * time.Millisecond)})
+
+	if _, err := m.Get("soon"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := m.Get("soon"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired session: %v", err)
+	}
+	if list, _ := m.List(); len(list) != 1 || list[0].ID != "live" {
+		t.Errorf("List = %v", list)
+	}
+	m.mu.Lock()
+	_, kept := m.sessions["soon"]
+	m.mu.Unlock()
+	if kept {
+		t.Error("expired session was not evicted")
+	}
+}
+
+// TestFileStoreRestart は FileStore に保存したセッションを、開き直した FileStore から読めることを確認します。
+func TestFileStoreRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	f, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.Save(&Session{ID: "a", User: "alice", Values: map[string]string{"visits": "3"}, ExpiresAt: now.Add(time.Hour)})
+	f.Save(&Session{ID: "b", ExpiresAt: now.Add(time.Hour)})
+	f.Save(&Session{ID: "expired", ExpiresAt: now.Add(-time.Second)})
+	f.Delete("b")
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := reopened.Get("a")
+	if err != nil || s.User != "alice" || s.Values["visits"] != "3" {
+		t.Errorf("Get(a) = %+v, %v", s, err)
+	}
+	for _, id := range []string{"b", "expired"} {
+		if _, err := reopened.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s): %v", id, err)
+		}
+	}
+}
+
+func newManager() *Manager {
+	return &Manager{Store: NewMemoryStore(0), CookieName: "SID", TTL: time.Hour}
+}
+
+// TestLoginRegeneratesID はログインで ID が振り直され、ログイン前の ID（攻撃者が仕込んだかもしれないもの）が使えなくなることを確認します。
+func TestLoginRegeneratesID(t *testing.T) {
+	m := newManager()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s, err := m.New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Values["visits"] = "1"
+	m.Save(httptest.NewRecorder(), s)
+	fixed := s.ID
+
+	w := httptest.NewRecorder()
+	next, err := m.Login(w, s, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == fixed || next.User != "alice" || next.Values["visits"] != "1" {
+		t.Errorf("after login: %+v", next)
+	}
+	if _, err := m.Store.Get(fixed); !errors.Is(err, ErrNotFound) {
+		t.Errorf("the old ID is still valid: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != next.ID || !cookies[0].HttpOnly {
+		t.Errorf("Set-Cookie: %v", cookies)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "SID", Value: fixed})
+	if _, err := m.Load(r); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load with the old ID: %v", err)
+	}
+}
+
+// TestAdminHandler は /_sessions がループバック以外を拒否し、一覧にセッション ID を出さず Digest で失効できることを確認します。
+func TestAdminHandler(t *testing.T) {
+	m := newManager()
+	for _, user := range []string{"alice", "bob", "bob"} {
+		s, _ := m.New(httptest.NewRequest(http.MethodGet, "/", nil))
+		s.User = user
+		m.Save(httptest.NewRecorder(), s)
+	}
+	h := m.AdminHandler()
+	do := func(method, target, remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/_sessions", "192.0.2.1:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("remote GET: %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/_sessions", "192.0.2.1:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("remote DELETE: %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/_sessions", "[::1]:1234")
+	var list []Summary
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 3 {
+		t.Fatalf("GET: %d %s", w.Code, w.Body)
+	}
+	sessions, _ := m.Store.List()
+	for _, s := range sessions {
+		if strings.Contains(w.Body.String(), s.ID) {
+			t.Errorf("session ID %s is listed", s.ID)
+		}
+	}
+	var alice string
+	for _, s := range list {
+		if s.User == "alice" {
+			alice = s.ID
+		}
+	}
+	if w := do(http.MethodDelete, "/_sessions?id="+alice, "127.0.0.1:1234"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"revoked":1`) {
+		t.Errorf("DELETE id: %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodDelete, "/_sessions?id="+alice, "127.0.0.1:1234"); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE revoked id: %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/_sessions?user=bob", "127.0.0.1:1234"); !strings.Contains(w.Body.String(), `"revoked":2`) {
+		t.Errorf("DELETE user: %d %s", w.Code, w.Body)
+	}
+}
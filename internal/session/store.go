@@ -0,0 +1,194 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore はメモリ上のストアです。期限切れのセッションは定期的に削除されます。
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewMemoryStore は interval ごとに期限切れを掃除する MemoryStore を返します。
+// interval が 0 以下なら掃除はせず、Get/List で期限切れを見えなくするだけにします。
+func NewMemoryStore(interval time.Duration) *MemoryStore {
+	m := &MemoryStore{sessions: map[string]*Session{}, stop: make(chan struct{})}
+	if interval > 0 {
+		go m.evictLoop(interval)
+	}
+	return m
+}
+
+func (m *MemoryStore) evictLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for id, s := range m.sessions {
+				if s.Expired(now) {
+					delete(m.sessions, id)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// Close は掃除用のゴルーチンを止めます。
+func (m *MemoryStore) Close() error {
+	m.once.Do(func() { close(m.stop) })
+	return nil
+}
+
+func (m *MemoryStore) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return s.clone(), nil
+}
+
+func (m *MemoryStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = s.clone()
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemoryStore) List() ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return listLive(m.sessions), nil
+}
+
+// listLive は期限切れを除いたセッションを作成日時の順に返します。
+func listLive(sessions map[string]*Session) []*Session {
+	now := time.Now()
+	out := make([]*Session, 0, len(sessions))
+	for _, s := range sessions {
+		if !s.Expired(now) {
+			out = append(out, s.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// FileStore は JSON ファイルに保存するストアです。サーバーを再起動してもセッションが残ります。
+// 更新のたびにファイル全体を一時ファイルへ書き出してから置き換えるため、書き込み途中で落ちても壊れません。
+// 学習・開発用の規模（数千件程度まで）を想定しています。
+type FileStore struct {
+	mu       sync.Mutex
+	path     string
+	sessions map[string]*Session
+}
+
+// NewFileStore は path のファイルを読み込んだ FileStore を返します（ファイルがなければ空で始めます）。
+func NewFileStore(path string) (*FileStore, error) {
+	f := &FileStore{path: path, sessions: map[string]*Session{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Session
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, s := range list {
+		if !s.Expired(now) {
+			f.sessions[s.ID] = s
+		}
+	}
+	return f, nil
+}
+
+func (f *FileStore) Get(id string) (*Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.sessions[id]
+	if !ok || s.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return s.clone(), nil
+}
+
+func (f *FileStore) Save(s *Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions[s.ID] = s.clone()
+	return f.flush()
+}
+
+func (f *FileStore) Delete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.sessions[id]; !ok {
+		return nil
+	}
+	delete(f.sessions, id)
+	return f.flush()
+}
+
+func (f *FileStore) List() ([]*Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return listLive(f.sessions), nil
+}
+
+// flush は期限切れを落としてからファイルへ書き出します（f.mu を保持して呼ぶこと）。
+func (f *FileStore) flush() error {
+	now := time.Now()
+	for id, s := range f.sessions {
+		if s.Expired(now) {
+			delete(f.sessions, id)
+		}
+	}
+	data, err := json.MarshalIndent(listLive(f.sessions), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// セッション ID を含むため所有者のみ読み書きできるようにする
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,173 @@
+package wirecap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// DefaultMaxBytes は 1 つの接続で未処理のまま保持するバイト数の上限です。
+const DefaultMaxBytes = 1 << 20
+
+// Listener は受け付けた接続を Conn で包み、読み込んだバイト列を記録します。
+type Listener struct {
+	net.Listener
+	// MaxBytes は接続ごとに保持するバイト数の上限です（0 なら DefaultMaxBytes）。
+	// 超えた接続ではそれ以降の記録をやめます。
+	MaxBytes int
+}
+
+// Wrap は ln を包んだ Listener を返します。
+func Wrap(ln net.Listener, maxBytes int) *Listener {
+	return &Listener{Listener: ln, MaxBytes: maxBytes}
+}
+
+// Accept は次の接続を受け付けて Conn で包みます。
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	max := l.MaxBytes
+	if max <= 0 {
+		max = DefaultMaxBytes
+	}
+	return &Conn{Conn: c, max: max}, nil
+}
+
+// Conn は Read したバイト列をリクエスト単位に切り出すまで保持する接続です。
+type Conn struct {
+	net.Conn
+	max int
+
+	mu       sync.Mutex
+	pending  []byte
+	disabled bool // 上限を超えたか解析に失敗し、リクエストの境界を見失った（または Hijack された）
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		if !c.disabled {
+			if len(c.pending)+n > c.max {
+				c.disabled, c.pending = true, nil
+				log.Printf("wirecap: %s の記録を停止しました（%d バイトを超えました）", c.RemoteAddr(), c.max)
+			} else {
+				c.pending = append(c.pending, p[:n]...)
+			}
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// take は保持しているバイト列の先頭からリクエスト 1 件を切り出します。
+// 残りのバイト列（パイプライン化された次のリクエストなど）は次回のために残します。
+func (c *Conn) take() (*Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.disabled {
+		return nil, false
+	}
+	n, msg, err := Split(c.pending)
+	if err != nil {
+		if !errors.Is(err, errIncomplete) {
+			log.Printf("wirecap: %s: %v", c.RemoteAddr(), err)
+		}
+		// 境界がわからなくなったので、この接続ではこれ以上記録しない
+		c.disabled, c.pending = true, nil
+		return nil, false
+	}
+	c.pending = append(c.pending[:0], c.pending[n:]...)
+	return msg, true
+}
+
+// stop はこの接続の記録をやめ、保持しているバイト列を捨てます。
+func (c *Conn) stop() {
+	c.mu.Lock()
+	c.disabled, c.pending = true, nil
+	c.mu.Unlock()
+}
+
+type connKey struct{}
+
+type messageKey struct{}
+
+// ConnContext は http.Server.ConnContext に設定し、ハンドラから接続を参照できるようにします。
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if wc, ok := c.(*Conn); ok {
+		return context.WithValue(ctx, connKey{}, wc)
+	}
+	return ctx
+}
+
+// FromContext は Middleware が切り出したワイヤ上のリクエストを返します。
+func FromContext(ctx context.Context) (*Message, bool) {
+	m, ok := ctx.Value(messageKey{}).(*Message)
+	return m, ok
+}
+
+// Middleware はボディを最後まで読んでからリクエスト 1 件分のバイト列を切り出し、
+// FromContext で取り出せるようにして next を呼びます。
+// ボディは読み込んだ内容に差し替えるので、next からは通常どおり読めます。
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := r.Context().Value(connKey{}).(*Conn)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			body, err := io.ReadAll(io.LimitReader(r.Body, int64(c.max)+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(body) > c.max {
+				// 上限を超えるボディは記録できないので、読んだ分を戻して残りはそのまま流す
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			} else {
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+		}
+		if msg, ok := c.take(); ok {
+			r = r.WithContext(context.WithValue(r.Context(), messageKey{}, msg))
+		}
+		next.ServeHTTP(&hijackWriter{ResponseWriter: w, c: c}, r)
+	})
+}
+
+// hijackWriter は Hijack されたら接続の記録をやめる ResponseWriter です。
+// CONNECT のトンネルの中身は HTTP ではないので、上限まで溜め込んでから記録を諦めることのないようにします。
+// Unwrap を実装しているので http.NewResponseController 経由の Flush も透過します。
+type hijackWriter struct {
+	http.ResponseWriter
+	c *Conn
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.c.stop()
+	}
+	return conn, rw, err
+}
+
+// Flush は既存コードの w.(http.Flusher) 型アサーション向けに用意しています。
+func (w *hijackWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *hijackWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
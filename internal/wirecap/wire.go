@@ -0,0 +1,257 @@
+// パッケージ wirecap は、TCP から読んだバイト列を net/http が解析する前に写し取り、
+// リクエストをワイヤ上の形式のまま見られるようにします。
+//
+// httputil.DumpRequest は解析済みの http.Request から組み立て直すため、ヘッダの順序・大文字小文字・
+// 同名ヘッダの並び・行の折り返し（obs-fold）・チャンクの区切りが失われます。
+// wirecap は Listener で受け付けた接続の Read をすべて記録し、Middleware でリクエスト 1 件分の
+// バイト列を切り出して Message として context に載せます。
+//
+// TLS を終端する前のバイト列は暗号文なので、平文の HTTP で待ち受けるときだけ使えます。
+package wirecap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Message はワイヤ上のリクエスト 1 件分です。
+type Message struct {
+	// Raw は受信したバイト列そのものです（JSON では base64）。
+	Raw []byte `json:"raw"`
+	// StartLine はリクエスト行です（行末の CRLF を除く）。
+	StartLine string `json:"startLine"`
+	// HeaderLines は受信した順・受信した大文字小文字のままのヘッダ行です。
+	// 折り返された行（obs-fold）は空白で始まる別の行として残ります。
+	HeaderLines []string `json:"headerLines"`
+	// Framing はボディの区切り方です（"content-length" / "chunked" / "none"）。
+	Framing string `json:"framing"`
+	// Chunks はチャンク形式のときの各チャンクのサイズ行です（最後の 0 サイズのチャンクを含む）。
+	Chunks []Chunk `json:"chunks,omitempty"`
+	// Trailers はチャンク形式の最後に付いたトレーラ行です。
+	Trailers []string `json:"trailers,omitempty"`
+	// ObsFold は折り返されたヘッダ行があったことを表します。
+	ObsFold bool `json:"obsFold,omitempty"`
+	// BareLF は CRLF ではなく LF だけで終わる行があったことを表します。
+	BareLF bool `json:"bareLF,omitempty"`
+}
+
+// Chunk はチャンク 1 つのサイズ行と、そこから読み取ったサイズ・拡張です。
+type Chunk struct {
+	SizeLine  string `json:"sizeLine"`
+	Size      int64  `json:"size"`
+	Extension string `json:"extension,omitempty"`
+}
+
+// errIncomplete はバイト列がまだリクエスト 1 件分に足りないことを表します。
+var errIncomplete = errors.New("wirecap: incomplete message")
+
+// parser はバッファ上の位置を進めながら行とボディを読み取ります。
+type parser struct {
+	buf []byte
+	pos int
+	msg *Message
+}
+
+// line は次の行を行末（CRLF または LF）を除いて返します。
+func (p *parser) line() (string, error) {
+	i := bytes.IndexByte(p.buf[p.pos:], '\n')
+	if i < 0 {
+		return "", errIncomplete
+	}
+	l := p.buf[p.pos : p.pos+i]
+	p.pos += i + 1
+	if n := len(l); n > 0 && l[n-1] == '\r' {
+		l = l[:n-1]
+	} else {
+		p.msg.BareLF = true
+	}
+	return string(l), nil
+}
+
+// Split は buf の先頭からリクエスト 1 件を読み取り、その長さと解析結果を返します。
+// バイト列が足りなければ errIncomplete を返します。
+func Split(buf []byte) (int, *Message, error) {
+	p := &parser{buf: buf, msg: &Message{HeaderLines: []string{}, Framing: "none"}}
+
+	// リクエスト行の前の空行は読み飛ばす（RFC 9112 2.2）
+	var start string
+	for {
+		l, err := p.line()
+		if err != nil {
+			return 0, nil, err
+		}
+		if l != "" {
+			start = l
+			break
+		}
+	}
+	p.msg.StartLine = start
+
+	var contentLength int64 = -1
+	chunked := false
+	lines, err := p.headerBlock()
+	if err != nil {
+		return 0, nil, err
+	}
+	p.msg.HeaderLines = lines
+	for _, h := range unfold(lines) {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "transfer-encoding":
+			codings := strings.Split(value, ",")
+			chunked = strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+		case "content-length":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return 0, nil, errors.New("wirecap: invalid Content-Length")
+			}
+			contentLength = n
+		}
+	}
+	for _, h := range lines {
+		if strings.HasPrefix(h, " ") || strings.HasPrefix(h, "\t") {
+			p.msg.ObsFold = true
+		}
+	}
+
+	switch {
+	case chunked:
+		p.msg.Framing = "chunked"
+		if err := p.chunkedBody(); err != nil {
+			return 0, nil, err
+		}
+	case contentLength >= 0:
+		p.msg.Framing = "content-length"
+		if int64(len(buf)-p.pos) < contentLength {
+			return 0, nil, errIncomplete
+		}
+		p.pos += int(contentLength)
+	}
+	p.msg.Raw = append([]byte(nil), buf[:p.pos]...)
+	return p.pos, p.msg, nil
+}
+
+// headerBlock は空行までのヘッダ行を返します。
+func (p *parser) headerBlock() ([]string, error) {
+	lines := []string{}
+	for {
+		l, err := p.line()
+		if err != nil {
+			return nil, err
+		}
+		if l == "" {
+			return lines, nil
+		}
+		lines = append(lines, l)
+	}
+}
+
+// chunkedBody はチャンク形式のボディとトレーラを読み進めます。
+func (p *parser) chunkedBody() error {
+	for {
+		l, err := p.line()
+		if err != nil {
+			return err
+		}
+		sizeText, ext, _ := strings.Cut(l, ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 64)
+		if err != nil || size < 0 {
+			return errors.New("wirecap: invalid chunk size line")
+		}
+		p.msg.Chunks = append(p.msg.Chunks, Chunk{SizeLine: l, Size: size, Extension: ext})
+		if size == 0 {
+			trailers, err := p.headerBlock()
+			if err != nil {
+				return err
+			}
+			if len(trailers) > 0 {
+				p.msg.Trailers = trailers
+			}
+			return nil
+		}
+		if int64(len(p.buf)-p.pos) < size {
+			return errIncomplete
+		}
+		p.pos += int(size)
+		// チャンクデータの後の CRLF
+		if _, err := p.line(); err != nil {
+			return err
+		}
+	}
+}
+
+// UnfoldedHeaderLines は HeaderLines の折り返し（obs-fold）を 1 行につないだものです。
+// 順序と大文字小文字は受信したままです。
+func (m *Message) UnfoldedHeaderLines() []string {
+	return unfold(m.HeaderLines)
+}
+
+// unfold は折り返された行を直前の行につなげます（ヘッダの意味を解釈するためだけに使います）。
+func unfold(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(out) > 0 {
+			out[len(out)-1] += " " + strings.TrimSpace(l)
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// Annotated は Raw を人が読める形にします。行末の CR/LF を \r \n として表示し、
+// チャンクのサイズ行には 10 進数のサイズを添えます。表示できないバイトは \xNN にします。
+func (m *Message) Annotated() string {
+	var b strings.Builder
+	chunkSizes := map[string]int64{}
+	for _, c := range m.Chunks {
+		chunkSizes[c.SizeLine] = c.Size
+	}
+	rest := m.Raw
+	started, inBody := false, false
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		var l []byte
+		if i < 0 {
+			l, rest = rest, nil
+		} else {
+			l, rest = rest[:i+1], rest[i+1:]
+		}
+		text := strings.TrimRight(string(l), "\r\n")
+		for j := 0; j < len(l); {
+			r, size := utf8.DecodeRune(l[j:])
+			switch {
+			case r == '\r':
+				b.WriteString(`\r`)
+			case r == '\n':
+				b.WriteString(`\n`)
+			case r == '\t':
+				b.WriteString(`\t`)
+			case r == utf8.RuneError && size == 1, r < 0x20, r == 0x7f:
+				fmt.Fprintf(&b, `\x%02x`, l[j])
+			default:
+				b.WriteRune(r)
+			}
+			j += size
+		}
+		if inBody && m.Framing == "chunked" {
+			if size, ok := chunkSizes[text]; ok {
+				b.WriteString("    ← チャンクサイズ " + strconv.FormatInt(size, 10) + " バイト")
+			}
+		}
+		if text == "" && started {
+			inBody = true
+		}
+		started = started || text != ""
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,152 @@
+package wirecap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestSplit はリクエスト 1 件分の長さと、ヘッダ行・ボディの区切り方・チャンク・折り返しの解析結果を確認します。
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		rest string   // 次のリクエストとして残るバイト列
+		want *Message // nil ならエラー
+		// incomplete はバイト列が足りない（errIncomplete）ことを期待します。
+		incomplete bool
+	}{
+		{
+			name: "no body",
+			in:   "GET / HTTP/1.1\r\nHost: a\r\nx-lower: 1\r\n\r\n",
+			want: &Message{StartLine: "GET / HTTP/1.1", HeaderLines: []string{"Host: a", "x-lower: 1"}, Framing: "none"},
+		},
+		{
+			name: "leading empty lines",
+			in:   "\r\n\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n",
+			want: &Message{StartLine: "GET / HTTP/1.1", HeaderLines: []string{"Host: a"}, Framing: "none"},
+		},
+		{
+			name: "content-length and a pipelined request",
+			in:   "POST / HTTP/1.1\r\ncontent-length: 3\r\n\r\nabcGET /next HTTP/1.1\r\n\r\n",
+			rest: "GET /next HTTP/1.1\r\n\r\n",
+			want: &Message{StartLine: "POST / HTTP/1.1", HeaderLines: []string{"content-length: 3"}, Framing: "content-length"},
+		},
+		{
+			name: "chunked with extension and trailer",
+			in:   "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3;ext=1\r\nabc\r\na\r\n0123456789\r\n0\r\nX-Trailer: 1\r\n\r\n",
+			want: &Message{
+				StartLine:   "POST / HTTP/1.1",
+				HeaderLines: []string{"Transfer-Encoding: chunked"},
+				Framing:     "chunked",
+				Chunks:      []Chunk{{SizeLine: "3;ext=1", Size: 3, Extension: "ext=1"}, {SizeLine: "a", Size: 10}, {SizeLine: "0", Size: 0}},
+				Trailers:    []string{"X-Trailer: 1"},
+			},
+		},
+		{
+			name: "chunked is the last coding",
+			in:   "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n",
+			want: &Message{
+				StartLine:   "POST / HTTP/1.1",
+				HeaderLines: []string{"Transfer-Encoding: gzip, chunked"},
+				Framing:     "chunked",
+				Chunks:      []Chunk{{SizeLine: "0"}},
+			},
+		},
+		{
+			name: "obs-fold",
+			in:   "POST / HTTP/1.1\r\nX-A: 1\r\n  folded\r\nContent-Length:\r\n\t2\r\n\r\nab",
+			want: &Message{
+				StartLine:   "POST / HTTP/1.1",
+				HeaderLines: []string{"X-A: 1", "  folded", "Content-Length:", "\t2"},
+				Framing:     "content-length",
+				ObsFold:     true,
+			},
+		},
+		{
+			name: "bare LF",
+			in:   "GET / HTTP/1.1\nHost: a\r\n\n",
+			want: &Message{StartLine: "GET / HTTP/1.1", HeaderLines: []string{"Host: a"}, Framing: "none", BareLF: true},
+		},
+		{name: "incomplete header", in: "GET / HTTP/1.1\r\nHost: a\r\n", incomplete: true},
+		{name: "incomplete body", in: "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nabc", incomplete: true},
+		{name: "incomplete chunk", in: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nabc", incomplete: true},
+		{name: "missing last chunk", in: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n", incomplete: true},
+		{name: "invalid Content-Length", in: "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n"},
+		{name: "invalid chunk size", in: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n"},
+	}
+	for _, tt := range tests {
+		n, msg, err := Split([]byte(tt.in))
+		if tt.want == nil {
+			if err == nil || errors.Is(err, errIncomplete) != tt.incomplete {
+				t.Errorf("%s: err = %v, incomplete %v", tt.name, err, tt.incomplete)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if want := len(tt.in) - len(tt.rest); n != want {
+			t.Errorf("%s: n = %d, want %d", tt.name, n, want)
+		}
+		tt.want.Raw = []byte(tt.in[:n])
+		if !reflect.DeepEqual(msg, tt.want) {
+			t.Errorf("%s:\n got  %+v\n want %+v", tt.name, msg, tt.want)
+		}
+	}
+}
+
+// TestUnfoldedHeaderLines は折り返された行を直前の行に 1 つの空白でつなぐことを確認します。
+func TestUnfoldedHeaderLines(t *testing.T) {
+	m := &Message{HeaderLines: []string{"X-A: 1", "  folded", "\tagain", "x-b: 2"}}
+	if got, want := m.UnfoldedHeaderLines(), []string{"X-A: 1 folded again", "x-b: 2"}; !slices.Equal(got, want) {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
+
+// TestHijack は Hijack された接続（CONNECT のトンネルなど）ではそれ以降のバイト列を記録しないことを確認します。
+func TestHijack(t *testing.T) {
+	done := make(chan *Conn, 1)
+	srv := httptest.NewUnstartedServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Context().Value(connKey{}).(*Conn)
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n")
+		rw.Flush()
+		io.CopyN(io.Discard, rw, 64<<10)
+		done <- c
+	})))
+	srv.Listener = Wrap(srv.Listener, DefaultMaxBytes)
+	srv.Config.ConnContext = ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || !strings.HasPrefix(line, "HTTP/1.1 200") {
+		t.Fatalf("%q %v", line, err)
+	}
+	conn.Write(make([]byte, 64<<10))
+	c := <-done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.disabled || len(c.pending) != 0 {
+		t.Errorf("still recording after Hijack: %d bytes pending", len(c.pending))
+	}
+}
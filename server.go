@@ -4,13 +4,36 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+
+	"real-world-http-learn/internal/capture"
+	"real-world-http-learn/internal/contentcoding"
+	"real-world-http-learn/internal/cookiecodec"
+	"real-world-http-learn/internal/cookielab"
+	"real-world-http-learn/internal/har"
+	"real-world-http-learn/internal/httpauth"
+	"real-world-http-learn/internal/inspect"
+	"real-world-http-learn/internal/listener"
+	"real-world-http-learn/internal/mitm"
+	"real-world-http-learn/internal/proxy"
+	"real-world-http-learn/internal/rules"
+	"real-world-http-learn/internal/session"
+	"real-world-http-learn/internal/wirecap"
 )
 
 // handler はHTTPリクエストを処理する関数です。
@@ -28,12 +51,37 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println("==========リクエスト情報==========")
 	fmt.Println(string(dump))
+	printWire(r)
 	fmt.Fprintf(w, "<html><body>hello</body></html>\n")
 }
 
+// printWire は -wire 指定時に、net/http が解析する前のワイヤ上のリクエストを表示します。
+// DumpRequest と違い、ヘッダの順序・大文字小文字・折り返し・チャンクの区切りが受信したとおりに見えます。
+func printWire(r *http.Request) {
+	m, ok := wirecap.FromContext(r.Context())
+	if !ok {
+		return
+	}
+	fmt.Println("==========ワイヤ上のリクエスト==========")
+	fmt.Print(m.Annotated())
+}
+
+// visitCodec は VISIT Cookie の値を署名（-cookie-encrypt 指定時は暗号化も）するコーデックです。
+// main で COOKIE_KEYS 環境変数（"id:secret,..."、先頭が発行用）から初期化します。
+var visitCodec *cookiecodec.Codec
+
+// visitSessions は訪問回数などの状態をサーバー側に保持するセッション管理です。
+// VISIT Cookie には署名付きの推測できないセッション ID だけが入ります。
+var visitSessions *session.Manager
+
+// visitCookieTTL は VISIT Cookie とセッションの有効期間です（アクセスのたびに延長します）。
+const visitCookieTTL = 24 * time.Hour
+
 // cookieHandler は/cookieパスへのリクエストを処理する関数です。
 // POSTとGETの両方のリクエストでCookieを設定・更新します。
 // Cookieの有無に基づいて異なるコンテンツを返します。
+// 訪問回数はサーバー側のセッションに保存し、VISIT Cookie にはセッション ID だけを入れます。
+// 改ざん・期限切れ・形式不正の Cookie や失効済みのセッションは信用せず、新しいセッションで数え直します。
 //
 // パラメータ:
 //   - w: HTTPレスポンスを書き込むためのResponseWriter
@@ -47,78 +95,398 @@ func cookieHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println("==========リクエスト情報==========")
 	fmt.Println(string(dump))
+	printWire(r)
 
 	// POSTとGETの両方のリクエストを処理
-	if r.Method == "POST" || r.Method == "GET" {
-		// Cookieを確認
-		cookie, err := r.Cookie("VISIT")
-
-		if err == http.ErrNoCookie {
-			// Cookieがない場合（初回訪問）- 新しいCookieを設定
-			expiration := time.Now().Add(24 * time.Hour)
-			newCookie := http.Cookie{
-				Name:     "VISIT",
-				Value:    "1",
-				Expires:  expiration,
-				HttpOnly: true,
-				Path:     "/",
-			}
-			http.SetCookie(w, &newCookie)
-
-			// JSONレスポンスを返す
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]string{
-				"status":  "success",
-				"message": "初めての訪問です - Cookieを設定しました",
-				"visits":  "1",
-			})
-		} else if err != nil {
-			// その他のエラー
-			http.Error(w, "Cookieの読み込みに失敗しました", http.StatusInternalServerError)
-		} else {
-			// Cookieがある場合（訪問回数を増やす）
-			visitCount, err := strconv.Atoi(cookie.Value)
-			if err != nil {
-				// 数値変換エラー
-				http.Error(w, "Cookie値の変換に失敗しました", http.StatusInternalServerError)
-				return
-			}
-			visitCount++
-
-			// 新しいCookieを設定
-			expiration := time.Now().Add(24 * time.Hour)
-			newCookie := http.Cookie{
-				Name:     "VISIT",
-				Value:    strconv.Itoa(visitCount),
-				Expires:  expiration,
-				HttpOnly: true,
-				Path:     "/",
-			}
-			http.SetCookie(w, &newCookie)
-
-			// JSONレスポンスを返す
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]string{
-				"status":  "success",
-				"message": "訪問回数を更新しました",
-				"visits":  strconv.Itoa(visitCount),
-			})
-		}
-	} else {
+	if r.Method != "POST" && r.Method != "GET" {
 		// その他のHTTPメソッド
 		http.Error(w, "サポートされていないHTTPメソッドです", http.StatusMethodNotAllowed)
 		return
 	}
+
+	sess, message, ok := loadVisitSession(w, r)
+	if !ok {
+		return
+	}
+
+	// 訪問回数を増やしてセッションに保存（Cookie の期限も延長される）
+	visitCount, err := strconv.Atoi(sess.Values["visits"])
+	if err != nil {
+		visitCount = 0
+	}
+	visitCount++
+	sess.Values["visits"] = strconv.Itoa(visitCount)
+	if err := visitSessions.Save(w, sess); err != nil {
+		http.Error(w, "セッションの保存に失敗しました", http.StatusInternalServerError)
+		return
+	}
+
+	// JSONレスポンスを返す
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": message,
+		"visits":  strconv.Itoa(visitCount),
+		"user":    sess.User,
+	})
+}
+
+// loadVisitSession は VISIT Cookie のセッションを読み出し、なければ新しく作ります。
+// 新しく作った理由（初回・改ざん・期限切れ・失効）をメッセージとして返します。
+// エラー応答を書いた場合は ok=false を返します。
+func loadVisitSession(w http.ResponseWriter, r *http.Request) (sess *session.Session, message string, ok bool) {
+	message = "訪問回数を更新しました"
+	sess, err := visitSessions.Load(r)
+	switch {
+	case err == nil:
+		return sess, message, true
+	case errors.Is(err, http.ErrNoCookie):
+		// Cookieがない場合（初回訪問）
+		message = "初めての訪問です - Cookieを設定しました"
+	case errors.Is(err, cookiecodec.ErrTampered), errors.Is(err, cookiecodec.ErrMalformed):
+		// クライアントが書き換えた値は信用しない
+		log.Println(err)
+		message = "Cookieの署名が不正なため訪問回数をリセットしました"
+	case errors.Is(err, cookiecodec.ErrExpired):
+		message = "Cookieの有効期限が切れていたため訪問回数をリセットしました"
+	case errors.Is(err, session.ErrNotFound):
+		message = "セッションが失効していたため訪問回数をリセットしました"
+	default:
+		// その他のエラー
+		http.Error(w, "Cookieの読み込みに失敗しました", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	sess, err = visitSessions.New(r)
+	if err != nil {
+		http.Error(w, "セッションの作成に失敗しました", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	return sess, message, true
+}
+
+// loginHandler は /session/login（POST user=名前）でセッションをログイン状態にします。
+// 権限が変わるため、セッション ID を再生成して古い ID を無効にします（セッション固定攻撃の対策）。
+// 学習用のためパスワードは確認しません。
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	user := r.PostFormValue("user")
+	if user == "" {
+		http.Error(w, "user is required", http.StatusBadRequest)
+		return
+	}
+	sess, _, ok := loadVisitSession(w, r)
+	if !ok {
+		return
+	}
+	oldID := sess.ID
+	sess, err := visitSessions.Login(w, sess, user)
+	if err != nil {
+		http.Error(w, "セッションの再生成に失敗しました", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("session: login user=%s (ID を再生成: %s → %s)", user, session.Digest(oldID), session.Digest(sess.ID))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "ログインしました - セッションIDを再生成しました",
+		"user":    sess.User,
+	})
+}
+
+// logoutHandler は /session/logout（POST）でログイン状態を解除し、セッション ID を再生成します。
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, err := visitSessions.Load(r)
+	if err != nil {
+		http.Error(w, "ログインしていません", http.StatusUnauthorized)
+		return
+	}
+	if _, err := visitSessions.Logout(w, sess); err != nil {
+		http.Error(w, "セッションの再生成に失敗しました", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "ログアウトしました - セッションIDを再生成しました",
+	})
+}
+
+// newSessionStore は -session-file の指定に応じてセッションの保存先を選びます。
+func newSessionStore(path string) (session.SessionStore, error) {
+	if path == "" {
+		return session.NewMemoryStore(time.Minute), nil
+	}
+	return session.NewFileStore(path)
+}
+
+// authHandler は/auth/以下へのリクエストを処理する関数です。
+// httpauth の Middleware が認証したユーザーと方式を返します。
+func authHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := httpauth.FromContext(r.Context())
+	body, _ := io.ReadAll(r.Body)
+	fmt.Printf("==========認証済みのリクエスト==========\n%s %s（%s 認証: %s、ボディ %d bytes）\n", r.Method, r.URL.Path, id.Scheme, id.User, len(body))
+	fmt.Fprintf(w, "<html><body>hello %s（%s 認証）</body></html>\n", html.EscapeString(id.User), id.Scheme)
+}
+
+// parseUsers は -proxy-user・-auth-user（name）の "user:password,user2:password2" を解釈します。
+func parseUsers(name, spec string) (map[string]string, error) {
+	users := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		user, password, ok := strings.Cut(item, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("-%s: %q は user:password の形式で指定してください", name, item)
+		}
+		users[user] = password
+	}
+	return users, nil
+}
+
+// newVisitCodec は COOKIE_KEYS 環境変数から VISIT Cookie 用のコーデックを作ります。
+// 未設定の場合は起動ごとに乱数の鍵を作るため、再起動すると以前の Cookie は無効になります。
+func newVisitCodec(encrypt bool) (*cookiecodec.Codec, error) {
+	keys, err := cookiecodec.ParseKeys(os.Getenv("COOKIE_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		key, err := cookiecodec.RandomKey("dev")
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		log.Println("COOKIE_KEYS が未設定のため、一時的な鍵で VISIT Cookie を署名します")
+	}
+	codec, err := cookiecodec.New(keys...)
+	if err != nil {
+		return nil, err
+	}
+	codec.MaxAge = visitCookieTTL
+	codec.Encrypt = encrypt
+	return codec, nil
 }
 
 // main はプログラムのエントリーポイントです。
-// ポート18888でHTTPサーバーを起動し、
+// ポート18888（-listen で変更可能）でHTTPサーバーを起動し、
 // 各パスに対応するハンドラ関数を登録します。
+// 待ち受けたアドレスは標準出力に JSON 1 行で出力し、SIGINT/SIGTERM を受けると
+// 処理中のリクエストを待ってから終了します。
+//
+// -capture を指定すると、受信したリクエストを構造化レコードとして
+// JSONL ファイルへ追記し、/_captures で参照できるようにします。
+// -har を指定すると、記録したセッションを /_har から HAR 1.2 として取得できます。
+// -rules を指定すると、ルールファイル（YAML/JSON）に一致したリクエストへルールどおりに応答します。
+// ルールは /_rules からも操作でき、ファイルを保存し直すと自動で読み直します。
+//
+//	go run server.go -capture captures.jsonl -har
+//	curl 'http://localhost:18888/_captures?method=POST&limit=1'
+//	curl -o session.har 'http://localhost:18888/_har'
+//	go run server.go -rules rules.example.yaml
+//	go run server.go -listen 127.0.0.1:0 -addr-file addr.json
+//	go run server.go -wire
+//	go run server.go -inspect    # ブラウザで http://localhost:18888/_inspect を開く
 func main() {
-	var httpServer http.Server
+	capturePath := flag.String("capture", "", "受信リクエストを追記する JSONL ファイル（空なら記録しない）")
+	harEnabled := flag.Bool("har", false, "/_har で現在のセッションを HAR 1.2 として公開する")
+	inspectEnabled := flag.Bool("inspect", false, "/_inspect で受信したリクエストをライブ表示するダッシュボードを有効にする")
+	rulesPath := flag.String("rules", "", "応答ルールを記述した YAML/JSON ファイル")
+	rulesAdmin := flag.Bool("rules-admin", false, "応答ルールを実行中に追加・置き換え・削除する /_rules を有効にする（ループバックからのみ）")
+	cookieEncrypt := flag.Bool("cookie-encrypt", false, "VISIT Cookie を署名に加えて AES-GCM で暗号化する")
+	sessionFile := flag.String("session-file", "", "セッションを保存する JSON ファイル（空ならメモリ上に保持）")
+	sessionAdmin := flag.Bool("session-admin", false, "セッションの一覧と失効を行う /_sessions を有効にする（ループバックからのみ）")
+	listen := flag.String("listen", ":18888", "待ち受け先（host:port、unix:/path、fd:N、systemd。ポート 0 で空きポート）")
+	addrFile := flag.String("addr-file", "", "待ち受けたアドレスを JSON で書き出すファイル")
+	readTimeout := flag.Duration("read-timeout", time.Minute, "リクエスト全体（ボディを含む）の読み込みタイムアウト")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "リクエストヘッダの読み込みタイムアウト")
+	writeTimeout := flag.Duration("write-timeout", 0, "レスポンス書き込みのタイムアウト（0 なら無制限。遅延ルールやストリーミングのため既定は無効）")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "Keep-Alive 接続で次のリクエストを待つ時間")
+	maxHeaderBytes := flag.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "リクエストヘッダの最大バイト数")
+	compress := flag.Bool("compress", false, "Accept-Encoding に応じてテキスト系の応答を zstd・br・gzip・deflate で圧縮する")
+	compressMin := flag.Int("compress-min", contentcoding.DefaultMinSize, "-compress で圧縮する応答の最小バイト数（0 ならすべて圧縮する）")
+	wire := flag.Bool("wire", false, "解析前のワイヤ上のリクエストを記録して表示する（平文 HTTP のみ）")
+	proxyEnabled := flag.Bool("proxy", false, "絶対形式のリクエストと CONNECT をフォワードプロキシとして転送する")
+	mitmEnabled := flag.Bool("mitm", false, "CONNECT のトンネルを終端し、自前 CA の証明書で HTTPS を復号して転送する（-proxy を含む）")
+	mitmCert := flag.String("mitm-ca", mitm.DefaultCACert, "-mitm で証明書の発行に使う CA 証明書")
+	mitmKey := flag.String("mitm-key", mitm.DefaultCAKey, "-mitm で証明書の発行に使う CA の秘密鍵")
+	mitmDump := flag.Bool("mitm-dump", false, "-mitm で復号したリクエストとレスポンスのヘッダをログに出す（Cookie や Authorization も含む）")
+	proxyUsers := flag.String("proxy-user", "", "プロキシの Basic 認証のユーザー（user:password をカンマ区切り。空なら認証なし）")
+	proxyOpen := flag.Bool("proxy-open", false, "-proxy-user なしでもループバック以外で待ち受ける（誰でも使えるオープンプロキシになる）")
+	authUsers := flag.String("auth-user", "", "/auth/ 以下で認証するユーザー（user:password をカンマ区切り。空なら /auth/ を公開しない）")
+	authSchemes := flag.String("auth-scheme", "Digest,Basic,Bearer", "/auth/ の 401 で提示する認証方式（カンマ区切り。並べた順に WWW-Authenticate に書く）")
+	authTokenTTL := flag.Duration("auth-token-ttl", httpauth.DefaultTokenTTL, "/auth/token が発行する Bearer トークンの有効期間")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "SIGINT/SIGTERM 受信後に処理中のリクエストを待つ時間")
+	flag.Parse()
+
+	// SIGINT/SIGTERM でグレースフルシャットダウンを始める。2 回目のシグナルでは即座に終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	codec, err := newVisitCodec(*cookieEncrypt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	visitCodec = codec
+	store, err := newSessionStore(*sessionFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	visitSessions = &session.Manager{
+		Store:      store,
+		CookieName: "VISIT",
+		TTL:        visitCookieTTL,
+		Codec:      visitCodec,
+	}
+
+	httpServer := http.Server{
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
 	http.HandleFunc("/", handler)
 	http.HandleFunc("/cookie", cookieHandler)
-	log.Println("start http listening :18888")
-	httpServer.Addr = ":18888"
-	log.Println(httpServer.ListenAndServe())
+	lab := cookielab.New()
+	http.Handle("/cookie/set", lab.SetHandler())
+	http.Handle("/cookie/inspect", lab.InspectHandler())
+	http.Handle("/cookie/inspect/", lab.InspectHandler())
+	http.HandleFunc("/session/login", loginHandler)
+	http.HandleFunc("/session/logout", logoutHandler)
+	if *sessionAdmin {
+		http.Handle("/_sessions", visitSessions.AdminHandler())
+	}
+	if *authUsers != "" {
+		users, err := parseUsers("auth-user", *authUsers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authenticator := httpauth.New("real-world-http", users)
+		authenticator.Schemes = strings.FieldsFunc(*authSchemes, func(r rune) bool { return r == ',' || r == ' ' })
+		authenticator.TokenTTL = *authTokenTTL
+		http.Handle("/auth/", authenticator.Middleware(http.HandlerFunc(authHandler)))
+		http.Handle("/auth/token", authenticator.Middleware(authenticator.TokenHandler()))
+		log.Printf("auth: /auth/ を %s で保護します（ユーザー %d 人。POST /auth/token で Bearer トークンを発行）", *authSchemes, len(users))
+	}
+	httpServer.Handler = http.DefaultServeMux
+
+	// 応答ルール: ファイル指定がなくても -rules-admin の /_rules から追加できるよう、ミドルウェアは常に挟んでおく
+	ruleEngine := rules.NewEngine()
+	if *rulesPath != "" {
+		if err := ruleEngine.Load(*rulesPath); err != nil {
+			log.Fatal(err)
+		}
+		go ruleEngine.Watch(ctx, time.Second)
+		log.Printf("rules: %s から %d 件のルールを読み込みました", *rulesPath, len(ruleEngine.Rules()))
+	}
+	if *rulesAdmin {
+		// 任意の応答を差し込めるため、/_sessions と同じくループバックからのみ受け付ける
+		http.Handle("/_rules", listener.LoopbackOnly(ruleEngine.AdminHandler()))
+		http.Handle("/_rules/", listener.LoopbackOnly(ruleEngine.AdminHandler()))
+	}
+	httpServer.Handler = ruleEngine.Middleware(httpServer.Handler)
+
+	var recorder *capture.Recorder
+	if *capturePath != "" || *harEnabled || *inspectEnabled {
+		// -har / -inspect のみの場合はファイルに書かず、メモリ上にだけ記録する
+		recorder, err = capture.NewRecorder(*capturePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		// 記録には Cookie や Authorization がそのまま入るため、/_sessions と同じくループバックからのみ見せる
+		http.Handle("/_captures", listener.LoopbackOnly(recorder.Handler()))
+		if *harEnabled {
+			http.Handle("/_har", listener.LoopbackOnly(har.Handler(recorder)))
+			log.Println("HAR export: GET /_har で現在のセッションを取得できます")
+		}
+		if *inspectEnabled {
+			dashboard := inspect.New(recorder)
+			http.Handle("/_inspect", listener.LoopbackOnly(dashboard))
+			http.Handle("/_inspect/", listener.LoopbackOnly(dashboard))
+			// SSE の接続が残っていると Shutdown が終わらないため、停止時に閉じる
+			httpServer.RegisterOnShutdown(dashboard.Close)
+			log.Println("inspect: /_inspect でリクエストをライブ表示します")
+		}
+		httpServer.Handler = recorder.Middleware(httpServer.Handler)
+		if *capturePath != "" {
+			log.Printf("capture mode: %s に記録します（GET /_captures で参照）", *capturePath)
+		}
+	}
+
+	if *compress {
+		// キャプチャより外側に置き、記録には圧縮前のボディを残す
+		compressor := &contentcoding.Compressor{MinSize: max(*compressMin, 1)}
+		httpServer.Handler = compressor.Middleware(httpServer.Handler)
+		log.Printf("compress: %d バイト以上のテキスト系の応答を Accept-Encoding に応じて圧縮します", compressor.MinSize)
+	}
+
+	if *proxyEnabled || *mitmEnabled {
+		// プロキシ宛てのリクエストはルールやキャプチャを通さずに転送する
+		fwd := proxy.New()
+		users, err := parseUsers("proxy-user", *proxyUsers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fwd.Users = users
+		if *mitmEnabled {
+			ca, err := mitm.LoadCA(*mitmCert, *mitmKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			interceptor, err := mitm.New(ca)
+			if err != nil {
+				log.Fatal(err)
+			}
+			interceptor.Dump = *mitmDump
+			if recorder != nil {
+				// 復号したリクエストも /_captures・/_har・/_inspect に記録する
+				interceptor.Middleware = recorder.Middleware
+			}
+			fwd.Interceptor = interceptor
+			log.Printf("mitm: CONNECT を終端し %s（%s）で証明書を発行します", *mitmCert, ca.Cert.Subject.CommonName)
+		}
+		httpServer.Handler = fwd.Dispatch(httpServer.Handler)
+		log.Printf("proxy: フォワードプロキシとして動作します（認証ユーザー %d 人）", len(users))
+	}
+
+	if *wire {
+		// ボディを読み切ってから切り出すため、キャプチャより外側に置く
+		httpServer.Handler = wirecap.Middleware(httpServer.Handler)
+		httpServer.ConnContext = wirecap.ConnContext
+	}
+
+	ln, err := listener.Listen(*listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if (*proxyEnabled || *mitmEnabled) && *proxyUsers == "" && !*proxyOpen && !listener.IsLoopback(ln.Addr()) {
+		// 認証のないプロキシを外から使えるようにすると、踏み台や内部ネットワークへの入口になる
+		ln.Close()
+		log.Fatalf("proxy: %s はループバック以外からも接続できます。-proxy-user で認証を求めるか、-listen 127.0.0.1:18888 で待ち受けてください（承知のうえなら -proxy-open）", ln.Addr())
+	}
+	if *wire {
+		ln = wirecap.Wrap(ln, wirecap.DefaultMaxBytes)
+	}
+	bound := listener.Describe(ln)
+	log.Printf("start http listening %s %s", bound.Network, bound.Addr)
+	if err := listener.Announce(os.Stdout, *addrFile, bound); err != nil {
+		log.Fatal(err)
+	}
+	if err := listener.Serve(ctx, &httpServer, ln, *shutdownTimeout); err != nil {
+		log.Println(err)
+	}
+	log.Println("shutdown: 完了しました")
 }